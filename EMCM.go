@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,10 +33,10 @@ const (
 
 var (
 	serverList     []ServerInfo
-	translationMap = make(map[string]string)
 	config         Config
 	runningServers = make(map[string]*exec.Cmd)
 	serverMutex    sync.Mutex
+	configMutex    sync.Mutex
 )
 
 type ServerInfo struct {
@@ -80,6 +81,26 @@ type ServerInstance struct {
 	JVMArgs     string `json:"jvm_args"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+
+	EULAAcceptedAt     string        `json:"eula_accepted_at,omitempty"`
+	DictLocale         string        `json:"dict_locale,omitempty"`
+	DisableTranslation bool          `json:"disable_translation,omitempty"`
+	LastCrash          *CrashSummary `json:"last_crash,omitempty"`
+	Backup             *BackupConfig `json:"backup,omitempty"`
+	// Ports 记录 server-port、query.port 和 rcon.port 的分配，用于检测实例之间的冲突
+	Ports map[string]int `json:"ports,omitempty"`
+	// Plugins 记录从索引或 URL 安装的插件，键为插件名
+	Plugins map[string]*PluginSource `json:"plugins,omitempty"`
+	// ClientMods 是启动前对客户端模组的处理方式，为空时只警告
+	ClientMods string `json:"client_mods,omitempty"`
+	// ResourcePack 是由 EMCM 托管的资源包
+	ResourcePack *ResourcePackConfig `json:"resource_pack,omitempty"`
+}
+
+type CrashSummary struct {
+	Time   string `json:"time"`
+	Title  string `json:"title"`
+	Report string `json:"report,omitempty"`
 }
 
 type Config struct {
@@ -89,6 +110,14 @@ type Config struct {
 	ServerInstalls map[string]*ServerInstance `json:"server_installs"`
 	APICalls       int                        `json:"api_calls"`
 	LastAPICall    time.Time                  `json:"last_api_call"`
+	DictLocale     string                     `json:"dict_locale,omitempty"`
+	DisabledDicts  []string                   `json:"disabled_dicts,omitempty"`
+	LogMaxSizeMB   int                        `json:"log_max_size_mb,omitempty"`
+	LogRotateHours int                        `json:"log_rotate_hours,omitempty"`
+	LogKeepFiles   int                        `json:"log_keep_files,omitempty"`
+	BackupTargets  map[string]*BackupTarget   `json:"backup_targets,omitempty"`
+	PlayerGroups   map[string]*PlayerGroup    `json:"player_groups,omitempty"`
+	PluginIndexes  []*PluginIndex             `json:"plugin_indexes,omitempty"`
 }
 
 func main() {
@@ -167,62 +196,34 @@ func loadConfig() {
 }
 
 func saveConfig() {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	writeConfig()
+}
+
+// updateConfig 在持有配置锁时修改并保存配置，后台 goroutine 修改配置时使用
+func updateConfig(change func()) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	change()
+	writeConfig()
+}
+
+// writeConfig 把配置写入文件，调用方需持有 configMutex
+func writeConfig() {
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		log.Printf("保存配置失败: %v", err)
 		return
 	}
 
+	// 配置中可能包含备份目标的访问密钥
 	configPath := filepath.Join(CACHE_DIR, CONFIG_FILE)
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
 		log.Printf("写入配置文件失败: %v", err)
 	}
 }
 
-func loadTranslationDict() {
-	dictPath := filepath.Join(CACHE_DIR, DICT_FILE)
-	if _, err := os.Stat(dictPath); os.IsNotExist(err) {
-		defaultDict := []byte(`Player [a-zA-Z0-9_]+ joined#玩家 $0 加入游戏
-Done \(\d+\.\d+s\)!#启动完成 (耗时 $0 秒)
-Stopping server#正在停止服务器
-Preparing spawn area: (\d+)%#生成出生点区域: $1%`)
-		if err := os.WriteFile(dictPath, defaultDict, 0644); err != nil {
-			log.Printf("创建默认字典失败: %v", err)
-		}
-	}
-
-	file, err := os.Open(dictPath)
-	if err != nil {
-		log.Printf("打开字典文件失败: %v", err)
-		return
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.SplitN(line, "#", 2)
-		if len(parts) == 2 {
-			translationMap[parts[0]] = parts[1]
-		}
-	}
-}
-
-func translateLog(line string) string {
-	for pattern, translation := range translationMap {
-		re := regexp.MustCompile(pattern)
-		if matches := re.FindStringSubmatch(line); matches != nil {
-			result := translation
-			for i, match := range matches {
-				placeholder := fmt.Sprintf("$%d", i)
-				result = strings.ReplaceAll(result, placeholder, match)
-			}
-			return result
-		}
-	}
-	return line
-}
-
 func detectJava() string {
 	if runtime.GOOS == "windows" {
 		if path, err := exec.LookPath("javaw.exe"); err == nil {
@@ -245,7 +246,12 @@ func recommendJavaVersion(mcVersion string) string {
 	major, _ := strconv.Atoi(versionParts[0])
 	minor, _ := strconv.Atoi(versionParts[1])
 
-	if major >= 1 && minor >= 17 {
+	if requiredJava(mcVersion) >= 21 {
+		if path, ok := config.JavaVersions["21"]; ok {
+			return path
+		}
+		return "java21"
+	} else if major >= 1 && minor >= 17 {
 		if path, ok := config.JavaVersions["17"]; ok {
 			return path
 		}
@@ -402,6 +408,76 @@ func downloadServer(name, mcVersion, coreVersion string) (string, error) {
 	return filePath, nil
 }
 
+// serverDir 返回实例的工作目录(服务端核心所在目录)
+func serverDir(server *ServerInstance) string {
+	return filepath.Dir(server.Path)
+}
+
+// sortedServerIDs 按编号顺序返回所有实例ID
+func sortedServerIDs() []string {
+	ids := make([]string, 0, len(config.ServerInstalls))
+	for id := range config.ServerInstalls {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// lineInput 在后台按需读取标准输入的一行，等待输入时不会阻塞其他事件
+type lineInput struct {
+	once    sync.Once
+	request chan struct{}
+	lines   chan string
+	pending bool
+	closed  bool
+}
+
+var stdinInput = &lineInput{}
+
+// next 请求读取下一行，已有未完成的读取时直接复用
+func (in *lineInput) next() <-chan string {
+	in.once.Do(func() {
+		in.request = make(chan struct{})
+		in.lines = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for range in.request {
+				if !scanner.Scan() {
+					close(in.lines)
+					return
+				}
+				in.lines <- scanner.Text()
+			}
+		}()
+	})
+	if !in.pending && !in.closed {
+		in.pending = true
+		in.request <- struct{}{}
+	}
+	return in.lines
+}
+
+// received 在从 next 返回的通道收到结果后调用，ok 为 false 表示标准输入已关闭
+func (in *lineInput) received(ok bool) {
+	in.pending = false
+	in.closed = in.closed || !ok
+}
+
+// finish 等待未完成的读取，避免后台读取吞掉菜单的下一次输入
+func (in *lineInput) finish() {
+	if !in.pending {
+		return
+	}
+	fmt.Println("\n按回车键返回...")
+	_, ok := <-in.lines
+	in.received(ok)
+}
+
 func startServer(serverID string) {
 	server, ok := config.ServerInstalls[serverID]
 	if !ok {
@@ -413,8 +489,12 @@ func startServer(serverID string) {
 	if javaPath == "" {
 		javaPath = config.JavaPath
 	}
-	if javaPath == "" {
-		fmt.Println("未找到Java环境，请先配置Java路径")
+	if !ensureEULA(server) {
+		return
+	}
+	autoQuarantineMods(server)
+	prepareResourcePack(server)
+	if !runPreflight(server) {
 		return
 	}
 
@@ -434,7 +514,7 @@ func startServer(serverID string) {
 	}
 
 	cmd := exec.Command(javaPath, args...)
-	cmd.Dir = filepath.Dir(server.Path)
+	cmd.Dir = serverDir(server)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -451,6 +531,7 @@ func startServer(serverID string) {
 		log.Fatal(err)
 	}
 
+	startedAt := time.Now()
 	if err := cmd.Start(); err != nil {
 		log.Fatal(err)
 	}
@@ -460,39 +541,86 @@ func startServer(serverID string) {
 	runningServers[serverID] = cmd
 	serverMutex.Unlock()
 
+	console := newServerConsole(serverID, stdin)
+	registerConsole(console, cmd.Process.Pid)
+	stopScheduler := make(chan struct{})
+	go runBackupScheduler(server, stopScheduler)
+	go runResourcePackHost(server, stopScheduler)
+
 	colorGreen := "\033[32m"
 	colorReset := "\033[0m"
 	fmt.Printf("%s服务器 [%s] 启动中... (输入 'stop' 停止服务器)%s\n", colorGreen, server.Name, colorReset)
 
 	// 输出处理
+	recorder := newEventRecorder(serverID, 2)
+	consoleLog := newConsoleLogger(serverID)
+	tail := newLineRing(CRASH_TAIL_LINES)
+	var outputWg sync.WaitGroup
+	outputWg.Add(2)
+
 	go func() {
+		defer outputWg.Done()
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
 			line := scanner.Text()
-			fmt.Printf("[%s] %s\n", server.Name, translateLog(line))
+			translated := translateLog(server, line)
+			fmt.Printf("[%s] %s\n", server.Name, translated)
+			consoleLog.write(line, translated)
+			tail.add(line)
+			console.publish(line)
+			recorder.feed(0, line)
 		}
 	}()
 
 	go func() {
+		defer outputWg.Done()
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
 			line := scanner.Text()
-			fmt.Printf("[%s] %s\n", server.Name, translateLog(line))
+			translated := translateLog(server, line)
+			fmt.Printf("[%s] %s\n", server.Name, translated)
+			consoleLog.write(line, translated)
+			tail.add(line)
+			console.publish(line)
+			recorder.feed(1, line)
 		}
 	}()
 
+	// 进程退出时立即清理，不论是谁停止了服务器
+	var waitErr error
+	done := make(chan struct{})
+	go func() {
+		outputWg.Wait()
+		waitErr = cmd.Wait()
+		close(done)
+	}()
+
 	// 用户输入处理
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		text := scanner.Text()
-		if strings.EqualFold(text, "stop") {
-			fmt.Fprintln(stdin, "stop")
-			break
+	input := stdinInput.next()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case text, ok := <-input:
+			stdinInput.received(ok)
+			if !ok {
+				// 标准输入已关闭，只等待进程退出
+				input = nil
+				continue
+			}
+			if strings.EqualFold(text, "stop") {
+				console.send("stop")
+			} else {
+				console.send(text)
+			}
+			input = stdinInput.next()
 		}
-		fmt.Fprintln(stdin, text)
 	}
 
-	cmd.Wait()
+	close(stopScheduler)
+	unregisterConsole(serverID)
+	recorder.close()
+	consoleLog.close()
 
 	// 清理运行中的服务器
 	serverMutex.Lock()
@@ -500,6 +628,7 @@ func startServer(serverID string) {
 	serverMutex.Unlock()
 
 	fmt.Printf("%s服务器 [%s] 已停止%s\n", colorGreen, server.Name, colorReset)
+	handleServerExit(server, startedAt, waitErr, tail.snapshot())
 }
 
 func stopServer(serverID string) {
@@ -509,6 +638,13 @@ func stopServer(serverID string) {
 	if cmd, ok := runningServers[serverID]; ok {
 		cmd.Process.Signal(os.Interrupt)
 		fmt.Printf("已发送停止信号到服务器: %s\n", serverID)
+	} else if remoteRunInfo(serverID) != nil {
+		// 由其他 emcm 进程运行的服务器通过控制端口发送 stop
+		if _, err := consoleCommand(serverID, "stop", nil, 0); err != nil {
+			fmt.Printf("发送停止命令失败: %v\n", err)
+		} else {
+			fmt.Printf("已发送停止命令到服务器: %s\n", serverID)
+		}
 	} else {
 		fmt.Printf("未找到运行中的服务器: %s\n", serverID)
 	}
@@ -585,22 +721,9 @@ func handleCLI() {
 		fmt.Printf("下载完成! 文件保存至: %s\n", path)
 
 		// 创建服务器实例
-		serverID := fmt.Sprintf("server-%d", len(config.ServerInstalls)+1)
-		server := &ServerInstance{
-			ID:          serverID,
-			Name:        fmt.Sprintf("%s-%s", name, mcVersion),
-			ServerType:  name,
-			MCVersion:   mcVersion,
-			CoreVersion: coreVersion,
-			Path:        path,
-			JavaPath:    recommendJavaVersion(mcVersion),
-			Memory:      config.DefaultMemory,
-			CreatedAt:   time.Now().Format(time.RFC3339),
-			UpdatedAt:   time.Now().Format(time.RFC3339),
-		}
-		config.ServerInstalls[serverID] = server
-		saveConfig()
-		fmt.Printf("已创建服务器实例: %s\n", serverID)
+		server := registerServerInstance(fmt.Sprintf("%s-%s", name, mcVersion), name, mcVersion, coreVersion, path)
+		fmt.Printf("已创建服务器实例: %s\n", server.ID)
+		fmt.Printf("启动前需要同意 EULA: emcm eula %s accept\n", server.ID)
 
 	case "start":
 		if len(os.Args) < 3 {
@@ -676,9 +799,72 @@ func handleCLI() {
 				id, server.Name, server.ServerType, server.MCVersion, server.Path)
 		}
 
+	case "dict":
+		handleDictCLI(os.Args[2:])
+
+	case "events":
+		handleEventsCLI(os.Args[2:])
+
+	case "logs":
+		handleLogsCLI(os.Args[2:])
+
+	case "crash":
+		handleCrashCLI(os.Args[2:])
+
+	case "backup":
+		handleBackupCLI(os.Args[2:])
+
+	case "restore":
+		handleRestoreCLI(os.Args[2:])
+
+	case "cmd":
+		handleCmdCLI(os.Args[2:])
+
+	case "world":
+		handleWorldCLI(os.Args[2:])
+
+	case "players", "player", "leaderboard":
+		handlePlayersCLI(os.Args[1], os.Args[2:])
+
+	case "whitelist", "op", "ban":
+		handleAccessCLI(os.Args[1], os.Args[2:])
+
+	case "create":
+		handleCreateCLI(os.Args[2:])
+
+	case "eula":
+		handleEULACLI(os.Args[2:])
+
+	case "ports":
+		handlePortsCLI(os.Args[2:])
+
+	case "doctor":
+		handleDoctorCLI(os.Args[2:])
+
+	case "plugin":
+		handlePluginCLI(os.Args[2:])
+
+	case "mod":
+		handleModCLI(os.Args[2:])
+
+	case "datapack":
+		handleDatapackCLI(os.Args[2:])
+
+	case "resourcepack":
+		handleResourcePackCLI(os.Args[2:])
+
+	case "export-mrpack":
+		handleExportMrpackCLI(os.Args[2:])
+
+	case "group":
+		handleGroupCLI(os.Args[2:])
+
+	case "props":
+		handlePropsCLI(os.Args[2:])
+
 	default:
 		fmt.Println("未知命令:", os.Args[1])
-		fmt.Println("可用命令: list, versions, download, start, stop, java, memory, servers")
+		fmt.Println("可用命令: list, versions, download, create, eula, ports, doctor, start, stop, java, memory, servers, dict, events, logs, crash, backup, restore, cmd, world, players, player, leaderboard, whitelist, op, ban, group, props, plugin, mod, export-mrpack, datapack, resourcepack")
 	}
 }
 
@@ -695,6 +881,7 @@ func showMainMenu() {
 			continue
 		}
 
+		printCrashNotices()
 		fmt.Println("\n\033[1;36mEMCM 主菜单\033[0m")
 		fmt.Println("----------------------------------------")
 		fmt.Println("1. 启动服务器")
@@ -704,7 +891,8 @@ func showMainMenu() {
 		fmt.Println("5. Java环境管理")
 		fmt.Println("6. 内存设置")
 		fmt.Println("7. 编辑日志翻译字典")
-		fmt.Println("8. 退出")
+		fmt.Println("8. 崩溃分析")
+		fmt.Println("9. 退出")
 		fmt.Println("----------------------------------------")
 		fmt.Print("请选择操作: ")
 
@@ -727,6 +915,8 @@ func showMainMenu() {
 		case 7:
 			editTranslationDict()
 		case 8:
+			crashMenu()
+		case 9:
 			fmt.Println("感谢使用 EMCM!")
 			os.Exit(0)
 		default:
@@ -789,6 +979,7 @@ func startServerMenu() {
 	}
 
 	startServer(serverID)
+	stdinInput.finish()
 }
 
 func stopServerMenu() {
@@ -874,6 +1065,8 @@ func manageServersMenu() {
 		fmt.Println("3. 配置Java环境")
 		fmt.Println("4. 配置启动参数")
 		fmt.Println("5. 删除实例")
+		fmt.Println("6. 立即备份")
+		fmt.Println("7. 编辑 server.properties")
 		fmt.Println("0. 返回")
 		fmt.Println("----------------------------------------")
 		fmt.Print("请选择操作: ")
@@ -890,7 +1083,7 @@ func manageServersMenu() {
 			continue
 		}
 
-		if action >= 2 && action <= 5 {
+		if action >= 2 && action <= 7 {
 			fmt.Print("请选择服务器实例: ")
 			var serverChoice int
 			fmt.Scanln(&serverChoice)
@@ -951,15 +1144,90 @@ func manageServersMenu() {
 				fmt.Scanln(&confirm)
 				if strings.ToLower(confirm) == "y" {
 					delete(config.ServerInstalls, serverID)
+					removeFromGroups(serverID)
 					saveConfig()
 					fmt.Println("实例已删除")
 				}
+			case 6: // 备份
+				if _, err := createBackup(server, "", false); err != nil {
+					fmt.Println("备份失败:", err)
+				} else {
+					if removed := pruneBackups(server, false); len(removed) > 0 {
+						fmt.Printf("按保留策略删除了 %d 个旧备份\n", len(removed))
+					}
+					spawnBackgroundPush(server)
+				}
+			case 7: // 编辑 server.properties
+				editPropertiesMenu(server)
 			}
 			time.Sleep(2 * time.Second)
 		}
 	}
 }
 
+// detectServerJar 从服务端文件名推断类型和 MC 版本
+func detectServerJar(serverPath string) (string, string) {
+	fileName := strings.ToLower(filepath.Base(serverPath))
+	serverType := "Unknown"
+	if strings.Contains(fileName, "paper") {
+		serverType = "Paper"
+	} else if strings.Contains(fileName, "forge") {
+		serverType = "Forge"
+	} else if strings.Contains(fileName, "fabric") {
+		serverType = "Fabric"
+	}
+
+	// 从文件名中提取版本号
+	mcVersion := "Unknown"
+	re := regexp.MustCompile(`(\d+\.\d+(\.\d+)?)`)
+	if matches := re.FindStringSubmatch(fileName); len(matches) > 0 {
+		mcVersion = matches[0]
+	}
+	return serverType, mcVersion
+}
+
+// registerServerInstance 创建实例并保存配置，Java 路径按 MC 版本推荐
+func registerServerInstance(name, serverType, mcVersion, coreVersion, path string) *ServerInstance {
+	javaPath := config.JavaPath
+	if mcVersion != "" && mcVersion != "Unknown" {
+		recommended := recommendJavaVersion(mcVersion)
+		if !strings.HasPrefix(recommended, "java") {
+			javaPath = recommended
+		}
+	}
+
+	// 编号从实例数加一开始，跳过已存在的 ID (删除过实例后可能冲突)
+	serverID := ""
+	for n := len(config.ServerInstalls) + 1; ; n++ {
+		serverID = fmt.Sprintf("server-%d", n)
+		if _, exists := config.ServerInstalls[serverID]; !exists {
+			break
+		}
+	}
+	now := time.Now().Format(time.RFC3339)
+	server := &ServerInstance{
+		ID:          serverID,
+		Name:        name,
+		ServerType:  serverType,
+		MCVersion:   mcVersion,
+		CoreVersion: coreVersion,
+		Path:        path,
+		JavaPath:    javaPath,
+		Memory:      config.DefaultMemory,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	config.ServerInstalls[serverID] = server
+	saveConfig()
+
+	if assigned, err := assignPorts(server); err != nil {
+		fmt.Println("分配端口失败:", err)
+	} else {
+		fmt.Printf("已分配端口: server-port %d, query.port %d, rcon.port %d\n", assigned[PORT_SERVER], assigned[PORT_QUERY], assigned[PORT_RCON])
+	}
+	return server
+}
+
 func createServerInstance() {
 	clearScreen()
 	fmt.Println("\n\033[1;36m创建服务器实例\033[0m")
@@ -1001,56 +1269,31 @@ func createServerInstance() {
 		fmt.Print("请输入服务端路径: ")
 		fmt.Scanln(&serverPath)
 
-		// 尝试解析服务端类型和版本
-		fileName := filepath.Base(serverPath)
-		if strings.Contains(fileName, "paper") {
-			serverType = "Paper"
-		} else if strings.Contains(fileName, "forge") {
-			serverType = "Forge"
-		} else if strings.Contains(fileName, "fabric") {
-			serverType = "Fabric"
-		} else {
-			serverType = "Unknown"
-		}
-
-		// 从文件名中提取版本号
-		re := regexp.MustCompile(`(\d+\.\d+(\.\d+)?)`)
-		if matches := re.FindStringSubmatch(fileName); len(matches) > 0 {
-			mcVersion = matches[0]
-		} else {
-			mcVersion = "Unknown"
-		}
+		serverType, mcVersion = detectServerJar(serverPath)
 	default:
 		fmt.Println("无效选择")
 		return
 	}
 
-	// 3. 配置Java环境
-	javaPath := config.JavaPath
-	if mcVersion != "" && mcVersion != "Unknown" {
-		recommended := recommendJavaVersion(mcVersion)
-		if !strings.HasPrefix(recommended, "java") {
-			javaPath = recommended
-		}
-	}
+	// 3. 创建服务器实例并配置Java环境
+	server := registerServerInstance(serverName, serverType, mcVersion, coreVersion, serverPath)
+	serverID, javaPath := server.ID, server.JavaPath
 
-	// 创建服务器实例
-	serverID := fmt.Sprintf("server-%d", len(config.ServerInstalls)+1)
-	server := &ServerInstance{
-		ID:          serverID,
-		Name:        serverName,
-		ServerType:  serverType,
-		MCVersion:   mcVersion,
-		CoreVersion: coreVersion,
-		Path:        serverPath,
-		JavaPath:    javaPath,
-		Memory:      config.DefaultMemory,
-		CreatedAt:   time.Now().Format(time.RFC3339),
-		UpdatedAt:   time.Now().Format(time.RFC3339),
+	// 4. 常用的 server.properties 设置
+	fmt.Println("\n服务器设置 (回车使用方括号中的值):")
+	if err := propertiesWizard(scanner, server, "server-port", "motd", "gamemode", "difficulty", "level-seed", "max-players"); err != nil {
+		fmt.Println("写入 server.properties 失败:", err)
 	}
 
-	config.ServerInstalls[serverID] = server
-	saveConfig()
+	// 5. 同意 EULA
+	fmt.Println()
+	if promptEULA(scanner) {
+		if err := acceptEULA(server); err != nil {
+			fmt.Println(err)
+		}
+	} else {
+		fmt.Println("未同意 EULA，首次启动时会再次询问")
+	}
 
 	fmt.Printf("\n\033[32m服务器实例创建成功!\033[0m\n")
 	fmt.Printf("ID: %s\n", serverID)
@@ -1278,68 +1521,6 @@ func memorySettingsMenu() {
 	time.Sleep(2 * time.Second)
 }
 
-func editTranslationDict() {
-	clearScreen()
-	fmt.Println("\n\033[1;36m日志翻译字典编辑\033[0m")
-	fmt.Println("----------------------------------------")
-	fmt.Println("当前字典规则:")
-
-	dictPath := filepath.Join(CACHE_DIR, DICT_FILE)
-	content, err := os.ReadFile(dictPath)
-	if err != nil {
-		fmt.Println("无法读取字典文件:", err)
-	} else {
-		fmt.Println(string(content))
-	}
-
-	fmt.Println("\n操作选项:")
-	fmt.Println("1. 使用系统编辑器编辑")
-	fmt.Println("2. 恢复默认字典")
-	fmt.Println("0. 返回主菜单")
-	fmt.Println("----------------------------------------")
-	fmt.Print("请选择操作: ")
-
-	var choice int
-	fmt.Scanln(&choice)
-
-	switch choice {
-	case 0:
-		return
-	case 1:
-		var editor string
-		if runtime.GOOS == "windows" {
-			editor = "notepad"
-		} else {
-			editor = "nano"
-		}
-
-		cmd := exec.Command(editor, dictPath)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			fmt.Println("编辑失败:", err)
-		} else {
-			fmt.Println("字典已更新，重新加载中...")
-			loadTranslationDict()
-		}
-		time.Sleep(2 * time.Second)
-	case 2:
-		defaultDict := []byte(`Player [a-zA-Z0-9_]+ joined#玩家 $0 加入游戏
-Done \(\d+\.\d+s\)!#启动完成 (耗时 $0 秒)
-Stopping server#正在停止服务器
-Preparing spawn area: (\d+)%#生成出生点区域: $1%`)
-		if err := os.WriteFile(dictPath, defaultDict, 0644); err != nil {
-			fmt.Println("恢复默认字典失败:", err)
-		} else {
-			fmt.Println("默认字典已恢复，重新加载中...")
-			loadTranslationDict()
-		}
-		time.Sleep(2 * time.Second)
-	}
-}
-
 func clearScreen() {
 	switch runtime.GOOS {
 	case "linux", "darwin":
@@ -0,0 +1,699 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WHITELIST_FILE      = "whitelist.json"
+	OPS_FILE            = "ops.json"
+	BANNED_PLAYERS_FILE = "banned-players.json"
+	BANNED_IPS_FILE     = "banned-ips.json"
+
+	BAN_TIME_FORMAT     = "2006-01-02 15:04:05 -0700"
+	BAN_FOREVER         = "forever"
+	BAN_SOURCE          = "EMCM"
+	DEFAULT_BAN_REASON  = "Banned by an operator."
+	DEFAULT_OP_LEVEL    = 4
+	MOJANG_PROFILE_API  = "https://api.mojang.com/users/profiles/minecraft/"
+	PROFILE_API_TIMEOUT = 10 * time.Second
+	ACCESS_CMD_TIMEOUT  = 5 * time.Second
+)
+
+// accessReplyRe 匹配 whitelist、op、ban 等命令的回复
+var accessReplyRe = regexp.MustCompile(`(?i)(added .* to the whitelist|removed .* from the whitelist|made .* (a|no longer a) server operator|\bbanned\b|\bunbanned\b|nothing changed|already|is not whitelisted|does not exist|unknown player|invalid ip|whitelist is now|no player was found)`)
+
+type whitelistEntry struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+type opEntry struct {
+	UUID                string `json:"uuid"`
+	Name                string `json:"name"`
+	Level               int    `json:"level"`
+	BypassesPlayerLimit bool   `json:"bypassesPlayerLimit"`
+}
+
+// banEntry 同时用于 banned-players.json (uuid、name) 和 banned-ips.json (ip)
+type banEntry struct {
+	UUID    string `json:"uuid,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Created string `json:"created"`
+	Source  string `json:"source"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+func accessListPath(server *ServerInstance, file string) string {
+	return filepath.Join(serverDir(server), file)
+}
+
+// readAccessList 读取 JSON 列表，文件不存在时返回空列表
+func readAccessList(server *ServerInstance, file string, v interface{}) error {
+	data, err := os.ReadFile(accessListPath(server, file))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s 格式错误: %v", file, err)
+	}
+	return nil
+}
+
+// offlineUUID 计算离线模式下的 UUID，与服务端的 UUID.nameUUIDFromBytes("OfflinePlayer:" + name) 相同
+func offlineUUID(name string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return formatUUID(fmt.Sprintf("%x", sum))
+}
+
+func formatUUID(hex string) string {
+	hex = strings.ToLower(strings.ReplaceAll(hex, "-", ""))
+	if len(hex) != 32 {
+		return hex
+	}
+	return hex[:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:]
+}
+
+func isOnlineMode(server *ServerInstance) bool {
+	props, err := readServerProperties(server)
+	return err != nil || props["online-mode"] != "false"
+}
+
+// resolveProfile 查找玩家的 UUID: 离线模式直接计算，正版模式先查 usercache.json 再查询 Mojang API
+func resolveProfile(server *ServerInstance, name string) (string, string, error) {
+	if !isOnlineMode(server) {
+		return offlineUUID(name), name, nil
+	}
+	if cache, err := readUserCache(server); err == nil {
+		for _, entry := range cache {
+			if strings.EqualFold(entry.Name, name) {
+				return strings.ToLower(entry.UUID), entry.Name, nil
+			}
+		}
+	}
+
+	client := &http.Client{Timeout: PROFILE_API_TIMEOUT}
+	resp, err := client.Get(MOJANG_PROFILE_API + name)
+	if err != nil {
+		return "", "", fmt.Errorf("查询玩家 %s 的 UUID 失败: %v (可以用 --uuid 指定)", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotFound {
+		return "", "", fmt.Errorf("正版玩家 %s 不存在", name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("查询玩家 %s 的 UUID 失败: HTTP %d (可以用 --uuid 指定)", name, resp.StatusCode)
+	}
+	var profile struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return "", "", err
+	}
+	return formatUUID(profile.ID), profile.Name, nil
+}
+
+// accessOptions 是 add 子命令的附加参数
+type accessOptions struct {
+	uuid    string
+	level   int
+	bypass  bool
+	reason  string
+	expires time.Duration
+}
+
+func (o accessOptions) profile(server *ServerInstance, name string) (string, string, error) {
+	if o.uuid != "" {
+		return formatUUID(o.uuid), name, nil
+	}
+	return resolveProfile(server, name)
+}
+
+// liveCommand 在服务器运行时执行控制台命令，由服务端负责写回 JSON 文件
+func liveCommand(server *ServerInstance, command string) {
+	reply, err := consoleCommand(server.ID, command, accessReplyRe, ACCESS_CMD_TIMEOUT)
+	if err != nil {
+		fmt.Printf("\033[33m%s: %v\033[0m\n", command, err)
+		return
+	}
+	if reply == "" {
+		fmt.Println("已发送:", command)
+		return
+	}
+	fmt.Printf("%s -> %s\n", command, strings.TrimSpace(reply))
+}
+
+// 名单类型，与服务端的 JSON 文件一一对应
+const (
+	LIST_WHITELIST      = "whitelist"
+	LIST_OPS            = "ops"
+	LIST_BANNED_PLAYERS = "banned-players"
+	LIST_BANNED_IPS     = "banned-ips"
+)
+
+type accessListInfo struct {
+	file      string
+	added     string
+	unchanged string
+	removed   string
+	missing   string
+}
+
+var accessLists = map[string]accessListInfo{
+	LIST_WHITELIST:      {WHITELIST_FILE, "已将 %s 加入白名单", "%s 已在白名单中", "已将 %s 移出白名单", "%s 不在白名单中"},
+	LIST_OPS:            {OPS_FILE, "已将 %s 设为管理员", "%s 已是管理员", "已取消 %s 的管理员权限", "%s 不是管理员"},
+	LIST_BANNED_PLAYERS: {BANNED_PLAYERS_FILE, "已封禁 %s", "%s 已被封禁", "已解除 %s 的封禁", "%s 未被封禁"},
+	LIST_BANNED_IPS:     {BANNED_IPS_FILE, "已封禁 IP %s", "IP %s 已被封禁", "已解除 IP %s 的封禁", "IP %s 未被封禁"},
+}
+
+// accessItem 是名单中的一条记录，key 为小写的 UUID 或 IP，entry 为对应文件中的条目结构
+type accessItem struct {
+	key   string
+	name  string
+	entry interface{}
+}
+
+func (it accessItem) matches(query accessItem) bool {
+	return (query.key != "" && it.key == query.key) || (query.name != "" && strings.EqualFold(it.name, query.name))
+}
+
+// queryItem 构造用于删除的查询条件: 参数可以是玩家名、UUID 或 IP
+func queryItem(kind, target string) accessItem {
+	if kind == LIST_BANNED_IPS {
+		return accessItem{key: target, name: target}
+	}
+	return accessItem{key: formatUUID(target), name: target}
+}
+
+// toAccessItems 把文件中的条目列表转换为通用记录
+func toAccessItems(list interface{}) []accessItem {
+	var items []accessItem
+	switch l := list.(type) {
+	case []whitelistEntry:
+		for _, e := range l {
+			items = append(items, accessItem{strings.ToLower(e.UUID), e.Name, e})
+		}
+	case []opEntry:
+		for _, e := range l {
+			items = append(items, accessItem{strings.ToLower(e.UUID), e.Name, e})
+		}
+	case []banEntry:
+		for _, e := range l {
+			if e.IP != "" {
+				items = append(items, accessItem{e.IP, e.IP, e})
+			} else {
+				items = append(items, accessItem{strings.ToLower(e.UUID), e.Name, e})
+			}
+		}
+	}
+	return items
+}
+
+// fromAccessItems 把通用记录转换回文件中的条目列表，空列表写为 []
+func fromAccessItems(kind string, items []accessItem) interface{} {
+	switch kind {
+	case LIST_WHITELIST:
+		list := []whitelistEntry{}
+		for _, it := range items {
+			list = append(list, it.entry.(whitelistEntry))
+		}
+		return list
+	case LIST_OPS:
+		list := []opEntry{}
+		for _, it := range items {
+			list = append(list, it.entry.(opEntry))
+		}
+		return list
+	}
+	list := []banEntry{}
+	for _, it := range items {
+		list = append(list, it.entry.(banEntry))
+	}
+	return list
+}
+
+func readAccessItems(server *ServerInstance, kind string) ([]accessItem, error) {
+	var err error
+	var list interface{}
+	switch kind {
+	case LIST_WHITELIST:
+		var l []whitelistEntry
+		err = readAccessList(server, accessLists[kind].file, &l)
+		list = l
+	case LIST_OPS:
+		var l []opEntry
+		err = readAccessList(server, accessLists[kind].file, &l)
+		list = l
+	default:
+		var l []banEntry
+		err = readAccessList(server, accessLists[kind].file, &l)
+		list = l
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toAccessItems(list), nil
+}
+
+func writeAccessItems(server *ServerInstance, kind string, items []accessItem) error {
+	return saveJSON(accessListPath(server, accessLists[kind].file), fromAccessItems(kind, items))
+}
+
+// upsertItem 按 key 替换或追加记录，返回是否有变化
+func upsertItem(items []accessItem, item accessItem) ([]accessItem, bool) {
+	for i, it := range items {
+		if it.key == item.key {
+			if it.entry == item.entry {
+				return items, false
+			}
+			items[i] = item
+			return items, true
+		}
+	}
+	return append(items, item), true
+}
+
+// removeItems 删除与查询匹配的记录；离线模式下大小写不同的玩家名是不同的玩家，有完全匹配时只删除完全匹配的
+func removeItems(items []accessItem, query accessItem) ([]accessItem, bool) {
+	exact := false
+	for _, it := range items {
+		if it.key == query.key || it.name == query.name {
+			exact = true
+		}
+	}
+	kept := make([]accessItem, 0, len(items))
+	for _, it := range items {
+		remove := it.matches(query)
+		if exact {
+			remove = it.key == query.key || it.name == query.name
+		}
+		if !remove {
+			kept = append(kept, it)
+		}
+	}
+	return kept, len(kept) != len(items)
+}
+
+// accessCommand 返回修改名单的控制台命令
+func accessCommand(kind string, item accessItem, add bool) string {
+	switch kind {
+	case LIST_WHITELIST:
+		if add {
+			return "whitelist add " + item.name
+		}
+		return "whitelist remove " + item.name
+	case LIST_OPS:
+		if add {
+			return "op " + item.name
+		}
+		return "deop " + item.name
+	}
+
+	command := "pardon "
+	if add {
+		command = "ban "
+	}
+	if kind == LIST_BANNED_IPS {
+		command = strings.TrimSpace(command) + "-ip "
+	}
+	command += item.name
+	if e, ok := item.entry.(banEntry); ok && add && e.Reason != "" && e.Reason != DEFAULT_BAN_REASON {
+		command += " " + e.Reason
+	}
+	return command
+}
+
+// applyAccessChange 把一条修改应用到实例: 运行中执行控制台命令，否则修改 JSON 文件
+func applyAccessChange(server *ServerInstance, kind string, item accessItem, add bool) error {
+	if isServerRunning(server.ID) {
+		liveCommand(server, accessCommand(kind, item, add))
+		return nil
+	}
+	items, err := readAccessItems(server, kind)
+	if err != nil {
+		return err
+	}
+	info := accessLists[kind]
+	changed := false
+	if add {
+		items, changed = upsertItem(items, item)
+		if changed {
+			fmt.Printf(info.added+"\n", describeItem(item))
+		} else {
+			fmt.Printf(info.unchanged+"\n", describeItem(item))
+		}
+	} else {
+		items, changed = removeItems(items, item)
+		if changed {
+			fmt.Printf(info.removed+"\n", item.name)
+		} else {
+			fmt.Printf(info.missing+"\n", item.name)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeAccessItems(server, kind, items)
+}
+
+func describeItem(item accessItem) string {
+	if item.key == item.name {
+		return item.name
+	}
+	return fmt.Sprintf("%s (%s)", item.name, item.key)
+}
+
+// checkLiveOptions 检查控制台命令无法表达的参数
+func checkLiveOptions(kind string, opts accessOptions) error {
+	switch {
+	case kind == LIST_OPS && (opts.level != 0 || opts.bypass):
+		return errors.New("服务器运行时只能使用默认权限等级 (op-permission-level)，--level 和 --bypass 需要先停止服务器")
+	case (kind == LIST_BANNED_PLAYERS || kind == LIST_BANNED_IPS) && opts.expires > 0:
+		return errors.New("控制台的 ban 命令不支持限时封禁，--expires 需要先停止服务器")
+	}
+	return nil
+}
+
+// banListKind 根据参数是否为 IP 地址选择封禁名单
+func banListKind(target string) string {
+	if net.ParseIP(target) != nil {
+		return LIST_BANNED_IPS
+	}
+	return LIST_BANNED_PLAYERS
+}
+
+// newAccessItem 为 add 构造记录，resolver 用于确定 UUID 和玩家名的规范大小写
+func newAccessItem(kind, target string, opts accessOptions, resolver *ServerInstance) (accessItem, error) {
+	if kind == LIST_BANNED_IPS {
+		e := newBanEntry(opts)
+		e.IP = target
+		return accessItem{target, target, e}, nil
+	}
+
+	uuid, name, err := opts.profile(resolver, target)
+	if err != nil {
+		return accessItem{}, err
+	}
+	item := accessItem{key: uuid, name: name}
+	switch kind {
+	case LIST_WHITELIST:
+		item.entry = whitelistEntry{UUID: uuid, Name: name}
+	case LIST_OPS:
+		level := opts.level
+		if level == 0 {
+			level = opPermissionLevel(resolver)
+		}
+		item.entry = opEntry{UUID: uuid, Name: name, Level: level, BypassesPlayerLimit: opts.bypass}
+	default:
+		e := newBanEntry(opts)
+		e.UUID, e.Name = uuid, name
+		item.entry = e
+	}
+	return item, nil
+}
+
+// opPermissionLevel 返回 op 命令使用的权限等级
+func opPermissionLevel(server *ServerInstance) int {
+	if props, err := readServerProperties(server); err == nil {
+		if n, err := strconv.Atoi(props["op-permission-level"]); err == nil {
+			return n
+		}
+	}
+	return DEFAULT_OP_LEVEL
+}
+
+func newBanEntry(opts accessOptions) banEntry {
+	now := time.Now()
+	e := banEntry{
+		Created: now.Format(BAN_TIME_FORMAT),
+		Source:  BAN_SOURCE,
+		Expires: BAN_FOREVER,
+		Reason:  opts.reason,
+	}
+	if e.Reason == "" {
+		e.Reason = DEFAULT_BAN_REASON
+	}
+	if opts.expires > 0 {
+		e.Expires = now.Add(opts.expires).Format(BAN_TIME_FORMAT)
+	}
+	return e
+}
+
+// banExpired 判断封禁是否已过期，过期的条目服务端加载时会忽略
+func banExpired(e banEntry) bool {
+	if e.Expires == "" || e.Expires == BAN_FOREVER {
+		return false
+	}
+	t, err := time.Parse(BAN_TIME_FORMAT, e.Expires)
+	return err == nil && t.Before(time.Now())
+}
+
+func printAccessItems(kind string, items []accessItem) {
+	for _, it := range items {
+		switch e := it.entry.(type) {
+		case whitelistEntry:
+			fmt.Printf("  %s%s\n", padRight(e.Name, 18), e.UUID)
+		case opEntry:
+			bypass := ""
+			if e.BypassesPlayerLimit {
+				bypass = " 可超过人数上限"
+			}
+			fmt.Printf("  %s%s 等级 %d%s\n", padRight(e.Name, 18), e.UUID, e.Level, bypass)
+		case banEntry:
+			expires := "永久"
+			if e.Expires != "" && e.Expires != BAN_FOREVER {
+				expires = "至 " + e.Expires
+				if banExpired(e) {
+					expires += " (已过期)"
+				}
+			}
+			fmt.Printf("  %s%s  %s  %s  来源: %s\n", padRight(it.name, 18), e.Created, expires, e.Reason, e.Source)
+		}
+	}
+}
+
+var listTitles = map[string]string{
+	LIST_WHITELIST:      "白名单",
+	LIST_OPS:            "管理员",
+	LIST_BANNED_PLAYERS: "封禁玩家",
+	LIST_BANNED_IPS:     "封禁 IP",
+}
+
+// commandLists 返回命令对应的名单类型
+func commandLists(command string) []string {
+	switch command {
+	case "whitelist":
+		return []string{LIST_WHITELIST}
+	case "op":
+		return []string{LIST_OPS}
+	}
+	return []string{LIST_BANNED_PLAYERS, LIST_BANNED_IPS}
+}
+
+// targetKind 返回某个参数在命令下对应的名单类型
+func targetKind(command, target string) string {
+	if command == "ban" {
+		return banListKind(target)
+	}
+	return commandLists(command)[0]
+}
+
+func accessServerCommand(server *ServerInstance, command, action string, targets []string, opts accessOptions) error {
+	live := isServerRunning(server.ID)
+	switch action {
+	case "on", "off":
+		if live {
+			liveCommand(server, "whitelist "+action)
+			return nil
+		}
+		if err := setServerProperties(server, map[string]string{"white-list": strconv.FormatBool(action == "on")}); err != nil {
+			return err
+		}
+		fmt.Printf("已%s白名单 (white-list=%t)\n", map[string]string{"on": "启用", "off": "关闭"}[action], action == "on")
+		return nil
+
+	case "ls":
+		for _, kind := range commandLists(command) {
+			items, err := readAccessItems(server, kind)
+			if err != nil {
+				return err
+			}
+			title := listTitles[kind]
+			if kind == LIST_WHITELIST {
+				if props, err := readServerProperties(server); err == nil && props["white-list"] == "true" {
+					title += "，已启用"
+				} else {
+					title += "，未启用"
+				}
+			}
+			fmt.Printf("\n%s (共 %d 条):\n", title, len(items))
+			printAccessItems(kind, items)
+		}
+		return nil
+	}
+
+	for _, target := range targets {
+		kind := targetKind(command, target)
+		if live {
+			if err := checkLiveOptions(kind, opts); err != nil {
+				return err
+			}
+		}
+		item := queryItem(kind, target)
+		if action == "add" {
+			var err error
+			if live {
+				// 控制台命令由服务端自己解析玩家，不需要查询 UUID
+				item.entry = newBanEntry(opts)
+			} else if item, err = newAccessItem(kind, target, opts, server); err != nil {
+				return err
+			}
+		}
+		if err := applyAccessChange(server, kind, item, action == "add"); err != nil {
+			return err
+		}
+	}
+	printGroupHint(server, commandLists(command))
+	return nil
+}
+
+// parseBanDuration 解析封禁时长，支持 30m、12h 和 7d
+func parseBanDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("无效的时长: %s (示例: 30m、12h、7d)", value)
+	}
+	return d, nil
+}
+
+// parseAccessArgs 解析 add 的附加参数，其余参数作为玩家名或 IP
+func parseAccessArgs(args []string) (accessOptions, []string, error) {
+	var opts accessOptions
+	var targets []string
+	for i := 0; i < len(args); i++ {
+		value := ""
+		if strings.HasPrefix(args[i], "--") && args[i] != "--bypass" {
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("缺少参数值: %s", args[i])
+			}
+			value = args[i+1]
+		}
+		switch args[i] {
+		case "--uuid":
+			opts.uuid = value
+			i++
+		case "--level":
+			level, err := strconv.Atoi(value)
+			if err != nil || level < 1 || level > 4 {
+				return opts, nil, errors.New("权限等级必须是 1-4")
+			}
+			opts.level = level
+			i++
+		case "--bypass":
+			opts.bypass = true
+		case "--reason":
+			opts.reason = value
+			i++
+		case "--expires":
+			d, err := parseBanDuration(value)
+			if err != nil {
+				return opts, nil, err
+			}
+			opts.expires = d
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return opts, nil, fmt.Errorf("未知参数: %s", args[i])
+			}
+			targets = append(targets, args[i])
+		}
+	}
+	if opts.uuid != "" && len(targets) > 1 {
+		return opts, nil, errors.New("--uuid 只能用于单个玩家")
+	}
+	return opts, targets, nil
+}
+
+func validAccessAction(command, action string, targets []string) bool {
+	actions := map[string][]string{
+		"whitelist": {"ls", "add", "rm", "on", "off"},
+		"op":        {"ls", "add", "rm"},
+		"ban":       {"ls", "add", "rm"},
+	}
+	for _, a := range actions[command] {
+		if a == action {
+			return (action != "add" && action != "rm") || len(targets) > 0
+		}
+	}
+	return false
+}
+
+func printAccessUsage(command string) {
+	fmt.Println("用法:")
+	switch command {
+	case "whitelist":
+		fmt.Println("  emcm whitelist <服务器ID> ls")
+		fmt.Println("  emcm whitelist <服务器ID> add|rm <玩家名>... [--uuid UUID]")
+		fmt.Println("  emcm whitelist <服务器ID> on|off")
+	case "op":
+		fmt.Println("  emcm op <服务器ID> ls")
+		fmt.Println("  emcm op <服务器ID> add <玩家名>... [--level 1-4] [--bypass] [--uuid UUID]")
+		fmt.Println("  emcm op <服务器ID> rm <玩家名>...")
+	case "ban":
+		fmt.Println("  emcm ban <服务器ID> ls")
+		fmt.Println("  emcm ban <服务器ID> add <玩家名|IP>... [--reason 原因] [--expires 7d] [--uuid UUID]")
+		fmt.Println("  emcm ban <服务器ID> rm <玩家名|IP>...")
+	}
+	fmt.Println("服务器运行时通过控制台命令修改 (由服务端写回文件)，否则直接修改 JSON 文件；")
+	fmt.Println("离线模式 (online-mode=false) 的 UUID 由玩家名计算，正版模式从 usercache.json 或 Mojang API 查询")
+}
+
+func handleAccessCLI(command string, args []string) {
+	if len(args) < 2 {
+		printAccessUsage(command)
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	opts, targets, err := parseAccessArgs(args[2:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if !validAccessAction(command, args[1], targets) {
+		printAccessUsage(command)
+		return
+	}
+	if err := accessServerCommand(server, command, args[1], targets, opts); err != nil {
+		fmt.Println("操作失败:", err)
+	}
+}
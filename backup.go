@@ -0,0 +1,866 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BACKUPS_DIR         = "backups"
+	BACKUP_ARCHIVES_DIR = "archives"
+	BACKUP_FORMAT_TARGZ = "tar.gz"
+	BACKUP_FORMAT_ZIP   = "zip"
+	BACKUP_STAMP        = "20060102-150405"
+	SAVE_OFF_TIMEOUT    = 30 * time.Second
+	SAVE_FLUSH_TIMEOUT  = 2 * time.Minute
+	SCHEDULER_TICK      = time.Minute
+
+	DEFAULT_KEEP_LAST   = 5
+	DEFAULT_KEEP_DAILY  = 7
+	DEFAULT_KEEP_WEEKLY = 4
+)
+
+var (
+	defaultBackupExcludes = []string{
+		"logs/", "crash-reports/", "cache/", "libraries/", "versions/", ".fabric/",
+		"session.lock", "*.log", "*.log.gz", "*.tmp", "hs_err_pid*.log",
+	}
+	saveOffRe    = regexp.MustCompile(`(?i)(automatic saving is now disabled|saving is already turned off|saving is now disabled)`)
+	saveFlushRe  = regexp.MustCompile(`(?i)saved the (game|world)`)
+	backupNameRe = regexp.MustCompile(`^(\d{8}-\d{6})\.(tar\.gz|zip|dedup)$`)
+)
+
+type BackupConfig struct {
+	Format       string   `json:"format"`
+	Excludes     []string `json:"excludes"`
+	Schedule     string   `json:"schedule,omitempty"`
+	KeepLast     int      `json:"keep_last"`
+	KeepDaily    int      `json:"keep_daily"`
+	KeepWeekly   int      `json:"keep_weekly"`
+	LastBackupAt string   `json:"last_backup_at,omitempty"`
+	Targets      []string `json:"targets,omitempty"`
+}
+
+// backupSnapshot 是一个备份: 完整的压缩包，或去重仓库中的一个快照 (Size 为该快照新增的数据量)
+type backupSnapshot struct {
+	Name   string
+	Path   string
+	Time   time.Time
+	Size   int64
+	Format string
+}
+
+func getBackupConfig(server *ServerInstance) *BackupConfig {
+	if server.Backup == nil {
+		server.Backup = &BackupConfig{
+			Format:     BACKUP_FORMAT_TARGZ,
+			Excludes:   append([]string{}, defaultBackupExcludes...),
+			KeepLast:   DEFAULT_KEEP_LAST,
+			KeepDaily:  DEFAULT_KEEP_DAILY,
+			KeepWeekly: DEFAULT_KEEP_WEEKLY,
+		}
+	}
+	if server.Backup.Format == "" {
+		server.Backup.Format = BACKUP_FORMAT_TARGZ
+	}
+	return server.Backup
+}
+
+func backupDir(serverID string) string {
+	return filepath.Join(CACHE_DIR, BACKUPS_DIR, serverID)
+}
+
+func backupArchiveDir(serverID string) string {
+	return filepath.Join(backupDir(serverID), BACKUP_ARCHIVES_DIR)
+}
+
+func backupTargetDir(serverID, format string) string {
+	if format == BACKUP_FORMAT_DEDUP {
+		return dedupSnapshotsDir(serverID)
+	}
+	return backupArchiveDir(serverID)
+}
+
+// listBackups 按时间从旧到新返回实例的所有备份，包括压缩包和去重快照
+func listBackups(serverID string) []backupSnapshot {
+	var snapshots []backupSnapshot
+	for _, dir := range []string{backupArchiveDir(serverID), dedupSnapshotsDir(serverID)} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			m := backupNameRe.FindStringSubmatch(entry.Name())
+			if m == nil || entry.IsDir() {
+				continue
+			}
+			t, err := time.ParseInLocation(BACKUP_STAMP, m[1], time.Local)
+			if err != nil {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			snapshot := backupSnapshot{
+				Name:   entry.Name(),
+				Path:   filepath.Join(dir, entry.Name()),
+				Time:   t,
+				Size:   info.Size(),
+				Format: m[2],
+			}
+			if snapshot.Format == BACKUP_FORMAT_DEDUP {
+				_, snapshot.Size = dedupSnapshotSizes(snapshot.Path)
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	return snapshots
+}
+
+// matchExclude 判断相对路径是否被排除: 含 / 的规则匹配完整路径，否则匹配任意一级名称，以 / 结尾的规则只匹配目录
+func matchExclude(rel string, isDir bool, patterns []string) bool {
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		p := strings.TrimSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+		if strings.Contains(p, "/") {
+			if ok, _ := path.Match(strings.TrimPrefix(p, "/"), rel); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walkBackupFiles 遍历实例目录中需要备份的文件，跳过排除项和 EMCM 自身的数据目录
+func walkBackupFiles(root string, excludes []string, fn func(rel, full string, info fs.FileInfo) error) error {
+	absCache, _ := filepath.Abs(CACHE_DIR)
+
+	return filepath.WalkDir(root, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Printf("\033[33m跳过 %s: %v\033[0m\n", full, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if full == root {
+			return nil
+		}
+
+		if abs, _ := filepath.Abs(full); abs == absCache {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, full)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(rel, RESTORE_ASIDE_PREFIX) || matchExclude(rel, d.IsDir(), excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		return fn(rel, full, info)
+	})
+}
+
+type archiveStats struct {
+	Files int
+	Bytes int64
+}
+
+func writeTarGzArchive(root, dst string, excludes []string) (archiveStats, error) {
+	var stats archiveStats
+	file, err := os.Create(dst)
+	if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	err = walkBackupFiles(root, excludes, func(rel, full string, info fs.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+			return tw.WriteHeader(header)
+		}
+
+		src, err := os.Open(full)
+		if err != nil {
+			fmt.Printf("\033[33m跳过 %s: %v\033[0m\n", rel, err)
+			return nil
+		}
+		defer src.Close()
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		n, err := io.CopyN(tw, src, header.Size)
+		if err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", rel, err)
+		}
+		stats.Files++
+		stats.Bytes += n
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	if err := tw.Close(); err != nil {
+		return stats, err
+	}
+	if err := gz.Close(); err != nil {
+		return stats, err
+	}
+	return stats, file.Close()
+}
+
+func writeZipArchive(root, dst string, excludes []string) (archiveStats, error) {
+	var stats archiveStats
+	file, err := os.Create(dst)
+	if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	err = walkBackupFiles(root, excludes, func(rel, full string, info fs.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+			_, err := zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+
+		src, err := os.Open(full)
+		if err != nil {
+			fmt.Printf("\033[33m跳过 %s: %v\033[0m\n", rel, err)
+			return nil
+		}
+		defer src.Close()
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(w, src)
+		if err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", rel, err)
+		}
+		stats.Files++
+		stats.Bytes += n
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	if err := zw.Close(); err != nil {
+		return stats, err
+	}
+	return stats, file.Close()
+}
+
+// withSavingPaused 在服务器运行时暂停自动保存并刷新存档，执行 fn 后恢复自动保存
+func withSavingPaused(server *ServerInstance, force bool, fn func() error) error {
+	if !isServerRunning(server.ID) {
+		return fn()
+	}
+
+	fmt.Println("服务器运行中，暂停自动保存...")
+	if _, err := consoleCommand(server.ID, "save-off", saveOffRe, SAVE_OFF_TIMEOUT); err != nil {
+		if !force {
+			return fmt.Errorf("无法暂停自动保存: %v (使用 --force 强制备份，存档可能不一致)", err)
+		}
+		fmt.Printf("\033[33m无法暂停自动保存: %v，继续备份\033[0m\n", err)
+		return fn()
+	}
+	defer func() {
+		if _, err := consoleCommand(server.ID, "save-on", nil, SAVE_OFF_TIMEOUT); err != nil {
+			fmt.Printf("\033[31m恢复自动保存失败: %v，请手动执行 save-on\033[0m\n", err)
+		} else {
+			fmt.Println("已恢复自动保存")
+		}
+	}()
+
+	fmt.Println("正在保存世界...")
+	if _, err := consoleCommand(server.ID, "save-all flush", saveFlushRe, SAVE_FLUSH_TIMEOUT); err != nil {
+		if !force {
+			return fmt.Errorf("保存世界失败: %v", err)
+		}
+		fmt.Printf("\033[33m保存世界失败: %v，继续备份\033[0m\n", err)
+	}
+	return fn()
+}
+
+func createBackup(server *ServerInstance, format string, force bool) (*backupSnapshot, error) {
+	cfg := getBackupConfig(server)
+	if format == "" {
+		format = cfg.Format
+	}
+	if !validBackupFormat(format) {
+		return nil, fmt.Errorf("不支持的备份格式: %s", format)
+	}
+
+	root := serverDir(server)
+	if _, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("实例目录不存在: %s", root)
+	}
+	if err := os.MkdirAll(backupTargetDir(server.ID, format), 0755); err != nil {
+		return nil, err
+	}
+
+	// 同一秒内的多次备份顺延时间戳，避免覆盖
+	now := time.Now()
+	name := now.Format(BACKUP_STAMP) + "." + format
+	for existsBackupStamp(server.ID, now) {
+		now = now.Add(time.Second)
+		name = now.Format(BACKUP_STAMP) + "." + format
+	}
+	dst := filepath.Join(backupTargetDir(server.ID, format), name)
+	partial := dst + ".partial"
+
+	var stats archiveStats
+	err := withSavingPaused(server, force, func() error {
+		fmt.Printf("正在备份 %s -> %s\n", root, dst)
+		var err error
+		switch format {
+		case BACKUP_FORMAT_ZIP:
+			stats, err = writeZipArchive(root, partial, cfg.Excludes)
+		case BACKUP_FORMAT_DEDUP:
+			stats, err = writeDedupSnapshot(server.ID, root, dst, cfg.Excludes)
+		default:
+			stats, err = writeTarGzArchive(root, partial, cfg.Excludes)
+		}
+		return err
+	})
+	if err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	// 去重快照的清单已在仓库锁内改名
+	if format != BACKUP_FORMAT_DEDUP {
+		if err := os.Rename(partial, dst); err != nil {
+			os.Remove(partial)
+			return nil, err
+		}
+	}
+
+	info, _ := os.Stat(dst)
+	snapshot := &backupSnapshot{Name: name, Path: dst, Time: now, Format: format}
+	if format == BACKUP_FORMAT_DEDUP {
+		_, snapshot.Size = dedupSnapshotSizes(dst)
+	} else if info != nil {
+		snapshot.Size = info.Size()
+	}
+	fmt.Printf("\033[32m备份完成: %s (%d 个文件, %s -> %s)\033[0m\n",
+		name, stats.Files, formatBytes(stats.Bytes), formatBytes(snapshot.Size))
+
+	// 定时备份在后台 goroutine 中执行，需要在配置锁内修改
+	updateConfig(func() { cfg.LastBackupAt = now.Format(time.RFC3339) })
+	return snapshot, nil
+}
+
+func existsBackupStamp(serverID string, t time.Time) bool {
+	for _, dir := range []string{backupArchiveDir(serverID), dedupSnapshotsDir(serverID)} {
+		if matches, _ := filepath.Glob(filepath.Join(dir, t.Format(BACKUP_STAMP)+".*")); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func validBackupFormat(format string) bool {
+	return format == BACKUP_FORMAT_TARGZ || format == BACKUP_FORMAT_ZIP || format == BACKUP_FORMAT_DEDUP
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// retainedBackups 按保留策略选出需要保留的备份: 最近 N 个、最近若干天每天一个、最近若干周每周一个
+func retainedBackups(snapshots []backupSnapshot, keepLast, keepDaily, keepWeekly int) map[string]bool {
+	keep := make(map[string]bool)
+	newestFirst := append([]backupSnapshot{}, snapshots...)
+	sort.Slice(newestFirst, func(i, j int) bool { return newestFirst[i].Time.After(newestFirst[j].Time) })
+
+	if keepLast < 1 {
+		keepLast = 1
+	}
+	for i, s := range newestFirst {
+		if i < keepLast {
+			keep[s.Name] = true
+		}
+	}
+
+	days := make(map[string]bool)
+	for _, s := range newestFirst {
+		day := s.Time.Format("2006-01-02")
+		if len(days) >= keepDaily {
+			break
+		}
+		if !days[day] {
+			days[day] = true
+			keep[s.Name] = true
+		}
+	}
+
+	weeks := make(map[string]bool)
+	for _, s := range newestFirst {
+		year, week := s.Time.ISOWeek()
+		key := fmt.Sprintf("%d-%02d", year, week)
+		if len(weeks) >= keepWeekly {
+			break
+		}
+		if !weeks[key] {
+			weeks[key] = true
+			keep[s.Name] = true
+		}
+	}
+	return keep
+}
+
+// pruneBackups 按保留策略删除旧备份，删除去重快照后回收不再被引用的数据块
+func pruneBackups(server *ServerInstance, dryRun bool) []backupSnapshot {
+	cfg := getBackupConfig(server)
+	snapshots := listBackups(server.ID)
+	keep := retainedBackups(snapshots, cfg.KeepLast, cfg.KeepDaily, cfg.KeepWeekly)
+
+	var removed []backupSnapshot
+	dropped := make(map[string]bool)
+	for _, s := range snapshots {
+		if keep[s.Name] {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(s.Path); err != nil {
+				fmt.Printf("删除备份 %s 失败: %v\n", s.Name, err)
+				continue
+			}
+		}
+		removed = append(removed, s)
+		dropped[s.Name] = true
+	}
+
+	chunks, freed, err := gcBackupRepo(server.ID, dropped, dryRun)
+	if err != nil {
+		fmt.Printf("\033[33m回收数据块失败: %v\033[0m\n", err)
+	} else if chunks > 0 {
+		action := "回收了"
+		if dryRun {
+			action = "将回收"
+		}
+		fmt.Printf("%s %d 个未引用的数据块 (%s)\n", action, chunks, formatBytes(freed))
+	}
+	return removed
+}
+
+// parseScheduleInterval 解析备份计划: 30m、6h、1d、daily、weekly，off 表示关闭
+func parseScheduleInterval(schedule string) (time.Duration, error) {
+	switch schedule {
+	case "", "off":
+		return 0, nil
+	case "hourly":
+		return time.Hour, nil
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	if strings.HasSuffix(schedule, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(schedule, "d"))
+		if err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(schedule)
+	if err != nil || d < time.Minute {
+		return 0, fmt.Errorf("无效的备份计划: %s (示例: 30m、6h、1d、daily)", schedule)
+	}
+	return d, nil
+}
+
+// runBackupScheduler 在服务器运行期间按计划自动备份并执行保留策略
+func runBackupScheduler(server *ServerInstance, stop <-chan struct{}) {
+	ticker := time.NewTicker(SCHEDULER_TICK)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		cfg := getBackupConfig(server)
+		interval, err := parseScheduleInterval(cfg.Schedule)
+		if err != nil || interval == 0 {
+			continue
+		}
+		if last, err := time.Parse(time.RFC3339, cfg.LastBackupAt); err == nil && time.Since(last) < interval {
+			continue
+		}
+
+		fmt.Printf("\033[36m[%s] 开始计划备份\033[0m\n", server.Name)
+		if _, err := createBackup(server, "", false); err != nil {
+			fmt.Printf("\033[31m[%s] 计划备份失败: %v\033[0m\n", server.Name, err)
+			continue
+		}
+		if removed := pruneBackups(server, false); len(removed) > 0 {
+			fmt.Printf("[%s] 按保留策略删除了 %d 个旧备份\n", server.Name, len(removed))
+		}
+		spawnBackgroundPush(server)
+	}
+}
+
+func printBackupUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm backup <服务器ID> [--format tar.gz|zip|dedup] [--force]  立即备份")
+	fmt.Println("  emcm backup format <服务器ID> <tar.gz|zip|dedup>         设置默认备份格式")
+	fmt.Println("  emcm backup schedule <服务器ID> <30m|6h|1d|daily|off>    设置备份计划")
+	fmt.Println("  emcm backup retention <服务器ID> [--last N] [--daily N] [--weekly N]  设置保留策略")
+	fmt.Println("  emcm backup exclude <服务器ID> [add|rm] [规则]         管理排除规则")
+	fmt.Println("  emcm backup prune <服务器ID> [--dry-run]               按保留策略清理旧备份并回收数据块")
+	fmt.Println("  emcm backup check <服务器ID> [--read-data]             校验备份完整性")
+	fmt.Println("  emcm backup stats <服务器ID>                           查看去重仓库统计")
+	fmt.Println("  emcm backup ls <服务器ID> [--target 目标]              列出本地或远程的备份")
+	fmt.Println("  emcm backup diff <服务器ID> <备份A> <备份B> [--all]     比较两个备份中变化的区域文件")
+	fmt.Println("  emcm backup target ...                                 管理异地备份目标 (local、s3、sftp)")
+	fmt.Println("  emcm backup push <服务器ID> [目标]                     上传尚未上传的备份并执行远程保留策略")
+	fmt.Println("  emcm backup pull <服务器ID> <目标> <备份|latest>        从目标下载备份到本地")
+	fmt.Println("  emcm restore <服务器ID> <备份> [--dimension 维度] [--player 玩家]  从备份恢复")
+}
+
+func requireServer(id string) (*ServerInstance, bool) {
+	server, ok := config.ServerInstalls[id]
+	if !ok {
+		fmt.Printf("找不到服务器实例: %s\n", id)
+	}
+	return server, ok
+}
+
+func handleBackupCLI(args []string) {
+	if len(args) < 1 {
+		printBackupUsage()
+		return
+	}
+
+	switch args[0] {
+	case "schedule":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		cfg := getBackupConfig(server)
+		if len(args) < 3 {
+			schedule := cfg.Schedule
+			if schedule == "" {
+				schedule = "off"
+			}
+			fmt.Printf("备份计划: %s\n上次备份: %s\n", schedule, cfg.LastBackupAt)
+			return
+		}
+		if _, err := parseScheduleInterval(args[2]); err != nil {
+			fmt.Println(err)
+			return
+		}
+		cfg.Schedule = args[2]
+		if args[2] == "off" {
+			cfg.Schedule = ""
+		}
+		saveConfig()
+		fmt.Printf("备份计划已设置为: %s (服务器运行期间生效)\n", args[2])
+
+	case "retention":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		cfg := getBackupConfig(server)
+		for i := 2; i+1 < len(args); i += 2 {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 {
+				fmt.Printf("无效的数量: %s\n", args[i+1])
+				return
+			}
+			switch args[i] {
+			case "--last":
+				cfg.KeepLast = n
+			case "--daily":
+				cfg.KeepDaily = n
+			case "--weekly":
+				cfg.KeepWeekly = n
+			default:
+				fmt.Println("未知参数:", args[i])
+				return
+			}
+		}
+		saveConfig()
+		fmt.Printf("保留策略: 最近 %d 个, 每天一个保留 %d 天, 每周一个保留 %d 周\n", cfg.KeepLast, cfg.KeepDaily, cfg.KeepWeekly)
+
+	case "format":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		cfg := getBackupConfig(server)
+		if len(args) >= 3 {
+			if !validBackupFormat(args[2]) {
+				fmt.Println("不支持的备份格式:", args[2])
+				return
+			}
+			cfg.Format = args[2]
+			saveConfig()
+		}
+		fmt.Println("默认备份格式:", cfg.Format)
+
+	case "check":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		readData := len(args) > 2 && args[2] == "--read-data"
+		if problems := checkBackupRepo(server, readData); problems > 0 {
+			fmt.Printf("\033[31m发现 %d 个问题\033[0m\n", problems)
+			os.Exit(1)
+		}
+
+	case "stats":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		if server, ok := requireServer(args[1]); ok {
+			if err := printBackupStats(server); err != nil {
+				fmt.Println("读取统计失败:", err)
+			}
+		}
+
+	case "exclude":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		cfg := getBackupConfig(server)
+		if len(args) >= 4 {
+			switch args[2] {
+			case "add":
+				cfg.Excludes = appendUnique(cfg.Excludes, args[3])
+			case "rm":
+				var kept []string
+				for _, e := range cfg.Excludes {
+					if e != args[3] {
+						kept = append(kept, e)
+					}
+				}
+				cfg.Excludes = kept
+			default:
+				printBackupUsage()
+				return
+			}
+			saveConfig()
+		}
+		fmt.Println("排除规则:")
+		for _, e := range cfg.Excludes {
+			fmt.Println("-", e)
+		}
+
+	case "ls":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		if len(args) > 3 && args[2] == "--target" {
+			if err := printRemoteBackupList(server, args[3]); err != nil {
+				fmt.Println("读取远程备份失败:", err)
+			}
+			return
+		}
+		printBackupList(server)
+
+	case "target":
+		handleTargetCLI(args[1:])
+
+	case "push":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		only := ""
+		if len(args) > 2 {
+			only = args[2]
+		}
+		if err := pushBackups(server, only); err != nil {
+			fmt.Println("上传失败:", err)
+			os.Exit(1)
+		}
+
+	case "pull":
+		if len(args) < 4 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		if err := pullBackup(server, args[2], args[3]); err != nil {
+			fmt.Println("下载失败:", err)
+			return
+		}
+		fmt.Println("\033[32m下载完成，可使用 emcm restore 恢复\033[0m")
+
+	case "diff":
+		if len(args) < 4 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		all := len(args) > 4 && args[4] == "--all"
+		if err := diffBackups(server, args[2], args[3], all); err != nil {
+			fmt.Println(err)
+		}
+
+	case "prune":
+		if len(args) < 2 {
+			printBackupUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		dryRun := len(args) > 2 && args[2] == "--dry-run"
+		removed := pruneBackups(server, dryRun)
+		if len(removed) == 0 {
+			fmt.Println("没有需要清理的备份")
+			return
+		}
+		action := "已删除"
+		if dryRun {
+			action = "将删除"
+		}
+		for _, s := range removed {
+			fmt.Printf("%s: %s (%s)\n", action, s.Name, formatBytes(s.Size))
+		}
+
+	default:
+		server, ok := requireServer(args[0])
+		if !ok {
+			return
+		}
+		format := ""
+		force := false
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--format":
+				if i+1 < len(args) {
+					i++
+					format = args[i]
+				}
+			case "--zip":
+				format = BACKUP_FORMAT_ZIP
+			case "--dedup":
+				format = BACKUP_FORMAT_DEDUP
+			case "--force":
+				force = true
+			default:
+				fmt.Println("未知参数:", args[i])
+				return
+			}
+		}
+
+		if _, err := createBackup(server, format, force); err != nil {
+			fmt.Println("备份失败:", err)
+			return
+		}
+		if removed := pruneBackups(server, false); len(removed) > 0 {
+			fmt.Printf("按保留策略删除了 %d 个旧备份\n", len(removed))
+		}
+		spawnBackgroundPush(server)
+	}
+}
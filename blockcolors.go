@@ -0,0 +1,176 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+)
+
+func rgb(hex uint32) color.NRGBA {
+	return color.NRGBA{uint8(hex >> 16), uint8(hex >> 8), uint8(hex), 255}
+}
+
+var (
+	waterColor   = rgb(0x3f76e4)
+	plantColor   = rgb(0x6a9e3a)
+	leavesColor  = rgb(0x48b518)
+	barkColor    = rgb(0x6b5133)
+	planksColor  = rgb(0xa88754)
+	stoneColor   = rgb(0x707070)
+	unknownColor = rgb(0x808080)
+)
+
+// blockColors 是常见方块在地图上的颜色 (不含命名空间)，参考原版地图颜色并按俯视效果调整
+var blockColors = map[string]color.NRGBA{
+	"grass_block":       rgb(0x7fb238),
+	"dirt":              rgb(0x976d4d),
+	"coarse_dirt":       rgb(0x8a6444),
+	"rooted_dirt":       rgb(0x90684a),
+	"podzol":            rgb(0x7a5a3a),
+	"mycelium":          rgb(0x6f6369),
+	"farmland":          rgb(0x8f6a43),
+	"dirt_path":         rgb(0x9b8451),
+	"grass_path":        rgb(0x9b8451),
+	"mud":               rgb(0x3c3837),
+	"moss_block":        rgb(0x596e2d),
+	"moss_carpet":       rgb(0x596e2d),
+	"sand":              rgb(0xdbcf9c),
+	"sandstone":         rgb(0xd8cb96),
+	"red_sand":          rgb(0xbe6621),
+	"red_sandstone":     rgb(0xb5621f),
+	"gravel":            rgb(0x8a8380),
+	"clay":              rgb(0xa4a8b8),
+	"granite":           rgb(0x9a6b57),
+	"diorite":           rgb(0xbdbdbd),
+	"calcite":           rgb(0xdfe0dc),
+	"tuff":              rgb(0x6b6b62),
+	"deepslate":         rgb(0x505050),
+	"bedrock":           rgb(0x565656),
+	"obsidian":          rgb(0x14121e),
+	"water":             waterColor,
+	"bubble_column":     waterColor,
+	"lava":              rgb(0xff5a00),
+	"magma_block":       rgb(0x8e3f1f),
+	"ice":               rgb(0xa0a0ff),
+	"packed_ice":        rgb(0x8db4fa),
+	"blue_ice":          rgb(0x74a8fd),
+	"snow":              rgb(0xf8fdfd),
+	"snow_block":        rgb(0xf8fdfd),
+	"powder_snow":       rgb(0xf8fdfd),
+	"spruce_leaves":     rgb(0x619961),
+	"birch_leaves":      rgb(0x80a755),
+	"cherry_leaves":     rgb(0xf4b8d0),
+	"azalea_leaves":     rgb(0x5a7a2a),
+	"lily_pad":          rgb(0x208030),
+	"sugar_cane":        rgb(0x94c065),
+	"cactus":            rgb(0x5b7f2a),
+	"pumpkin":           rgb(0xc67a1c),
+	"melon":             rgb(0x6f9a25),
+	"hay_block":         rgb(0xb5970f),
+	"bricks":            rgb(0x96604f),
+	"terracotta":        rgb(0x985e43),
+	"glass":             rgb(0xc0e0e8),
+	"netherrack":        rgb(0x6f3634),
+	"nether_bricks":     rgb(0x2c161a),
+	"soul_sand":         rgb(0x51402f),
+	"soul_soil":         rgb(0x4b3a2c),
+	"basalt":            rgb(0x4e4d53),
+	"blackstone":        rgb(0x2a2328),
+	"crimson_nylium":    rgb(0x942b2b),
+	"warped_nylium":     rgb(0x2b7265),
+	"nether_wart_block": rgb(0x730b0b),
+	"warped_wart_block": rgb(0x167e86),
+	"glowstone":         rgb(0xf8d68a),
+	"shroomlight":       rgb(0xf09a4a),
+	"end_stone":         rgb(0xdbde9e),
+	"end_stone_bricks":  rgb(0xdbde9e),
+	"purpur_block":      rgb(0xa97ea9),
+	"chorus_plant":      rgb(0x5e3b5e),
+	"chorus_flower":     rgb(0x8f6f8f),
+	"poppy":             rgb(0xb02e26),
+	"dandelion":         rgb(0xfed83d),
+}
+
+// dyeColors 按名称前缀匹配染色方块 (羊毛、混凝土、陶瓦等)，较长的前缀在前
+var dyeColors = []struct {
+	prefix string
+	color  color.NRGBA
+}{
+	{"light_blue_", rgb(0x3ab3da)},
+	{"light_gray_", rgb(0x9d9d97)},
+	{"white_", rgb(0xf9fffe)},
+	{"orange_", rgb(0xf9801d)},
+	{"magenta_", rgb(0xc74ebd)},
+	{"yellow_", rgb(0xfed83d)},
+	{"lime_", rgb(0x80c71f)},
+	{"pink_", rgb(0xf38baa)},
+	{"gray_", rgb(0x474f52)},
+	{"cyan_", rgb(0x169c9c)},
+	{"purple_", rgb(0x8932b8)},
+	{"blue_", rgb(0x3c44aa)},
+	{"brown_", rgb(0x835432)},
+	{"green_", rgb(0x5e7c16)},
+	{"red_", rgb(0xb02e26)},
+	{"black_", rgb(0x1d1d21)},
+}
+
+// blockColor 返回方块的地图颜色，未收录的方块 (包括模组方块) 按名称推断
+func blockColor(name string) color.NRGBA {
+	if _, path, ok := strings.Cut(name, ":"); ok {
+		name = path
+	}
+	if c, ok := blockColors[name]; ok {
+		return c
+	}
+	// blue_ice 等已在表中，这里只处理染色方块
+	for _, dye := range dyeColors {
+		if strings.HasPrefix(name, dye.prefix) {
+			return dye.color
+		}
+	}
+
+	contains := func(parts ...string) bool {
+		for _, part := range parts {
+			if strings.Contains(name, part) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case contains("water", "kelp", "seagrass", "coral"):
+		return waterColor
+	case contains("lava"):
+		return blockColors["lava"]
+	case contains("ice"):
+		return blockColors["ice"]
+	case contains("snow"):
+		return blockColors["snow"]
+	case contains("leaves"):
+		return leavesColor
+	case contains("log", "_wood", "stem", "hyphae"):
+		return barkColor
+	case contains("sand"):
+		return blockColors["sand"]
+	case contains("stone", "cobble", "brick", "deepslate", "andesite", "ore", "tile"):
+		return stoneColor
+	case contains("planks", "slab", "stairs", "fence", "door", "sign", "chest", "barrel", "crafting"):
+		return planksColor
+	case contains("grass", "fern", "flower", "tulip", "orchid", "allium", "bluet", "daisy", "bush", "vine", "sapling", "roots", "crop", "wheat", "carrots", "potatoes", "beetroots"):
+		return plantColor
+	case contains("dirt", "mud"):
+		return blockColors["dirt"]
+	}
+	return unknownColor
+}
+
+func isAirBlock(name string) bool {
+	switch name {
+	case "", "minecraft:air", "minecraft:cave_air", "minecraft:void_air", "air", "cave_air", "void_air":
+		return true
+	}
+	return false
+}
+
+func isWaterBlock(name string) bool {
+	return blockColor(name) == waterColor
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LOGS_DIR           = "logs"
+	RAW_LOG_NAME       = "console"
+	TRANSLATED_LOG     = "translated"
+	LOG_TIME_LAYOUT    = "2006-01-02 15:04:05"
+	DEFAULT_LOG_SIZE   = 10 // MB
+	DEFAULT_LOG_HOURS  = 24
+	DEFAULT_LOG_KEEP   = 30
+	LOG_FOLLOW_TICK    = 500 * time.Millisecond
+	ARCHIVE_NAME_STAMP = "20060102-150405"
+)
+
+var (
+	emcmLogLineRe   = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\] `)
+	serverLogTimeRe = regexp.MustCompile(`^\[(?:[A-Za-z]{3} )?(\d{2}:\d{2}:\d{2})`)
+	serverLogDateRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-\d+\.log\.gz$`)
+)
+
+// rotatingLog 按大小和时间滚动的日志文件，旧文件会被压缩为 .log.gz
+type rotatingLog struct {
+	dir      string
+	name     string
+	maxSize  int64
+	maxAge   time.Duration
+	keep     int
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	mu       sync.Mutex
+	gzipWg   sync.WaitGroup
+}
+
+func logMaxSize() int64 {
+	size := config.LogMaxSizeMB
+	if size <= 0 {
+		size = DEFAULT_LOG_SIZE
+	}
+	return int64(size) * 1024 * 1024
+}
+
+func logRotateInterval() time.Duration {
+	hours := config.LogRotateHours
+	if hours <= 0 {
+		hours = DEFAULT_LOG_HOURS
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func logKeepFiles() int {
+	if config.LogKeepFiles <= 0 {
+		return DEFAULT_LOG_KEEP
+	}
+	return config.LogKeepFiles
+}
+
+func serverLogDir(serverID string) string {
+	return filepath.Join(CACHE_DIR, LOGS_DIR, serverID)
+}
+
+func newRotatingLog(dir, name string) (*rotatingLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &rotatingLog{
+		dir:     dir,
+		name:    name,
+		maxSize: logMaxSize(),
+		maxAge:  logRotateInterval(),
+		keep:    logKeepFiles(),
+	}
+
+	// 上次遗留的日志已超出限制时先滚动
+	if info, err := os.Stat(l.currentPath()); err == nil {
+		if info.Size() >= l.maxSize || time.Since(l.segmentStart(info)) >= l.maxAge {
+			l.archive(info.ModTime())
+		}
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *rotatingLog) currentPath() string {
+	return filepath.Join(l.dir, l.name+".log")
+}
+
+func (l *rotatingLog) open() error {
+	file, err := os.OpenFile(l.currentPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	l.openedAt = time.Now()
+	if l.size > 0 {
+		l.openedAt = l.segmentStart(info)
+	}
+	return nil
+}
+
+// segmentStart 返回当前日志文件开始记录的时间，即第一行的时间。
+// 多次启动会追加到同一个文件，修改时间不能代表开始时间
+func (l *rotatingLog) segmentStart(info os.FileInfo) time.Time {
+	if start, ok := firstLogTime(l.currentPath(), time.Time{}); ok {
+		return start
+	}
+	return info.ModTime()
+}
+
+// archive 把当前日志改名并在后台压缩
+func (l *rotatingLog) archive(stamp time.Time) {
+	archived := filepath.Join(l.dir, fmt.Sprintf("%s-%s.log", l.name, stamp.Format(ARCHIVE_NAME_STAMP)))
+	if err := os.Rename(l.currentPath(), archived); err != nil {
+		return
+	}
+
+	l.gzipWg.Add(1)
+	go func() {
+		defer l.gzipWg.Done()
+		if err := gzipFile(archived); err != nil {
+			fmt.Printf("压缩日志失败: %v\n", err)
+			return
+		}
+		l.prune()
+	}()
+}
+
+func (l *rotatingLog) rotate() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	l.archive(time.Now())
+	if err := l.open(); err != nil {
+		fmt.Printf("打开日志文件失败: %v\n", err)
+	}
+}
+
+func (l *rotatingLog) prune() {
+	archives := listLogArchives(l.dir, l.name)
+	for len(archives) > l.keep {
+		os.Remove(archives[0])
+		archives = archives[1:]
+	}
+}
+
+func (l *rotatingLog) writeLine(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil && (l.size >= l.maxSize || time.Since(l.openedAt) >= l.maxAge) {
+		l.rotate()
+	}
+	if l.file == nil {
+		return
+	}
+
+	entry := fmt.Sprintf("[%s] %s\n", time.Now().Format(LOG_TIME_LAYOUT), line)
+	n, _ := l.file.WriteString(entry)
+	l.size += int64(n)
+}
+
+func (l *rotatingLog) close() {
+	l.mu.Lock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	l.mu.Unlock()
+	l.gzipWg.Wait()
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+func listLogArchives(dir, name string) []string {
+	matches, _ := filepath.Glob(filepath.Join(dir, name+"-*.log.gz"))
+	sort.Strings(matches)
+	return matches
+}
+
+// consoleLogger 同时记录原始输出和翻译后的输出
+type consoleLogger struct {
+	raw        *rotatingLog
+	translated *rotatingLog
+}
+
+func newConsoleLogger(serverID string) *consoleLogger {
+	dir := serverLogDir(serverID)
+	c := &consoleLogger{}
+	var err error
+	if c.raw, err = newRotatingLog(dir, RAW_LOG_NAME); err != nil {
+		fmt.Printf("创建控制台日志失败: %v\n", err)
+	}
+	if c.translated, err = newRotatingLog(dir, TRANSLATED_LOG); err != nil {
+		fmt.Printf("创建翻译日志失败: %v\n", err)
+	}
+	return c
+}
+
+func (c *consoleLogger) write(raw, translated string) {
+	if c.raw != nil {
+		c.raw.writeLine(raw)
+	}
+	if c.translated != nil {
+		c.translated.writeLine(translated)
+	}
+}
+
+func (c *consoleLogger) close() {
+	if c.raw != nil {
+		c.raw.close()
+	}
+	if c.translated != nil {
+		c.translated.close()
+	}
+}
+
+// parseSince 支持 2h、30m、3d 这样的相对时间和 2006-01-02[ 15:04] 这样的绝对时间
+func parseSince(value string) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间: %s", value)
+}
+
+type logFilter struct {
+	since time.Time
+	grep  *regexp.Regexp
+	// afterSince 表示上一条带时间的行不早于 since，没有时间的行 (如异常堆栈) 随它一起保留或丢弃
+	afterSince bool
+}
+
+func newLogFilter() *logFilter {
+	return &logFilter{afterSince: true}
+}
+
+// match 判断一行日志是否满足条件，date 为服务端日志所在日期(仅服务端日志需要)
+func (f *logFilter) match(line string, date time.Time) bool {
+	if ts, ok := logLineTime(line, date); ok {
+		f.afterSince = !ts.Before(f.since)
+	}
+	if !f.afterSince {
+		return false
+	}
+	if f.grep != nil && !f.grep.MatchString(line) {
+		return false
+	}
+	return true
+}
+
+func logLineTime(line string, date time.Time) (time.Time, bool) {
+	if m := emcmLogLineRe.FindStringSubmatch(line); m != nil {
+		t, err := time.ParseInLocation(LOG_TIME_LAYOUT, m[1], time.Local)
+		return t, err == nil
+	}
+	if date.IsZero() {
+		return time.Time{}, false
+	}
+	if m := serverLogTimeRe.FindStringSubmatch(line); m != nil {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", date.Format("2006-01-02")+" "+m[1], time.Local)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+type logSource struct {
+	path string
+	date time.Time
+	// server 不为空时表示服务端自身的日志，查看翻译日志时按该实例的字典翻译
+	server *ServerInstance
+	// until 不为零时只显示这之前的行
+	until time.Time
+}
+
+// firstLogTime 返回日志中第一条带时间的行的时间，没有时返回 false
+func firstLogTime(path string, date time.Time) (time.Time, bool) {
+	reader, err := openLogFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if t, ok := logLineTime(scanner.Text(), date); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sortLogSources 按每个日志开始的时间排序，无法判断时使用文件修改时间
+func sortLogSources(sources []logSource) {
+	starts := make(map[string]time.Time, len(sources))
+	for _, source := range sources {
+		start, ok := firstLogTime(source.path, source.date)
+		if !ok {
+			if info, err := os.Stat(source.path); err == nil {
+				start = info.ModTime()
+			}
+		}
+		starts[source.path] = start
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		return starts[sources[i].path].Before(starts[sources[j].path])
+	})
+}
+
+func emcmLogSources(serverID, name string) []logSource {
+	dir := serverLogDir(serverID)
+	var sources []logSource
+	for _, path := range listLogArchives(dir, name) {
+		sources = append(sources, logSource{path: path})
+	}
+	current := filepath.Join(dir, name+".log")
+	if _, err := os.Stat(current); err == nil {
+		sources = append(sources, logSource{path: current})
+	}
+	return sources
+}
+
+// serverLogArchives 返回服务端 logs/ 目录中的 .log.gz 归档
+func serverLogArchives(server *ServerInstance) []logSource {
+	archives, _ := filepath.Glob(filepath.Join(serverDir(server), "logs", "*.log.gz"))
+	sort.Strings(archives)
+	var sources []logSource
+	for _, path := range archives {
+		source := logSource{path: path, server: server}
+		if m := serverLogDateRe.FindStringSubmatch(filepath.Base(path)); m != nil {
+			source.date, _ = time.ParseInLocation("2006-01-02", m[1], time.Local)
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+func serverOwnLogSources(server *ServerInstance) []logSource {
+	sources := serverLogArchives(server)
+	latest := filepath.Join(serverDir(server), "logs", "latest.log")
+	if info, err := os.Stat(latest); err == nil {
+		sources = append(sources, logSource{path: latest, date: info.ModTime(), server: server})
+	}
+	return sources
+}
+
+func printLogSource(source logSource, filter *logFilter, translated bool) int64 {
+	reader, err := openLogFile(source.path)
+	if err != nil {
+		fmt.Printf("读取日志失败 %s: %v\n", source.path, err)
+		return 0
+	}
+	defer reader.Close()
+
+	var offset int64
+	beforeUntil := true
+	r := bufio.NewReader(reader)
+	for {
+		line, err := r.ReadString('\n')
+		if len(line) > 0 && (err == nil || err == io.EOF) {
+			offset += int64(len(line))
+			trimmed := strings.TrimRight(line, "\r\n")
+			if !source.until.IsZero() {
+				if ts, ok := logLineTime(trimmed, source.date); ok {
+					beforeUntil = ts.Before(source.until)
+				}
+				if !beforeUntil {
+					continue
+				}
+			}
+			if translated && source.server != nil {
+				trimmed = translateLog(source.server, trimmed)
+			}
+			if filter.match(trimmed, source.date) {
+				fmt.Println(trimmed)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return offset
+}
+
+// followLog 持续输出日志新增内容，检测到文件被滚动后从头读取新文件
+func followLog(path string, offset int64, filter *logFilter) {
+	var date time.Time
+	var pending string
+	for {
+		time.Sleep(LOG_FOLLOW_TICK)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.Size() < offset {
+			offset = 0
+			pending = ""
+		}
+		if info.Size() == offset {
+			continue
+		}
+		if filepath.Base(path) == "latest.log" {
+			date = time.Now()
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		file.Seek(offset, io.SeekStart)
+		data, _ := io.ReadAll(file)
+		file.Close()
+		offset += int64(len(data))
+
+		chunk := pending + string(data)
+		lines := strings.Split(chunk, "\n")
+		pending = lines[len(lines)-1]
+		for _, line := range lines[:len(lines)-1] {
+			line = strings.TrimRight(line, "\r")
+			if filter.match(line, date) {
+				fmt.Println(line)
+			}
+		}
+	}
+}
+
+func handleLogsCLI(args []string) {
+	if len(args) < 1 {
+		fmt.Println("用法: emcm logs <服务器ID> [-f] [--since 2h] [--grep 正则] [--translated] [--server]")
+		fmt.Println("  -f            持续跟踪最新日志")
+		fmt.Println("  --since       只显示指定时间之后的日志 (如 30m、2h、3d、2006-01-02)")
+		fmt.Println("  --grep        按正则表达式过滤")
+		fmt.Println("  --translated  查看翻译后的控制台日志")
+		fmt.Println("  --server      只查看服务端自身的 logs/ 目录 (含 latest.log)")
+		fmt.Println("默认显示 EMCM 记录的控制台日志，EMCM 开始记录之前的部分来自服务端 logs/ 目录中的 .log.gz 归档")
+		return
+	}
+
+	serverID := args[0]
+	server, ok := config.ServerInstalls[serverID]
+	if !ok {
+		fmt.Printf("找不到服务器实例: %s\n", serverID)
+		return
+	}
+
+	follow := false
+	name := RAW_LOG_NAME
+	useServerLogs := false
+	filter := newLogFilter()
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "--follow":
+			follow = true
+		case "--translated":
+			name = TRANSLATED_LOG
+		case "--server":
+			useServerLogs = true
+		case "--since":
+			if i+1 >= len(args) {
+				fmt.Println("--since 需要一个时间参数")
+				return
+			}
+			i++
+			since, err := parseSince(args[i])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			filter.since = since
+			filter.afterSince = false
+		case "--grep":
+			if i+1 >= len(args) {
+				fmt.Println("--grep 需要一个正则表达式")
+				return
+			}
+			i++
+			re, err := regexp.Compile(args[i])
+			if err != nil {
+				fmt.Println("正则表达式无效:", err)
+				return
+			}
+			filter.grep = re
+		default:
+			fmt.Println("未知参数:", args[i])
+			return
+		}
+	}
+
+	var sources []logSource
+	livePath := filepath.Join(serverLogDir(serverID), name+".log")
+	if useServerLogs {
+		sources = serverOwnLogSources(server)
+		livePath = filepath.Join(serverDir(server), "logs", "latest.log")
+	} else {
+		// 服务端的日志和 EMCM 记录的内容相同，只用来补充 EMCM 开始记录之前的部分
+		sources = emcmLogSources(serverID, name)
+		var until time.Time
+		if len(sources) > 0 {
+			if first, ok := firstLogTime(sources[0].path, time.Time{}); ok {
+				until = first
+			}
+		}
+		for _, source := range serverLogArchives(server) {
+			source.until = until
+			sources = append(sources, source)
+		}
+		sortLogSources(sources)
+	}
+
+	if len(sources) == 0 && !follow {
+		fmt.Println("暂无日志")
+		return
+	}
+
+	var offset int64
+	for _, source := range sources {
+		n := printLogSource(source, filter, name == TRANSLATED_LOG)
+		if source.path == livePath {
+			offset = n
+		}
+	}
+
+	if follow {
+		fmt.Printf("\033[36m--- 正在跟踪 %s (Ctrl+C 退出) ---\033[0m\n", livePath)
+		followLog(livePath, offset, filter)
+	}
+}
@@ -0,0 +1,688 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CRASH_REPORTS_DIR = "crash-reports"
+	CRASH_TAIL_LINES  = 300
+	CRASH_STACK_LINES = 8
+	CRASH_KIND_REPORT = "crash-report"
+	CRASH_KIND_HSERR  = "hs_err"
+	CRASH_KIND_LOG    = "console"
+)
+
+// 堆栈中属于游戏本体、服务端或 JDK 的包，不作为可疑模组/插件
+var knownPackagePrefixes = []string{
+	"java.", "javax.", "jdk.", "sun.", "com.sun.", "net.minecraft.", "com.mojang.",
+	"org.bukkit.", "org.spigotmc.", "io.papermc.", "com.destroystokyo.", "net.md_5.",
+	"net.minecraftforge.", "net.neoforged.", "net.fabricmc.", "org.quiltmc.", "cpw.mods.",
+	"org.spongepowered.", "io.netty.", "com.google.", "org.apache.", "it.unimi.",
+	"org.objectweb.", "org.slf4j.", "org.jline.", "joptsimple.", "oshi.", "com.electronwill.",
+	"io.izzel.arclight.", "catserver.", "com.velocitypowered.", "org.eclipse.", "kotlin.",
+}
+
+var (
+	crashDescRe      = regexp.MustCompile(`^Description: (.*)$`)
+	crashTimeRe      = regexp.MustCompile(`^Time: (.*)$`)
+	crashDetailRe    = regexp.MustCompile(`^\t([^:\t]+): (.*)$`)
+	stackFrameRe     = regexp.MustCompile(`^\s+at (?:[\w.$-]+/)*([\w$]+(?:\.[\w$]+)+)\.[\w$<>]+\(`)
+	hsErrSignalRe    = regexp.MustCompile(`^#\s+(SIG\w+|EXCEPTION_\w+) .*`)
+	hsErrJreRe       = regexp.MustCompile(`^# JRE version: (.*)$`)
+	hsErrVMRe        = regexp.MustCompile(`^# Java VM: (.*)$`)
+	hsErrFrameRe     = regexp.MustCompile(`^# (?:[CJVj] )\s*(.*)$`)
+	hsErrArgsRe      = regexp.MustCompile(`^jvm_args: (.*)$`)
+	hsErrOSRe        = regexp.MustCompile(`^OS:\s*(.*)$`)
+	hsErrMemoryRe    = regexp.MustCompile(`^# (There is insufficient memory.*|Native memory allocation.*|Out of Memory Error.*)$`)
+	classVersionRe   = regexp.MustCompile(`class file version (\d+)\.\d+\), this version of the Java Runtime only recognizes class file versions up to (\d+)`)
+	classVersionAlt  = regexp.MustCompile(`Unsupported class file major version (\d+)`)
+	suspectedModEnRe = regexp.MustCompile(`^\s*(.+?) \(([\w-]+)\)\s*$`)
+)
+
+type CrashReport struct {
+	Path          string
+	Kind          string
+	Time          time.Time
+	Description   string
+	Exception     string
+	Stack         []string
+	SuspectedMods []string
+	Details       map[string]string
+	Causes        []crashCause
+	text          string
+}
+
+type crashCause struct {
+	Title string
+	Hint  string
+}
+
+// crashRule 是已知崩溃原因规则，命中后用 explain 生成说明
+type crashRule struct {
+	Title   string
+	Pattern *regexp.Regexp
+	explain func(m []string, r *CrashReport) crashCause
+}
+
+var crashRules = []crashRule{
+	{
+		Title:   "Java 版本过低",
+		Pattern: classVersionRe,
+		explain: func(m []string, r *CrashReport) crashCause {
+			need, _ := strconv.Atoi(m[1])
+			have, _ := strconv.Atoi(m[2])
+			return crashCause{
+				Title: "Java 版本过低",
+				Hint:  fmt.Sprintf("服务端需要 Java %d，但当前运行的是 Java %d。请使用 'emcm java add %d <路径>' 添加对应版本，并在实例管理中切换 Java。", need-44, have-44, need-44),
+			}
+		},
+	},
+	{
+		Title:   "Java 版本不受支持",
+		Pattern: classVersionAlt,
+		explain: func(m []string, r *CrashReport) crashCause {
+			ver, _ := strconv.Atoi(m[1])
+			return crashCause{
+				Title: "Java 版本过高",
+				Hint:  fmt.Sprintf("当前 Java %d 对该服务端/模组加载器来说太新了，请换用 MC 版本推荐的 Java。", ver-44),
+			}
+		},
+	},
+	{
+		Title:   "内存不足 (堆内存)",
+		Pattern: regexp.MustCompile(`java\.lang\.OutOfMemoryError: (Java heap space|GC overhead limit exceeded|Metaspace)`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			return crashCause{
+				Title: "内存不足: " + m[1],
+				Hint:  "分配给服务器的内存不够。请在实例管理中调大内存，或减少模组/插件、降低视距。",
+			}
+		},
+	},
+	{
+		Title:   "内存不足 (系统内存)",
+		Pattern: regexp.MustCompile(`There is insufficient memory for the Java Runtime Environment|Native memory allocation \(\w+\) failed|unable to create (?:new )?native thread`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			return crashCause{
+				Title: "系统内存不足",
+				Hint:  "主机剩余内存不足以满足 JVM 申请。请关闭其他程序、调小 -Xmx，或增加交换空间。",
+			}
+		},
+	},
+	{
+		Title:   "服务端安装了仅客户端模组",
+		Pattern: regexp.MustCompile(`invalid dist DEDICATED_SERVER|net[/.]minecraft[/.]client[/.]|Environment type CLIENT|onlyIn\(Dist\.CLIENT\)`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			hint := "有模组只能在客户端运行 (如光影、小地图、界面类模组)，请把它从 mods/ 中移除。"
+			if len(r.SuspectedMods) > 0 {
+				hint += " 可疑模组: " + strings.Join(r.SuspectedMods, ", ")
+			}
+			return crashCause{Title: "服务端安装了仅客户端模组", Hint: hint}
+		},
+	},
+	{
+		Title:   "端口被占用",
+		Pattern: regexp.MustCompile(`FAILED TO BIND TO PORT|java\.net\.BindException: Address already in use|Perhaps a server is already running on that port`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			return crashCause{
+				Title: "端口被占用",
+				Hint:  "server.properties 中的端口已被其他程序或另一个服务器实例占用。请关闭占用端口的程序，或修改 server-port。",
+			}
+		},
+	},
+	{
+		Title:   "未同意 EULA",
+		Pattern: regexp.MustCompile(`You need to agree to the EULA in order to run the server`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			return crashCause{
+				Title: "未同意 EULA",
+				Hint:  "请阅读 https://aka.ms/MinecraftEULA 后，将服务器目录下 eula.txt 中的 eula=false 改为 eula=true。",
+			}
+		},
+	},
+	{
+		Title:   "缺少前置模组",
+		Pattern: regexp.MustCompile(`(?:requires|depends on) (?:mod |any version of )?'?([\w-]+)'?.*(?:which is missing|but it is not installed)|Missing or unsupported mandatory dependencies|Mod resolution failed`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			return crashCause{
+				Title: "缺少前置模组或版本不匹配",
+				Hint:  "有模组缺少依赖或依赖版本不兼容，请根据日志安装缺失的前置模组，或更换匹配的版本。",
+			}
+		},
+	},
+	{
+		Title:   "Mixin 注入失败",
+		Pattern: regexp.MustCompile(`MixinApplyError|Mixin apply (?:for mod )?(\S+)? ?failed|InvalidInjectionException`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			return crashCause{
+				Title: "模组 Mixin 注入失败",
+				Hint:  "通常是模组与当前 MC/加载器版本不兼容，或两个模组互相冲突。请更新或移除相关模组。",
+			}
+		},
+	},
+	{
+		Title:   "世界存档损坏",
+		Pattern: regexp.MustCompile(`Failed to load level|Couldn't load chunk|Exception reading .*\.mca|Failed to read level data|level\.dat.*(?:corrupt|EOFException)`),
+		explain: func(m []string, r *CrashReport) crashCause {
+			return crashCause{
+				Title: "世界存档可能损坏",
+				Hint:  "读取区块或 level.dat 时出错。请先备份世界，再尝试用 level.dat_old 替换 level.dat 或从备份恢复。",
+			}
+		},
+	},
+}
+
+// lineRing 保存最近的若干行输出，用于没有崩溃报告时分析
+type lineRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newLineRing(size int) *lineRing {
+	return &lineRing{lines: make([]string, size)}
+}
+
+func (r *lineRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *lineRing) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string{}, r.lines[:r.next]...)
+	}
+	return append(append([]string{}, r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// findCrashFiles 返回实例目录下的崩溃报告和 hs_err 文件，按修改时间从新到旧排列
+func findCrashFiles(server *ServerInstance, since time.Time) []string {
+	dir := serverDir(server)
+	var files []string
+	reports, _ := filepath.Glob(filepath.Join(dir, CRASH_REPORTS_DIR, "crash-*.txt"))
+	files = append(files, reports...)
+	hsErrs, _ := filepath.Glob(filepath.Join(dir, "hs_err_pid*.log"))
+	files = append(files, hsErrs...)
+
+	type crashFile struct {
+		path string
+		mod  time.Time
+	}
+	var found []crashFile
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		found = append(found, crashFile{f, info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].mod.After(found[j].mod) })
+
+	result := make([]string, len(found))
+	for i, f := range found {
+		result[i] = f.path
+	}
+	return result
+}
+
+func analyzeCrashFile(path string) (*CrashReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &CrashReport{Path: path, Details: make(map[string]string), text: string(data)}
+	if info, err := os.Stat(path); err == nil {
+		report.Time = info.ModTime()
+	}
+
+	if strings.HasPrefix(filepath.Base(path), "hs_err_pid") {
+		report.Kind = CRASH_KIND_HSERR
+		parseHsErr(report)
+	} else {
+		report.Kind = CRASH_KIND_REPORT
+		parseCrashReport(report)
+	}
+	applyCrashRules(report)
+	return report, nil
+}
+
+func analyzeConsoleTail(lines []string) *CrashReport {
+	report := &CrashReport{
+		Kind:    CRASH_KIND_LOG,
+		Time:    time.Now(),
+		Details: make(map[string]string),
+		text:    strings.Join(lines, "\n"),
+	}
+
+	parser := newLogEventParser("", nil, nil)
+	var last *LogEvent
+	for _, line := range lines {
+		for _, event := range parser.feed(line) {
+			if event.Type == EVENT_EXCEPTION {
+				e := event
+				last = &e
+			}
+		}
+	}
+	for _, event := range parser.flush() {
+		if event.Type == EVENT_EXCEPTION {
+			e := event
+			last = &e
+		}
+	}
+
+	if last != nil {
+		report.Description = last.Message
+		report.Exception = last.Data["exception"]
+		report.Stack = last.Stack
+		report.SuspectedMods = suspectPackages(last.Stack)
+	}
+	applyCrashRules(report)
+	return report
+}
+
+func parseCrashReport(report *CrashReport) {
+	scanner := bufio.NewScanner(strings.NewReader(report.text))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	inStack := false
+	inSuspects := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if m := crashDescRe.FindStringSubmatch(line); m != nil && report.Description == "" {
+			report.Description = m[1]
+			inStack = true
+			continue
+		}
+		if m := crashTimeRe.FindStringSubmatch(line); m != nil {
+			if t, err := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(m[1]), time.Local); err == nil {
+				report.Time = t
+			} else if t, err := time.ParseInLocation("1/2/06, 3:04 PM", strings.TrimSpace(m[1]), time.Local); err == nil {
+				report.Time = t
+			}
+			continue
+		}
+
+		if inStack {
+			if strings.TrimSpace(line) == "" {
+				if report.Exception != "" {
+					inStack = false
+				}
+				continue
+			}
+			if report.Exception == "" {
+				report.Exception = line
+				continue
+			}
+			report.Stack = append(report.Stack, line)
+			continue
+		}
+
+		// Forge: "Suspected Mods: X (x)"，Fabric: "Suspected Mod(s):" 后接多行
+		if strings.HasPrefix(line, "\tSuspected Mod") || strings.HasPrefix(line, "Suspected Mod") {
+			_, rest, _ := strings.Cut(line, ":")
+			rest = strings.TrimSpace(rest)
+			if rest != "" && !strings.EqualFold(rest, "NONE") && !strings.HasPrefix(rest, "~~") {
+				for _, mod := range strings.Split(rest, ",") {
+					report.SuspectedMods = appendUnique(report.SuspectedMods, strings.TrimSpace(mod))
+				}
+			}
+			inSuspects = rest == ""
+			continue
+		}
+		if inSuspects {
+			if m := suspectedModEnRe.FindStringSubmatch(line); m != nil && strings.HasPrefix(line, "\t") {
+				report.SuspectedMods = appendUnique(report.SuspectedMods, fmt.Sprintf("%s (%s)", strings.TrimSpace(m[1]), m[2]))
+				continue
+			}
+			if !strings.HasPrefix(line, "\t\t") {
+				inSuspects = false
+			}
+		}
+
+		if m := crashDetailRe.FindStringSubmatch(line); m != nil {
+			key := strings.TrimSpace(m[1])
+			if _, exists := report.Details[key]; !exists {
+				report.Details[key] = strings.TrimSpace(m[2])
+			}
+		}
+	}
+
+	if len(report.SuspectedMods) == 0 {
+		report.SuspectedMods = suspectPackages(report.Stack)
+	}
+}
+
+func parseHsErr(report *CrashReport) {
+	scanner := bufio.NewScanner(strings.NewReader(report.text))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	expectFrame := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if m := hsErrMemoryRe.FindStringSubmatch(line); m != nil && report.Description == "" {
+			report.Description = m[1]
+		}
+		if m := hsErrSignalRe.FindStringSubmatch(line); m != nil && report.Exception == "" {
+			report.Exception = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		}
+		if m := hsErrJreRe.FindStringSubmatch(line); m != nil {
+			report.Details["Java Version"] = m[1]
+		}
+		if m := hsErrVMRe.FindStringSubmatch(line); m != nil {
+			report.Details["Java VM"] = m[1]
+		}
+		if m := hsErrArgsRe.FindStringSubmatch(line); m != nil {
+			report.Details["JVM Flags"] = m[1]
+		}
+		if m := hsErrOSRe.FindStringSubmatch(line); m != nil && report.Details["Operating System"] == "" {
+			report.Details["Operating System"] = m[1]
+		}
+
+		if strings.HasPrefix(line, "# Problematic frame:") {
+			expectFrame = true
+			continue
+		}
+		if expectFrame {
+			if m := hsErrFrameRe.FindStringSubmatch(line); m != nil {
+				report.Details["Problematic Frame"] = m[1]
+				report.Stack = append(report.Stack, m[1])
+			}
+			expectFrame = false
+		}
+	}
+
+	if report.Description == "" {
+		report.Description = "JVM 致命错误"
+	}
+}
+
+// suspectPackages 从堆栈中找出不属于游戏本体和 JDK 的包名
+func suspectPackages(stack []string) []string {
+	var suspects []string
+	for _, line := range stack {
+		m := stackFrameRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		class := m[1]
+		known := false
+		for _, prefix := range knownPackagePrefixes {
+			if strings.HasPrefix(class, prefix) {
+				known = true
+				break
+			}
+		}
+		if known {
+			continue
+		}
+		parts := strings.Split(class, ".")
+		if len(parts) > 3 {
+			parts = parts[:3]
+		}
+		suspects = appendUnique(suspects, strings.Join(parts, "."))
+	}
+	return suspects
+}
+
+func appendUnique(list []string, item string) []string {
+	if item == "" {
+		return list
+	}
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
+
+func applyCrashRules(report *CrashReport) {
+	seen := make(map[string]bool)
+	for _, rule := range crashRules {
+		m := rule.Pattern.FindStringSubmatch(report.text)
+		if m == nil || seen[rule.Title] {
+			continue
+		}
+		seen[rule.Title] = true
+		report.Causes = append(report.Causes, rule.explain(m, report))
+	}
+}
+
+func (r *CrashReport) title() string {
+	if len(r.Causes) > 0 {
+		return r.Causes[0].Title
+	}
+	if r.Description != "" {
+		return r.Description
+	}
+	if r.Exception != "" {
+		return r.Exception
+	}
+	return "未知原因"
+}
+
+func printCrashReport(r *CrashReport) {
+	fmt.Println("\n\033[1;31m崩溃分析\033[0m")
+	fmt.Println("----------------------------------------")
+	switch r.Kind {
+	case CRASH_KIND_REPORT:
+		fmt.Printf("来源: 崩溃报告 %s\n", r.Path)
+	case CRASH_KIND_HSERR:
+		fmt.Printf("来源: JVM 错误日志 %s\n", r.Path)
+	default:
+		fmt.Println("来源: 控制台输出")
+	}
+	if !r.Time.IsZero() {
+		fmt.Printf("时间: %s\n", r.Time.Format("2006-01-02 15:04:05"))
+	}
+	if r.Description != "" {
+		fmt.Printf("描述: %s\n", r.Description)
+	}
+	if r.Exception != "" {
+		fmt.Printf("异常: %s\n", r.Exception)
+	}
+	for i, line := range r.Stack {
+		if i >= CRASH_STACK_LINES {
+			fmt.Printf("      ... 共 %d 行\n", len(r.Stack))
+			break
+		}
+		fmt.Printf("      %s\n", strings.TrimSpace(line))
+	}
+	if len(r.SuspectedMods) > 0 {
+		fmt.Printf("可疑模组/插件: %s\n", strings.Join(r.SuspectedMods, ", "))
+	}
+
+	for _, key := range []string{"Minecraft Version", "Java Version", "Java VM", "JVM Flags", "Memory", "Operating System", "Problematic Frame"} {
+		if value, ok := r.Details[key]; ok {
+			fmt.Printf("%s: %s\n", key, value)
+		}
+	}
+
+	fmt.Println("----------------------------------------")
+	if len(r.Causes) == 0 {
+		fmt.Println("未匹配到已知的崩溃原因，请查看完整报告或日志。")
+		return
+	}
+	fmt.Println("\033[33m可能的原因:\033[0m")
+	for i, cause := range r.Causes {
+		fmt.Printf("%d. %s\n   %s\n", i+1, cause.Title, cause.Hint)
+	}
+}
+
+// handleServerExit 在服务器退出后检查是否为异常退出并分析崩溃原因
+func handleServerExit(server *ServerInstance, startedAt time.Time, waitErr error, tail []string) {
+	files := findCrashFiles(server, startedAt)
+	if waitErr == nil && len(files) == 0 {
+		if server.LastCrash != nil {
+			server.LastCrash = nil
+			saveConfig()
+		}
+		return
+	}
+
+	var report *CrashReport
+	if len(files) > 0 {
+		report, _ = analyzeCrashFile(files[0])
+	}
+	if report == nil {
+		report = analyzeConsoleTail(tail)
+	}
+
+	fmt.Printf("\033[31m服务器 [%s] 异常退出: %v\033[0m\n", server.Name, waitErr)
+	printCrashReport(report)
+
+	server.LastCrash = &CrashSummary{
+		Time:   time.Now().Format(time.RFC3339),
+		Title:  report.title(),
+		Report: report.Path,
+	}
+	saveConfig()
+}
+
+func handleCrashCLI(args []string) {
+	if len(args) < 1 {
+		fmt.Println("用法: emcm crash <服务器ID> [ls|clear|崩溃文件路径]")
+		return
+	}
+	server, ok := config.ServerInstalls[args[0]]
+	if !ok {
+		fmt.Printf("找不到服务器实例: %s\n", args[0])
+		return
+	}
+
+	if len(args) > 1 {
+		switch args[1] {
+		case "ls":
+			files := findCrashFiles(server, time.Time{})
+			if len(files) == 0 {
+				fmt.Println("未找到崩溃报告")
+				return
+			}
+			for _, f := range files {
+				info, _ := os.Stat(f)
+				fmt.Printf("- %s  %s\n", info.ModTime().Format("2006-01-02 15:04:05"), f)
+			}
+			return
+		case "clear":
+			server.LastCrash = nil
+			saveConfig()
+			fmt.Println("崩溃提醒已清除")
+			return
+		default:
+			report, err := analyzeCrashFile(args[1])
+			if err != nil {
+				fmt.Println("读取崩溃文件失败:", err)
+				return
+			}
+			printCrashReport(report)
+			return
+		}
+	}
+
+	showLatestCrash(server)
+}
+
+func showLatestCrash(server *ServerInstance) {
+	if files := findCrashFiles(server, time.Time{}); len(files) > 0 {
+		report, err := analyzeCrashFile(files[0])
+		if err != nil {
+			fmt.Println("读取崩溃文件失败:", err)
+			return
+		}
+		printCrashReport(report)
+		return
+	}
+
+	// 没有崩溃文件时分析 EMCM 保存的控制台日志末尾
+	path := filepath.Join(serverLogDir(server.ID), RAW_LOG_NAME+".log")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("未找到崩溃报告或控制台日志")
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > CRASH_TAIL_LINES {
+		lines = lines[len(lines)-CRASH_TAIL_LINES:]
+	}
+	for i, line := range lines {
+		if m := emcmLogLineRe.FindStringIndex(line); m != nil {
+			lines[i] = line[m[1]:]
+		}
+	}
+	printCrashReport(analyzeConsoleTail(lines))
+}
+
+func printCrashNotices() {
+	for _, id := range sortedServerIDs() {
+		server := config.ServerInstalls[id]
+		if server.LastCrash == nil {
+			continue
+		}
+		ts := server.LastCrash.Time
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			ts = t.Format("01-02 15:04")
+		}
+		fmt.Printf("\033[31m⚠ 服务器 [%s] 于 %s 崩溃: %s\033[0m\n", server.Name, ts, server.LastCrash.Title)
+	}
+}
+
+func crashMenu() {
+	clearScreen()
+	fmt.Println("\n\033[1;36m崩溃分析\033[0m")
+	fmt.Println("----------------------------------------")
+
+	serverIDs := sortedServerIDs()
+	for i, id := range serverIDs {
+		server := config.ServerInstalls[id]
+		status := ""
+		if server.LastCrash != nil {
+			status = fmt.Sprintf(" \033[31m[崩溃: %s]\033[0m", server.LastCrash.Title)
+		}
+		fmt.Printf("%d. %s%s\n", i+1, server.Name, status)
+	}
+	fmt.Println("0. 返回")
+	fmt.Println("----------------------------------------")
+	fmt.Print("请选择: ")
+
+	var choice int
+	fmt.Scanln(&choice)
+	if choice < 1 || choice > len(serverIDs) {
+		return
+	}
+
+	server := config.ServerInstalls[serverIDs[choice-1]]
+	showLatestCrash(server)
+
+	if server.LastCrash != nil {
+		fmt.Print("\n是否清除该崩溃提醒? (y/n): ")
+		var confirm string
+		fmt.Scanln(&confirm)
+		if strings.ToLower(confirm) == "y" {
+			server.LastCrash = nil
+			saveConfig()
+		}
+	} else {
+		fmt.Println("\n按回车键返回...")
+		fmt.Scanln()
+	}
+}
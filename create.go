@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// createOptions 是 emcm create 的参数
+type createOptions struct {
+	name        string
+	jar         string
+	serverType  string
+	mcVersion   string
+	coreVersion string
+	dir         string
+	acceptEULA  bool
+	// mrpack 是 --from-mrpack 指定的 Modrinth 整合包
+	mrpack string
+}
+
+func parseCreateArgs(args []string) (createOptions, error) {
+	var opts createOptions
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--accept-eula" {
+			opts.acceptEULA = true
+			continue
+		}
+		if strings.HasPrefix(args[i], "--") {
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("缺少参数值: %s", args[i])
+			}
+			value := args[i+1]
+			switch args[i] {
+			case "--jar":
+				opts.jar = value
+			case "--type":
+				opts.serverType = value
+			case "--version":
+				opts.mcVersion = value
+			case "--core":
+				opts.coreVersion = value
+			case "--dir":
+				opts.dir = value
+			case "--from-mrpack":
+				opts.mrpack = value
+			default:
+				return opts, fmt.Errorf("未知参数: %s", args[i])
+			}
+			i++
+			continue
+		}
+		if opts.name != "" {
+			return opts, fmt.Errorf("多余的参数: %s", args[i])
+		}
+		opts.name = args[i]
+	}
+	switch {
+	case opts.mrpack != "":
+		// 名称、服务端和版本可以从整合包中读取
+	case opts.name == "":
+		return opts, errors.New("缺少实例名称")
+	case opts.jar == "" && (opts.serverType == "" || opts.mcVersion == ""):
+		return opts, errors.New("需要 --jar，或者 --type 和 --version")
+	}
+	return opts, nil
+}
+
+// obtainServerJar 下载或定位服务端核心，指定 --dir 时复制到该目录作为实例目录
+func obtainServerJar(opts *createOptions) (string, error) {
+	path := opts.jar
+	if path == "" {
+		if opts.coreVersion == "" {
+			builds, err := getBuilds(opts.serverType, opts.mcVersion)
+			if err != nil {
+				return "", err
+			}
+			if len(builds.Builds) == 0 {
+				return "", errors.New("未找到可用构建")
+			}
+			opts.coreVersion = builds.Builds[0].Core
+			fmt.Printf("使用最新版本: %s\n", opts.coreVersion)
+		}
+		downloaded, err := downloadServer(opts.serverType, opts.mcVersion, opts.coreVersion)
+		if err != nil {
+			return "", fmt.Errorf("下载失败: %v", err)
+		}
+		path = downloaded
+	} else {
+		detectedType, detectedVersion := detectServerJar(path)
+		if opts.serverType == "" {
+			opts.serverType = detectedType
+		}
+		if opts.mcVersion == "" {
+			opts.mcVersion = detectedVersion
+		}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return "", err
+	}
+	if opts.dir == "" {
+		return abs, nil
+	}
+
+	dir, err := filepath.Abs(opts.dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(abs))
+	if dst != abs {
+		if err := copyFile(abs, dst); err != nil {
+			return "", fmt.Errorf("复制服务端失败: %v", err)
+		}
+	}
+	return dst, nil
+}
+
+func printCreateUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm create <名称> --jar <服务端路径> [--dir 实例目录] [--accept-eula]")
+	fmt.Println("  emcm create <名称> --type <服务端> --version <MC版本> [--core 核心版本] [--dir 实例目录] [--accept-eula]")
+	fmt.Println("  emcm create [名称] --from-mrpack <整合包.mrpack> [--dir 实例目录] [--core 核心版本|--jar 服务端路径] [--accept-eula]")
+	fmt.Println("指定 --dir 时服务端复制到该目录，否则在服务端所在目录运行；")
+	fmt.Println("--accept-eula 表示已阅读并同意 Minecraft EULA (" + EULA_URL + ")，不指定时会询问")
+}
+
+func handleCreateCLI(args []string) {
+	opts, err := parseCreateArgs(args)
+	if err != nil {
+		fmt.Println(err)
+		printCreateUsage()
+		return
+	}
+	var pack *zip.ReadCloser
+	var index *mrpackIndex
+	if opts.mrpack != "" {
+		pack, index, err = prepareMrpackCreate(&opts)
+		if err != nil {
+			fmt.Println("读取整合包失败:", err)
+			return
+		}
+		defer pack.Close()
+	}
+	path, err := obtainServerJar(&opts)
+	if err != nil {
+		fmt.Println("创建失败:", err)
+		return
+	}
+	if pack != nil {
+		if err := installMrpack(pack, index, filepath.Dir(path)); err != nil {
+			fmt.Println("安装整合包失败:", err)
+			return
+		}
+	}
+
+	server := registerServerInstance(opts.name, opts.serverType, opts.mcVersion, opts.coreVersion, path)
+	fmt.Printf("已创建服务器实例: %s (%s %s)\n", server.ID, server.ServerType, server.MCVersion)
+	fmt.Printf("目录: %s\n", serverDir(server))
+
+	accepted := opts.acceptEULA
+	if !accepted && isInteractive() {
+		accepted = promptEULA(bufio.NewScanner(os.Stdin))
+	}
+	if !accepted {
+		fmt.Printf("未同意 EULA，启动前运行 emcm eula %s accept\n", server.ID)
+		return
+	}
+	if err := acceptEULA(server); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("已同意 Minecraft EULA (%s)\n", EULA_URL)
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DATAPACKS_DIR        = "datapacks"
+	PACK_MCMETA          = "pack.mcmeta"
+	DATAPACK_PREFIX      = "file/"
+	DATAPACK_CMD_TIMEOUT = 5 * time.Second
+
+	// DATAPACK_FORMATS_KNOWN_UNTIL 之后的版本没有收录，不检查格式
+	DATAPACK_FORMATS_KNOWN_UNTIL = "1.21.8"
+)
+
+// datapackFormats 是各 MC 版本起使用的数据包格式 (pack_format)，按版本排序
+var datapackFormats = []struct {
+	since  string
+	format int
+}{
+	{"1.13", 4},
+	{"1.15", 5},
+	{"1.16.2", 6},
+	{"1.17", 7},
+	{"1.18", 8},
+	{"1.18.2", 9},
+	{"1.19", 10},
+	{"1.19.4", 12},
+	{"1.20", 15},
+	{"1.20.2", 18},
+	{"1.20.3", 26},
+	{"1.20.5", 41},
+	{"1.21", 48},
+	{"1.21.2", 57},
+	{"1.21.4", 61},
+	{"1.21.5", 71},
+	{"1.21.6", 80},
+	{"1.21.7", 81},
+}
+
+// datapackReplyRe 匹配 /datapack enable|disable 的回复
+var datapackReplyRe = regexp.MustCompile(`(?i)(enabling|disabling|already enabled|not enabled|unknown data pack)`)
+
+// datapackInfo 是 datapacks 目录中的一个数据包 (目录或 zip)
+type datapackInfo struct {
+	name        string
+	description string
+	format      int
+	// minFormat、maxFormat 来自 supported_formats，没有声明时为 0
+	minFormat int
+	maxFormat int
+	err       error
+}
+
+// serverDatapackFormat 返回服务端 MC 版本使用的数据包格式，未知时返回 0
+func serverDatapackFormat(mcVersion string) int {
+	if _, ok := parseMCVersion(mcVersion); !ok || compareMCVersion(mcVersion, DATAPACK_FORMATS_KNOWN_UNTIL) > 0 {
+		return 0
+	}
+	format := 0
+	for _, f := range datapackFormats {
+		if compareMCVersion(mcVersion, f.since) >= 0 {
+			format = f.format
+		}
+	}
+	return format
+}
+
+func datapacksDir(server *ServerInstance, world string) string {
+	return filepath.Join(worldDir(server, world), DATAPACKS_DIR)
+}
+
+// readPackMeta 读取目录或 zip 中的 pack.mcmeta
+func readPackMeta(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		data, err := os.ReadFile(filepath.Join(path, PACK_MCMETA))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("没有 %s", PACK_MCMETA)
+		}
+		return data, err
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("不是 zip 文件: %v", err)
+	}
+	defer zr.Close()
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	data, err := readZipFile(files, PACK_MCMETA)
+	if err == nil && data == nil {
+		err = fmt.Errorf("没有 %s", PACK_MCMETA)
+	}
+	return data, err
+}
+
+// parseFormatRange 解析 supported_formats，可以是整数、[最小, 最大] 或 {min_inclusive, max_inclusive}
+func parseFormatRange(v interface{}) (int, int, bool) {
+	switch t := v.(type) {
+	case float64:
+		return int(t), int(t), true
+	case []interface{}:
+		if len(t) == 2 {
+			min, okMin := t[0].(float64)
+			max, okMax := t[1].(float64)
+			return int(min), int(max), okMin && okMax
+		}
+	case map[string]interface{}:
+		min, okMin := t["min_inclusive"].(float64)
+		max, okMax := t["max_inclusive"].(float64)
+		return int(min), int(max), okMin && okMax
+	}
+	return 0, 0, false
+}
+
+func readDatapack(path string) datapackInfo {
+	pack := datapackInfo{name: filepath.Base(path)}
+	data, err := readPackMeta(path)
+	if err != nil {
+		pack.err = err
+		return pack
+	}
+	var meta struct {
+		Pack struct {
+			PackFormat       int         `json:"pack_format"`
+			Description      interface{} `json:"description"`
+			SupportedFormats interface{} `json:"supported_formats"`
+		} `json:"pack"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		pack.err = fmt.Errorf("%s 解析失败: %v", PACK_MCMETA, err)
+		return pack
+	}
+	pack.format = meta.Pack.PackFormat
+	pack.description = strings.TrimSpace(jsonText(meta.Pack.Description))
+	if meta.Pack.SupportedFormats != nil {
+		pack.minFormat, pack.maxFormat, _ = parseFormatRange(meta.Pack.SupportedFormats)
+	}
+	return pack
+}
+
+// formatWarning 检查数据包格式与服务端是否一致，一致或无法判断时返回空字符串
+func (p datapackInfo) formatWarning(mcVersion string) string {
+	want := serverDatapackFormat(mcVersion)
+	if want == 0 || p.err != nil || p.format == want {
+		return ""
+	}
+	if p.maxFormat > 0 && want >= p.minFormat && want <= p.maxFormat {
+		return ""
+	}
+	declared := fmt.Sprint(p.format)
+	if p.maxFormat > 0 {
+		declared = fmt.Sprintf("%d (支持 %d-%d)", p.format, p.minFormat, p.maxFormat)
+	}
+	return fmt.Sprintf("%s 的格式为 %s，%s 使用格式 %d，可能无法正常工作", p.name, declared, mcVersion, want)
+}
+
+func installedDatapacks(server *ServerInstance, world string) []datapackInfo {
+	entries, _ := os.ReadDir(datapacksDir(server, world))
+	var packs []datapackInfo
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(strings.ToLower(e.Name()), ".zip") {
+			continue
+		}
+		packs = append(packs, readDatapack(filepath.Join(datapacksDir(server, world), e.Name())))
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].name < packs[j].name })
+	return packs
+}
+
+// levelDatapacks 读取 level.dat 中 DataPacks 的 Enabled 和 Disabled 列表，世界尚未生成时返回 nil
+func levelDatapacks(server *ServerInstance, world string) (enabled, disabled []string, err error) {
+	level, err := readNBTFile(levelDatPath(server, world))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	packs := datapackCompound(level.Root)
+	if packs == nil {
+		return nil, nil, nil
+	}
+	return nbtStrings(packs, "Enabled"), nbtStrings(packs, "Disabled"), nil
+}
+
+func datapackCompound(root *nbtCompound) *nbtCompound {
+	if data := root.compound("Data"); data != nil {
+		return data.compound("DataPacks")
+	}
+	return nil
+}
+
+func nbtStrings(c *nbtCompound, name string) []string {
+	var result []string
+	if list, ok := c.values[name].(*nbtList); ok {
+		for _, item := range list.items {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+func nbtStringList(items []string) *nbtList {
+	list := &nbtList{elemType: TAG_STRING}
+	for _, s := range items {
+		list.items = append(list.items, s)
+	}
+	return list
+}
+
+func removeString(items []string, s string) []string {
+	var result []string
+	for _, item := range items {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// setLevelDatapack 在服务器停止时修改 level.dat，把数据包移到 Enabled 或 Disabled 列表，
+// remove 为 true 时从两个列表中都删除
+func setLevelDatapack(server *ServerInstance, world, name string, enable, remove bool) error {
+	path := levelDatPath(server, world)
+	level, err := readNBTFile(path)
+	if err != nil {
+		return err
+	}
+	data := level.Root.compound("Data")
+	if data == nil {
+		return errors.New("level.dat 中没有 Data")
+	}
+	packs := data.compound("DataPacks")
+	if packs == nil {
+		packs = newNBTCompound()
+		data.set("DataPacks", packs)
+	}
+	id := DATAPACK_PREFIX + name
+	enabled := removeString(nbtStrings(packs, "Enabled"), id)
+	disabled := removeString(nbtStrings(packs, "Disabled"), id)
+	switch {
+	case remove:
+	case enable:
+		enabled = append(enabled, id)
+	default:
+		disabled = append(disabled, id)
+	}
+	packs.set("Enabled", nbtStringList(enabled))
+	packs.set("Disabled", nbtStringList(disabled))
+
+	if err := copyFile(path, filepath.Join(filepath.Dir(path), LEVEL_DAT_OLD)); err != nil {
+		return fmt.Errorf("备份 level.dat 失败: %v", err)
+	}
+	return writeNBTFile(path, level)
+}
+
+// datapackCommand 在服务器运行时执行 /datapack 命令
+func datapackCommand(server *ServerInstance, command string) error {
+	reply, err := consoleCommand(server.ID, command, datapackReplyRe, DATAPACK_CMD_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	if reply == "" {
+		fmt.Println("已发送:", command)
+	} else {
+		fmt.Printf("%s -> %s\n", command, strings.TrimSpace(reply))
+	}
+	return nil
+}
+
+func printDatapacks(server *ServerInstance, world string) {
+	packs := installedDatapacks(server, world)
+	if len(packs) == 0 {
+		fmt.Printf("%s 中没有数据包\n", datapacksDir(server, world))
+		return
+	}
+	enabled, disabled, err := levelDatapacks(server, world)
+	if err != nil {
+		fmt.Printf("\033[33m读取 level.dat 失败: %v\033[0m\n", err)
+	}
+	if format := serverDatapackFormat(server.MCVersion); format > 0 {
+		fmt.Printf("%s 的数据包格式为 %d\n\n", server.MCVersion, format)
+	}
+	fmt.Printf("%s%s%s%s\n", padRight("名称", 32), padRight("状态", 12), padRight("格式", 8), "说明")
+	var warnings []string
+	for _, p := range packs {
+		id := DATAPACK_PREFIX + p.name
+		status := "\033[90m" + padRight("新", 12) + "\033[0m"
+		switch {
+		case containsString(disabled, id):
+			status = "\033[33m" + padRight("禁用", 12) + "\033[0m"
+		case containsString(enabled, id):
+			status = "\033[32m" + padRight("启用", 12) + "\033[0m"
+		}
+		if p.err != nil {
+			fmt.Printf("%s%s\033[31m%v\033[0m\n", padRight(p.name, 32), status, p.err)
+			continue
+		}
+		format := fmt.Sprint(p.format)
+		if p.maxFormat > 0 {
+			format = fmt.Sprintf("%d-%d", p.minFormat, p.maxFormat)
+		}
+		fmt.Printf("%s%s%s%s\n", padRight(p.name, 32), status, padRight(format, 8), firstLine(p.description))
+		if w := p.formatWarning(server.MCVersion); w != "" {
+			warnings = append(warnings, w)
+		}
+	}
+	for _, w := range warnings {
+		fmt.Printf("\033[33m⚠ %s\033[0m\n", w)
+	}
+	fmt.Println("\n\033[90m新数据包在下次启动时自动启用\033[0m")
+}
+
+// copyDir 递归复制目录
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+}
+
+// addDatapack 安装本地目录、zip 或 URL 中的数据包，同名数据包会被替换
+func addDatapack(server *ServerInstance, world, source string) error {
+	dir := datapacksDir(server, world)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Base(source)
+	if isURL(source) {
+		name = urlFilename(source)
+	}
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return fmt.Errorf("无法确定数据包名称: %s", source)
+	}
+
+	// 先放到临时位置检查 pack.mcmeta
+	stage := filepath.Join(dir, "."+name+".download")
+	os.RemoveAll(stage)
+	var err error
+	switch info, statErr := os.Stat(source); {
+	case isURL(source):
+		err = downloadVerified(source, stage, nil)
+	case statErr != nil:
+		err = statErr
+	case info.IsDir():
+		err = copyDir(source, stage)
+	default:
+		err = copyFile(source, stage)
+	}
+	if err != nil {
+		os.RemoveAll(stage)
+		return err
+	}
+	pack := readDatapack(stage)
+	pack.name = name
+	if pack.err != nil {
+		os.RemoveAll(stage)
+		return fmt.Errorf("%s 不是有效的数据包: %v", name, pack.err)
+	}
+	if info, err := os.Stat(stage); err == nil && !info.IsDir() && !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+		pack.name = name
+	}
+
+	target := filepath.Join(dir, name)
+	_, statErr := os.Stat(target)
+	replaced := statErr == nil
+	if err := os.RemoveAll(target); err != nil {
+		os.RemoveAll(stage)
+		return err
+	}
+	if err := os.Rename(stage, target); err != nil {
+		os.RemoveAll(stage)
+		return err
+	}
+	if replaced {
+		fmt.Printf("已替换数据包 %s\n", name)
+	} else {
+		fmt.Printf("已安装数据包 %s\n", name)
+	}
+	if w := pack.formatWarning(server.MCVersion); w != "" {
+		fmt.Printf("\033[33m警告: %s\033[0m\n", w)
+	}
+
+	if isServerRunning(server.ID) {
+		// /datapack list 会重新扫描 datapacks 目录，之后才能启用新数据包
+		if _, err := consoleCommand(server.ID, "datapack list", nil, 0); err != nil {
+			return err
+		}
+		if replaced {
+			return datapackCommand(server, "reload")
+		}
+		return datapackCommand(server, fmt.Sprintf("datapack enable \"%s%s\"", DATAPACK_PREFIX, name))
+	}
+	return nil
+}
+
+func findDatapack(server *ServerInstance, world, name string) (string, error) {
+	name = strings.TrimPrefix(name, DATAPACK_PREFIX)
+	for _, candidate := range []string{name, name + ".zip"} {
+		if _, err := os.Stat(filepath.Join(datapacksDir(server, world), candidate)); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("没有找到数据包: %s", name)
+}
+
+func removeDatapack(server *ServerInstance, world, name string) error {
+	name, err := findDatapack(server, world, name)
+	if err != nil {
+		return err
+	}
+	if isServerRunning(server.ID) {
+		if err := datapackCommand(server, fmt.Sprintf("datapack disable \"%s%s\"", DATAPACK_PREFIX, name)); err != nil {
+			return err
+		}
+	} else if err := setLevelDatapack(server, world, name, false, true); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(datapacksDir(server, world), name)); err != nil {
+		return err
+	}
+	fmt.Printf("已删除数据包 %s\n", name)
+	return nil
+}
+
+// toggleDatapack 启用或禁用数据包，服务器运行时执行 /datapack，否则修改 level.dat
+func toggleDatapack(server *ServerInstance, world, name string, enable bool) error {
+	name, err := findDatapack(server, world, name)
+	if err != nil {
+		return err
+	}
+	action := "disable"
+	if enable {
+		action = "enable"
+	}
+	if isServerRunning(server.ID) {
+		return datapackCommand(server, fmt.Sprintf("datapack %s \"%s%s\"", action, DATAPACK_PREFIX, name))
+	}
+	if err := setLevelDatapack(server, world, name, enable, false); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("世界尚未生成，新数据包会在首次启动时自动启用")
+		}
+		return err
+	}
+	if enable {
+		fmt.Printf("已启用数据包 %s\n", name)
+	} else {
+		fmt.Printf("已禁用数据包 %s\n", name)
+	}
+	return nil
+}
+
+func printDatapackUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm datapack <服务器ID> ls [--world 世界目录]                 列出数据包并检查格式")
+	fmt.Println("  emcm datapack <服务器ID> add <目录|zip|URL>... [--world 世界目录]  安装数据包")
+	fmt.Println("  emcm datapack <服务器ID> rm <名称>... [--world 世界目录]         删除数据包")
+	fmt.Println("  emcm datapack <服务器ID> enable|disable <名称>... [--world 世界目录]  启用或禁用数据包")
+	fmt.Println("服务器运行时通过 /datapack 命令立即生效，否则修改 level.dat")
+}
+
+func handleDatapackCLI(args []string) {
+	if len(args) < 1 {
+		printDatapackUsage()
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	rest, world := takeWorldFlag(args[1:])
+	action := "ls"
+	if len(rest) > 0 {
+		action, rest = rest[0], rest[1:]
+	}
+	if action != "ls" && len(rest) == 0 {
+		printDatapackUsage()
+		return
+	}
+
+	switch action {
+	case "ls":
+		printDatapacks(server, world)
+	case "add":
+		for _, source := range rest {
+			if err := addDatapack(server, world, source); err != nil {
+				fmt.Println("安装数据包失败:", err)
+			}
+		}
+	case "rm":
+		for _, name := range rest {
+			if err := removeDatapack(server, world, name); err != nil {
+				fmt.Println("删除数据包失败:", err)
+			}
+		}
+	case "enable", "disable":
+		for _, name := range rest {
+			if err := toggleDatapack(server, world, name, action == "enable"); err != nil {
+				fmt.Printf("%s 失败: %v\n", name, err)
+			}
+		}
+	default:
+		printDatapackUsage()
+	}
+}
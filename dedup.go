@@ -0,0 +1,696 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BACKUP_FORMAT_DEDUP  = "dedup"
+	DEDUP_CHUNKS_DIR     = "chunks"
+	DEDUP_SNAPSHOTS_DIR  = "snapshots"
+	DEDUP_LOCK_FILE      = "lock"
+	DEDUP_LOCK_STALE     = 6 * time.Hour
+	DEDUP_CHUNK_MIN      = 64 << 10
+	DEDUP_CHUNK_AVG      = 256 << 10
+	DEDUP_CHUNK_MAX      = 1 << 20
+	DEDUP_CHUNK_RAW      = 0
+	DEDUP_CHUNK_DEFLATED = 1
+)
+
+// 切分掩码取哈希的高位: gear 哈希的高位由最近 64 个字节决定，低位只受最后几个字节影响
+// 未到平均长度前使用更严格的掩码，超过后放宽，使块长度集中在平均值附近 (FastCDC 的归一化切分)
+var (
+	dedupMaskStrict = uint64(0xfffff) << 44
+	dedupMaskLoose  = uint64(0xffff) << 48
+	gearTable       = newGearTable()
+)
+
+// dedupSnapshot 是去重仓库中的一次备份，记录每个文件由哪些数据块组成
+type dedupSnapshot struct {
+	Time      time.Time   `json:"time"`
+	Files     []dedupFile `json:"files"`
+	TotalSize int64       `json:"total_size"`
+	NewChunks int         `json:"new_chunks"`
+	NewBytes  int64       `json:"new_bytes"`
+}
+
+type dedupFile struct {
+	Path    string    `json:"path"`
+	Dir     bool      `json:"dir,omitempty"`
+	Size    int64     `json:"size"`
+	Mode    uint32    `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+	Chunks  []string  `json:"chunks,omitempty"`
+	Sizes   []int64   `json:"sizes,omitempty"`
+}
+
+// newGearTable 用固定种子生成 gear 哈希表，保证不同版本和机器切出相同的块
+func newGearTable() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x454d434d)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}
+
+// cutPoint 返回 data 中第一个块的长度
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= DEDUP_CHUNK_MIN {
+		return n
+	}
+	if n > DEDUP_CHUNK_MAX {
+		n = DEDUP_CHUNK_MAX
+	}
+	normal := DEDUP_CHUNK_AVG
+	if normal > n {
+		normal = n
+	}
+
+	var h uint64
+	i := DEDUP_CHUNK_MIN
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&dedupMaskStrict == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&dedupMaskLoose == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunker 按内容把数据流切分成变长块，插入或删除数据只影响附近的块
+type chunker struct {
+	r          io.Reader
+	buf        []byte
+	start, end int
+	eof        bool
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, DEDUP_CHUNK_MAX)}
+}
+
+// next 返回下一个块，返回的切片在下次调用前有效
+func (c *chunker) next() ([]byte, error) {
+	if c.start > 0 {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+	}
+	for c.end < len(c.buf) && !c.eof {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.end == 0 {
+		return nil, io.EOF
+	}
+	n := cutPoint(c.buf[:c.end])
+	c.start = n
+	return c.buf[:n], nil
+}
+
+func dedupChunksDir(serverID string) string {
+	return filepath.Join(backupDir(serverID), DEDUP_CHUNKS_DIR)
+}
+
+func dedupSnapshotsDir(serverID string) string {
+	return filepath.Join(backupDir(serverID), DEDUP_SNAPSHOTS_DIR)
+}
+
+func chunkPath(serverID, id string) string {
+	return filepath.Join(dedupChunksDir(serverID), id[:2], id)
+}
+
+// lockBackupRepo 防止备份和垃圾回收同时进行
+func lockBackupRepo(serverID string) (func(), error) {
+	return acquireLock(filepath.Join(backupDir(serverID), DEDUP_LOCK_FILE))
+}
+
+// acquireLock 以独占方式创建锁文件，超过 DEDUP_LOCK_STALE 的锁视为残留
+func acquireLock(lockPath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		info, statErr := os.Stat(lockPath)
+		if statErr != nil || time.Since(info.ModTime()) < DEDUP_LOCK_STALE {
+			data, _ := os.ReadFile(lockPath)
+			return nil, fmt.Errorf("备份仓库正被其他操作使用 (PID %s)，如确认没有其他 emcm 在运行可删除 %s",
+				strings.TrimSpace(string(data)), lockPath)
+		}
+		os.Remove(lockPath)
+	}
+	return nil, errors.New("无法锁定备份仓库")
+}
+
+// storeChunk 保存一个数据块，已存在时跳过，返回块 ID 和新写入的字节数
+func storeChunk(serverID string, data []byte) (string, int64, error) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	target := chunkPath(serverID, id)
+	if _, err := os.Stat(target); err == nil {
+		return id, 0, nil
+	}
+
+	// 区域文件本身已经压缩过，压缩后没有变小的块按原样保存
+	var encoded bytes.Buffer
+	encoded.WriteByte(DEDUP_CHUNK_DEFLATED)
+	fw, _ := flate.NewWriter(&encoded, flate.BestSpeed)
+	fw.Write(data)
+	fw.Close()
+	payload := encoded.Bytes()
+	if len(payload) >= len(data)+1 {
+		payload = append([]byte{DEDUP_CHUNK_RAW}, data...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), id+".tmp*")
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return id, int64(len(payload)), nil
+}
+
+// loadChunk 读取数据块并校验内容与块 ID 是否一致
+func loadChunk(serverID, id string) ([]byte, error) {
+	if len(id) != sha256.Size*2 {
+		return nil, fmt.Errorf("无效的块 ID: %s", id)
+	}
+	payload, err := os.ReadFile(chunkPath(serverID, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("数据块 %s 为空", id[:12])
+	}
+
+	var data []byte
+	switch payload[0] {
+	case DEDUP_CHUNK_RAW:
+		data = payload[1:]
+	case DEDUP_CHUNK_DEFLATED:
+		fr := flate.NewReader(bytes.NewReader(payload[1:]))
+		data, err = io.ReadAll(fr)
+		fr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("数据块 %s 解压失败: %v", id[:12], err)
+		}
+	default:
+		return nil, fmt.Errorf("数据块 %s 格式未知", id[:12])
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != id {
+		return nil, fmt.Errorf("数据块 %s 校验失败", id[:12])
+	}
+	return data, nil
+}
+
+// chunkReader 把文件的数据块依次拼接为一个 Reader
+type chunkReader struct {
+	serverID string
+	chunks   []string
+	current  []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		data, err := loadChunk(r.serverID, r.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		r.current = data
+		r.chunks = r.chunks[1:]
+	}
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+func readDedupSnapshot(snapshotPath string) (*dedupSnapshot, error) {
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot dedupSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("快照文件损坏: %v", err)
+	}
+	return &snapshot, nil
+}
+
+// serverIDOfSnapshot 从 .emcm/backups/<ID>/snapshots/<名称> 推出实例 ID
+func serverIDOfSnapshot(snapshotPath string) string {
+	return filepath.Base(filepath.Dir(filepath.Dir(snapshotPath)))
+}
+
+// walkDedupSnapshot 以与 walkArchive 相同的方式遍历去重快照中的文件
+func walkDedupSnapshot(snapshotPath string, fn func(entry archiveEntry, r io.Reader) error) error {
+	snapshot, err := readDedupSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+	serverID := serverIDOfSnapshot(snapshotPath)
+
+	for _, f := range snapshot.Files {
+		entry := archiveEntry{
+			Name:    f.Path,
+			Size:    f.Size,
+			ModTime: f.ModTime,
+			Mode:    fs.FileMode(f.Mode),
+			IsDir:   f.Dir,
+		}
+		var r io.Reader
+		if !f.Dir {
+			r = &chunkReader{serverID: serverID, chunks: f.Chunks}
+		}
+		if err := fn(entry, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestDedupSnapshot 返回最近一次去重快照，用于跳过未修改的文件
+func latestDedupSnapshot(serverID string) *dedupSnapshot {
+	latest := ""
+	for _, s := range listBackups(serverID) {
+		if s.Format == BACKUP_FORMAT_DEDUP {
+			latest = s.Path
+		}
+	}
+	if latest == "" {
+		return nil
+	}
+	snapshot, err := readDedupSnapshot(latest)
+	if err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// writeDedupSnapshot 把实例目录切块写入去重仓库，大小和修改时间都未变的文件直接沿用上一个快照的块列表。
+// 快照清单先写入 .partial，在释放仓库锁之前改名，否则垃圾回收可能删除新写入的块
+func writeDedupSnapshot(serverID, root, dst string, excludes []string) (archiveStats, error) {
+	var stats archiveStats
+	unlock, err := lockBackupRepo(serverID)
+	if err != nil {
+		return stats, err
+	}
+	defer unlock()
+
+	previous := make(map[string]dedupFile)
+	if parent := latestDedupSnapshot(serverID); parent != nil {
+		for _, f := range parent.Files {
+			previous[f.Path] = f
+		}
+	}
+
+	snapshot := dedupSnapshot{Time: time.Now()}
+	reused := 0
+	err = walkBackupFiles(root, excludes, func(rel, full string, info fs.FileInfo) error {
+		file := dedupFile{
+			Path:    rel,
+			Dir:     info.IsDir(),
+			Mode:    uint32(info.Mode().Perm()),
+			ModTime: info.ModTime(),
+		}
+		if info.IsDir() {
+			snapshot.Files = append(snapshot.Files, file)
+			return nil
+		}
+		file.Size = info.Size()
+
+		if old, ok := previous[rel]; ok && !old.Dir && old.Size == file.Size && old.ModTime.Equal(file.ModTime) && chunksExist(serverID, old.Chunks) {
+			file.Chunks = old.Chunks
+			file.Sizes = old.Sizes
+			reused++
+		} else {
+			src, err := os.Open(full)
+			if err != nil {
+				fmt.Printf("\033[33m跳过 %s: %v\033[0m\n", rel, err)
+				return nil
+			}
+			var size int64
+			c := newChunker(src)
+			for {
+				data, err := c.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					src.Close()
+					return fmt.Errorf("读取 %s 失败: %v", rel, err)
+				}
+				id, written, err := storeChunk(serverID, data)
+				if err != nil {
+					src.Close()
+					return fmt.Errorf("写入 %s 失败: %v", rel, err)
+				}
+				if written > 0 {
+					snapshot.NewChunks++
+					snapshot.NewBytes += written
+				}
+				size += int64(len(data))
+				file.Chunks = append(file.Chunks, id)
+				file.Sizes = append(file.Sizes, int64(len(data)))
+			}
+			src.Close()
+			file.Size = size
+		}
+
+		snapshot.Files = append(snapshot.Files, file)
+		snapshot.TotalSize += file.Size
+		stats.Files++
+		stats.Bytes += file.Size
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return stats, err
+	}
+	partial := dst + ".partial"
+	if err := os.WriteFile(partial, data, 0644); err != nil {
+		os.Remove(partial)
+		return stats, err
+	}
+	if err := os.Rename(partial, dst); err != nil {
+		os.Remove(partial)
+		return stats, err
+	}
+	fmt.Printf("新增 %d 个数据块 (%s)，%d 个文件未修改\n", snapshot.NewChunks, formatBytes(snapshot.NewBytes), reused)
+	return stats, nil
+}
+
+func chunksExist(serverID string, chunks []string) bool {
+	for _, id := range chunks {
+		if _, err := os.Stat(chunkPath(serverID, id)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// listChunks 返回仓库中所有数据块及其占用空间
+func listChunks(serverID string) (map[string]int64, error) {
+	chunks := make(map[string]int64)
+	err := filepath.WalkDir(dedupChunksDir(serverID), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || len(d.Name()) < 2 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		chunks[d.Name()] = info.Size()
+		return nil
+	})
+	return chunks, err
+}
+
+// referencedChunks 汇总快照引用的数据块，skip 中的快照视为已删除
+func referencedChunks(serverID string, skip map[string]bool) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	for _, s := range listBackups(serverID) {
+		if s.Format != BACKUP_FORMAT_DEDUP || skip[s.Name] {
+			continue
+		}
+		snapshot, err := readDedupSnapshot(s.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", s.Name, err)
+		}
+		for _, f := range snapshot.Files {
+			for _, id := range f.Chunks {
+				refs[id] = true
+			}
+		}
+	}
+	return refs, nil
+}
+
+// gcBackupRepo 删除没有任何快照引用的数据块以及中断写入留下的临时文件，dryRun 时只统计
+// skip 中的快照按已删除处理，便于预演 prune 的效果
+func gcBackupRepo(serverID string, skip map[string]bool, dryRun bool) (int, int64, error) {
+	if _, err := os.Stat(dedupChunksDir(serverID)); os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	unlock, err := lockBackupRepo(serverID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	refs, err := referencedChunks(serverID, skip)
+	if err != nil {
+		// 快照无法读取时不能判断块是否仍被引用，放弃回收
+		return 0, 0, err
+	}
+	chunks, err := listChunks(serverID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	removed := 0
+	var freed int64
+	for id, size := range chunks {
+		if refs[id] {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(chunkPath(serverID, id)); err != nil {
+				fmt.Printf("删除数据块 %s 失败: %v\n", id, err)
+				continue
+			}
+		}
+		removed++
+		freed += size
+	}
+	return removed, freed, nil
+}
+
+// checkBackupRepo 校验备份的完整性: 快照引用的块是否存在，readData 时还会读取并校验每个块和每个压缩包
+func checkBackupRepo(server *ServerInstance, readData bool) int {
+	problems := 0
+	report := func(format string, a ...interface{}) {
+		problems++
+		fmt.Printf("\033[31m"+format+"\033[0m\n", a...)
+	}
+
+	snapshots := listBackups(server.ID)
+	if len(snapshots) == 0 {
+		fmt.Println("该实例还没有任何备份")
+		return 0
+	}
+	chunks, err := listChunks(server.ID)
+	if err != nil {
+		report("读取数据块目录失败: %v", err)
+		return problems
+	}
+
+	verified := make(map[string]bool)
+	var corrupt []string
+	for _, s := range snapshots {
+		if s.Format != BACKUP_FORMAT_DEDUP {
+			if !readData {
+				continue
+			}
+			fmt.Printf("检查 %s ...\n", s.Name)
+			err := walkArchive(s.Path, func(entry archiveEntry, r io.Reader) error {
+				if r == nil {
+					return nil
+				}
+				_, err := io.Copy(io.Discard, r)
+				return err
+			})
+			if err != nil {
+				report("%s: 压缩包损坏: %v", s.Name, err)
+			}
+			continue
+		}
+
+		fmt.Printf("检查 %s ...\n", s.Name)
+		snapshot, err := readDedupSnapshot(s.Path)
+		if err != nil {
+			report("%s: %v", s.Name, err)
+			continue
+		}
+		for _, f := range snapshot.Files {
+			for _, id := range f.Chunks {
+				if _, ok := chunks[id]; !ok {
+					report("%s: %s 缺少数据块 %s", s.Name, f.Path, id)
+					continue
+				}
+				if readData && !verified[id] {
+					if _, err := loadChunk(server.ID, id); err != nil {
+						report("%s: %s: %v", s.Name, f.Path, err)
+						corrupt = append(corrupt, chunkPath(server.ID, id))
+					}
+					verified[id] = true
+				}
+			}
+		}
+	}
+
+	if len(corrupt) > 0 {
+		// 缺失的块会在下次去重备份时按实例中仍存在的文件重新写入
+		fmt.Println("\n删除以下损坏的数据块后执行一次去重备份，可以用实例中现有的文件重新写入:")
+		for _, p := range corrupt {
+			fmt.Println("-", p)
+		}
+	}
+
+	if refs, err := referencedChunks(server.ID, nil); err == nil {
+		unused := 0
+		for id := range chunks {
+			if !refs[id] {
+				unused++
+			}
+		}
+		if unused > 0 {
+			fmt.Printf("\033[33m有 %d 个数据块未被任何快照引用，可用 emcm backup prune %s 回收\033[0m\n", unused, server.ID)
+		}
+	}
+
+	if problems == 0 {
+		mode := "结构"
+		if readData {
+			mode = "结构和数据"
+		}
+		fmt.Printf("\033[32m检查通过 (%s)，共 %d 个备份\033[0m\n", mode, len(snapshots))
+	}
+	return problems
+}
+
+// printBackupStats 输出去重仓库的统计: 逻辑大小、去重后大小、实际占用和去重率
+func printBackupStats(server *ServerInstance) error {
+	var logical, unique int64
+	uniqueChunks := make(map[string]bool)
+	count := 0
+
+	for _, s := range listBackups(server.ID) {
+		if s.Format != BACKUP_FORMAT_DEDUP {
+			continue
+		}
+		snapshot, err := readDedupSnapshot(s.Path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.Name, err)
+		}
+		count++
+		logical += snapshot.TotalSize
+		for _, f := range snapshot.Files {
+			for i, id := range f.Chunks {
+				if uniqueChunks[id] || i >= len(f.Sizes) {
+					continue
+				}
+				uniqueChunks[id] = true
+				unique += f.Sizes[i]
+			}
+		}
+	}
+	if count == 0 {
+		fmt.Printf("该实例还没有去重备份 (使用 emcm backup %s --format dedup 创建)\n", server.ID)
+		return nil
+	}
+
+	chunks, err := listChunks(server.ID)
+	if err != nil {
+		return err
+	}
+	var stored int64
+	for _, size := range chunks {
+		stored += size
+	}
+
+	ratio := func(a, b int64) string {
+		if b == 0 {
+			return "-"
+		}
+		return strconv.FormatFloat(float64(a)/float64(b), 'f', 2, 64) + "x"
+	}
+
+	fmt.Printf("\n%s 的去重仓库:\n", server.Name)
+	fmt.Printf("快照数:        %d\n", count)
+	fmt.Printf("数据块:        %d\n", len(chunks))
+	fmt.Printf("快照总大小:    %s\n", formatBytes(logical))
+	fmt.Printf("去重后大小:    %s\n", formatBytes(unique))
+	fmt.Printf("实际占用:      %s\n", formatBytes(stored))
+	fmt.Printf("去重率:        %s\n", ratio(logical, unique))
+	fmt.Printf("压缩率:        %s\n", ratio(unique, stored))
+	fmt.Printf("总节省:        %s (%s)\n", ratio(logical, stored), formatBytes(logical-stored))
+	return nil
+}
+
+// dedupSnapshotSizes 读取快照的逻辑大小和新增数据量，用于备份列表
+func dedupSnapshotSizes(snapshotPath string) (int64, int64) {
+	snapshot, err := readDedupSnapshot(snapshotPath)
+	if err != nil {
+		return 0, 0
+	}
+	return snapshot.TotalSize, snapshot.NewBytes
+}
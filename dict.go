@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DICTS_DIR      = "dicts"
+	DICT_EXT       = ".dict"
+	DEFAULT_LOCALE = "zh_CN"
+	CUSTOM_DICT    = "custom.dict"
+	INSTANCE_DICTS = "instances"
+)
+
+// 内置字典，作为最低优先级的一层
+var builtinDicts = map[string]string{
+	"zh_CN": `# EMCM 内置字典 (zh_CN)
+([a-zA-Z0-9_]+) joined the game#玩家 $1 加入游戏
+([a-zA-Z0-9_]+) left the game#玩家 $1 离开游戏
+Player ([a-zA-Z0-9_]+) joined#玩家 $1 加入游戏
+Done \((\d+\.\d+)s\)!#启动完成 (耗时 $1 秒)
+Stopping server#正在停止服务器
+Stopping the server#正在停止服务器
+Preparing spawn area: (\d+)%#生成出生点区域: $1%
+Starting minecraft server version (.+)#正在启动 Minecraft 服务器 $1
+Loading properties#正在加载配置文件
+Preparing level "(.+)"#正在准备世界 "$1"
+Can't keep up! Is the server overloaded\? Running (\d+)ms or (\d+) ticks behind#服务器过载! 落后 $1 毫秒 ($2 刻)
+You need to agree to the EULA in order to run the server#需要同意 EULA 才能运行服务器
+Saving chunks for level '(.+)'/(.+)#正在保存世界 '$1' 的区块 ($2)
+ThreadedAnvilChunkStorage: All dimensions are saved#所有维度已保存`,
+}
+
+var (
+	placeholderRe = regexp.MustCompile(`\$(\d+)`)
+	dictCache     = make(map[string]*translationDict)
+	dictMutex     sync.Mutex
+)
+
+type dictRule struct {
+	Pattern     string
+	Translation string
+	Layer       string
+	Line        int
+	re          *regexp.Regexp
+}
+
+type dictLayer struct {
+	Name    string
+	Path    string
+	Enabled bool
+	Rules   []*dictRule
+	Errors  []string
+}
+
+// translationDict 是某个实例最终生效的分层字典，靠前的层优先匹配
+type translationDict struct {
+	Locale string
+	Layers []*dictLayer
+}
+
+func loadTranslationDict() {
+	os.MkdirAll(filepath.Join(CACHE_DIR, DICTS_DIR, DEFAULT_LOCALE), 0755)
+	os.MkdirAll(filepath.Join(CACHE_DIR, DICTS_DIR, INSTANCE_DICTS), 0755)
+
+	// 旧版单文件字典迁移到默认语言目录
+	legacyPath := filepath.Join(CACHE_DIR, DICT_FILE)
+	if _, err := os.Stat(legacyPath); err == nil {
+		target := filepath.Join(CACHE_DIR, DICTS_DIR, DEFAULT_LOCALE, DICT_FILE)
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			if err := os.Rename(legacyPath, target); err != nil {
+				fmt.Printf("迁移旧版字典失败: %v\n", err)
+			}
+		}
+	}
+
+	customPath := filepath.Join(CACHE_DIR, DICTS_DIR, DEFAULT_LOCALE, CUSTOM_DICT)
+	if _, err := os.Stat(customPath); os.IsNotExist(err) {
+		writeCustomDictTemplate(customPath)
+	}
+
+	dictMutex.Lock()
+	dictCache = make(map[string]*translationDict)
+	dictMutex.Unlock()
+}
+
+// resetMigratedDict 把从旧版迁移来的 logs.dict 改名为 logs.dict.bak，恢复默认字典后它不再覆盖内置规则
+func resetMigratedDict(locale string) error {
+	paths := []string{filepath.Join(CACHE_DIR, DICTS_DIR, locale, DICT_FILE)}
+	if locale == DEFAULT_LOCALE {
+		// 旧版字典还在原位置时，下次加载会再次迁移
+		paths = append(paths, filepath.Join(CACHE_DIR, DICT_FILE))
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := os.Rename(path, path+".bak"); err != nil {
+			return err
+		}
+		fmt.Printf("已将 %s 改名为 %s\n", path, filepath.Base(path)+".bak")
+	}
+	return nil
+}
+
+func writeCustomDictTemplate(path string) error {
+	template := []byte(`# 自定义翻译规则，格式: 原始日志正则表达式#翻译文本
+# $0 为整行匹配内容，$1、$2... 为正则分组，以 # 开头的行为注释
+`)
+	return os.WriteFile(path, template, 0644)
+}
+
+func defaultDictLocale() string {
+	if config.DictLocale != "" {
+		return config.DictLocale
+	}
+	return DEFAULT_LOCALE
+}
+
+// serverDictLocale 返回实例使用的字典语言，关闭翻译时返回空字符串
+func serverDictLocale(server *ServerInstance) string {
+	if server == nil {
+		return defaultDictLocale()
+	}
+	if server.DisableTranslation {
+		return ""
+	}
+	if server.DictLocale != "" {
+		return server.DictLocale
+	}
+	return defaultDictLocale()
+}
+
+func instanceDictPath(serverID string) string {
+	return filepath.Join(CACHE_DIR, DICTS_DIR, INSTANCE_DICTS, serverID+DICT_EXT)
+}
+
+func listDictLocales() []string {
+	seen := make(map[string]bool)
+	for locale := range builtinDicts {
+		seen[locale] = true
+	}
+	entries, _ := os.ReadDir(filepath.Join(CACHE_DIR, DICTS_DIR))
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != INSTANCE_DICTS {
+			seen[entry.Name()] = true
+		}
+	}
+
+	locales := make([]string, 0, len(seen))
+	for locale := range seen {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func isDictLayerDisabled(name string) bool {
+	for _, disabled := range config.DisabledDicts {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDictLayer(name, path, content string) *dictLayer {
+	layer := &dictLayer{
+		Name:    name,
+		Path:    path,
+		Enabled: !isDictLayerDisabled(name),
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "#", 2)
+		if len(parts) != 2 {
+			layer.Errors = append(layer.Errors, fmt.Sprintf("第 %d 行: 缺少 # 分隔符", lineNo))
+			continue
+		}
+
+		re, err := regexp.Compile(parts[0])
+		if err != nil {
+			layer.Errors = append(layer.Errors, fmt.Sprintf("第 %d 行: 正则表达式无效: %v", lineNo, err))
+			continue
+		}
+
+		layer.Rules = append(layer.Rules, &dictRule{
+			Pattern:     parts[0],
+			Translation: parts[1],
+			Layer:       name,
+			Line:        lineNo,
+			re:          re,
+		})
+	}
+	return layer
+}
+
+func loadDictFileLayer(name, path string) *dictLayer {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		layer := &dictLayer{Name: name, Path: path, Enabled: !isDictLayerDisabled(name)}
+		layer.Errors = append(layer.Errors, fmt.Sprintf("读取失败: %v", err))
+		return layer
+	}
+	return parseDictLayer(name, path, string(data))
+}
+
+// buildDictLayers 按优先级从高到低返回: 实例覆盖 -> 语言字典文件 -> 内置字典
+func buildDictLayers(locale, serverID string) []*dictLayer {
+	var layers []*dictLayer
+
+	if serverID != "" {
+		path := instanceDictPath(serverID)
+		if _, err := os.Stat(path); err == nil {
+			layers = append(layers, loadDictFileLayer("instance:"+serverID, path))
+		}
+	}
+
+	localeDir := filepath.Join(CACHE_DIR, DICTS_DIR, locale)
+	if entries, err := os.ReadDir(localeDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), DICT_EXT) {
+				continue
+			}
+			name := locale + "/" + entry.Name()
+			layers = append(layers, loadDictFileLayer(name, filepath.Join(localeDir, entry.Name())))
+		}
+	}
+
+	if content, ok := builtinDicts[locale]; ok {
+		layers = append(layers, parseDictLayer("builtin:"+locale, "", content))
+	}
+
+	return layers
+}
+
+func getServerDict(server *ServerInstance) *translationDict {
+	locale := serverDictLocale(server)
+	if locale == "" {
+		return nil
+	}
+
+	serverID := ""
+	if server != nil {
+		serverID = server.ID
+	}
+	key := locale + "|" + serverID
+
+	dictMutex.Lock()
+	defer dictMutex.Unlock()
+	if dict, ok := dictCache[key]; ok {
+		return dict
+	}
+
+	dict := &translationDict{
+		Locale: locale,
+		Layers: buildDictLayers(locale, serverID),
+	}
+	dictCache[key] = dict
+	return dict
+}
+
+func (d *translationDict) rules() []*dictRule {
+	var rules []*dictRule
+	for _, layer := range d.Layers {
+		if layer.Enabled {
+			rules = append(rules, layer.Rules...)
+		}
+	}
+	return rules
+}
+
+func (r *dictRule) apply(line string) (string, bool) {
+	matches := r.re.FindStringSubmatch(line)
+	if matches == nil {
+		return "", false
+	}
+	result := placeholderRe.ReplaceAllStringFunc(r.Translation, func(ph string) string {
+		idx, _ := strconv.Atoi(ph[1:])
+		if idx < len(matches) {
+			return matches[idx]
+		}
+		return ph
+	})
+	return result, true
+}
+
+func (d *translationDict) translate(line string) string {
+	if d == nil {
+		return line
+	}
+	for _, rule := range d.rules() {
+		if result, ok := rule.apply(line); ok {
+			return result
+		}
+	}
+	return line
+}
+
+func translateLog(server *ServerInstance, line string) string {
+	return getServerDict(server).translate(line)
+}
+
+func handleDictCLI(args []string) {
+	if len(args) < 1 {
+		fmt.Println("用法: emcm dict <list|enable|disable|test|check> ...")
+		fmt.Println("  emcm dict list [服务器ID]            列出字典层")
+		fmt.Println("  emcm dict enable <层名|服务器ID> [语言] 启用字典层或实例翻译")
+		fmt.Println("  emcm dict disable <层名|服务器ID>     禁用字典层或实例翻译")
+		fmt.Println("  emcm dict test <日志文件> [--server ID] [--locale 语言] [-q]  用现有日志测试规则")
+		fmt.Println("  emcm dict check [--server ID] [--locale 语言]  检查正则语法和占位符")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) > 1 {
+			server, ok := config.ServerInstalls[args[1]]
+			if !ok {
+				fmt.Printf("找不到服务器实例: %s\n", args[1])
+				return
+			}
+			printServerDictLayers(server)
+			return
+		}
+		printAllDictLayers()
+
+	case "enable", "disable":
+		if len(args) < 2 {
+			fmt.Printf("用法: emcm dict %s <层名|服务器ID>\n", args[0])
+			return
+		}
+		enable := args[0] == "enable"
+		target := args[1]
+
+		if server, ok := config.ServerInstalls[target]; ok {
+			server.DisableTranslation = !enable
+			if enable && len(args) > 2 {
+				server.DictLocale = args[2]
+			}
+			saveConfig()
+			loadTranslationDict()
+			if enable {
+				fmt.Printf("服务器 %s 的日志翻译已启用 (语言: %s)\n", target, serverDictLocale(server))
+			} else {
+				fmt.Printf("服务器 %s 的日志翻译已禁用\n", target)
+			}
+			return
+		}
+
+		if !dictLayerExists(target) {
+			fmt.Printf("未找到字典层: %s\n", target)
+			return
+		}
+		setDictLayerEnabled(target, enable)
+		saveConfig()
+		loadTranslationDict()
+		if enable {
+			fmt.Printf("字典层已启用: %s\n", target)
+		} else {
+			fmt.Printf("字典层已禁用: %s\n", target)
+		}
+
+	case "test":
+		runDictTest(args[1:])
+
+	case "check":
+		runDictCheck(args[1:])
+
+	default:
+		fmt.Println("未知字典命令:", args[0])
+	}
+}
+
+func dictLayerExists(name string) bool {
+	if strings.HasPrefix(name, "builtin:") {
+		_, ok := builtinDicts[strings.TrimPrefix(name, "builtin:")]
+		return ok
+	}
+	if strings.HasPrefix(name, "instance:") {
+		_, err := os.Stat(instanceDictPath(strings.TrimPrefix(name, "instance:")))
+		return err == nil
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(CACHE_DIR, DICTS_DIR, parts[0], parts[1]))
+	return err == nil
+}
+
+func setDictLayerEnabled(name string, enable bool) {
+	disabled := make([]string, 0, len(config.DisabledDicts))
+	for _, d := range config.DisabledDicts {
+		if d != name {
+			disabled = append(disabled, d)
+		}
+	}
+	if !enable {
+		disabled = append(disabled, name)
+	}
+	config.DisabledDicts = disabled
+}
+
+func printDictLayer(layer *dictLayer) {
+	status := "\033[32m启用\033[0m"
+	if !layer.Enabled {
+		status = "\033[33m禁用\033[0m"
+	}
+	fmt.Printf("  - %s [%s] %d 条规则\n", layer.Name, status, len(layer.Rules))
+	if layer.Path != "" {
+		fmt.Printf("    路径: %s\n", layer.Path)
+	}
+	for _, e := range layer.Errors {
+		fmt.Printf("    \033[31m%s\033[0m\n", e)
+	}
+}
+
+func printAllDictLayers() {
+	fmt.Printf("\n默认字典语言: %s\n", defaultDictLocale())
+	fmt.Println("字典层 (优先级从高到低):")
+	for _, locale := range listDictLocales() {
+		fmt.Printf("\n[%s]\n", locale)
+		for _, layer := range buildDictLayers(locale, "") {
+			printDictLayer(layer)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(CACHE_DIR, DICTS_DIR, INSTANCE_DICTS))
+	if len(entries) > 0 {
+		fmt.Println("\n[实例覆盖]")
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), DICT_EXT) {
+				continue
+			}
+			id := strings.TrimSuffix(entry.Name(), DICT_EXT)
+			printDictLayer(loadDictFileLayer("instance:"+id, instanceDictPath(id)))
+		}
+	}
+}
+
+func printServerDictLayers(server *ServerInstance) {
+	locale := serverDictLocale(server)
+	if locale == "" {
+		fmt.Printf("服务器 %s 已禁用日志翻译\n", server.ID)
+		return
+	}
+	fmt.Printf("\n服务器 %s 字典语言: %s\n", server.ID, locale)
+	fmt.Println("生效字典层 (优先级从高到低):")
+	for _, layer := range buildDictLayers(locale, server.ID) {
+		printDictLayer(layer)
+	}
+}
+
+func editTranslationDict() {
+	clearScreen()
+	fmt.Println("\n\033[1;36m日志翻译字典编辑\033[0m")
+	fmt.Println("----------------------------------------")
+	locale := defaultDictLocale()
+	fmt.Printf("当前字典语言: %s\n", locale)
+	fmt.Println("字典层 (优先级从高到低):")
+	for _, layer := range buildDictLayers(locale, "") {
+		printDictLayer(layer)
+	}
+
+	customPath := filepath.Join(CACHE_DIR, DICTS_DIR, locale, CUSTOM_DICT)
+
+	fmt.Println("\n操作选项:")
+	fmt.Println("1. 使用系统编辑器编辑自定义字典")
+	fmt.Println("2. 编辑实例覆盖字典")
+	fmt.Println("3. 恢复默认字典")
+	fmt.Println("4. 切换默认字典语言")
+	fmt.Println("0. 返回主菜单")
+	fmt.Println("----------------------------------------")
+	fmt.Print("请选择操作: ")
+
+	var choice int
+	fmt.Scanln(&choice)
+
+	switch choice {
+	case 0:
+		return
+	case 1:
+		os.MkdirAll(filepath.Dir(customPath), 0755)
+		if _, err := os.Stat(customPath); os.IsNotExist(err) {
+			writeCustomDictTemplate(customPath)
+		}
+		openDictEditor(customPath)
+	case 2:
+		fmt.Print("请输入服务器ID: ")
+		var serverID string
+		fmt.Scanln(&serverID)
+		if _, ok := config.ServerInstalls[serverID]; !ok {
+			fmt.Printf("找不到服务器实例: %s\n", serverID)
+			time.Sleep(2 * time.Second)
+			return
+		}
+		path := instanceDictPath(serverID)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			writeCustomDictTemplate(path)
+		}
+		openDictEditor(path)
+	case 3:
+		if err := writeCustomDictTemplate(customPath); err != nil {
+			fmt.Println("恢复默认字典失败:", err)
+		} else if err := resetMigratedDict(locale); err != nil {
+			fmt.Println("恢复默认字典失败:", err)
+		} else {
+			setDictLayerEnabled("builtin:"+locale, true)
+			saveConfig()
+			fmt.Println("默认字典已恢复，重新加载中...")
+			loadTranslationDict()
+		}
+		time.Sleep(2 * time.Second)
+	case 4:
+		fmt.Printf("可用语言: %s\n", strings.Join(listDictLocales(), ", "))
+		fmt.Print("请输入语言: ")
+		var newLocale string
+		fmt.Scanln(&newLocale)
+		if newLocale != "" {
+			config.DictLocale = newLocale
+			saveConfig()
+			os.MkdirAll(filepath.Join(CACHE_DIR, DICTS_DIR, newLocale), 0755)
+			loadTranslationDict()
+			fmt.Printf("默认字典语言已设置为 %s\n", newLocale)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func openDictEditor(path string) {
+	var editor string
+	if runtime.GOOS == "windows" {
+		editor = "notepad"
+	} else {
+		editor = "nano"
+	}
+
+	cmd := exec.Command(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		fmt.Println("编辑失败:", err)
+	} else {
+		fmt.Println("字典已更新，重新加载中...")
+		loadTranslationDict()
+	}
+	time.Sleep(2 * time.Second)
+}
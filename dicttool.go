@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const MAX_REPORT_LINES = 20
+
+type dictRuleStat struct {
+	Rule *dictRule
+	Hits int
+}
+
+type dictMultiMatch struct {
+	LineNo int
+	Line   string
+	Rules  []*dictRule
+}
+
+// openLogFile 打开日志文件，.gz 文件自动解压
+func openLogFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
+
+func (r *dictRule) String() string {
+	return fmt.Sprintf("%s:%d %s", r.Layer, r.Line, r.Pattern)
+}
+
+// placeholderErrors 检查翻译文本中引用了不存在分组的占位符
+func (r *dictRule) placeholderErrors() []string {
+	var errs []string
+	groups := r.re.NumSubexp()
+	for _, m := range placeholderRe.FindAllStringSubmatch(r.Translation, -1) {
+		idx, _ := strconv.Atoi(m[1])
+		if idx > groups {
+			errs = append(errs, fmt.Sprintf("第 %d 行: 占位符 %s 超出分组数量 (正则只有 %d 个分组)", r.Line, m[0], groups))
+		}
+	}
+	return errs
+}
+
+func dictForCLI(args []string) (*translationDict, []string) {
+	var rest []string
+	var server *ServerInstance
+	locale := ""
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--server":
+			if i+1 < len(args) {
+				i++
+				server = config.ServerInstalls[args[i]]
+				if server == nil {
+					fmt.Printf("找不到服务器实例: %s\n", args[i])
+					return nil, nil
+				}
+			}
+		case "--locale":
+			if i+1 < len(args) {
+				i++
+				locale = args[i]
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	if locale != "" {
+		serverID := ""
+		if server != nil {
+			serverID = server.ID
+		}
+		return &translationDict{Locale: locale, Layers: buildDictLayers(locale, serverID)}, rest
+	}
+	if server != nil && serverDictLocale(server) == "" {
+		fmt.Printf("服务器 %s 已禁用日志翻译\n", server.ID)
+		return nil, nil
+	}
+	return getServerDict(server), rest
+}
+
+func runDictTest(args []string) {
+	quiet := false
+	var filtered []string
+	for _, a := range args {
+		if a == "-q" || a == "--quiet" {
+			quiet = true
+		} else {
+			filtered = append(filtered, a)
+		}
+	}
+
+	dict, rest := dictForCLI(filtered)
+	if dict == nil {
+		return
+	}
+	if len(rest) < 1 {
+		fmt.Println("用法: emcm dict test <日志文件> [--server 服务器ID] [--locale 语言] [-q]")
+		return
+	}
+
+	reader, err := openLogFile(rest[0])
+	if err != nil {
+		fmt.Println("打开日志文件失败:", err)
+		return
+	}
+	defer reader.Close()
+
+	rules := dict.rules()
+	stats := make([]*dictRuleStat, len(rules))
+	for i, rule := range rules {
+		stats[i] = &dictRuleStat{Rule: rule}
+	}
+
+	var multi []dictMultiMatch
+	total, translated := 0, 0
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		total++
+		line := scanner.Text()
+		output := line
+		var matched []*dictRule
+
+		for i, rule := range rules {
+			result, ok := rule.apply(line)
+			if !ok {
+				continue
+			}
+			if len(matched) == 0 {
+				output = result
+				translated++
+			}
+			matched = append(matched, rule)
+			stats[i].Hits++
+		}
+
+		if len(matched) > 1 {
+			multi = append(multi, dictMultiMatch{LineNo: total, Line: line, Rules: matched})
+		}
+
+		if !quiet {
+			if len(matched) > 0 {
+				fmt.Printf("\033[32m%6d\033[0m %s\n", total, output)
+			} else {
+				fmt.Printf("%6d %s\n", total, output)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Println("读取日志文件失败:", err)
+	}
+
+	fmt.Println("\n----------------------------------------")
+	fmt.Printf("字典语言: %s\n", dict.Locale)
+	fmt.Printf("共 %d 行，已翻译 %d 行", total, translated)
+	if total > 0 {
+		fmt.Printf(" (%.1f%%)", float64(translated)*100/float64(total))
+	}
+	fmt.Println()
+
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Hits > stats[j].Hits })
+
+	fmt.Println("\n规则命中次数:")
+	var unused []*dictRule
+	for _, s := range stats {
+		if s.Hits == 0 {
+			unused = append(unused, s.Rule)
+			continue
+		}
+		fmt.Printf("  %6d  %s\n", s.Hits, s.Rule)
+	}
+
+	if len(unused) > 0 {
+		fmt.Printf("\n\033[33m从未匹配的规则 (%d):\033[0m\n", len(unused))
+		for _, rule := range unused {
+			fmt.Printf("  %s\n", rule)
+		}
+	}
+
+	if len(multi) > 0 {
+		fmt.Printf("\n\033[33m被多条规则匹配的行 (%d):\033[0m\n", len(multi))
+		for i, m := range multi {
+			if i >= MAX_REPORT_LINES {
+				fmt.Printf("  ... 还有 %d 行\n", len(multi)-MAX_REPORT_LINES)
+				break
+			}
+			fmt.Printf("  第 %d 行: %s\n", m.LineNo, m.Line)
+			for j, rule := range m.Rules {
+				mark := "  "
+				if j == 0 {
+					mark = "* "
+				}
+				fmt.Printf("    %s%s\n", mark, rule)
+			}
+		}
+		fmt.Println("  (* 为实际生效的规则)")
+	}
+}
+
+// allDictLayers 返回所有语言的字典层和实例覆盖字典
+func allDictLayers() []*dictLayer {
+	var layers []*dictLayer
+	seen := make(map[string]bool)
+	for _, locale := range listDictLocales() {
+		for _, layer := range buildDictLayers(locale, "") {
+			seen[layer.Name] = true
+			layers = append(layers, layer)
+		}
+	}
+	for id := range config.ServerInstalls {
+		name := "instance:" + id
+		if _, err := os.Stat(instanceDictPath(id)); err == nil && !seen[name] {
+			layers = append(layers, loadDictFileLayer(name, instanceDictPath(id)))
+		}
+	}
+	return layers
+}
+
+// dictLayerProblems 返回字典层的解析错误、占位符错误和重复规则
+func dictLayerProblems(layer *dictLayer) []string {
+	errs := append([]string{}, layer.Errors...)
+	patterns := make(map[string]int)
+	for _, rule := range layer.Rules {
+		errs = append(errs, rule.placeholderErrors()...)
+		if first, ok := patterns[rule.Pattern]; ok {
+			errs = append(errs, fmt.Sprintf("第 %d 行: 与第 %d 行的正则重复，该规则不会生效", rule.Line, first))
+		} else {
+			patterns[rule.Pattern] = rule.Line
+		}
+	}
+	return errs
+}
+
+func runDictCheck(args []string) {
+	var layers []*dictLayer
+	if len(args) > 0 {
+		dict, _ := dictForCLI(args)
+		if dict == nil {
+			return
+		}
+		layers = dict.Layers
+	} else {
+		layers = allDictLayers()
+	}
+
+	problems := 0
+	for _, layer := range layers {
+		errs := dictLayerProblems(layer)
+		if len(errs) == 0 {
+			fmt.Printf("\033[32m✔\033[0m %s (%d 条规则)\n", layer.Name, len(layer.Rules))
+			continue
+		}
+		fmt.Printf("\033[31m✘\033[0m %s\n", layer.Name)
+		for _, e := range errs {
+			fmt.Printf("    %s\n", e)
+		}
+		problems += len(errs)
+	}
+
+	if problems > 0 {
+		fmt.Printf("\n发现 %d 个问题\n", problems)
+		os.Exit(1)
+	}
+	fmt.Println("\n所有字典检查通过")
+}
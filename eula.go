@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	EULA_FILE = "eula.txt"
+	EULA_URL  = "https://aka.ms/MinecraftEULA"
+	// EULA_TIME_FORMAT 与服务端生成的 eula.txt 中 java.util.Date 的格式相同
+	EULA_TIME_FORMAT = "Mon Jan 02 15:04:05 MST 2006"
+)
+
+func eulaPath(server *ServerInstance) string {
+	return filepath.Join(serverDir(server), EULA_FILE)
+}
+
+// eulaAccepted 检查 eula.txt 中是否为 eula=true
+func eulaAccepted(server *ServerInstance) bool {
+	data, err := os.ReadFile(eulaPath(server))
+	if err != nil {
+		return false
+	}
+	value, _ := parseProperties(string(data)).get("eula")
+	return strings.EqualFold(strings.TrimSpace(value), "true")
+}
+
+// acceptEULA 写入 eula.txt 并在实例上记录同意时间
+func acceptEULA(server *ServerInstance) error {
+	now := time.Now()
+	content := fmt.Sprintf("#By changing the setting below to TRUE you are indicating your agreement to our EULA (%s).\n#%s\neula=true\n",
+		EULA_URL, now.Format(EULA_TIME_FORMAT))
+	if err := os.WriteFile(eulaPath(server), []byte(content), 0644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", EULA_FILE, err)
+	}
+	server.EULAAcceptedAt = now.Format(time.RFC3339)
+	server.UpdatedAt = now.Format(time.RFC3339)
+	saveConfig()
+	return nil
+}
+
+// promptEULA 显示 EULA 链接并要求用户明确同意
+func promptEULA(scanner *bufio.Scanner) bool {
+	fmt.Println("运行 Minecraft 服务器需要同意 Minecraft 最终用户许可协议 (EULA):")
+	fmt.Printf("  %s\n", EULA_URL)
+	fmt.Print("是否已阅读并同意 EULA? (y/n): ")
+	if !scanner.Scan() {
+		fmt.Println()
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// isInteractive 判断标准输入是否为终端，脚本中运行时不进行询问
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ensureEULA 在启动前检查 EULA，未同意时在终端中询问，避免服务端启动后直接退出
+func ensureEULA(server *ServerInstance) bool {
+	if eulaAccepted(server) {
+		if server.EULAAcceptedAt == "" {
+			// 在 EMCM 之外修改过 eula.txt，补充记录
+			if info, err := os.Stat(eulaPath(server)); err == nil {
+				server.EULAAcceptedAt = info.ModTime().Format(time.RFC3339)
+				saveConfig()
+			}
+		}
+		return true
+	}
+	if server.EULAAcceptedAt != "" {
+		// 已经同意过，但 eula.txt 丢失或被覆盖 (例如恢复了旧备份)
+		fmt.Printf("已于 %s 同意 EULA，重新写入 %s\n", server.EULAAcceptedAt, EULA_FILE)
+		if err := acceptEULA(server); err != nil {
+			fmt.Println(err)
+			return false
+		}
+		return true
+	}
+
+	if !isInteractive() {
+		fmt.Printf("\033[31m实例 %s 尚未同意 Minecraft EULA (%s)\033[0m\n", server.ID, EULA_URL)
+		fmt.Printf("阅读后运行 emcm eula %s accept\n", server.ID)
+		return false
+	}
+	if !promptEULA(bufio.NewScanner(os.Stdin)) {
+		fmt.Println("未同意 EULA，服务器无法启动")
+		return false
+	}
+	if err := acceptEULA(server); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	fmt.Println("已同意 EULA")
+	return true
+}
+
+func handleEULACLI(args []string) {
+	if len(args) < 1 {
+		fmt.Println("用法: emcm eula <服务器ID> [accept]")
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	if len(args) > 1 && args[1] == "accept" {
+		if err := acceptEULA(server); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("已同意 Minecraft EULA (%s)，写入 %s\n", EULA_URL, eulaPath(server))
+		return
+	}
+
+	switch {
+	case eulaAccepted(server) && server.EULAAcceptedAt != "":
+		fmt.Printf("已同意 EULA (%s)\n", server.EULAAcceptedAt)
+	case eulaAccepted(server):
+		fmt.Printf("%s 中已同意 EULA\n", EULA_FILE)
+	case server.EULAAcceptedAt != "":
+		fmt.Printf("已于 %s 同意 EULA，但 %s 缺失或为 false (启动时会重新写入)\n", server.EULAAcceptedAt, EULA_FILE)
+	default:
+		fmt.Printf("尚未同意 EULA (%s)，阅读后运行 emcm eula %s accept\n", EULA_URL, server.ID)
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EVENTS_DIR = "events"
+
+	EVENT_PLAYER_JOIN  = "player_join"
+	EVENT_PLAYER_LEAVE = "player_leave"
+	EVENT_CHAT         = "chat"
+	EVENT_DEATH        = "death"
+	EVENT_ADVANCEMENT  = "advancement"
+	EVENT_STARTED      = "started"
+	EVENT_LAG          = "lag"
+	EVENT_PLUGIN_ERROR = "plugin_error"
+	EVENT_EXCEPTION    = "exception"
+)
+
+var (
+	logPrefixRe   = regexp.MustCompile(`^\[[^\]]*\](?: ?\[[^\]]*\])*:? ?(.*)$`)
+	logLevelRe    = regexp.MustCompile(`^(?:\[[^\]]*\] ?)*?\[[^\]]*?[ /](TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL|SEVERE)\]`)
+	uuidOfRe      = regexp.MustCompile(`^UUID of player (\w+) is ([0-9a-fA-F-]{32,36})`)
+	loggedInRe    = regexp.MustCompile(`^(\w+)\[/?([^\]]*?)(?::\d+)?\] logged in with entity id`)
+	joinedRe      = regexp.MustCompile(`^(\w+) joined the game`)
+	leftRe        = regexp.MustCompile(`^(\w+) left the game`)
+	lostConnRe    = regexp.MustCompile(`^(\w+) lost connection: (.*)$`)
+	chatRe        = regexp.MustCompile(`^(?:\[Not Secure\] )?<([^>]+)> (.*)$`)
+	advancementRe = regexp.MustCompile(`^(\w+) has (made the advancement|completed the challenge|reached the goal) \[(.+)\]`)
+	doneRe        = regexp.MustCompile(`^Done \((\d+(?:[.,]\d+)?)s\)!`)
+	lagRe         = regexp.MustCompile(`^Can't keep up! Is the server overloaded\? Running (\d+)ms or (\d+) ticks behind`)
+	pluginErrRe   = regexp.MustCompile(`^(?:Error occurred while enabling (\S+)(?: v?(\S+))?|Could not load '(?:.*[/\\])?([^/\\']+)' in folder)`)
+	exceptionRe   = regexp.MustCompile(`((?:[a-zA-Z_$][\w$]*\.)+[\w$]*(?:Exception|Error|Throwable))\b(?::\s*(.*))?`)
+	stackLineRe   = regexp.MustCompile(`^(?:\s+at |\s*Caused by: |\s+\.\.\. \d+ more|\s*Suppressed: )`)
+	deathRe       = regexp.MustCompile(`^(\w{3,16}) (was |fell |drowned|died|blew up|burned|went up in flames|went off with a bang|hit the ground|tried to swim in lava|starved|suffocated|withered away|experienced kinetic energy|froze to death|walked into|discovered the floor was lava|didn't want to live|left the confines of this world|was squashed|was impaled|was skewered|was stung|was poked|was obliterated)(.*)$`)
+)
+
+var advancementKinds = map[string]string{
+	"made the advancement":    "advancement",
+	"completed the challenge": "challenge",
+	"reached the goal":        "goal",
+}
+
+type LogEvent struct {
+	Time     time.Time         `json:"time"`
+	ServerID string            `json:"server_id"`
+	Type     string            `json:"type"`
+	Player   string            `json:"player,omitempty"`
+	UUID     string            `json:"uuid,omitempty"`
+	IP       string            `json:"ip,omitempty"`
+	Message  string            `json:"message,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+	Stack    []string          `json:"stack,omitempty"`
+	Raw      string            `json:"raw"`
+}
+
+// eventBus 是进程内的日志事件总线，订阅者在发布协程中同步调用
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers map[int]func(LogEvent)
+	nextID   int
+}
+
+var logEvents = &eventBus{handlers: make(map[int]func(LogEvent))}
+
+func (b *eventBus) subscribe(handler func(LogEvent)) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	b.handlers[b.nextID] = handler
+	return b.nextID
+}
+
+func (b *eventBus) unsubscribe(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.handlers, id)
+}
+
+func (b *eventBus) publish(event LogEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+}
+
+type playerSession struct {
+	UUID   string
+	IP     string
+	Reason string
+}
+
+// logEventParser 把一条输出流解析成事件，异常堆栈会被合并到同一个事件中
+type logEventParser struct {
+	serverID string
+	players  map[string]*playerSession
+	lastLine string
+	lastMsg  string
+	pending  *LogEvent
+	mu       *sync.Mutex
+}
+
+func newLogEventParser(serverID string, players map[string]*playerSession, mu *sync.Mutex) *logEventParser {
+	if players == nil {
+		players = make(map[string]*playerSession)
+	}
+	if mu == nil {
+		mu = &sync.Mutex{}
+	}
+	return &logEventParser{serverID: serverID, players: players, mu: mu}
+}
+
+func splitLogLine(line string) (level, message string) {
+	if m := logLevelRe.FindStringSubmatch(line); m != nil {
+		level = m[1]
+	}
+	if strings.HasPrefix(line, "[") {
+		if m := logPrefixRe.FindStringSubmatch(line); m != nil {
+			return level, m[1]
+		}
+	}
+	return level, line
+}
+
+func (p *logEventParser) newEvent(eventType, raw string) LogEvent {
+	return LogEvent{
+		Time:     time.Now(),
+		ServerID: p.serverID,
+		Type:     eventType,
+		Raw:      raw,
+	}
+}
+
+func (p *logEventParser) session(name string) *playerSession {
+	s, ok := p.players[name]
+	if !ok {
+		s = &playerSession{}
+		p.players[name] = s
+	}
+	return s
+}
+
+// feed 处理一行输出，返回已完成的事件
+func (p *logEventParser) feed(line string) []LogEvent {
+	var out []LogEvent
+
+	if stackLineRe.MatchString(line) {
+		if p.pending == nil {
+			event := p.newEvent(EVENT_EXCEPTION, p.lastLine)
+			event.Message = p.lastMsg
+			if m := exceptionRe.FindStringSubmatch(p.lastMsg); m != nil {
+				event.Data = map[string]string{"exception": m[1]}
+			}
+			p.pending = &event
+		}
+		p.pending.Stack = append(p.pending.Stack, line)
+		if p.pending.Data == nil {
+			if m := exceptionRe.FindStringSubmatch(line); m != nil && strings.Contains(line, "Caused by:") {
+				p.pending.Data = map[string]string{"exception": m[1]}
+			}
+		}
+		return nil
+	}
+
+	if p.pending != nil {
+		out = append(out, *p.pending)
+		p.pending = nil
+	}
+
+	level, msg := splitLogLine(line)
+	p.lastLine = line
+	p.lastMsg = msg
+
+	if event, ok := p.parseMessage(level, msg, line); ok {
+		out = append(out, event)
+	}
+	return out
+}
+
+func (p *logEventParser) flush() []LogEvent {
+	if p.pending == nil {
+		return nil
+	}
+	event := *p.pending
+	p.pending = nil
+	return []LogEvent{event}
+}
+
+func (p *logEventParser) parseMessage(level, msg, raw string) (LogEvent, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if m := uuidOfRe.FindStringSubmatch(msg); m != nil {
+		p.session(m[1]).UUID = m[2]
+		return LogEvent{}, false
+	}
+
+	if m := loggedInRe.FindStringSubmatch(msg); m != nil {
+		p.session(m[1]).IP = m[2]
+		return LogEvent{}, false
+	}
+
+	if m := joinedRe.FindStringSubmatch(msg); m != nil {
+		s := p.session(m[1])
+		event := p.newEvent(EVENT_PLAYER_JOIN, raw)
+		event.Player, event.UUID, event.IP = m[1], s.UUID, s.IP
+		return event, true
+	}
+
+	if m := lostConnRe.FindStringSubmatch(msg); m != nil {
+		if s, ok := p.players[m[1]]; ok {
+			s.Reason = m[2]
+		}
+		return LogEvent{}, false
+	}
+
+	if m := leftRe.FindStringSubmatch(msg); m != nil {
+		event := p.newEvent(EVENT_PLAYER_LEAVE, raw)
+		event.Player = m[1]
+		if s, ok := p.players[m[1]]; ok {
+			event.UUID, event.IP, event.Message = s.UUID, s.IP, s.Reason
+			delete(p.players, m[1])
+		}
+		return event, true
+	}
+
+	if m := chatRe.FindStringSubmatch(msg); m != nil {
+		event := p.newEvent(EVENT_CHAT, raw)
+		event.Player, event.Message = m[1], m[2]
+		if s, ok := p.players[m[1]]; ok {
+			event.UUID = s.UUID
+		}
+		return event, true
+	}
+
+	if m := advancementRe.FindStringSubmatch(msg); m != nil {
+		event := p.newEvent(EVENT_ADVANCEMENT, raw)
+		event.Player, event.Message = m[1], m[3]
+		event.Data = map[string]string{"kind": advancementKinds[m[2]]}
+		return event, true
+	}
+
+	if m := doneRe.FindStringSubmatch(msg); m != nil {
+		event := p.newEvent(EVENT_STARTED, raw)
+		event.Data = map[string]string{"seconds": strings.ReplaceAll(m[1], ",", ".")}
+		return event, true
+	}
+
+	if m := lagRe.FindStringSubmatch(msg); m != nil {
+		event := p.newEvent(EVENT_LAG, raw)
+		event.Data = map[string]string{"ms": m[1], "ticks": m[2]}
+		return event, true
+	}
+
+	if m := pluginErrRe.FindStringSubmatch(msg); m != nil {
+		event := p.newEvent(EVENT_PLUGIN_ERROR, raw)
+		event.Message = msg
+		event.Data = map[string]string{"plugin": m[1] + m[3]}
+		if m[2] != "" {
+			event.Data["version"] = m[2]
+		}
+		return event, true
+	}
+
+	if m := deathRe.FindStringSubmatch(msg); m != nil && (level == "" || level == "INFO") {
+		// 已跟踪到在线玩家时只认在线玩家，避免把 "Config was reloaded" 这类普通日志误判为死亡消息
+		if s, online := p.players[m[1]]; online || len(p.players) == 0 {
+			event := p.newEvent(EVENT_DEATH, raw)
+			event.Player, event.Message = m[1], msg
+			if online {
+				event.UUID = s.UUID
+			}
+			return event, true
+		}
+	}
+
+	return LogEvent{}, false
+}
+
+func eventLogPath(serverID string) string {
+	return filepath.Join(CACHE_DIR, EVENTS_DIR, serverID+".jsonl")
+}
+
+// eventRecorder 负责一个运行中实例的事件解析、发布和落盘
+type eventRecorder struct {
+	serverID string
+	parsers  []*logEventParser
+	file     *os.File
+	fileMu   sync.Mutex
+	subID    int
+}
+
+func newEventRecorder(serverID string, streams int) *eventRecorder {
+	r := &eventRecorder{serverID: serverID}
+
+	players := make(map[string]*playerSession)
+	mu := &sync.Mutex{}
+	for i := 0; i < streams; i++ {
+		r.parsers = append(r.parsers, newLogEventParser(serverID, players, mu))
+	}
+
+	os.MkdirAll(filepath.Join(CACHE_DIR, EVENTS_DIR), 0755)
+	file, err := os.OpenFile(eventLogPath(serverID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("打开事件日志失败: %v\n", err)
+	} else {
+		r.file = file
+	}
+
+	r.subID = logEvents.subscribe(func(event LogEvent) {
+		if event.ServerID != r.serverID {
+			return
+		}
+		r.write(event)
+	})
+	return r
+}
+
+func (r *eventRecorder) write(event LogEvent) {
+	r.fileMu.Lock()
+	defer r.fileMu.Unlock()
+	if r.file == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	r.file.Write(append(data, '\n'))
+}
+
+func (r *eventRecorder) feed(stream int, line string) {
+	for _, event := range r.parsers[stream].feed(line) {
+		logEvents.publish(event)
+	}
+}
+
+func (r *eventRecorder) close() {
+	for _, parser := range r.parsers {
+		for _, event := range parser.flush() {
+			logEvents.publish(event)
+		}
+	}
+	logEvents.unsubscribe(r.subID)
+
+	r.fileMu.Lock()
+	defer r.fileMu.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+func handleEventsCLI(args []string) {
+	if len(args) < 1 {
+		fmt.Println("用法: emcm events <服务器ID> [--type 事件类型] [-n 条数]")
+		fmt.Println("事件类型: player_join, player_leave, chat, death, advancement, started, lag, plugin_error, exception")
+		return
+	}
+
+	serverID := args[0]
+	if _, ok := config.ServerInstalls[serverID]; !ok {
+		fmt.Printf("找不到服务器实例: %s\n", serverID)
+		return
+	}
+
+	eventType := ""
+	limit := 50
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--type":
+			if i+1 < len(args) {
+				i++
+				eventType = args[i]
+			}
+		case "-n":
+			if i+1 < len(args) {
+				i++
+				if n, err := strconv.Atoi(args[i]); err == nil {
+					limit = n
+				}
+			}
+		}
+	}
+
+	file, err := os.Open(eventLogPath(serverID))
+	if err != nil {
+		fmt.Println("暂无事件记录")
+		return
+	}
+	defer file.Close()
+
+	var matched []LogEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var event LogEvent
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			continue
+		}
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+		matched = append(matched, event)
+	}
+
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+	for _, event := range matched {
+		printLogEvent(event)
+	}
+}
+
+func printLogEvent(event LogEvent) {
+	ts := event.Time.Format("2006-01-02 15:04:05")
+	switch event.Type {
+	case EVENT_PLAYER_JOIN:
+		fmt.Printf("%s \033[32m加入\033[0m %s uuid=%s ip=%s\n", ts, event.Player, event.UUID, event.IP)
+	case EVENT_PLAYER_LEAVE:
+		fmt.Printf("%s \033[33m离开\033[0m %s %s\n", ts, event.Player, event.Message)
+	case EVENT_CHAT:
+		fmt.Printf("%s 聊天 <%s> %s\n", ts, event.Player, event.Message)
+	case EVENT_DEATH:
+		fmt.Printf("%s 死亡 %s\n", ts, event.Message)
+	case EVENT_ADVANCEMENT:
+		fmt.Printf("%s 进度 %s [%s]\n", ts, event.Player, event.Message)
+	case EVENT_STARTED:
+		fmt.Printf("%s \033[32m启动完成\033[0m 耗时 %s 秒\n", ts, event.Data["seconds"])
+	case EVENT_LAG:
+		fmt.Printf("%s \033[33m卡顿\033[0m 落后 %sms (%s 刻)\n", ts, event.Data["ms"], event.Data["ticks"])
+	case EVENT_PLUGIN_ERROR:
+		fmt.Printf("%s \033[31m插件错误\033[0m %s: %s\n", ts, event.Data["plugin"], event.Message)
+	case EVENT_EXCEPTION:
+		fmt.Printf("%s \033[31m异常\033[0m %s (%d 行堆栈)\n", ts, event.Data["exception"], len(event.Stack))
+		if event.Message != "" {
+			fmt.Printf("    %s\n", event.Message)
+		}
+	default:
+		fmt.Printf("%s %s %s\n", ts, event.Type, event.Raw)
+	}
+}
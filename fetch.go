@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Modrinth 要求请求带有能识别客户端的 User-Agent
+	HTTP_USER_AGENT = "Easily-Miku/emcm (github.com/Easily-Miku/emcm)"
+	HTTP_TIMEOUT    = 30 * time.Second
+)
+
+var httpClient = &http.Client{Timeout: HTTP_TIMEOUT}
+
+func httpGet(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", HTTP_USER_AGENT)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &httpStatusError{rawURL, resp.StatusCode, resp.Status}
+	}
+	return resp, nil
+}
+
+type httpStatusError struct {
+	url    string
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("请求 %s 失败: %s", e.url, e.status)
+}
+
+func isNotFound(err error) bool {
+	statusErr, ok := err.(*httpStatusError)
+	return ok && statusErr.code == http.StatusNotFound
+}
+
+// httpGetJSON 请求 URL 并把返回的 JSON 解析到 target
+func httpGetJSON(rawURL string, target interface{}) error {
+	resp, err := httpGet(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("解析 %s 的响应失败: %v", rawURL, err)
+	}
+	return nil
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// downloadVerified 下载文件到 dst，hashes 为算法到十六进制摘要的映射 (sha1、sha256、sha512)，
+// 先写入临时文件，全部摘要一致后才替换 dst
+func downloadVerified(rawURL, dst string, hashes map[string]string) error {
+	resp, err := httpGet(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writers := []io.Writer{out}
+	sums := make(map[string]hash.Hash)
+	for algorithm, expected := range hashes {
+		if h := newHash(algorithm); h != nil && expected != "" {
+			sums[algorithm] = h
+			writers = append(writers, h)
+		}
+	}
+	_, err = io.Copy(io.MultiWriter(writers...), resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("下载 %s 失败: %v", rawURL, err)
+	}
+	for algorithm, h := range sums {
+		if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, hashes[algorithm]) {
+			os.Remove(tmp)
+			return fmt.Errorf("%s 校验失败: 应为 %s，实际为 %s", algorithm, hashes[algorithm], actual)
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
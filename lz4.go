@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 1.20.5 起区块可以使用 LZ4 压缩 (region-file-compression=lz4)，格式为 lz4-java 的 LZ4BlockOutputStream:
+// 每个块由 "LZ4Block" 魔数、方法字节、压缩长度、原始长度和校验和组成，最后以一个空块结束
+var lz4BlockMagic = []byte("LZ4Block")
+
+const (
+	LZ4_BLOCK_HEADER = 21
+	LZ4_METHOD_RAW   = 0x10
+	LZ4_METHOD_LZ4   = 0x20
+	// LZ4_MAX_BLOCK_SIZE 是 lz4-java 允许的最大块大小，超出的长度只可能来自损坏的数据
+	LZ4_MAX_BLOCK_SIZE = 1 << 25
+)
+
+// decodeLZ4Stream 解压 LZ4BlockOutputStream 数据，校验和不做检查，损坏的数据会在解析 NBT 时发现
+func decodeLZ4Stream(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) > 0 {
+		if len(data) < LZ4_BLOCK_HEADER || !bytes.Equal(data[:len(lz4BlockMagic)], lz4BlockMagic) {
+			return nil, errors.New("LZ4 数据块头无效")
+		}
+		method := data[8] & 0xf0
+		compressedLen := int(binary.LittleEndian.Uint32(data[9:13]))
+		originalLen := int(binary.LittleEndian.Uint32(data[13:17]))
+		data = data[LZ4_BLOCK_HEADER:]
+		if originalLen == 0 {
+			break
+		}
+		if compressedLen < 0 || compressedLen > len(data) || originalLen < 0 || originalLen > LZ4_MAX_BLOCK_SIZE {
+			return nil, errors.New("LZ4 数据块长度无效")
+		}
+
+		block := data[:compressedLen]
+		data = data[compressedLen:]
+		switch method {
+		case LZ4_METHOD_RAW:
+			out = append(out, block...)
+		case LZ4_METHOD_LZ4:
+			decoded, err := decodeLZ4Block(block, originalLen)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, decoded...)
+		default:
+			return nil, fmt.Errorf("未知的 LZ4 块类型: 0x%x", method)
+		}
+	}
+	return out, nil
+}
+
+// decodeLZ4Block 解压一个 LZ4 块 (不带帧头的原始块格式)
+func decodeLZ4Block(src []byte, size int) ([]byte, error) {
+	dst := make([]byte, 0, size)
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		literals := int(token >> 4)
+		if literals == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errors.New("LZ4 数据被截断")
+				}
+				b := src[i]
+				i++
+				literals += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if i+literals > len(src) {
+			return nil, errors.New("LZ4 数据被截断")
+		}
+		if len(dst)+literals > size {
+			return nil, errors.New("LZ4 解压后超出声明的长度")
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errors.New("LZ4 数据被截断")
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errors.New("LZ4 匹配偏移无效")
+		}
+		match := int(token & 0x0f)
+		if match == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errors.New("LZ4 数据被截断")
+				}
+				b := src[i]
+				i++
+				match += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		match += 4
+		if len(dst)+match > size {
+			return nil, errors.New("LZ4 解压后超出声明的长度")
+		}
+		// 匹配区间可能与输出重叠，需要逐字节复制
+		start := len(dst) - offset
+		for j := 0; j < match; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	if len(dst) != size {
+		return nil, fmt.Errorf("LZ4 解压后长度不符: %d != %d", len(dst), size)
+	}
+	return dst, nil
+}
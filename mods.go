@@ -0,0 +1,950 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	MODS_DIR = "mods"
+
+	LOADER_FABRIC   = "fabric"
+	LOADER_QUILT    = "quilt"
+	LOADER_FORGE    = "forge"
+	LOADER_NEOFORGE = "neoforge"
+
+	DEP_REQUIRED  = "required"
+	DEP_OPTIONAL  = "optional"
+	DEP_BREAKS    = "breaks"
+	DEP_CONFLICTS = "conflicts"
+
+	// MAX_NESTED_JARS 限制 jar-in-jar 的嵌套深度
+	MAX_NESTED_JARS = 4
+)
+
+var loaderNames = map[string]string{
+	LOADER_FABRIC:   "Fabric",
+	LOADER_QUILT:    "Quilt",
+	LOADER_FORGE:    "Forge",
+	LOADER_NEOFORGE: "NeoForge",
+}
+
+// modDependency 是模组声明的一条依赖，ranges 满足其一即可，为空表示任意版本
+type modDependency struct {
+	id     string
+	ranges []string
+	kind   string
+	// side 是 Forge 依赖的生效端 (BOTH、CLIENT、SERVER)
+	side string
+}
+
+// modInfo 是从 jar 中读取的一个模组
+type modInfo struct {
+	id       string
+	name     string
+	version  string
+	format   string
+	deps     []modDependency
+	provides []string
+	// loaderVersion 是 mods.toml 中 javafml 的版本范围
+	loaderVersion string
+	// side 是描述文件声明的运行端 (SIDE_CLIENT、SIDE_SERVER)，为空表示两端都可以
+	side string
+}
+
+// modJar 是 mods 目录中的一个文件，一个 jar 可以声明多个模组并内嵌其他模组
+type modJar struct {
+	file   string
+	mods   []modInfo
+	nested []modInfo
+	// library 表示没有模组描述的 Forge 库 (清单中有 FMLModType)
+	library bool
+	err     error
+}
+
+// serverModLoader 返回实例的模组加载器，不支持模组时返回空字符串
+func serverModLoader(server *ServerInstance) string {
+	t := strings.ToLower(server.ServerType)
+	switch {
+	case strings.Contains(t, "neoforge") || strings.Contains(t, "youer"):
+		return LOADER_NEOFORGE
+	case strings.Contains(t, "quilt"):
+		return LOADER_QUILT
+	case strings.Contains(t, "fabric") || strings.Contains(t, "banner"):
+		return LOADER_FABRIC
+	case strings.Contains(t, "forge"), strings.Contains(t, "mohist"), strings.Contains(t, "catserver"),
+		strings.Contains(t, "magma"), strings.Contains(t, "ketting"), strings.Contains(t, "arclight"):
+		return LOADER_FORGE
+	}
+	return ""
+}
+
+// loaderAccepts 判断加载器能否加载该格式的模组: Quilt 兼容 Fabric 模组，1.20.5 之前的 NeoForge 兼容 mods.toml
+func loaderAccepts(server *ServerInstance, loader, format string) bool {
+	switch {
+	case loader == format:
+		return true
+	case loader == LOADER_QUILT:
+		return format == LOADER_FABRIC
+	case loader == LOADER_NEOFORGE && format == LOADER_FORGE:
+		return compareMCVersion(server.MCVersion, "1.20.5") < 0
+	}
+	return false
+}
+
+// modLoaderVersion 返回加载器版本，核心版本为 1.20.1-47.2.0 这样的形式时去掉 MC 版本
+func modLoaderVersion(server *ServerInstance) string {
+	v := strings.TrimPrefix(server.CoreVersion, server.MCVersion+"-")
+	if !comparableVersion(v) {
+		return ""
+	}
+	return v
+}
+
+func modsDir(server *ServerInstance) string {
+	return filepath.Join(serverDir(server), MODS_DIR)
+}
+
+// readZipFile 读取 zip 中的文件，不存在时返回 nil
+func readZipFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// readManifest 解析 META-INF/MANIFEST.MF，续行以空格开头
+func readManifest(data []byte) map[string]string {
+	manifest := make(map[string]string)
+	var last string
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, " ") && last != "" {
+			manifest[last] += line[1:]
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			last = strings.TrimSpace(key)
+			manifest[last] = strings.TrimSpace(value)
+		}
+	}
+	return manifest
+}
+
+// readModJar 读取 mods 目录中的 jar，loader 用于在同时带有多种描述文件时选择
+func readModJar(jarPath, loader string) modJar {
+	jar := modJar{file: filepath.Base(jarPath)}
+	zr, err := zip.OpenReader(jarPath)
+	if err != nil {
+		jar.err = fmt.Errorf("不是有效的 jar 文件: %v", err)
+		return jar
+	}
+	defer zr.Close()
+	jar.mods, jar.nested, jar.library, jar.err = readModArchive(&zr.Reader, loader, 0)
+	if jar.err == nil && len(jar.mods) == 0 && !jar.library {
+		jar.err = errors.New("没有模组描述文件，不是模组")
+	}
+	return jar
+}
+
+// readModArchive 读取 jar 中的模组描述和内嵌的 jar
+func readModArchive(zr *zip.Reader, loader string, depth int) ([]modInfo, []modInfo, bool, error) {
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	read := func(name string) []byte {
+		data, _ := readZipFile(files, name)
+		return data
+	}
+
+	var mods []modInfo
+	var nestedPaths []string
+	var err error
+	fabric, quilt := read("fabric.mod.json"), read("quilt.mod.json")
+	forge, neoforge := read("META-INF/mods.toml"), read("META-INF/neoforge.mods.toml")
+	switch {
+	case quilt != nil && (loader == LOADER_QUILT || fabric == nil):
+		mods, nestedPaths, err = parseQuiltMod(quilt)
+	case fabric != nil && (loader == LOADER_FABRIC || loader == LOADER_QUILT || (forge == nil && neoforge == nil)):
+		mods, nestedPaths, err = parseFabricMod(fabric)
+	case neoforge != nil && (loader == LOADER_NEOFORGE || forge == nil):
+		mods, err = parseForgeMods(neoforge, LOADER_NEOFORGE, readManifest(read("META-INF/MANIFEST.MF")))
+	case forge != nil:
+		mods, err = parseForgeMods(forge, LOADER_FORGE, readManifest(read("META-INF/MANIFEST.MF")))
+	case fabric != nil:
+		mods, nestedPaths, err = parseFabricMod(fabric)
+	default:
+		if files["plugin.yml"] != nil || files["paper-plugin.yml"] != nil {
+			return nil, nil, false, errors.New("这是 Bukkit 插件而不是模组")
+		}
+		manifest := readManifest(read("META-INF/MANIFEST.MF"))
+		return nil, nil, manifest["FMLModType"] != "", nil
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// Forge/NeoForge 的 Jar-in-Jar 列在 META-INF/jarjar/metadata.json 中
+	if data := read("META-INF/jarjar/metadata.json"); data != nil {
+		var meta struct {
+			Jars []struct {
+				Path string `json:"path"`
+			} `json:"jars"`
+		}
+		if json.Unmarshal(data, &meta) == nil {
+			for _, j := range meta.Jars {
+				nestedPaths = append(nestedPaths, j.Path)
+			}
+		}
+	}
+
+	var nested []modInfo
+	if depth < MAX_NESTED_JARS {
+		for _, path := range nestedPaths {
+			data := read(path)
+			if data == nil {
+				continue
+			}
+			inner, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				continue
+			}
+			innerMods, innerNested, _, err := readModArchive(inner, loader, depth+1)
+			if err != nil {
+				continue
+			}
+			nested = append(nested, innerMods...)
+			nested = append(nested, innerNested...)
+		}
+	}
+	return mods, nested, false, nil
+}
+
+// jsonStrings 把字符串或字符串数组转换为列表
+func jsonStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var result []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func parseFabricMod(data []byte) ([]modInfo, []string, error) {
+	var meta struct {
+		ID          string                 `json:"id"`
+		Name        string                 `json:"name"`
+		Version     string                 `json:"version"`
+		Environment string                 `json:"environment"`
+		Depends     map[string]interface{} `json:"depends"`
+		Recommends  map[string]interface{} `json:"recommends"`
+		Breaks      map[string]interface{} `json:"breaks"`
+		Conflicts   map[string]interface{} `json:"conflicts"`
+		Provides    []string               `json:"provides"`
+		Jars        []struct {
+			File string `json:"file"`
+		} `json:"jars"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, nil, fmt.Errorf("fabric.mod.json 解析失败: %v", err)
+	}
+	if meta.ID == "" {
+		return nil, nil, errors.New("fabric.mod.json 中没有 id")
+	}
+	mod := modInfo{id: meta.ID, name: meta.Name, version: meta.Version, format: LOADER_FABRIC, provides: meta.Provides}
+	if meta.Environment == SIDE_CLIENT || meta.Environment == SIDE_SERVER {
+		mod.side = meta.Environment
+	}
+	for kind, deps := range map[string]map[string]interface{}{
+		DEP_REQUIRED: meta.Depends, DEP_OPTIONAL: meta.Recommends, DEP_BREAKS: meta.Breaks, DEP_CONFLICTS: meta.Conflicts,
+	} {
+		for id, v := range deps {
+			mod.deps = append(mod.deps, modDependency{id: id, ranges: jsonStrings(v), kind: kind})
+		}
+	}
+	sortDependencies(mod.deps)
+	var nested []string
+	for _, j := range meta.Jars {
+		nested = append(nested, j.File)
+	}
+	return []modInfo{mod}, nested, nil
+}
+
+func parseQuiltMod(data []byte) ([]modInfo, []string, error) {
+	var meta struct {
+		QuiltLoader struct {
+			ID       string `json:"id"`
+			Version  string `json:"version"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Depends  []interface{} `json:"depends"`
+			Breaks   []interface{} `json:"breaks"`
+			Provides []interface{} `json:"provides"`
+			Jars     []string      `json:"jars"`
+		} `json:"quilt_loader"`
+		Minecraft struct {
+			Environment string `json:"environment"`
+		} `json:"minecraft"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, nil, fmt.Errorf("quilt.mod.json 解析失败: %v", err)
+	}
+	q := meta.QuiltLoader
+	if q.ID == "" {
+		return nil, nil, errors.New("quilt.mod.json 中没有 id")
+	}
+	mod := modInfo{id: q.ID, name: q.Metadata.Name, version: q.Version, format: LOADER_QUILT}
+	switch meta.Minecraft.Environment {
+	case SIDE_CLIENT:
+		mod.side = SIDE_CLIENT
+	case "dedicated_server":
+		mod.side = SIDE_SERVER
+	}
+	for _, p := range q.Provides {
+		switch v := p.(type) {
+		case string:
+			mod.provides = append(mod.provides, v)
+		case map[string]interface{}:
+			if id, ok := v["id"].(string); ok {
+				mod.provides = append(mod.provides, id)
+			}
+		}
+	}
+	// 依赖可以是 "id" 或 {id, versions, optional}；数组形式表示任选其一，不检查
+	parse := func(entries []interface{}, kind string) {
+		for _, entry := range entries {
+			dep := modDependency{kind: kind}
+			switch v := entry.(type) {
+			case string:
+				dep.id = v
+			case map[string]interface{}:
+				dep.id, _ = v["id"].(string)
+				dep.ranges = jsonStrings(v["versions"])
+				if optional, _ := v["optional"].(bool); optional && kind == DEP_REQUIRED {
+					dep.kind = DEP_OPTIONAL
+				}
+			}
+			// 可以带 maven 组名，例如 org.quiltmc:quilt_loader
+			if i := strings.LastIndex(dep.id, ":"); i >= 0 {
+				dep.id = dep.id[i+1:]
+			}
+			if dep.id != "" {
+				mod.deps = append(mod.deps, dep)
+			}
+		}
+	}
+	parse(q.Depends, DEP_REQUIRED)
+	parse(q.Breaks, DEP_BREAKS)
+	return []modInfo{mod}, q.Jars, nil
+}
+
+// parseForgeMods 解析 mods.toml 或 neoforge.mods.toml，版本为 ${file.jarVersion} 时使用清单中的 Implementation-Version
+func parseForgeMods(data []byte, format string, manifest map[string]string) ([]modInfo, error) {
+	name := "mods.toml"
+	if format == LOADER_NEOFORGE {
+		name = "neoforge.mods.toml"
+	}
+	doc, err := parseTOML(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s 解析失败: %v", name, err)
+	}
+	loaderVersion := ""
+	if tomlString(doc, "modLoader") == "javafml" {
+		loaderVersion = tomlString(doc, "loaderVersion")
+	}
+	dependencies, _ := doc["dependencies"].(map[string]interface{})
+
+	var mods []modInfo
+	for _, m := range tomlTables(doc["mods"]) {
+		mod := modInfo{
+			id:            tomlString(m, "modId"),
+			name:          tomlString(m, "displayName"),
+			version:       tomlString(m, "version"),
+			format:        format,
+			loaderVersion: loaderVersion,
+		}
+		if mod.id == "" {
+			continue
+		}
+		if strings.Contains(mod.version, "${file.jarVersion}") {
+			mod.version = manifest["Implementation-Version"]
+		}
+		// clientSideOnly 和 displayTest="IGNORE_SERVER_VERSION" 都表示只在客户端运行
+		if clientOnly, _ := doc["clientSideOnly"].(bool); clientOnly || tomlString(m, "displayTest") == "IGNORE_SERVER_VERSION" {
+			mod.side = SIDE_CLIENT
+		}
+		for _, d := range tomlTables(dependencies[mod.id]) {
+			dep := modDependency{id: tomlString(d, "modId"), side: strings.ToUpper(tomlString(d, "side")), kind: DEP_OPTIONAL}
+			// Forge 使用 mandatory，NeoForge 使用 type
+			switch strings.ToLower(tomlString(d, "type")) {
+			case "required":
+				dep.kind = DEP_REQUIRED
+			case "incompatible":
+				dep.kind = DEP_BREAKS
+			case "discouraged":
+				dep.kind = DEP_CONFLICTS
+			case "":
+				if mandatory, _ := d["mandatory"].(bool); mandatory {
+					dep.kind = DEP_REQUIRED
+				}
+			}
+			if r := tomlString(d, "versionRange"); r != "" {
+				dep.ranges = []string{r}
+			}
+			// 只在客户端依赖 minecraft 的模组也是客户端模组
+			if dep.id == "minecraft" && dep.side == "CLIENT" {
+				mod.side = SIDE_CLIENT
+			}
+			if dep.id != "" {
+				mod.deps = append(mod.deps, dep)
+			}
+		}
+		mods = append(mods, mod)
+	}
+	if len(mods) == 0 {
+		return nil, fmt.Errorf("%s 中没有 [[mods]]", name)
+	}
+	return mods, nil
+}
+
+func sortDependencies(deps []modDependency) {
+	order := map[string]int{DEP_REQUIRED: 0, DEP_OPTIONAL: 1, DEP_BREAKS: 2, DEP_CONFLICTS: 3}
+	sort.SliceStable(deps, func(i, j int) bool {
+		if order[deps[i].kind] != order[deps[j].kind] {
+			return order[deps[i].kind] < order[deps[j].kind]
+		}
+		return deps[i].id < deps[j].id
+	})
+}
+
+// installedMods 读取 mods 目录中的所有 jar，按文件名排序
+func installedMods(server *ServerInstance) []modJar {
+	files, _ := filepath.Glob(filepath.Join(modsDir(server), "*.jar"))
+	sort.Strings(files)
+	loader := serverModLoader(server)
+	var jars []modJar
+	for _, file := range files {
+		jars = append(jars, readModJar(file, loader))
+	}
+	return jars
+}
+
+// modProblem 是依赖检查发现的问题，fatal 表示加载器会拒绝启动
+type modProblem struct {
+	fatal   bool
+	mods    []string
+	message string
+}
+
+// describeRanges 把版本范围格式化为便于阅读的形式
+func describeRanges(ranges []string) string {
+	var shown []string
+	for _, r := range ranges {
+		if r != "*" && r != "" {
+			shown = append(shown, r)
+		}
+	}
+	if len(shown) == 0 {
+		return ""
+	}
+	return " " + strings.Join(shown, " || ")
+}
+
+// satisfies 判断版本是否满足任一范围，版本号无法比较时视为满足
+func satisfies(format, version string, ranges []string) bool {
+	if len(ranges) == 0 || !comparableVersion(version) {
+		return true
+	}
+	for _, r := range ranges {
+		if format == LOADER_FORGE || format == LOADER_NEOFORGE {
+			if matchMavenRange(version, r) {
+				return true
+			}
+		} else if matchFabricPredicate(version, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// modProblems 检查重复的模组、加载器不匹配、缺少或版本不符的依赖以及不兼容的模组
+func modProblems(server *ServerInstance, jars []modJar) []modProblem {
+	loader := serverModLoader(server)
+	loaderVersion := modLoaderVersion(server)
+	var problems []modProblem
+	add := func(fatal bool, mods []string, format string, args ...interface{}) {
+		message := fmt.Sprintf(format, args...)
+		for _, p := range problems {
+			if p.message == message {
+				return
+			}
+		}
+		problems = append(problems, modProblem{fatal, mods, message})
+	}
+
+	// 运行环境提供的 ID，版本为空表示未知
+	available := map[string][]string{"minecraft": {server.MCVersion}}
+	javaChecked := false
+	switch loader {
+	case LOADER_FABRIC:
+		available["fabricloader"] = []string{loaderVersion}
+	case LOADER_QUILT:
+		available["quilt_loader"] = []string{loaderVersion}
+		available["fabricloader"] = []string{""}
+	case LOADER_FORGE:
+		available["forge"] = []string{loaderVersion}
+	case LOADER_NEOFORGE:
+		available["neoforge"] = []string{loaderVersion}
+	}
+
+	files := make(map[string][]string)
+	var ids []string
+	var checked []modInfo
+	for _, jar := range jars {
+		for _, m := range jar.mods {
+			if _, ok := files[m.id]; !ok {
+				ids = append(ids, m.id)
+			}
+			files[m.id] = append(files[m.id], jar.file)
+		}
+		for _, m := range append(append([]modInfo{}, jar.mods...), jar.nested...) {
+			if !loaderAccepts(server, loader, m.format) {
+				continue
+			}
+			for _, id := range append([]string{m.id}, m.provides...) {
+				if !containsString(available[id], m.version) {
+					available[id] = append(available[id], m.version)
+				}
+			}
+			checked = append(checked, m)
+		}
+	}
+
+	for _, jar := range jars {
+		if jar.err != nil {
+			add(false, nil, "%s: %v", jar.file, jar.err)
+			continue
+		}
+		for _, m := range jar.mods {
+			if !loaderAccepts(server, loader, m.format) {
+				add(true, []string{m.id}, "%s (%s) 是 %s 模组，%s 服务端无法加载", m.id, jar.file, loaderNames[m.format], loaderNames[loader])
+			}
+		}
+	}
+	for _, id := range ids {
+		if len(files[id]) > 1 {
+			add(true, []string{id}, "%s 有多个文件: %s", id, strings.Join(files[id], ", "))
+		}
+	}
+
+	for _, m := range checked {
+		// Fabric 和 Quilt 在服务端不加载声明为客户端的模组，也不检查它们的依赖
+		if m.side == SIDE_CLIENT && (m.format == LOADER_FABRIC || m.format == LOADER_QUILT) {
+			continue
+		}
+		if m.loaderVersion != "" && loader == LOADER_FORGE && loaderVersion != "" {
+			major := splitVersion(loaderVersion)[0]
+			if !matchMavenRange(major, m.loaderVersion) {
+				add(true, []string{m.id}, "%s 需要 Forge 加载器 %s，当前为 %s", m.id, m.loaderVersion, loaderVersion)
+			}
+		}
+		for _, dep := range m.deps {
+			if dep.side == "CLIENT" || dep.id == m.id {
+				continue
+			}
+			if dep.id == "java" && !javaChecked {
+				javaChecked = true
+				if major, err := javaMajorVersion(serverJavaPath(server)); err == nil {
+					available["java"] = []string{fmt.Sprint(major)}
+				} else {
+					available["java"] = []string{""}
+				}
+			}
+			versions := available[dep.id]
+			// 版本未知时视为满足范围，但只有不限版本的 breaks/conflicts 才报告
+			found, matched := false, ""
+			for _, v := range versions {
+				if satisfies(m.format, v, dep.ranges) {
+					found, matched = true, v
+					break
+				}
+			}
+			conflicting := found && (matched != "" || len(dep.ranges) == 0)
+			other := strings.TrimSpace(dep.id + " " + matched)
+			installed := strings.Join(versions, ", ")
+			switch {
+			case dep.kind == DEP_REQUIRED && len(versions) == 0:
+				add(true, []string{m.id, dep.id}, "%s 需要 %s%s，但没有安装", m.id, dep.id, describeRanges(dep.ranges))
+			case dep.kind == DEP_REQUIRED && !found && len(versions) > 0:
+				add(true, []string{m.id, dep.id}, "%s 需要 %s%s，当前为 %s", m.id, dep.id, describeRanges(dep.ranges), installed)
+			case dep.kind == DEP_OPTIONAL && !found && len(versions) > 0:
+				// Forge 对已安装的可选依赖同样检查版本，Fabric 只给出警告
+				fatal := m.format == LOADER_FORGE || m.format == LOADER_NEOFORGE
+				add(fatal, []string{m.id, dep.id}, "%s 需要 %s%s，当前为 %s", m.id, dep.id, describeRanges(dep.ranges), installed)
+			case dep.kind == DEP_BREAKS && conflicting:
+				add(true, []string{m.id, dep.id}, "%s 与 %s 不兼容", m.id, other)
+			case dep.kind == DEP_CONFLICTS && conflicting:
+				add(false, []string{m.id, dep.id}, "%s 与 %s 可能冲突", m.id, other)
+			}
+		}
+	}
+	return problems
+}
+
+func printModProblems(problems []modProblem) {
+	if len(problems) == 0 {
+		return
+	}
+	fmt.Println("\n\033[33m问题:\033[0m")
+	for _, p := range problems {
+		if p.fatal {
+			fmt.Printf("  \033[31m✘\033[0m %s\n", p.message)
+		} else {
+			fmt.Printf("  \033[33m⚠\033[0m %s\n", p.message)
+		}
+	}
+}
+
+func printMods(server *ServerInstance) {
+	jars := installedMods(server)
+	if len(jars) == 0 {
+		fmt.Println("没有安装模组")
+		return
+	}
+	loader := serverModLoader(server)
+	fmt.Printf("%s 服务端 %s，加载器版本 %s\n\n", loaderNames[loader], server.MCVersion, orUnknown(modLoaderVersion(server)))
+	fmt.Printf("%s%s%s%s\n", padRight("模组ID", 28), padRight("版本", 20), padRight("格式", 10), "文件")
+	for _, jar := range jars {
+		switch {
+		case jar.err != nil:
+			fmt.Printf("\033[31m%s\033[0m%s\n", padRight("?", 58), jar.file)
+			continue
+		case jar.library:
+			fmt.Printf("\033[90m%s\033[0m%s\n", padRight("(库)", 58), jar.file)
+			continue
+		}
+		for _, m := range jar.mods {
+			fmt.Printf("%s%s%s%s\n", padRight(m.id, 28), padRight(m.version, 20), padRight(loaderNames[m.format], 10), jar.file)
+		}
+		if len(jar.nested) > 0 {
+			var nested []string
+			for _, m := range jar.nested {
+				nested = append(nested, m.id+" "+m.version)
+			}
+			fmt.Printf("  \033[90m内含: %s\033[0m\n", strings.Join(nested, ", "))
+		}
+	}
+	printModProblems(modProblems(server, jars))
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "未知"
+	}
+	return s
+}
+
+// modIndexLoaders 返回在 Modrinth 上查找模组时使用的加载器
+func modIndexLoaders(loader string) []string {
+	if loader == LOADER_QUILT {
+		return []string{LOADER_QUILT, LOADER_FABRIC}
+	}
+	return []string{loader}
+}
+
+// resolveMod 在 Modrinth 类型的索引中查找模组，spec 可以是 项目 或 索引:项目
+func resolveMod(server *ServerInstance, spec, version string) (*pluginRelease, *PluginSource, error) {
+	var indexes []*PluginIndex
+	project := spec
+	if name, rest, ok := strings.Cut(spec, ":"); ok {
+		index := findPluginIndex(name)
+		if index == nil {
+			return nil, nil, fmt.Errorf("找不到索引: %s", name)
+		}
+		if index.Type != INDEX_MODRINTH {
+			return nil, nil, fmt.Errorf("索引 %s 不是 Modrinth 类型，不能用于模组", name)
+		}
+		indexes = []*PluginIndex{index}
+		project = rest
+	} else {
+		indexes = pluginIndexes()
+	}
+	var errs []string
+	for _, index := range indexes {
+		if index.Type != INDEX_MODRINTH {
+			continue
+		}
+		release, err := modrinthRelease(index.URL, project, modIndexLoaders(serverModLoader(server)), server.MCVersion, version)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", index.Name, err))
+			continue
+		}
+		return release, &PluginSource{Index: index.Name, Project: project, Version: release.version}, nil
+	}
+	if len(errs) == 0 {
+		return nil, nil, errors.New("没有 Modrinth 类型的索引")
+	}
+	return nil, nil, errors.New(strings.Join(errs, "\n"))
+}
+
+// jarModIDs 返回 jar 中声明的顶层模组 ID
+func jarModIDs(jar modJar) []string {
+	var ids []string
+	for _, m := range jar.mods {
+		ids = append(ids, m.id)
+	}
+	return ids
+}
+
+func addMod(server *ServerInstance, spec, version string, force bool) error {
+	stage, filename, _, err := stageFile(modsDir(server), spec, func(project string) (*pluginRelease, *PluginSource, error) {
+		return resolveMod(server, project, version)
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(stage)
+
+	loader := serverModLoader(server)
+	jar := readModJar(stage, loader)
+	if jar.err != nil {
+		return fmt.Errorf("%s: %v", filename, jar.err)
+	}
+	jar.file = filename
+	for _, m := range jar.mods {
+		if !loaderAccepts(server, loader, m.format) && !force {
+			return fmt.Errorf("%s 是 %s 模组，%s 服务端无法加载 (使用 --force 仍然安装)", m.id, loaderNames[m.format], loaderNames[loader])
+		}
+	}
+
+	// 包含相同模组的旧文件视为旧版本
+	ids := jarModIDs(jar)
+	var replaced []string
+	for _, existing := range installedMods(server) {
+		if existing.file == filename {
+			continue
+		}
+		for _, id := range jarModIDs(existing) {
+			if containsString(ids, id) {
+				replaced = append(replaced, existing.file)
+				break
+			}
+		}
+	}
+	if err := os.Rename(stage, filepath.Join(modsDir(server), filename)); err != nil {
+		return err
+	}
+	for _, file := range replaced {
+		if err := os.Remove(filepath.Join(modsDir(server), file)); err != nil {
+			fmt.Printf("\033[33m删除旧版本 %s 失败: %v\033[0m\n", file, err)
+		} else {
+			fmt.Printf("已删除旧版本 %s\n", file)
+		}
+	}
+
+	for _, m := range jar.mods {
+		fmt.Printf("已安装 %s %s (%s)\n", m.id, m.version, filename)
+	}
+	if jar.library {
+		fmt.Printf("已安装库 %s\n", filename)
+	}
+	for _, p := range modProblems(server, installedMods(server)) {
+		for _, id := range ids {
+			if containsString(p.mods, id) {
+				fmt.Printf("\033[33m警告: %s\033[0m\n", p.message)
+				break
+			}
+		}
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("服务器正在运行，重启后生效")
+	}
+	return nil
+}
+
+// removeMod 按模组 ID 或文件名删除，其他模组必需的依赖只由它提供时需要 force
+func removeMod(server *ServerInstance, target string, force bool) error {
+	jars := installedMods(server)
+	var removed, kept []modJar
+	for _, jar := range jars {
+		if jar.file == target || containsString(jarModIDs(jar), target) {
+			removed = append(removed, jar)
+		} else {
+			kept = append(kept, jar)
+		}
+	}
+	if len(removed) == 0 {
+		return fmt.Errorf("没有找到模组: %s", target)
+	}
+
+	if !force {
+		if broken := newFatalProblems(server, jars, kept); len(broken) > 0 {
+			return fmt.Errorf("删除后 %s，使用 --force 仍然删除", strings.Join(broken, "；"))
+		}
+	}
+
+	for _, jar := range removed {
+		if err := os.Remove(filepath.Join(modsDir(server), jar.file)); err != nil {
+			return err
+		}
+		fmt.Printf("已删除 %s\n", jar.file)
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("服务器正在运行，重启后生效")
+	}
+	return nil
+}
+
+// checkMods 是启动前的模组依赖检查
+func checkMods(server *ServerInstance) []checkResult {
+	if serverModLoader(server) == "" {
+		return nil
+	}
+	jars := installedMods(server)
+	var results []checkResult
+	for _, p := range modProblems(server, jars) {
+		status := CHECK_WARN
+		if p.fatal {
+			status = CHECK_FAIL
+		}
+		results = append(results, checkResult{"模组", status, p.message, fmt.Sprintf("运行 emcm mod %s ls 查看详情", server.ID)})
+	}
+	for _, jar := range clientOnlyJars(jars) {
+		message := fmt.Sprintf("%s 是客户端模组，可能导致服务端崩溃", jar.file)
+		results = append(results, checkResult{"模组", CHECK_WARN, message, fmt.Sprintf("运行 emcm mod %s sides --quarantine 移到 %s", server.ID, DISABLED_MODS_DIR)})
+	}
+	if len(results) == 0 {
+		results = append(results, checkResult{"模组", CHECK_PASS, fmt.Sprintf("%d 个文件", len(jars)), ""})
+	}
+	return results
+}
+
+func printModUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm mod <服务器ID> ls                                   列出模组并检查依赖")
+	fmt.Println("  emcm mod <服务器ID> add <文件|URL|[索引:]项目> [--version 版本] [--force]  安装模组")
+	fmt.Println("  emcm mod <服务器ID> rm <模组ID|文件名> [--force]          删除模组")
+	fmt.Println("  emcm mod <服务器ID> sides [--quarantine] [--auto warn|quarantine]  查看模组运行端，隔离客户端模组")
+	fmt.Println("  emcm mod <服务器ID> enable <文件名|all>                   恢复 mods.disabled 中的模组")
+}
+
+func handleModCLI(args []string) {
+	if len(args) < 1 {
+		printModUsage()
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	if serverModLoader(server) == "" {
+		fmt.Printf("实例类型 %s 不支持模组\n", server.ServerType)
+		return
+	}
+	action := "ls"
+	if len(args) > 1 {
+		action = args[1]
+	}
+
+	var version, auto string
+	force, quarantine := false, false
+	var targets []string
+	for i := 2; i < len(args); i++ {
+		switch {
+		case args[i] == "--version" && i+1 < len(args):
+			version = args[i+1]
+			i++
+		case args[i] == "--force":
+			force = true
+		case args[i] == "--quarantine":
+			quarantine = true
+		case args[i] == "--auto" && i+1 < len(args):
+			auto = args[i+1]
+			i++
+		default:
+			targets = append(targets, args[i])
+		}
+	}
+
+	switch action {
+	case "ls":
+		printMods(server)
+	case "add":
+		if len(targets) == 0 {
+			printModUsage()
+			return
+		}
+		for _, target := range targets {
+			if err := addMod(server, target, version, force); err != nil {
+				fmt.Println("安装模组失败:", err)
+			}
+		}
+	case "rm":
+		if len(targets) == 0 {
+			printModUsage()
+			return
+		}
+		for _, target := range targets {
+			if err := removeMod(server, target, force); err != nil {
+				fmt.Println("删除模组失败:", err)
+			}
+		}
+	case "sides":
+		if auto != "" {
+			if err := setClientModsPolicy(server, auto); err != nil {
+				fmt.Println("设置失败:", err)
+			}
+		}
+		if quarantine {
+			moved, err := quarantineClientMods(server)
+			for _, file := range moved {
+				fmt.Printf("已将 %s 移到 %s\n", file, DISABLED_MODS_DIR)
+			}
+			if err != nil {
+				fmt.Println("隔离客户端模组失败:", err)
+			} else if len(moved) == 0 {
+				fmt.Println("没有需要隔离的客户端模组")
+			}
+			if len(moved) > 0 && isServerRunning(server.ID) {
+				fmt.Println("服务器正在运行，重启后生效")
+			}
+		}
+		if auto == "" && !quarantine {
+			printModSides(server)
+		}
+	case "enable":
+		if len(targets) == 0 {
+			printModUsage()
+			return
+		}
+		for _, target := range targets {
+			if err := enableMod(server, target); err != nil {
+				fmt.Println("恢复模组失败:", err)
+			}
+		}
+	default:
+		printModUsage()
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DISABLED_MODS_DIR 存放被隔离的客户端模组，加载器不会读取
+	DISABLED_MODS_DIR = "mods.disabled"
+	// CLIENT_MODS_FILE 是用户维护的客户端模组列表，位于 CACHE_DIR
+	CLIENT_MODS_FILE = "client-mods.txt"
+
+	SIDE_BOTH   = "both"
+	SIDE_CLIENT = "client"
+	SIDE_SERVER = "server"
+
+	// 实例的客户端模组处理方式，默认为 CLIENT_MODS_WARN
+	CLIENT_MODS_WARN       = "warn"
+	CLIENT_MODS_QUARANTINE = "quarantine"
+)
+
+var sideNames = map[string]string{
+	SIDE_BOTH:   "双端",
+	SIDE_CLIENT: "客户端",
+	SIDE_SERVER: "服务端",
+}
+
+// knownClientMods 是没有在描述文件中声明运行端、但只能在客户端运行的常见模组，值为分类
+var knownClientMods = map[string]string{
+	// 渲染和光影
+	"iris":                  "光影",
+	"oculus":                "光影",
+	"optifine":              "光影",
+	"sodium":                "渲染优化",
+	"rubidium":              "渲染优化",
+	"embeddium":             "渲染优化",
+	"magnesium":             "渲染优化",
+	"indium":                "渲染优化",
+	"entityculling":         "渲染优化",
+	"immediatelyfast":       "渲染优化",
+	"enhancedblockentities": "渲染优化",
+	"dynamic_fps":           "渲染优化",
+	"continuity":            "连接纹理",
+	"lambdynlights":         "动态光源",
+	"dynamiclights":         "动态光源",
+	"skinlayers3d":          "外观",
+	"notenoughanimations":   "外观",
+	"cullleaves":            "外观",
+	// 小地图
+	"xaerominimap":     "小地图",
+	"xaeroworldmap":    "小地图",
+	"xaerominimapfair": "小地图",
+	"voxelmap":         "小地图",
+	// 界面
+	"modmenu":           "界面",
+	"betterf3":          "界面",
+	"controlling":       "界面",
+	"mousetweaks":       "界面",
+	"fancymenu":         "界面",
+	"legendarytooltips": "界面",
+	"blur":              "界面",
+	"catalogue":         "界面",
+	"configured":        "界面",
+	"chat_heads":        "界面",
+	// 视角和操作
+	"zoomify":           "视角",
+	"okzoomer":          "视角",
+	"freecam":           "视角",
+	"shouldersurfing":   "视角",
+	"betterthirdperson": "视角",
+}
+
+func clientModsPath() string {
+	return filepath.Join(CACHE_DIR, CLIENT_MODS_FILE)
+}
+
+func writeClientModsTemplate(path string) error {
+	template := []byte(`# 客户端模组列表，每行一个模组ID，以 # 开头的行为注释
+# 写 模组ID 表示只能在客户端运行，写 !模组ID 表示服务端可以运行 (覆盖内置列表)
+`)
+	return os.WriteFile(path, template, 0644)
+}
+
+// loadClientModList 读取用户的客户端模组列表，值为 true 表示客户端模组，false 表示服务端可以运行
+func loadClientModList() map[string]bool {
+	path := clientModsPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		writeClientModsTemplate(path)
+		return nil
+	}
+	list := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if id := strings.TrimPrefix(line, "!"); id != line {
+			list[strings.TrimSpace(id)] = false
+		} else {
+			list[line] = true
+		}
+	}
+	return list
+}
+
+// modSide 返回模组的运行端和判断依据，依次参考用户列表、描述文件和内置列表
+func modSide(m modInfo, userList map[string]bool) (string, string) {
+	if clientOnly, ok := userList[m.id]; ok {
+		if clientOnly {
+			return SIDE_CLIENT, "用户列表"
+		}
+		return SIDE_BOTH, "用户列表"
+	}
+	if m.side != "" {
+		return m.side, "描述文件"
+	}
+	if category, ok := knownClientMods[m.id]; ok {
+		return SIDE_CLIENT, "内置列表 (" + category + ")"
+	}
+	return SIDE_BOTH, ""
+}
+
+// isClientOnlyJar 判断 jar 中的模组是否都只能在客户端运行
+func isClientOnlyJar(jar modJar, userList map[string]bool) bool {
+	if jar.err != nil || len(jar.mods) == 0 {
+		return false
+	}
+	for _, m := range jar.mods {
+		if side, _ := modSide(m, userList); side != SIDE_CLIENT {
+			return false
+		}
+	}
+	return true
+}
+
+func clientOnlyJars(jars []modJar) []modJar {
+	userList := loadClientModList()
+	var result []modJar
+	for _, jar := range jars {
+		if isClientOnlyJar(jar, userList) {
+			result = append(result, jar)
+		}
+	}
+	return result
+}
+
+func disabledModsDir(server *ServerInstance) string {
+	return filepath.Join(serverDir(server), DISABLED_MODS_DIR)
+}
+
+func disabledMods(server *ServerInstance) []string {
+	files, _ := filepath.Glob(filepath.Join(disabledModsDir(server), "*.jar"))
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newFatalProblems 返回只剩 kept 时新出现的致命问题
+func newFatalProblems(server *ServerInstance, jars, kept []modJar) []string {
+	before := make(map[string]bool)
+	for _, p := range modProblems(server, jars) {
+		before[p.message] = true
+	}
+	var broken []string
+	for _, p := range modProblems(server, kept) {
+		if p.fatal && !before[p.message] {
+			broken = append(broken, p.message)
+		}
+	}
+	return broken
+}
+
+// quarantineClientMods 把客户端模组移动到 mods.disabled，其他模组必需的跳过
+func quarantineClientMods(server *ServerInstance) ([]string, error) {
+	jars := installedMods(server)
+	candidates := clientOnlyJars(jars)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(disabledModsDir(server), 0755); err != nil {
+		return nil, err
+	}
+	var moved []string
+	for _, candidate := range candidates {
+		var kept []modJar
+		for _, jar := range jars {
+			if jar.file != candidate.file {
+				kept = append(kept, jar)
+			}
+		}
+		if broken := newFatalProblems(server, jars, kept); len(broken) > 0 {
+			fmt.Printf("\033[33m跳过 %s: 移走后 %s\033[0m\n", candidate.file, strings.Join(broken, "；"))
+			continue
+		}
+		src := filepath.Join(modsDir(server), candidate.file)
+		if err := os.Rename(src, filepath.Join(disabledModsDir(server), candidate.file)); err != nil {
+			return moved, err
+		}
+		moved = append(moved, candidate.file)
+		jars = kept
+	}
+	return moved, nil
+}
+
+// autoQuarantineMods 在启动前按实例设置隔离客户端模组
+func autoQuarantineMods(server *ServerInstance) {
+	if server.ClientMods != CLIENT_MODS_QUARANTINE || serverModLoader(server) == "" {
+		return
+	}
+	moved, err := quarantineClientMods(server)
+	for _, file := range moved {
+		fmt.Printf("已将客户端模组 %s 移到 %s\n", file, DISABLED_MODS_DIR)
+	}
+	if err != nil {
+		fmt.Println("隔离客户端模组失败:", err)
+	}
+}
+
+// enableMod 把 mods.disabled 中的文件移回 mods，target 为 all 时移回全部
+func enableMod(server *ServerInstance, target string) error {
+	files := disabledMods(server)
+	if target != "all" {
+		if !containsString(files, target) {
+			return fmt.Errorf("%s 中没有 %s", DISABLED_MODS_DIR, target)
+		}
+		files = []string{target}
+	}
+	if len(files) == 0 {
+		fmt.Printf("%s 中没有文件\n", DISABLED_MODS_DIR)
+		return nil
+	}
+	if err := os.MkdirAll(modsDir(server), 0755); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Rename(filepath.Join(disabledModsDir(server), file), filepath.Join(modsDir(server), file)); err != nil {
+			return err
+		}
+		fmt.Printf("已恢复 %s\n", file)
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("服务器正在运行，重启后生效")
+	}
+	return nil
+}
+
+func printModSides(server *ServerInstance) {
+	jars := installedMods(server)
+	userList := loadClientModList()
+	if len(jars) == 0 {
+		fmt.Println("没有安装模组")
+	} else {
+		fmt.Printf("%s%s%s%s\n", padRight("模组ID", 28), padRight("端", 10), padRight("依据", 24), "文件")
+		for _, jar := range jars {
+			for _, m := range jar.mods {
+				side, basis := modSide(m, userList)
+				line := fmt.Sprintf("%s%s%s%s", padRight(m.id, 28), padRight(sideNames[side], 10), padRight(basis, 24), jar.file)
+				if side == SIDE_CLIENT {
+					line = "\033[33m" + line + "\033[0m"
+				}
+				fmt.Println(line)
+			}
+		}
+	}
+
+	policy := server.ClientMods
+	if policy == "" {
+		policy = CLIENT_MODS_WARN
+	}
+	fmt.Printf("\n启动前处理客户端模组: %s\n", policy)
+	if disabled := disabledMods(server); len(disabled) > 0 {
+		fmt.Printf("\n\033[90m%s 中的文件:\033[0m\n", DISABLED_MODS_DIR)
+		for _, file := range disabled {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+}
+
+func setClientModsPolicy(server *ServerInstance, policy string) error {
+	if policy != CLIENT_MODS_WARN && policy != CLIENT_MODS_QUARANTINE {
+		return fmt.Errorf("无效的处理方式: %s (可选 %s、%s)", policy, CLIENT_MODS_WARN, CLIENT_MODS_QUARANTINE)
+	}
+	if policy == CLIENT_MODS_WARN {
+		server.ClientMods = ""
+	} else {
+		server.ClientMods = policy
+	}
+	server.UpdatedAt = time.Now().Format(time.RFC3339)
+	saveConfig()
+	fmt.Printf("启动前处理客户端模组: %s\n", policy)
+	return nil
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Modrinth 整合包 (.mrpack) 是一个 zip，包含 modrinth.index.json 和 overrides 目录，
+// 格式见 https://support.modrinth.com/en/articles/8802351-modrinth-modpack-format-mrpack
+
+const (
+	MRPACK_INDEX            = "modrinth.index.json"
+	MRPACK_FORMAT_VERSION   = 1
+	MRPACK_GAME             = "minecraft"
+	MRPACK_OVERRIDES        = "overrides"
+	MRPACK_SERVER_OVERRIDES = "server-overrides"
+	MRPACK_CLIENT_OVERRIDES = "client-overrides"
+
+	MRPACK_ENV_REQUIRED    = "required"
+	MRPACK_ENV_OPTIONAL    = "optional"
+	MRPACK_ENV_UNSUPPORTED = "unsupported"
+)
+
+type mrpackFile struct {
+	Path      string            `json:"path"`
+	Hashes    map[string]string `json:"hashes"`
+	Env       map[string]string `json:"env,omitempty"`
+	Downloads []string          `json:"downloads"`
+	FileSize  int64             `json:"fileSize"`
+}
+
+type mrpackIndex struct {
+	FormatVersion int               `json:"formatVersion"`
+	Game          string            `json:"game"`
+	VersionID     string            `json:"versionId"`
+	Name          string            `json:"name"`
+	Summary       string            `json:"summary,omitempty"`
+	Files         []mrpackFile      `json:"files"`
+	Dependencies  map[string]string `json:"dependencies"`
+}
+
+// mrpackLoaders 是 dependencies 中的加载器键、EMCM 的加载器和下载源中的服务端名称
+var mrpackLoaders = []struct {
+	key        string
+	loader     string
+	serverType string
+}{
+	{"fabric-loader", LOADER_FABRIC, "Fabric"},
+	{"quilt-loader", LOADER_QUILT, "Quilt"},
+	{"forge", LOADER_FORGE, "Forge"},
+	{"neoforge", LOADER_NEOFORGE, "NeoForge"},
+}
+
+func readMrpack(packPath string) (*zip.ReadCloser, *mrpackIndex, error) {
+	zr, err := zip.OpenReader(packPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	data, err := readZipFile(files, MRPACK_INDEX)
+	if err == nil && data == nil {
+		err = fmt.Errorf("没有 %s，不是 Modrinth 整合包", MRPACK_INDEX)
+	}
+	if err != nil {
+		zr.Close()
+		return nil, nil, err
+	}
+	var index mrpackIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		zr.Close()
+		return nil, nil, fmt.Errorf("%s 解析失败: %v", MRPACK_INDEX, err)
+	}
+	switch {
+	case index.Game != MRPACK_GAME:
+		err = fmt.Errorf("不支持的游戏: %s", index.Game)
+	case index.FormatVersion != MRPACK_FORMAT_VERSION:
+		err = fmt.Errorf("不支持的整合包格式版本: %d", index.FormatVersion)
+	case index.Dependencies["minecraft"] == "":
+		err = errors.New("整合包没有指定 Minecraft 版本")
+	}
+	if err != nil {
+		zr.Close()
+		return nil, nil, err
+	}
+	return zr, &index, nil
+}
+
+// mrpackServerType 返回整合包使用的服务端和加载器版本，没有加载器时为原版
+func mrpackServerType(index *mrpackIndex) (string, string) {
+	for _, l := range mrpackLoaders {
+		if v := index.Dependencies[l.key]; v != "" {
+			return l.serverType, v
+		}
+	}
+	return "Vanilla", ""
+}
+
+// matchCoreVersion 在下载源中查找与加载器版本对应的核心，核心版本可能带有 MC 版本前缀 (例如 1.20.1-47.2.0)
+func matchCoreVersion(serverType, mcVersion, loaderVersion string) (string, error) {
+	builds, err := getBuilds(serverType, mcVersion)
+	if err != nil {
+		return "", err
+	}
+	if len(builds.Builds) == 0 {
+		return "", fmt.Errorf("下载源中没有 %s %s", serverType, mcVersion)
+	}
+	if loaderVersion == "" {
+		return builds.Builds[0].Core, nil
+	}
+	for _, b := range builds.Builds {
+		if b.Core == loaderVersion || strings.HasSuffix(b.Core, "-"+loaderVersion) || strings.HasPrefix(b.Core, loaderVersion+"-") {
+			return b.Core, nil
+		}
+	}
+	return "", fmt.Errorf("下载源中没有 %s %s 加载器版本 %s 的核心，可以用 --core 或 --jar 指定", serverType, mcVersion, loaderVersion)
+}
+
+// prepareMrpackCreate 读取整合包并补全 emcm create 的参数，已经指定的参数不覆盖
+func prepareMrpackCreate(opts *createOptions) (*zip.ReadCloser, *mrpackIndex, error) {
+	zr, index, err := readMrpack(opts.mrpack)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverType, loaderVersion := mrpackServerType(index)
+	if opts.name == "" {
+		opts.name = index.Name
+	}
+	if opts.name == "" {
+		opts.name = strings.TrimSuffix(filepath.Base(opts.mrpack), filepath.Ext(opts.mrpack))
+	}
+	if opts.serverType == "" {
+		opts.serverType = serverType
+	}
+	if opts.mcVersion == "" {
+		opts.mcVersion = index.Dependencies["minecraft"]
+	}
+	if opts.jar != "" && opts.coreVersion == "" {
+		// 使用本地服务端时以整合包的加载器版本作为核心版本，用于检查模组依赖
+		opts.coreVersion = loaderVersion
+	}
+	if opts.jar == "" && opts.coreVersion == "" {
+		core, err := matchCoreVersion(opts.serverType, opts.mcVersion, loaderVersion)
+		if err != nil {
+			zr.Close()
+			return nil, nil, err
+		}
+		opts.coreVersion = core
+	}
+	// 整合包需要独立的实例目录
+	if opts.dir == "" {
+		opts.dir = opts.name
+	}
+	if entries, err := os.ReadDir(opts.dir); err == nil && len(entries) > 0 {
+		zr.Close()
+		return nil, nil, fmt.Errorf("目录 %s 不为空，用 --dir 指定其他目录", opts.dir)
+	}
+	fmt.Printf("整合包: %s %s (%s %s", index.Name, index.VersionID, opts.serverType, opts.mcVersion)
+	if loaderVersion != "" {
+		fmt.Printf("，加载器 %s", loaderVersion)
+	}
+	fmt.Println(")")
+	return zr, index, nil
+}
+
+// installMrpackFiles 下载服务端需要的文件并校验摘要
+func installMrpackFiles(dir string, index *mrpackIndex) error {
+	installed, skipped := 0, 0
+	for _, f := range index.Files {
+		if f.Env["server"] == MRPACK_ENV_UNSUPPORTED {
+			skipped++
+			continue
+		}
+		dst, err := safeJoin(dir, f.Path)
+		if err != nil {
+			return err
+		}
+		if len(f.Downloads) == 0 {
+			return fmt.Errorf("%s 没有下载地址", f.Path)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		hashes := map[string]string{"sha1": f.Hashes["sha1"], "sha512": f.Hashes["sha512"]}
+		var errs []string
+		for _, u := range f.Downloads {
+			if err = downloadVerified(u, dst, hashes); err == nil {
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.Path, strings.Join(errs, "；"))
+		}
+		installed++
+		if f.Env["server"] == MRPACK_ENV_OPTIONAL {
+			fmt.Printf("已下载 %s (可选)\n", f.Path)
+		} else {
+			fmt.Printf("已下载 %s\n", f.Path)
+		}
+	}
+	fmt.Printf("下载了 %d 个文件，跳过 %d 个客户端文件\n", installed, skipped)
+	return nil
+}
+
+// applyMrpackOverrides 先解压 overrides，再解压 server-overrides 覆盖同名文件
+func applyMrpackOverrides(zr *zip.ReadCloser, dir string) error {
+	count := 0
+	for _, prefix := range []string{MRPACK_OVERRIDES + "/", MRPACK_SERVER_OVERRIDES + "/"} {
+		for _, f := range zr.File {
+			name := strings.TrimPrefix(f.Name, prefix)
+			if name == f.Name || name == "" {
+				continue
+			}
+			target, err := safeJoin(dir, name)
+			if err != nil {
+				return err
+			}
+			if f.FileInfo().IsDir() {
+				if err := os.MkdirAll(target, 0755); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := extractZipFile(f, target); err != nil {
+				return fmt.Errorf("解压 %s 失败: %v", f.Name, err)
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		fmt.Printf("已应用 %d 个覆盖文件\n", count)
+	}
+	return nil
+}
+
+func extractZipFile(f *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// installMrpack 把整合包的文件安装到实例目录
+func installMrpack(zr *zip.ReadCloser, index *mrpackIndex, dir string) error {
+	if err := installMrpackFiles(dir, index); err != nil {
+		return err
+	}
+	return applyMrpackOverrides(zr, dir)
+}
+
+// hashFile 计算文件的 sha1 和 sha512
+func hashFile(file string) (map[string]string, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	sha1sum, sha512sum := newHash("sha1"), newHash("sha512")
+	n, err := io.Copy(io.MultiWriter(sha1sum, sha512sum), f)
+	if err != nil {
+		return nil, 0, err
+	}
+	return map[string]string{
+		"sha1":   hex.EncodeToString(sha1sum.Sum(nil)),
+		"sha512": hex.EncodeToString(sha512sum.Sum(nil)),
+	}, n, nil
+}
+
+// modrinthFileURL 按 sha1 在 Modrinth 类型的索引中查找文件的下载地址，找不到时返回空字符串
+func modrinthFileURL(sha1 string) string {
+	for _, index := range pluginIndexes() {
+		if index.Type != INDEX_MODRINTH {
+			continue
+		}
+		var version modrinthVersion
+		err := httpGetJSON(fmt.Sprintf("%s/version_file/%s?algorithm=sha1", strings.TrimRight(index.URL, "/"), sha1), &version)
+		if err != nil {
+			if !isNotFound(err) {
+				fmt.Printf("\033[33m查询 %s 失败: %v\033[0m\n", index.Name, err)
+			}
+			continue
+		}
+		for _, f := range version.Files {
+			if strings.EqualFold(f.Hashes["sha1"], sha1) {
+				return f.URL
+			}
+		}
+	}
+	return ""
+}
+
+// mrpackEnv 返回模组在客户端和服务端的需求
+func mrpackEnv(side string) map[string]string {
+	switch side {
+	case SIDE_CLIENT:
+		return map[string]string{"client": MRPACK_ENV_REQUIRED, "server": MRPACK_ENV_UNSUPPORTED}
+	case SIDE_SERVER:
+		return map[string]string{"client": MRPACK_ENV_UNSUPPORTED, "server": MRPACK_ENV_REQUIRED}
+	}
+	return map[string]string{"client": MRPACK_ENV_REQUIRED, "server": MRPACK_ENV_REQUIRED}
+}
+
+// mrpackOverrideDir 返回不在 Modrinth 上的文件放入的覆盖目录
+func mrpackOverrideDir(side string) string {
+	switch side {
+	case SIDE_CLIENT:
+		return MRPACK_CLIENT_OVERRIDES
+	case SIDE_SERVER:
+		return MRPACK_SERVER_OVERRIDES
+	}
+	return MRPACK_OVERRIDES
+}
+
+// exportMrpack 把实例的模组 (包括 mods.disabled 中的客户端模组) 打包为 .mrpack，
+// 能在 Modrinth 上找到的模组写入下载地址，其他模组直接放入覆盖目录
+func exportMrpack(server *ServerInstance, output, versionID string) error {
+	loader := serverModLoader(server)
+	index := mrpackIndex{
+		FormatVersion: MRPACK_FORMAT_VERSION,
+		Game:          MRPACK_GAME,
+		VersionID:     versionID,
+		Name:          server.Name,
+		Files:         []mrpackFile{},
+		Dependencies:  map[string]string{"minecraft": server.MCVersion},
+	}
+	for _, l := range mrpackLoaders {
+		if l.loader != loader {
+			continue
+		}
+		loaderVersion := modLoaderVersion(server)
+		if loaderVersion == "" {
+			return fmt.Errorf("无法确定 %s 加载器版本 (核心版本 %s)", loaderNames[loader], server.CoreVersion)
+		}
+		index.Dependencies[l.key] = loaderVersion
+	}
+
+	type exportJar struct {
+		dir  string
+		jar  modJar
+		side string
+	}
+	userList := loadClientModList()
+	var jars []exportJar
+	for _, jar := range installedMods(server) {
+		side := SIDE_BOTH
+		if isClientOnlyJar(jar, userList) {
+			side = SIDE_CLIENT
+		} else if len(jar.mods) > 0 && jar.mods[0].side == SIDE_SERVER {
+			side = SIDE_SERVER
+		}
+		jars = append(jars, exportJar{modsDir(server), jar, side})
+	}
+	for _, file := range disabledMods(server) {
+		jars = append(jars, exportJar{disabledModsDir(server), modJar{file: file}, SIDE_CLIENT})
+	}
+	if len(jars) == 0 {
+		return errors.New("没有安装模组")
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	linked, bundled := 0, 0
+	for _, e := range jars {
+		full := filepath.Join(e.dir, e.jar.file)
+		hashes, size, err := hashFile(full)
+		if err != nil {
+			return err
+		}
+		if u := modrinthFileURL(hashes["sha1"]); u != "" {
+			index.Files = append(index.Files, mrpackFile{
+				Path:      path.Join(MODS_DIR, e.jar.file),
+				Hashes:    hashes,
+				Env:       mrpackEnv(e.side),
+				Downloads: []string{u},
+				FileSize:  size,
+			})
+			linked++
+			continue
+		}
+		w, err := zw.Create(path.Join(mrpackOverrideDir(e.side), MODS_DIR, e.jar.file))
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(full)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+		bundled++
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := zw.Create(MRPACK_INDEX)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("已导出 %s: %d 个模组从 Modrinth 下载，%d 个模组直接打包\n", output, linked, bundled)
+	return out.Close()
+}
+
+func printExportMrpackUsage() {
+	fmt.Println("用法: emcm export-mrpack <服务器ID> [--output 文件] [--version 整合包版本]")
+}
+
+func handleExportMrpackCLI(args []string) {
+	if len(args) < 1 {
+		printExportMrpackUsage()
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	if serverModLoader(server) == "" {
+		fmt.Printf("实例类型 %s 不支持模组\n", server.ServerType)
+		return
+	}
+	output := server.Name + ".mrpack"
+	versionID := time.Now().Format("2006.01.02")
+	for i := 1; i < len(args); i++ {
+		switch {
+		case args[i] == "--output" && i+1 < len(args):
+			output = args[i+1]
+			i++
+		case args[i] == "--version" && i+1 < len(args):
+			versionID = args[i+1]
+			i++
+		default:
+			printExportMrpackUsage()
+			return
+		}
+	}
+	if err := exportMrpack(server, output, versionID); err != nil {
+		os.Remove(output)
+		fmt.Println("导出整合包失败:", err)
+	}
+}
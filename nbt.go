@@ -0,0 +1,698 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	TAG_END        = 0
+	TAG_BYTE       = 1
+	TAG_SHORT      = 2
+	TAG_INT        = 3
+	TAG_LONG       = 4
+	TAG_FLOAT      = 5
+	TAG_DOUBLE     = 6
+	TAG_BYTE_ARRAY = 7
+	TAG_STRING     = 8
+	TAG_LIST       = 9
+	TAG_COMPOUND   = 10
+	TAG_INT_ARRAY  = 11
+	TAG_LONG_ARRAY = 12
+
+	NBT_MAX_DEPTH    = 512
+	NBT_MAX_ELEMENTS = 1 << 26
+
+	NBT_COMPRESSION_NONE = "none"
+	NBT_COMPRESSION_GZIP = "gzip"
+	NBT_COMPRESSION_ZLIB = "zlib"
+)
+
+var nbtTypeNames = map[byte]string{
+	TAG_BYTE: "byte", TAG_SHORT: "short", TAG_INT: "int", TAG_LONG: "long",
+	TAG_FLOAT: "float", TAG_DOUBLE: "double", TAG_BYTE_ARRAY: "byte[]", TAG_STRING: "string",
+	TAG_LIST: "list", TAG_COMPOUND: "compound", TAG_INT_ARRAY: "int[]", TAG_LONG_ARRAY: "long[]",
+}
+
+// NBT 值在内存中的表示:
+// byte=int8 short=int16 int=int32 long=int64 float=float32 double=float64 string=string
+// byte[]=[]int8 int[]=[]int32 long[]=[]int64 list=*nbtList compound=*nbtCompound
+
+// nbtCompound 保留字段的原始顺序，写回时文件结构不变
+type nbtCompound struct {
+	names  []string
+	values map[string]interface{}
+}
+
+type nbtList struct {
+	elemType byte
+	items    []interface{}
+}
+
+// nbtFile 是一个完整的 NBT 文件，写回时使用读取时的压缩方式
+type nbtFile struct {
+	Name        string
+	Root        *nbtCompound
+	Compression string
+}
+
+func newNBTCompound() *nbtCompound {
+	return &nbtCompound{values: make(map[string]interface{})}
+}
+
+func (c *nbtCompound) get(name string) (interface{}, bool) {
+	v, ok := c.values[name]
+	return v, ok
+}
+
+func (c *nbtCompound) set(name string, value interface{}) {
+	if _, ok := c.values[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.values[name] = value
+}
+
+func (c *nbtCompound) keys() []string {
+	return c.names
+}
+
+// compound 返回子 compound，不存在或类型不符时返回 nil
+func (c *nbtCompound) compound(name string) *nbtCompound {
+	v, _ := c.values[name].(*nbtCompound)
+	return v
+}
+
+func nbtTagType(v interface{}) byte {
+	switch v.(type) {
+	case int8:
+		return TAG_BYTE
+	case int16:
+		return TAG_SHORT
+	case int32:
+		return TAG_INT
+	case int64:
+		return TAG_LONG
+	case float32:
+		return TAG_FLOAT
+	case float64:
+		return TAG_DOUBLE
+	case []int8:
+		return TAG_BYTE_ARRAY
+	case string:
+		return TAG_STRING
+	case *nbtList:
+		return TAG_LIST
+	case *nbtCompound:
+		return TAG_COMPOUND
+	case []int32:
+		return TAG_INT_ARRAY
+	case []int64:
+		return TAG_LONG_ARRAY
+	}
+	return TAG_END
+}
+
+// nbtInt 把任意整数类型的标签转换为 int64
+func nbtInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+type nbtReader struct {
+	r     *bufio.Reader
+	depth int
+}
+
+func (d *nbtReader) read(v interface{}) error {
+	return binary.Read(d.r, binary.BigEndian, v)
+}
+
+func (d *nbtReader) length() (int, error) {
+	var n int32
+	if err := d.read(&n); err != nil {
+		return 0, err
+	}
+	if n < 0 || n > NBT_MAX_ELEMENTS {
+		return 0, fmt.Errorf("NBT 长度无效: %d", n)
+	}
+	return int(n), nil
+}
+
+// arrayData 读取数组的长度和内容。数据按实际读到的大小逐步分配，
+// 损坏的长度不会在读取失败前先分配大量内存
+func (d *nbtReader) arrayData(elemSize int) (*bytes.Reader, int, error) {
+	n, err := d.length()
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)*int64(elemSize)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	return bytes.NewReader(buf.Bytes()), n, nil
+}
+
+func (d *nbtReader) readString() (string, error) {
+	var n uint16
+	if err := d.read(&n); err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return "", err
+	}
+	return decodeModifiedUTF8(buf), nil
+}
+
+func (d *nbtReader) readPayload(tagType byte) (interface{}, error) {
+	switch tagType {
+	case TAG_BYTE:
+		var v int8
+		return v, d.read(&v)
+	case TAG_SHORT:
+		var v int16
+		return v, d.read(&v)
+	case TAG_INT:
+		var v int32
+		return v, d.read(&v)
+	case TAG_LONG:
+		var v int64
+		return v, d.read(&v)
+	case TAG_FLOAT:
+		var v float32
+		return v, d.read(&v)
+	case TAG_DOUBLE:
+		var v float64
+		return v, d.read(&v)
+	case TAG_STRING:
+		return d.readString()
+	case TAG_BYTE_ARRAY:
+		data, n, err := d.arrayData(1)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int8, n)
+		return v, binary.Read(data, binary.BigEndian, v)
+	case TAG_INT_ARRAY:
+		data, n, err := d.arrayData(4)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int32, n)
+		return v, binary.Read(data, binary.BigEndian, v)
+	case TAG_LONG_ARRAY:
+		data, n, err := d.arrayData(8)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int64, n)
+		return v, binary.Read(data, binary.BigEndian, v)
+	case TAG_LIST:
+		d.depth++
+		defer func() { d.depth-- }()
+		if d.depth > NBT_MAX_DEPTH {
+			return nil, errors.New("NBT 嵌套过深")
+		}
+		elemType, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		list := &nbtList{elemType: elemType}
+		if elemType == TAG_END {
+			return list, nil
+		}
+		for i := 0; i < n; i++ {
+			item, err := d.readPayload(elemType)
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+		}
+		return list, nil
+	case TAG_COMPOUND:
+		d.depth++
+		defer func() { d.depth-- }()
+		if d.depth > NBT_MAX_DEPTH {
+			return nil, errors.New("NBT 嵌套过深")
+		}
+		c := newNBTCompound()
+		for {
+			childType, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if childType == TAG_END {
+				return c, nil
+			}
+			name, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.readPayload(childType)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			c.set(name, value)
+		}
+	}
+	return nil, fmt.Errorf("未知的 NBT 标签类型: %d", tagType)
+}
+
+// readNBT 读取未压缩的 NBT 数据，根标签必须是 compound
+func readNBT(r io.Reader) (string, *nbtCompound, error) {
+	d := &nbtReader{r: bufio.NewReader(r)}
+	tagType, err := d.r.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	if tagType != TAG_COMPOUND {
+		return "", nil, fmt.Errorf("NBT 根标签不是 compound (类型 %d)", tagType)
+	}
+	name, err := d.readString()
+	if err != nil {
+		return "", nil, err
+	}
+	root, err := d.readPayload(TAG_COMPOUND)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, root.(*nbtCompound), nil
+}
+
+// decodeNBT 自动识别 gzip、zlib 或未压缩的数据
+func decodeNBT(data []byte) (*nbtFile, error) {
+	var r io.Reader = bytes.NewReader(data)
+	compression := NBT_COMPRESSION_NONE
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r, compression = gz, NBT_COMPRESSION_GZIP
+	case len(data) >= 2 && data[0] == 0x78 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r, compression = zr, NBT_COMPRESSION_ZLIB
+	}
+	name, root, err := readNBT(r)
+	if err != nil {
+		return nil, err
+	}
+	return &nbtFile{Name: name, Root: root, Compression: compression}, nil
+}
+
+func readNBTFile(path string) (*nbtFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := decodeNBT(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", filepath.Base(path), err)
+	}
+	return f, nil
+}
+
+type nbtWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *nbtWriter) write(v interface{}) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.BigEndian, v)
+	}
+}
+
+func (e *nbtWriter) writeString(s string) {
+	data := encodeModifiedUTF8(s)
+	if len(data) > math.MaxUint16 && e.err == nil {
+		e.err = errors.New("NBT 字符串过长")
+		return
+	}
+	e.write(uint16(len(data)))
+	if e.err == nil {
+		_, e.err = e.w.Write(data)
+	}
+}
+
+func (e *nbtWriter) writePayload(v interface{}) {
+	switch t := v.(type) {
+	case int8, int16, int32, int64, float32, float64:
+		e.write(t)
+	case string:
+		e.writeString(t)
+	case []int8:
+		e.write(int32(len(t)))
+		e.write(t)
+	case []int32:
+		e.write(int32(len(t)))
+		e.write(t)
+	case []int64:
+		e.write(int32(len(t)))
+		e.write(t)
+	case *nbtList:
+		e.write(t.elemType)
+		e.write(int32(len(t.items)))
+		for _, item := range t.items {
+			if nbtTagType(item) != t.elemType && e.err == nil {
+				e.err = errors.New("NBT 列表元素类型不一致")
+			}
+			e.writePayload(item)
+		}
+	case *nbtCompound:
+		for _, name := range t.names {
+			value := t.values[name]
+			e.write(nbtTagType(value))
+			e.writeString(name)
+			e.writePayload(value)
+		}
+		e.write(byte(TAG_END))
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("不支持的 NBT 值类型: %T", v)
+		}
+	}
+}
+
+func writeNBT(w io.Writer, name string, root *nbtCompound) error {
+	e := &nbtWriter{w: bufio.NewWriter(w)}
+	e.write(byte(TAG_COMPOUND))
+	e.writeString(name)
+	e.writePayload(root)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+func encodeNBT(f *nbtFile) ([]byte, error) {
+	var buf bytes.Buffer
+	switch f.Compression {
+	case NBT_COMPRESSION_GZIP:
+		gz := gzip.NewWriter(&buf)
+		if err := writeNBT(gz, f.Name, f.Root); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	case NBT_COMPRESSION_ZLIB:
+		zw := zlib.NewWriter(&buf)
+		if err := writeNBT(zw, f.Name, f.Root); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		if err := writeNBT(&buf, f.Name, f.Root); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeNBTFile 先写入临时文件并重新解析校验，再替换原文件
+func writeNBTFile(path string, f *nbtFile) error {
+	data, err := encodeNBT(f)
+	if err != nil {
+		return err
+	}
+	if _, err := decodeNBT(data); err != nil {
+		return fmt.Errorf("写入的数据校验失败: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// decodeModifiedUTF8 解码 Java 的 Modified UTF-8: 空字符为 C0 80，增补字符以两个 3 字节代理项表示
+func decodeModifiedUTF8(data []byte) string {
+	units := make([]uint16, 0, len(data))
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c < 0x80:
+			units = append(units, uint16(c))
+			i++
+		case c&0xe0 == 0xc0 && i+1 < len(data):
+			units = append(units, uint16(c&0x1f)<<6|uint16(data[i+1]&0x3f))
+			i += 2
+		case c&0xf0 == 0xe0 && i+2 < len(data):
+			units = append(units, uint16(c&0x0f)<<12|uint16(data[i+1]&0x3f)<<6|uint16(data[i+2]&0x3f))
+			i += 3
+		default:
+			units = append(units, 0xfffd)
+			i++
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+func encodeModifiedUTF8(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, u := range utf16.Encode([]rune(s)) {
+		switch {
+		case u != 0 && u < 0x80:
+			out = append(out, byte(u))
+		case u < 0x800:
+			out = append(out, byte(0xc0|u>>6), byte(0x80|u&0x3f))
+		default:
+			out = append(out, byte(0xe0|u>>12), byte(0x80|(u>>6)&0x3f), byte(0x80|u&0x3f))
+		}
+	}
+	return out
+}
+
+// formatNBTValue 以 SNBT 风格输出标量值，数组和列表只显示长度
+func formatNBTValue(v interface{}) string {
+	switch t := v.(type) {
+	case int8:
+		return strconv.Itoa(int(t)) + "b"
+	case int16:
+		return strconv.Itoa(int(t)) + "s"
+	case int32:
+		return strconv.Itoa(int(t))
+	case int64:
+		return strconv.FormatInt(t, 10) + "L"
+	case float32:
+		return strconv.FormatFloat(float64(t), 'g', -1, 32) + "f"
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64) + "d"
+	case string:
+		return strconv.Quote(t)
+	case []int8:
+		return fmt.Sprintf("[B; %d 项]", len(t))
+	case []int32:
+		// 长度为 4 的 int 数组通常是 UUID，直接显示内容
+		if len(t) <= 4 {
+			parts := make([]string, len(t))
+			for i, n := range t {
+				parts[i] = strconv.Itoa(int(n))
+			}
+			return "[I; " + strings.Join(parts, ", ") + "]"
+		}
+		return fmt.Sprintf("[I; %d 项]", len(t))
+	case []int64:
+		return fmt.Sprintf("[L; %d 项]", len(t))
+	case *nbtList:
+		return fmt.Sprintf("[%s; %d 项]", nbtTypeNames[t.elemType], len(t.items))
+	case *nbtCompound:
+		return fmt.Sprintf("{%d 个字段}", len(t.names))
+	}
+	return fmt.Sprint(v)
+}
+
+// printNBTTree 以缩进的树形输出 NBT，maxDepth 为 0 时不限制深度
+func printNBTTree(name string, v interface{}, indent, maxDepth int) {
+	prefix := strings.Repeat("  ", indent)
+	switch t := v.(type) {
+	case *nbtCompound:
+		if name != "" {
+			fmt.Printf("%s%s:\n", prefix, name)
+			indent++
+		}
+		if maxDepth > 0 && indent > maxDepth {
+			fmt.Printf("%s  %s\n", prefix, formatNBTValue(t))
+			return
+		}
+		for _, key := range t.names {
+			printNBTTree(key, t.values[key], indent, maxDepth)
+		}
+	case *nbtList:
+		fmt.Printf("%s%s: %s\n", prefix, name, formatNBTValue(t))
+		if t.elemType != TAG_COMPOUND && t.elemType != TAG_LIST {
+			if len(t.items) <= 8 {
+				for i, item := range t.items {
+					fmt.Printf("%s  [%d] %s\n", prefix, i, formatNBTValue(item))
+				}
+			}
+			return
+		}
+		if maxDepth > 0 && indent+1 > maxDepth {
+			return
+		}
+		for i, item := range t.items {
+			printNBTTree(fmt.Sprintf("[%d]", i), item, indent+1, maxDepth)
+		}
+	default:
+		fmt.Printf("%s%s: %s\n", prefix, name, formatNBTValue(v))
+	}
+}
+
+// nbtPathSegments 把 Data.Player.Pos[0] 拆分为 Data、Player、Pos、[0]
+func nbtPathSegments(path string) ([]string, error) {
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			return nil, fmt.Errorf("无效的路径: %s", path)
+		}
+		for {
+			open := strings.Index(part, "[")
+			if open < 0 {
+				segments = append(segments, part)
+				break
+			}
+			if open > 0 {
+				segments = append(segments, part[:open])
+			}
+			end := strings.Index(part, "]")
+			if end < open {
+				return nil, fmt.Errorf("无效的路径: %s", path)
+			}
+			segments = append(segments, part[open:end+1])
+			part = part[end+1:]
+			if part == "" {
+				break
+			}
+		}
+	}
+	return segments, nil
+}
+
+// lookupNBT 按路径查找值，返回所在的容器以便修改
+func lookupNBT(root *nbtCompound, segments []string) (parent interface{}, key string, value interface{}, err error) {
+	var current interface{} = root
+	for i, seg := range segments {
+		parent = current
+		key = seg
+		switch c := current.(type) {
+		case *nbtCompound:
+			v, ok := c.get(seg)
+			if !ok {
+				if i == len(segments)-1 {
+					return parent, key, nil, nil
+				}
+				return nil, "", nil, fmt.Errorf("字段不存在: %s", strings.Join(segments[:i+1], "."))
+			}
+			current = v
+		case *nbtList:
+			idx, convErr := strconv.Atoi(strings.Trim(seg, "[]"))
+			if !strings.HasPrefix(seg, "[") || convErr != nil || idx < 0 || idx >= len(c.items) {
+				return nil, "", nil, fmt.Errorf("无效的列表下标: %s", seg)
+			}
+			current = c.items[idx]
+		default:
+			return nil, "", nil, fmt.Errorf("%s 不是 compound 或列表", strings.Join(segments[:i], "."))
+		}
+	}
+	return parent, key, current, nil
+}
+
+// parseNBTValue 按目标类型解析字符串值，byte 接受 true/false
+func parseNBTValue(tagType byte, text string) (interface{}, error) {
+	switch tagType {
+	case TAG_BYTE:
+		switch strings.ToLower(text) {
+		case "true":
+			return int8(1), nil
+		case "false":
+			return int8(0), nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(strings.ToLower(text), "b"), 10, 8)
+		return int8(n), err
+	case TAG_SHORT:
+		n, err := strconv.ParseInt(strings.TrimSuffix(strings.ToLower(text), "s"), 10, 16)
+		return int16(n), err
+	case TAG_INT:
+		n, err := strconv.ParseInt(text, 10, 32)
+		return int32(n), err
+	case TAG_LONG:
+		n, err := strconv.ParseInt(strings.TrimSuffix(strings.ToLower(text), "l"), 10, 64)
+		return n, err
+	case TAG_FLOAT:
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(text), "f"), 32)
+		return float32(f), err
+	case TAG_DOUBLE:
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(text), "d"), 64)
+		return f, err
+	case TAG_STRING:
+		if unquoted, err := strconv.Unquote(text); err == nil {
+			return unquoted, nil
+		}
+		return text, nil
+	}
+	return nil, fmt.Errorf("不能直接修改 %s 类型的字段", nbtTypeNames[tagType])
+}
+
+// nbtTypeByName 把 byte、int 等类型名转换为标签类型
+func nbtTypeByName(name string) (byte, bool) {
+	for t, n := range nbtTypeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func sortedNBTTypeNames() []string {
+	var names []string
+	for t, n := range nbtTypeNames {
+		if t <= TAG_DOUBLE || t == TAG_STRING {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
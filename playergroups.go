@@ -0,0 +1,627 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PlayerGroup 是多个实例共享的玩家名单，组内保存权威名单，修改时推送到所有成员
+type PlayerGroup struct {
+	Members       []string         `json:"members"`
+	Lists         []string         `json:"lists"`
+	Whitelist     []whitelistEntry `json:"whitelist,omitempty"`
+	Ops           []opEntry        `json:"ops,omitempty"`
+	BannedPlayers []banEntry       `json:"banned_players,omitempty"`
+	BannedIPs     []banEntry       `json:"banned_ips,omitempty"`
+}
+
+// groupListNames 是 --lists 可用的名称，bans 同时包含玩家和 IP 封禁
+var groupListNames = map[string][]string{
+	"whitelist": {LIST_WHITELIST},
+	"ops":       {LIST_OPS},
+	"bans":      {LIST_BANNED_PLAYERS, LIST_BANNED_IPS},
+}
+
+var defaultGroupLists = []string{LIST_WHITELIST, LIST_BANNED_PLAYERS, LIST_BANNED_IPS}
+
+func getPlayerGroup(name string) (*PlayerGroup, error) {
+	group, ok := config.PlayerGroups[name]
+	if !ok {
+		return nil, fmt.Errorf("名单组不存在: %s", name)
+	}
+	return group, nil
+}
+
+func sortedGroupNames() []string {
+	names := make([]string, 0, len(config.PlayerGroups))
+	for name := range config.PlayerGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *PlayerGroup) shares(kind string) bool {
+	for _, l := range g.Lists {
+		if l == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *PlayerGroup) hasMember(id string) bool {
+	for _, m := range g.Members {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *PlayerGroup) items(kind string) []accessItem {
+	switch kind {
+	case LIST_WHITELIST:
+		return toAccessItems(g.Whitelist)
+	case LIST_OPS:
+		return toAccessItems(g.Ops)
+	case LIST_BANNED_PLAYERS:
+		return toAccessItems(g.BannedPlayers)
+	}
+	return toAccessItems(g.BannedIPs)
+}
+
+func (g *PlayerGroup) setItems(kind string, items []accessItem) {
+	list := fromAccessItems(kind, items)
+	switch kind {
+	case LIST_WHITELIST:
+		g.Whitelist = list.([]whitelistEntry)
+	case LIST_OPS:
+		g.Ops = list.([]opEntry)
+	case LIST_BANNED_PLAYERS:
+		g.BannedPlayers = list.([]banEntry)
+	default:
+		g.BannedIPs = list.([]banEntry)
+	}
+}
+
+// members 返回仍然存在的成员实例，已删除的实例会给出提示
+func (g *PlayerGroup) members() []*ServerInstance {
+	var servers []*ServerInstance
+	for _, id := range g.Members {
+		server, ok := config.ServerInstalls[id]
+		if !ok {
+			fmt.Printf("\033[33m成员 %s 已不存在 (emcm group leave 可以移除)\033[0m\n", id)
+			continue
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// serverGroups 返回包含该实例的名单组
+func serverGroups(id string) []string {
+	var names []string
+	for _, name := range sortedGroupNames() {
+		if config.PlayerGroups[name].hasMember(id) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// printGroupHint 在单独修改组内实例的共享名单后提醒使用 emcm group
+func printGroupHint(server *ServerInstance, kinds []string) {
+	for _, name := range serverGroups(server.ID) {
+		for _, kind := range kinds {
+			if config.PlayerGroups[name].shares(kind) {
+				fmt.Printf("\033[33m提示: %s 属于名单组 %s，单独修改会与其他成员不一致，请使用 emcm group 修改 (emcm group check %s 查看差异)\033[0m\n", server.ID, name, name)
+				return
+			}
+		}
+	}
+}
+
+// removeFromGroups 在删除实例时把它移出所有名单组
+func removeFromGroups(id string) {
+	for _, group := range config.PlayerGroups {
+		var kept []string
+		for _, m := range group.Members {
+			if m != id {
+				kept = append(kept, m)
+			}
+		}
+		group.Members = kept
+	}
+}
+
+// itemsDiffer 比较同一玩家在两份名单中的条目，只比较会影响服务端行为的字段
+func itemsDiffer(a, b accessItem) bool {
+	switch ea := a.entry.(type) {
+	case opEntry:
+		eb := b.entry.(opEntry)
+		return ea.Level != eb.Level || ea.BypassesPlayerLimit != eb.BypassesPlayerLimit
+	case banEntry:
+		return ea.Expires != b.entry.(banEntry).Expires
+	}
+	return false
+}
+
+// listDrift 是某个成员的一份名单与组名单的差异
+type listDrift struct {
+	missing   []accessItem
+	extra     []accessItem
+	different []accessItem
+}
+
+func (d listDrift) empty() bool {
+	return len(d.missing) == 0 && len(d.extra) == 0 && len(d.different) == 0
+}
+
+// activeItems 去掉已过期的封禁，服务端加载时会忽略它们
+func activeItems(items []accessItem) []accessItem {
+	var active []accessItem
+	for _, it := range items {
+		if e, ok := it.entry.(banEntry); ok && banExpired(e) {
+			continue
+		}
+		active = append(active, it)
+	}
+	return active
+}
+
+func compareItems(canonical, actual []accessItem) listDrift {
+	var drift listDrift
+	byKey := make(map[string]accessItem)
+	for _, it := range activeItems(actual) {
+		byKey[it.key] = it
+	}
+	wanted := make(map[string]bool)
+	for _, it := range activeItems(canonical) {
+		wanted[it.key] = true
+		have, ok := byKey[it.key]
+		switch {
+		case !ok:
+			drift.missing = append(drift.missing, it)
+		case itemsDiffer(it, have):
+			drift.different = append(drift.different, it)
+		}
+	}
+	for _, it := range activeItems(actual) {
+		if !wanted[it.key] {
+			drift.extra = append(drift.extra, it)
+		}
+	}
+	return drift
+}
+
+func itemNames(items []accessItem) string {
+	names := make([]string, len(items))
+	for i, it := range items {
+		names[i] = it.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkGroup 报告每个成员与组名单的差异，返回有差异的名单数
+func checkGroup(name string, group *PlayerGroup) int {
+	fmt.Printf("\n名单组 %s:\n", name)
+	drifted := 0
+	for _, server := range group.members() {
+		clean := true
+		for _, kind := range group.Lists {
+			actual, err := readAccessItems(server, kind)
+			if err != nil {
+				fmt.Printf("  \033[31m%s %s: %v\033[0m\n", server.ID, listTitles[kind], err)
+				drifted++
+				clean = false
+				continue
+			}
+			drift := compareItems(group.items(kind), actual)
+			if drift.empty() {
+				continue
+			}
+			drifted++
+			clean = false
+			fmt.Printf("  \033[33m%s %s:\033[0m\n", server.ID, listTitles[kind])
+			if len(drift.missing) > 0 {
+				fmt.Printf("    缺少: %s\n", itemNames(drift.missing))
+			}
+			if len(drift.extra) > 0 {
+				fmt.Printf("    多出: %s\n", itemNames(drift.extra))
+			}
+			if len(drift.different) > 0 {
+				fmt.Printf("    不同: %s\n", itemNames(drift.different))
+			}
+		}
+		if clean {
+			fmt.Printf("  \033[32m%s 一致\033[0m\n", server.ID)
+		}
+	}
+	return drifted
+}
+
+// importGroupItems 把成员中组名单没有的条目并入组名单
+func importGroupItems(group *PlayerGroup) int {
+	imported := 0
+	members := group.members()
+	for _, kind := range group.Lists {
+		items := group.items(kind)
+		for _, server := range members {
+			actual, err := readAccessItems(server, kind)
+			if err != nil {
+				fmt.Printf("\033[33m读取 %s 的%s失败: %v\033[0m\n", server.ID, listTitles[kind], err)
+				continue
+			}
+			for _, it := range compareItems(items, actual).extra {
+				items = append(items, it)
+				fmt.Printf("从 %s 导入%s: %s\n", server.ID, listTitles[kind], describeItem(it))
+				imported++
+			}
+		}
+		group.setItems(kind, items)
+	}
+	return imported
+}
+
+// syncGroup 把组名单推送到所有成员，返回执行的修改数
+func syncGroup(group *PlayerGroup) (int, error) {
+	changes := 0
+	for _, server := range group.members() {
+		live := isServerRunning(server.ID)
+		for _, kind := range group.Lists {
+			actual, err := readAccessItems(server, kind)
+			if err != nil {
+				return changes, fmt.Errorf("%s: %v", server.ID, err)
+			}
+			drift := compareItems(group.items(kind), actual)
+			if drift.empty() {
+				continue
+			}
+			fmt.Printf("[%s] %s\n", server.ID, listTitles[kind])
+			for _, it := range drift.extra {
+				if err := applyAccessChange(server, kind, it, false); err != nil {
+					return changes, err
+				}
+				changes++
+			}
+			for _, it := range drift.missing {
+				if live && !liveExpressible(server, it) {
+					fmt.Printf("\033[33m  %s 需要停止服务器后同步 (控制台命令无法设置权限等级或封禁期限)\033[0m\n", it.name)
+					continue
+				}
+				if err := applyAccessChange(server, kind, it, true); err != nil {
+					return changes, err
+				}
+				changes++
+			}
+			for _, it := range drift.different {
+				if live {
+					fmt.Printf("\033[33m  %s 需要停止服务器后同步 (控制台命令无法设置权限等级或封禁期限)\033[0m\n", it.name)
+					continue
+				}
+				if err := applyAccessChange(server, kind, it, true); err != nil {
+					return changes, err
+				}
+				changes++
+			}
+		}
+	}
+	return changes, nil
+}
+
+// liveExpressible 判断条目能否用控制台命令原样添加: op 命令只能使用 op-permission-level，ban 命令只能永久封禁
+func liveExpressible(server *ServerInstance, item accessItem) bool {
+	switch e := item.entry.(type) {
+	case opEntry:
+		return e.Level == opPermissionLevel(server) && !e.BypassesPlayerLimit
+	case banEntry:
+		return e.Expires == "" || e.Expires == BAN_FOREVER
+	}
+	return true
+}
+
+// groupAccessCommand 修改组名单并推送到所有成员，运行中的成员通过控制台命令修改
+func groupAccessCommand(name string, group *PlayerGroup, command, action string, targets []string, opts accessOptions) error {
+	members := group.members()
+	switch action {
+	case "on", "off":
+		for _, server := range members {
+			fmt.Printf("[%s] ", server.ID)
+			if err := accessServerCommand(server, command, action, nil, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "ls":
+		for _, kind := range commandLists(command) {
+			if !group.shares(kind) {
+				continue
+			}
+			items := group.items(kind)
+			fmt.Printf("\n%s (共 %d 条):\n", listTitles[kind], len(items))
+			printAccessItems(kind, items)
+		}
+		return nil
+	}
+
+	if len(members) == 0 {
+		return fmt.Errorf("名单组 %s 还没有成员 (emcm group join %s <服务器ID>)", name, name)
+	}
+	for _, target := range targets {
+		kind := targetKind(command, target)
+		if !group.shares(kind) {
+			return fmt.Errorf("名单组 %s 不共享%s", name, listTitles[kind])
+		}
+		item := queryItem(kind, target)
+		if action == "add" {
+			var err error
+			// 组内成员的正版/离线模式相同，用第一个成员查询 UUID
+			if item, err = newAccessItem(kind, target, opts, members[0]); err != nil {
+				return err
+			}
+			for _, server := range members {
+				if isServerRunning(server.ID) && !liveExpressible(server, item) {
+					return fmt.Errorf("%s 正在运行，控制台命令无法设置权限等级或封禁期限，需要先停止服务器", server.ID)
+				}
+			}
+			items, _ := upsertItem(group.items(kind), item)
+			group.setItems(kind, items)
+		} else {
+			items, changed := removeItems(group.items(kind), item)
+			if !changed {
+				fmt.Printf("组名单中没有 %s，仍会从成员中移除\n", target)
+			}
+			group.setItems(kind, items)
+		}
+		saveConfig()
+
+		for _, server := range members {
+			fmt.Printf("[%s] ", server.ID)
+			if err := applyAccessChange(server, kind, item, action == "add"); err != nil {
+				fmt.Printf("\033[31m%v\033[0m\n", err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseGroupLists 解析 --lists，例如 whitelist,bans
+func parseGroupLists(value string) ([]string, error) {
+	var lists []string
+	for _, part := range strings.Split(value, ",") {
+		kinds, ok := groupListNames[strings.TrimSpace(part)]
+		if !ok {
+			return nil, fmt.Errorf("未知的名单: %s (可用: whitelist, ops, bans)", part)
+		}
+		lists = append(lists, kinds...)
+	}
+	return lists, nil
+}
+
+// describeGroupLists 把名单类型转换回 --lists 使用的名称
+func describeGroupLists(lists []string) string {
+	group := PlayerGroup{Lists: lists}
+	var names []string
+	for _, name := range []string{"whitelist", "ops", "bans"} {
+		if group.shares(groupListNames[name][0]) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// joinGroup 把实例加入名单组，正版模式不同或与其他组共享同一名单时给出警告
+func joinGroup(name string, group *PlayerGroup, server *ServerInstance) {
+	if group.hasMember(server.ID) {
+		fmt.Printf("%s 已在名单组 %s 中\n", server.ID, name)
+		return
+	}
+	for _, other := range group.members() {
+		if isOnlineMode(other) != isOnlineMode(server) {
+			fmt.Printf("\033[33m警告: %s 与 %s 的 online-mode 不同，同一玩家的 UUID 会不一致\033[0m\n", server.ID, other.ID)
+			break
+		}
+	}
+	for _, otherName := range serverGroups(server.ID) {
+		for _, kind := range group.Lists {
+			if config.PlayerGroups[otherName].shares(kind) {
+				fmt.Printf("\033[33m警告: %s 已在名单组 %s 中，两个组都管理%s\033[0m\n", server.ID, otherName, listTitles[kind])
+				break
+			}
+		}
+	}
+	group.Members = append(group.Members, server.ID)
+	fmt.Printf("已将 %s 加入名单组 %s\n", server.ID, name)
+}
+
+func printGroupUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm group ls")
+	fmt.Println("  emcm group create <组名> [--lists whitelist,ops,bans]   默认共享白名单和封禁")
+	fmt.Println("  emcm group rm <组名>")
+	fmt.Println("  emcm group join|leave <组名> <服务器ID>...")
+	fmt.Println("  emcm group whitelist <组名> ls|add|rm|on|off [玩家名]... [--uuid UUID]")
+	fmt.Println("  emcm group op <组名> ls|add|rm [玩家名]... [--level 1-4] [--bypass] [--uuid UUID]")
+	fmt.Println("  emcm group ban <组名> ls|add|rm [玩家名|IP]... [--reason 原因] [--expires 7d]")
+	fmt.Println("  emcm group check [组名]              报告成员与组名单的差异，有差异时退出码为 1")
+	fmt.Println("  emcm group sync <组名> [--import]    把组名单推送到所有成员，--import 先合并成员已有的条目")
+}
+
+func handleGroupCLI(args []string) {
+	if len(args) < 1 {
+		printGroupUsage()
+		return
+	}
+
+	switch args[0] {
+	case "ls":
+		if len(config.PlayerGroups) == 0 {
+			fmt.Println("还没有名单组")
+			return
+		}
+		for _, name := range sortedGroupNames() {
+			group := config.PlayerGroups[name]
+			fmt.Printf("%-12s 共享: %s  白名单 %d  管理员 %d  封禁 %d\n", name, describeGroupLists(group.Lists),
+				len(group.Whitelist), len(group.Ops), len(group.BannedPlayers)+len(group.BannedIPs))
+			fmt.Printf("%-12s 成员: %s\n", "", strings.Join(group.Members, ", "))
+		}
+
+	case "create":
+		if len(args) < 2 {
+			printGroupUsage()
+			return
+		}
+		name := args[1]
+		if _, ok := config.PlayerGroups[name]; ok {
+			fmt.Println("名单组已存在:", name)
+			return
+		}
+		group := &PlayerGroup{Lists: defaultGroupLists}
+		if len(args) >= 4 && args[2] == "--lists" {
+			lists, err := parseGroupLists(args[3])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			group.Lists = lists
+		} else if len(args) > 2 {
+			printGroupUsage()
+			return
+		}
+		if config.PlayerGroups == nil {
+			config.PlayerGroups = make(map[string]*PlayerGroup)
+		}
+		config.PlayerGroups[name] = group
+		saveConfig()
+		fmt.Printf("已创建名单组 %s (共享: %s)\n", name, describeGroupLists(group.Lists))
+
+	case "rm":
+		if len(args) < 2 {
+			printGroupUsage()
+			return
+		}
+		if _, err := getPlayerGroup(args[1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+		delete(config.PlayerGroups, args[1])
+		saveConfig()
+		fmt.Println("已删除名单组 (成员的名单文件不会改变):", args[1])
+
+	case "join", "leave":
+		if len(args) < 3 {
+			printGroupUsage()
+			return
+		}
+		group, err := getPlayerGroup(args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, id := range args[2:] {
+			if args[0] == "leave" {
+				if !group.hasMember(id) {
+					fmt.Printf("%s 不在名单组 %s 中\n", id, args[1])
+					continue
+				}
+				var kept []string
+				for _, m := range group.Members {
+					if m != id {
+						kept = append(kept, m)
+					}
+				}
+				group.Members = kept
+				fmt.Printf("已将 %s 移出名单组 %s\n", id, args[1])
+				continue
+			}
+			server, ok := requireServer(id)
+			if !ok {
+				return
+			}
+			joinGroup(args[1], group, server)
+		}
+		saveConfig()
+		if args[0] == "join" {
+			fmt.Printf("使用 emcm group sync %s 把组名单推送到新成员 (--import 可以先合并成员已有的条目)\n", args[1])
+		}
+
+	case "whitelist", "op", "ban":
+		if len(args) < 3 {
+			printGroupUsage()
+			return
+		}
+		group, err := getPlayerGroup(args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		opts, targets, err := parseAccessArgs(args[3:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if !validAccessAction(args[0], args[2], targets) {
+			printGroupUsage()
+			return
+		}
+		if err := groupAccessCommand(args[1], group, args[0], args[2], targets, opts); err != nil {
+			fmt.Println("操作失败:", err)
+		}
+
+	case "check":
+		names := sortedGroupNames()
+		if len(args) > 1 {
+			if _, err := getPlayerGroup(args[1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+			names = []string{args[1]}
+		}
+		if len(names) == 0 {
+			fmt.Println("还没有名单组")
+			return
+		}
+		drifted := 0
+		for _, name := range names {
+			drifted += checkGroup(name, config.PlayerGroups[name])
+		}
+		if drifted > 0 {
+			fmt.Printf("\n\033[33m发现 %d 处不一致，使用 emcm group sync <组名> 修复\033[0m\n", drifted)
+			os.Exit(1)
+		}
+
+	case "sync":
+		if len(args) < 2 {
+			printGroupUsage()
+			return
+		}
+		group, err := getPlayerGroup(args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if len(args) > 2 && args[2] == "--import" {
+			if n := importGroupItems(group); n > 0 {
+				saveConfig()
+				fmt.Printf("已导入 %d 条记录\n", n)
+			}
+		}
+		changes, err := syncGroup(group)
+		if err != nil {
+			fmt.Println("同步失败:", err)
+			return
+		}
+		if changes == 0 {
+			fmt.Println("所有成员已与组名单一致")
+		} else {
+			fmt.Printf("同步完成，共 %d 处修改\n", changes)
+		}
+
+	default:
+		printGroupUsage()
+	}
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const USERCACHE_FILE = "usercache.json"
+
+// playerUUIDRe 匹配 playerdata 中的文件名，其他文件 (如旧版按玩家名保存的存档) 会被跳过
+var playerUUIDRe = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+type userCacheEntry struct {
+	Name      string `json:"name"`
+	UUID      string `json:"uuid"`
+	ExpiresOn string `json:"expiresOn"`
+}
+
+func readUserCache(server *ServerInstance) ([]userCacheEntry, error) {
+	data, err := os.ReadFile(filepath.Join(serverDir(server), USERCACHE_FILE))
+	if err != nil {
+		return nil, err
+	}
+	var cache []userCacheEntry
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("%s 格式错误: %v", USERCACHE_FILE, err)
+	}
+	return cache, nil
+}
+
+// playerInfo 汇总世界目录中 playerdata、stats 和 advancements 下的玩家数据
+type playerInfo struct {
+	UUID         string
+	Name         string
+	LastSeen     time.Time
+	Data         *nbtCompound
+	Stats        map[string]map[string]int64
+	Advancements int
+}
+
+// loadPlayers 读取所有在该世界中有存档的玩家，按最后在线时间倒序
+func loadPlayers(server *ServerInstance, world string) ([]*playerInfo, error) {
+	dir := worldDir(server, world)
+	files, err := filepath.Glob(filepath.Join(dir, "playerdata", "*.dat"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s 中没有玩家数据", filepath.Join(dir, "playerdata"))
+	}
+
+	names := make(map[string]string)
+	if cache, err := readUserCache(server); err == nil {
+		for _, entry := range cache {
+			names[strings.ToLower(entry.UUID)] = entry.Name
+		}
+	}
+
+	var players []*playerInfo
+	for _, path := range files {
+		uuid := strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".dat"))
+		if !playerUUIDRe.MatchString(uuid) {
+			continue
+		}
+		player := &playerInfo{UUID: uuid, Name: names[uuid]}
+		if info, err := os.Stat(path); err == nil {
+			player.LastSeen = info.ModTime()
+		}
+		if level, err := readNBTFile(path); err == nil {
+			player.Data = level.Root
+			// Bukkit 系服务端额外记录了玩家名和最后在线时间
+			if bukkit := level.Root.compound("bukkit"); bukkit != nil {
+				if player.Name == "" {
+					player.Name = levelString(bukkit, "lastKnownName")
+				}
+				if last, ok := levelInt(bukkit, "lastPlayed"); ok && last > 0 {
+					player.LastSeen = time.UnixMilli(last)
+				}
+			}
+		} else {
+			fmt.Printf("\033[33m读取 %s 失败: %v\033[0m\n", filepath.Base(path), err)
+		}
+		if player.Name == "" {
+			player.Name = uuid[:8]
+		}
+		player.Stats, _ = loadPlayerStats(filepath.Join(dir, "stats", uuid+".json"))
+		player.Advancements, _ = countAdvancements(filepath.Join(dir, "advancements", uuid+".json"))
+		players = append(players, player)
+	}
+	if len(players) == 0 {
+		return nil, fmt.Errorf("%s 中没有玩家数据", filepath.Join(dir, "playerdata"))
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].LastSeen.After(players[j].LastSeen)
+	})
+	return players, nil
+}
+
+func findPlayer(players []*playerInfo, query string) *playerInfo {
+	query = strings.ToLower(query)
+	for _, p := range players {
+		if strings.ToLower(p.Name) == query || p.UUID == query {
+			return p
+		}
+	}
+	return nil
+}
+
+var (
+	camelRe = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+	// legacyStatCategories 是 1.13 之前统计项前缀与新分类的对应关系
+	legacyStatCategories = map[string]string{
+		"mineBlock":      "minecraft:mined",
+		"craftItem":      "minecraft:crafted",
+		"useItem":        "minecraft:used",
+		"breakItem":      "minecraft:broken",
+		"pickup":         "minecraft:picked_up",
+		"drop":           "minecraft:dropped",
+		"killEntity":     "minecraft:killed",
+		"entityKilledBy": "minecraft:killed_by",
+	}
+)
+
+// loadPlayerStats 读取统计数据，1.13 之前的 stat.xxx 格式会转换为新的 分类 -> 名称 结构
+func loadPlayerStats(path string) (map[string]map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var modern struct {
+		Stats map[string]map[string]int64 `json:"stats"`
+	}
+	if err := json.Unmarshal(data, &modern); err == nil && modern.Stats != nil {
+		return modern.Stats, nil
+	}
+
+	var legacy map[string]json.RawMessage
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	stats := make(map[string]map[string]int64)
+	add := func(category, name string, value int64) {
+		if stats[category] == nil {
+			stats[category] = make(map[string]int64)
+		}
+		stats[category][name] += value
+	}
+	for key, raw := range legacy {
+		var value int64
+		if json.Unmarshal(raw, &value) != nil || !strings.HasPrefix(key, "stat.") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(key, "stat."), ".", 2)
+		if category, ok := legacyStatCategories[parts[0]]; ok && len(parts) == 2 {
+			add(category, strings.Replace(parts[1], ".", ":", 1), value)
+			continue
+		}
+		add("minecraft:custom", "minecraft:"+strings.ToLower(camelRe.ReplaceAllString(parts[0], "${1}_${2}")), value)
+	}
+	return stats, nil
+}
+
+// countAdvancements 统计已完成的进度，不包括配方解锁
+func countAdvancements(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, err
+	}
+	done := 0
+	for key, raw := range entries {
+		var entry struct {
+			Done bool `json:"done"`
+		}
+		if strings.Contains(key, ":recipes/") || json.Unmarshal(raw, &entry) != nil {
+			continue
+		}
+		if entry.Done {
+			done++
+		}
+	}
+	return done, nil
+}
+
+// playtime 返回游戏时长 (tick)，1.17 起统计项由 play_one_minute 改名为 play_time
+func (p *playerInfo) playtime() int64 {
+	custom := p.Stats["minecraft:custom"]
+	if v, ok := custom["minecraft:play_time"]; ok {
+		return v
+	}
+	return custom["minecraft:play_one_minute"]
+}
+
+// dimension 兼容 1.16 之前以数字表示的维度
+func (p *playerInfo) dimension() string {
+	if p.Data == nil {
+		return "-"
+	}
+	v, ok := p.Data.get("Dimension")
+	if !ok {
+		return "-"
+	}
+	if n, ok := nbtInt(v); ok {
+		switch n {
+		case -1:
+			return "nether"
+		case 1:
+			return "end"
+		}
+		return "overworld"
+	}
+	name := strings.TrimPrefix(fmt.Sprint(v), "minecraft:")
+	return strings.TrimPrefix(name, "the_")
+}
+
+func (p *playerInfo) position() string {
+	if p.Data == nil {
+		return "-"
+	}
+	v, _ := p.Data.get("Pos")
+	list, ok := v.(*nbtList)
+	if !ok || len(list.items) != 3 {
+		return "-"
+	}
+	coords := make([]string, 3)
+	for i, item := range list.items {
+		f, _ := item.(float64)
+		coords[i] = strconv.Itoa(int(math.Floor(f)))
+	}
+	return strings.Join(coords, ", ")
+}
+
+func (p *playerInfo) gameMode() string {
+	if p.Data == nil {
+		return "-"
+	}
+	return namedValue(gameModeNames, p.Data, "playerGameType")
+}
+
+// padRight 按终端显示宽度补齐空格，中文字符占两列
+func padRight(s string, width int) string {
+	w := 0
+	for _, r := range s {
+		if r >= 0x1100 {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	if w >= width {
+		return s + " "
+	}
+	return s + strings.Repeat(" ", width-w)
+}
+
+func formatPlaytime(ticks int64) string {
+	minutes := ticks / TICKS_PER_SECOND / 60
+	if minutes < 60 {
+		return fmt.Sprintf("%d 分钟", minutes)
+	}
+	return fmt.Sprintf("%d 小时 %d 分", minutes/60, minutes%60)
+}
+
+func printPlayerList(server *ServerInstance, world string) error {
+	players, err := loadPlayers(server, world)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%s 的玩家 (共 %d 人):\n", server.Name, len(players))
+	fmt.Println(padRight("玩家", 18) + padRight("最后在线", 18) + padRight("游戏时长", 16) +
+		padRight("维度", 11) + padRight("位置", 22) + "模式")
+	for _, p := range players {
+		fmt.Println(padRight(p.Name, 18) + padRight(p.LastSeen.Format("2006-01-02 15:04"), 18) +
+			padRight(formatPlaytime(p.playtime()), 16) + padRight(p.dimension(), 11) + padRight(p.position(), 22) + p.gameMode())
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("\n服务器运行中，在线玩家的数据以最近一次保存为准")
+	}
+	return nil
+}
+
+// textComponent 从 JSON 文本组件中取出纯文本
+func textComponent(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		var component interface{}
+		if json.Unmarshal([]byte(t), &component) != nil {
+			return t
+		}
+		return jsonText(component)
+	case *nbtCompound:
+		// 1.21.5 起文本组件以 NBT 形式保存
+		text := levelString(t, "text")
+		if extra, ok := t.get("extra"); ok {
+			if list, ok := extra.(*nbtList); ok {
+				for _, item := range list.items {
+					text += textComponent(item)
+				}
+			}
+		}
+		return text
+	}
+	return fmt.Sprint(v)
+}
+
+func jsonText(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []interface{}:
+		var parts []string
+		for _, item := range t {
+			parts = append(parts, jsonText(item))
+		}
+		return strings.Join(parts, "")
+	case map[string]interface{}:
+		text, _ := t["text"].(string)
+		if extra, ok := t["extra"]; ok {
+			text += jsonText(extra)
+		}
+		return text
+	}
+	return ""
+}
+
+func shortID(id string) string {
+	return strings.TrimPrefix(id, "minecraft:")
+}
+
+// itemEnchantments 读取附魔，兼容 tag.Enchantments (1.20.4 及之前) 和 components (1.20.5 起)
+func itemEnchantments(item *nbtCompound) []string {
+	var result []string
+	if components := item.compound("components"); components != nil {
+		for _, key := range []string{"minecraft:enchantments", "minecraft:stored_enchantments"} {
+			enchants := components.compound(key)
+			if enchants == nil {
+				continue
+			}
+			if levels := enchants.compound("levels"); levels != nil {
+				enchants = levels
+			}
+			for _, id := range enchants.keys() {
+				lvl, _ := levelInt(enchants, id)
+				result = append(result, fmt.Sprintf("%s %d", shortID(id), lvl))
+			}
+		}
+		return result
+	}
+	if tag := item.compound("tag"); tag != nil {
+		for _, key := range []string{"Enchantments", "StoredEnchantments", "ench"} {
+			v, _ := tag.get(key)
+			list, ok := v.(*nbtList)
+			if !ok {
+				continue
+			}
+			for _, entry := range list.items {
+				e, ok := entry.(*nbtCompound)
+				if !ok {
+					continue
+				}
+				id, _ := e.get("id")
+				lvl, _ := levelInt(e, "lvl")
+				result = append(result, fmt.Sprintf("%s %d", shortID(fmt.Sprint(id)), lvl))
+			}
+		}
+	}
+	return result
+}
+
+func itemCustomName(item *nbtCompound) string {
+	if components := item.compound("components"); components != nil {
+		if name, ok := components.get("minecraft:custom_name"); ok {
+			return textComponent(name)
+		}
+		return ""
+	}
+	if tag := item.compound("tag"); tag != nil {
+		if display := tag.compound("display"); display != nil {
+			if name, ok := display.get("Name"); ok {
+				return textComponent(name)
+			}
+		}
+	}
+	return ""
+}
+
+// itemNestedCount 统计潜影盒等容器内的物品数
+func itemNestedCount(item *nbtCompound) int {
+	var list *nbtList
+	if components := item.compound("components"); components != nil {
+		v, _ := components.get("minecraft:container")
+		list, _ = v.(*nbtList)
+	} else if tag := item.compound("tag"); tag != nil {
+		if entity := tag.compound("BlockEntityTag"); entity != nil {
+			v, _ := entity.get("Items")
+			list, _ = v.(*nbtList)
+		}
+	}
+	if list == nil {
+		return 0
+	}
+	return len(list.items)
+}
+
+func formatItem(item *nbtCompound) string {
+	id := levelString(item, "id")
+	count, ok := levelInt(item, "count")
+	if !ok {
+		if count, ok = levelInt(item, "Count"); !ok {
+			count = 1
+		}
+	}
+	text := fmt.Sprintf("%s x%d", shortID(id), count)
+	if name := itemCustomName(item); name != "" {
+		text += fmt.Sprintf(" \"%s\"", name)
+	}
+	if enchants := itemEnchantments(item); len(enchants) > 0 {
+		text += " \033[35m[" + strings.Join(enchants, ", ") + "]\033[0m"
+	}
+	if n := itemNestedCount(item); n > 0 {
+		text += fmt.Sprintf(" (内含 %d 组物品)", n)
+	}
+	return text
+}
+
+var equipmentSlots = map[int64]string{100: "脚", 101: "腿", 102: "胸", 103: "头", -106: "副手"}
+
+// printItems 打印物品列表，equipment 为 true 时只打印盔甲和副手栏位，否则只打印其余栏位
+func printItems(title string, v interface{}, equipment bool) {
+	list, ok := v.(*nbtList)
+	if !ok {
+		return
+	}
+	var lines []string
+	for _, entry := range list.items {
+		item, ok := entry.(*nbtCompound)
+		if !ok {
+			continue
+		}
+		slot, _ := levelInt(item, "Slot")
+		if _, isEquipment := equipmentSlots[slot]; isEquipment != equipment {
+			continue
+		}
+		label := fmt.Sprintf("%3d", slot)
+		if equipment {
+			label = equipmentSlots[slot]
+		}
+		lines = append(lines, fmt.Sprintf("  %s  %s", label, formatItem(item)))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Printf("\n%s:\n", title)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+func printPlayer(server *ServerInstance, world, query string) error {
+	players, err := loadPlayers(server, world)
+	if err != nil {
+		return err
+	}
+	p := findPlayer(players, query)
+	if p == nil {
+		return fmt.Errorf("没有找到玩家 %s", query)
+	}
+	fmt.Printf("\n\033[1;36m%s\033[0m (%s)\n", p.Name, p.UUID)
+	fmt.Printf("最后在线:   %s\n", p.LastSeen.Format("2006-01-02 15:04:05"))
+	fmt.Printf("游戏时长:   %s\n", formatPlaytime(p.playtime()))
+	fmt.Printf("位置:       %s %s\n", p.dimension(), p.position())
+	fmt.Printf("已完成进度: %d\n", p.Advancements)
+	if p.Data == nil {
+		return nil
+	}
+	health, ok := p.Data.get("Health")
+	if !ok {
+		health = "-"
+	}
+	food, _ := levelInt(p.Data, "foodLevel")
+	xp, _ := levelInt(p.Data, "XpLevel")
+	fmt.Printf("模式:       %s, 生命值 %s, 饥饿值 %d, 经验等级 %d\n", p.gameMode(), fmt.Sprint(health), food, xp)
+
+	inventory, _ := p.Data.get("Inventory")
+	// 1.21.5 起盔甲和副手移到了 equipment 中
+	if equipment := p.Data.compound("equipment"); equipment != nil {
+		fmt.Println("\n装备:")
+		labels := map[string]string{"head": "头", "chest": "胸", "legs": "腿", "feet": "脚", "offhand": "副手", "body": "身体"}
+		for _, key := range equipment.keys() {
+			if item := equipment.compound(key); item != nil {
+				label := labels[key]
+				if label == "" {
+					label = key
+				}
+				fmt.Printf("  %s  %s\n", label, formatItem(item))
+			}
+		}
+	} else {
+		printItems("装备", inventory, true)
+	}
+	printItems("背包 (0-8 为快捷栏)", inventory, false)
+	enderItems, _ := p.Data.get("EnderItems")
+	printItems("末影箱", enderItems, false)
+	return nil
+}
+
+var statCategories = []string{"custom", "mined", "crafted", "used", "broken", "picked_up", "dropped", "killed", "killed_by"}
+
+// parseStatKey 解析统计项: playtime、deaths 等自定义统计，mined:diamond_ore 这样的 分类:名称，或只写分类表示该分类的合计
+func parseStatKey(arg string) (category, name string) {
+	if arg == "playtime" {
+		return "minecraft:custom", "minecraft:play_time"
+	}
+	withNS := func(s string) string {
+		if strings.Contains(s, ":") {
+			return s
+		}
+		return "minecraft:" + s
+	}
+	for _, c := range statCategories {
+		if arg == c {
+			return "minecraft:" + c, ""
+		}
+		if rest, ok := strings.CutPrefix(arg, c+":"); ok {
+			return "minecraft:" + c, withNS(rest)
+		}
+	}
+	return "minecraft:custom", withNS(arg)
+}
+
+func (p *playerInfo) statValue(category, name string) int64 {
+	if category == "minecraft:custom" && name == "minecraft:play_time" {
+		return p.playtime()
+	}
+	values := p.Stats[category]
+	if name != "" {
+		return values[name]
+	}
+	var total int64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// formatStat 按统计项的单位格式化: 时间类为 tick，距离类为厘米
+func formatStat(name string, value int64) string {
+	switch {
+	case strings.HasSuffix(name, "_one_cm"):
+		if value >= 100000 {
+			return fmt.Sprintf("%.2f km", float64(value)/100000)
+		}
+		return fmt.Sprintf("%.1f m", float64(value)/100)
+	case strings.Contains(name, "time") || strings.HasSuffix(name, "one_minute"):
+		return formatPlaytime(value)
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+func printLeaderboard(server *ServerInstance, world, stat string, top int) error {
+	players, err := loadPlayers(server, world)
+	if err != nil {
+		return err
+	}
+	category, name := parseStatKey(stat)
+	type entry struct {
+		player *playerInfo
+		value  int64
+	}
+	var entries []entry
+	for _, p := range players {
+		if v := p.statValue(category, name); v > 0 {
+			entries = append(entries, entry{p, v})
+		}
+	}
+	label := category + " " + name
+	if name == "" {
+		label = category + " (合计)"
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("没有玩家有统计项 %s", label)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].value > entries[j].value })
+	if len(entries) > top {
+		entries = entries[:top]
+	}
+	fmt.Printf("\n排行榜: %s\n", label)
+	for i, e := range entries {
+		fmt.Printf("%3d. %s%s\n", i+1, padRight(e.player.Name, 18), formatStat(name, e.value))
+	}
+	return nil
+}
+
+func handlePlayersCLI(command string, args []string) {
+	args, world := takeWorldFlag(args)
+	switch command {
+	case "players":
+		if len(args) < 1 {
+			fmt.Println("用法: emcm players <服务器ID> [--world 世界目录]")
+			return
+		}
+		server, ok := requireServer(args[0])
+		if !ok {
+			return
+		}
+		if err := printPlayerList(server, world); err != nil {
+			fmt.Println("读取玩家数据失败:", err)
+		}
+
+	case "player":
+		if len(args) < 2 {
+			fmt.Println("用法: emcm player <服务器ID> <玩家名|UUID> [--world 世界目录]")
+			return
+		}
+		server, ok := requireServer(args[0])
+		if !ok {
+			return
+		}
+		if err := printPlayer(server, world, args[1]); err != nil {
+			fmt.Println("读取玩家数据失败:", err)
+		}
+
+	case "leaderboard":
+		if len(args) < 2 {
+			fmt.Println("用法: emcm leaderboard <服务器ID> <统计项> [--top N] [--world 世界目录]")
+			fmt.Println("统计项: playtime、deaths、mob_kills、walk_one_cm 等自定义统计，")
+			fmt.Println("        或 分类:名称 (如 mined:diamond_ore、killed:zombie)，只写分类 (如 mined) 表示合计")
+			fmt.Println("分类: " + strings.Join(statCategories, ", "))
+			return
+		}
+		server, ok := requireServer(args[0])
+		if !ok {
+			return
+		}
+		top := 10
+		for i := 2; i < len(args); i++ {
+			if args[i] == "--top" && i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil && n > 0 {
+					top = n
+				}
+				i++
+			}
+		}
+		if err := printLeaderboard(server, world, args[1], top); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
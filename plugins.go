@@ -0,0 +1,885 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PLUGINS_DIR = "plugins"
+
+	INDEX_MODRINTH = "modrinth"
+	INDEX_HANGAR   = "hangar"
+)
+
+// PluginIndex 是插件来源，type 表示兼容的 API (modrinth 或 hangar)，可以指向自建的镜像
+type PluginIndex struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+var defaultPluginIndexes = []*PluginIndex{
+	{INDEX_MODRINTH, INDEX_MODRINTH, "https://api.modrinth.com/v2"},
+	{INDEX_HANGAR, INDEX_HANGAR, "https://hangar.papermc.io/api/v1"},
+}
+
+// PluginSource 记录从索引或 URL 安装的插件，供 update 使用
+type PluginSource struct {
+	File        string `json:"file"`
+	Index       string `json:"index,omitempty"`
+	Project     string `json:"project,omitempty"`
+	Version     string `json:"version,omitempty"`
+	URL         string `json:"url,omitempty"`
+	InstalledAt string `json:"installed_at"`
+}
+
+// pluginServerTypes 是能加载 Bukkit 插件的服务端 (包括同时支持模组的混合端)
+var pluginServerTypes = []string{"paper", "purpur", "folia", "pufferfish", "leaves", "leaf", "spigot", "bukkit",
+	"mohist", "arclight", "catserver", "banner", "youer", "magma", "ketting"}
+
+// supportsPlugins 判断实例能否加载插件，无法识别类型时不阻止
+func supportsPlugins(server *ServerInstance) bool {
+	t := strings.ToLower(server.ServerType)
+	if t == "" || t == "unknown" {
+		return true
+	}
+	for _, name := range pluginServerTypes {
+		if strings.Contains(t, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPaperFamily 判断实例是否支持 paper-plugin.yml
+func isPaperFamily(server *ServerInstance) bool {
+	t := strings.ToLower(server.ServerType)
+	return !strings.Contains(t, "spigot") && !strings.Contains(t, "bukkit") && !strings.Contains(t, "catserver")
+}
+
+// pluginLoaders 返回 Modrinth 上与实例兼容的加载器，按优先顺序排列
+func pluginLoaders(server *ServerInstance) []string {
+	t := strings.ToLower(server.ServerType)
+	switch {
+	case strings.Contains(t, "folia"):
+		return []string{"folia"}
+	case strings.Contains(t, "purpur"):
+		return []string{"purpur", "paper", "spigot", "bukkit"}
+	case !isPaperFamily(server):
+		return []string{"spigot", "bukkit"}
+	}
+	return []string{"paper", "spigot", "bukkit"}
+}
+
+func pluginsDir(server *ServerInstance) string {
+	return filepath.Join(serverDir(server), PLUGINS_DIR)
+}
+
+// pluginInfo 是从插件 jar 中读取的描述信息
+type pluginInfo struct {
+	file       string
+	name       string
+	version    string
+	apiVersion string
+	depend     []string
+	softDepend []string
+	provides   []string
+	// paperOnly 表示只有 paper-plugin.yml，Spigot 无法加载
+	paperOnly bool
+	err       error
+}
+
+// readPluginJar 读取 plugin.yml 或 paper-plugin.yml，Paper 系服务端优先读取 paper-plugin.yml
+func readPluginJar(jarPath string, paper bool) pluginInfo {
+	info := pluginInfo{file: filepath.Base(jarPath)}
+	zr, err := zip.OpenReader(jarPath)
+	if err != nil {
+		info.err = fmt.Errorf("不是有效的 jar 文件: %v", err)
+		return info
+	}
+	defer zr.Close()
+
+	descriptors := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		switch f.Name {
+		case "plugin.yml", "paper-plugin.yml", "fabric.mod.json", "quilt.mod.json", "META-INF/mods.toml", "META-INF/neoforge.mods.toml":
+			descriptors[f.Name] = f
+		}
+	}
+	f := descriptors["plugin.yml"]
+	if descriptors["paper-plugin.yml"] != nil && (paper || f == nil) {
+		f = descriptors["paper-plugin.yml"]
+		info.paperOnly = descriptors["plugin.yml"] == nil
+	}
+	if f == nil {
+		if len(descriptors) > 0 {
+			info.err = errors.New("这是模组而不是 Bukkit 插件")
+		} else {
+			info.err = errors.New("缺少 plugin.yml，不是 Bukkit 插件")
+		}
+		return info
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		info.err = err
+		return info
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		info.err = err
+		return info
+	}
+	doc, err := parseYAML(data)
+	if err != nil {
+		info.err = fmt.Errorf("%s 解析失败: %v", f.Name, err)
+		return info
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok || yamlString(m, "name") == "" {
+		info.err = fmt.Errorf("%s 中没有 name", f.Name)
+		return info
+	}
+	info.name = yamlString(m, "name")
+	info.version = yamlString(m, "version")
+	info.apiVersion = yamlString(m, "api-version")
+	info.provides = yamlStrings(m, "provides")
+	if f.Name == "plugin.yml" {
+		info.depend = yamlStrings(m, "depend")
+		info.softDepend = yamlStrings(m, "softdepend")
+	} else {
+		info.depend, info.softDepend = paperDependencies(m["dependencies"])
+	}
+	return info
+}
+
+// paperDependencies 解析 paper-plugin.yml 的依赖，required 默认为 true。
+// 支持 dependencies.server/bootstrap 映射和早期的 - name: 列表两种格式
+func paperDependencies(v interface{}) ([]string, []string) {
+	var depend, softDepend []string
+	add := func(name string, spec interface{}) {
+		required := true
+		if m, ok := spec.(map[string]interface{}); ok && strings.EqualFold(yamlString(m, "required"), "false") {
+			required = false
+		}
+		if required {
+			depend = append(depend, name)
+		} else {
+			softDepend = append(softDepend, name)
+		}
+	}
+	switch deps := v.(type) {
+	case map[string]interface{}:
+		seen := make(map[string]bool)
+		for _, section := range []string{"server", "bootstrap"} {
+			entries, _ := deps[section].(map[string]interface{})
+			names := make([]string, 0, len(entries))
+			for name := range entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if !seen[name] {
+					seen[name] = true
+					add(name, entries[name])
+				}
+			}
+		}
+	case []interface{}:
+		for _, item := range deps {
+			if m, ok := item.(map[string]interface{}); ok && yamlString(m, "name") != "" {
+				add(yamlString(m, "name"), m)
+			}
+		}
+	}
+	return depend, softDepend
+}
+
+// installedPlugins 读取 plugins 目录中的所有 jar，按文件名排序
+func installedPlugins(server *ServerInstance) []pluginInfo {
+	files, _ := filepath.Glob(filepath.Join(pluginsDir(server), "*.jar"))
+	sort.Strings(files)
+	paper := isPaperFamily(server)
+	var plugins []pluginInfo
+	for _, file := range files {
+		plugins = append(plugins, readPluginJar(file, paper))
+	}
+	return plugins
+}
+
+// pluginProblems 检查缺少的前置插件、重复的插件和高于服务器版本的 api-version
+func pluginProblems(server *ServerInstance, plugins []pluginInfo) []string {
+	var problems []string
+	available := make(map[string]bool)
+	files := make(map[string][]string)
+	var names []string
+	for _, p := range plugins {
+		if p.err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", p.file, p.err))
+			continue
+		}
+		if _, ok := files[p.name]; !ok {
+			names = append(names, p.name)
+		}
+		files[p.name] = append(files[p.name], p.file)
+		available[p.name] = true
+		for _, name := range p.provides {
+			available[name] = true
+		}
+	}
+	for _, name := range names {
+		if len(files[name]) > 1 {
+			problems = append(problems, fmt.Sprintf("%s 有多个文件: %s (只会加载其中一个)", name, strings.Join(files[name], ", ")))
+		}
+	}
+
+	_, versionKnown := parseMCVersion(server.MCVersion)
+	checked := make(map[string]bool)
+	for _, p := range plugins {
+		if p.err != nil || checked[p.name] {
+			continue
+		}
+		checked[p.name] = true
+		for _, dep := range p.depend {
+			if !available[dep] {
+				problems = append(problems, fmt.Sprintf("%s 缺少前置插件 %s", p.name, dep))
+			}
+		}
+		if _, ok := parseMCVersion(p.apiVersion); ok && versionKnown && compareMCVersion(p.apiVersion, server.MCVersion) > 0 {
+			problems = append(problems, fmt.Sprintf("%s 的 api-version 为 %s，高于服务器版本 %s", p.name, p.apiVersion, server.MCVersion))
+		}
+		if p.paperOnly && !isPaperFamily(server) {
+			problems = append(problems, fmt.Sprintf("%s 只有 paper-plugin.yml，%s 无法加载", p.name, server.ServerType))
+		}
+	}
+	return problems
+}
+
+func printPlugins(server *ServerInstance) {
+	plugins := installedPlugins(server)
+	if len(plugins) == 0 {
+		fmt.Println("没有安装插件")
+		return
+	}
+	fmt.Printf("%s%s%s%s%s\n", padRight("名称", 24), padRight("版本", 18), padRight("API", 8), padRight("文件", 36), "来源")
+	for _, p := range plugins {
+		if p.err != nil {
+			fmt.Printf("\033[31m%s%s\033[0m\n", padRight("?", 50), p.file)
+			continue
+		}
+		source := "本地"
+		if src := server.Plugins[p.name]; src != nil && src.File == p.file {
+			source = describePluginSource(src)
+		}
+		fmt.Printf("%s%s%s%s%s\n", padRight(p.name, 24), padRight(p.version, 18), padRight(p.apiVersion, 8), padRight(p.file, 36), source)
+		var deps []string
+		if len(p.depend) > 0 {
+			deps = append(deps, "依赖: "+strings.Join(p.depend, ", "))
+		}
+		if len(p.softDepend) > 0 {
+			deps = append(deps, "可选: "+strings.Join(p.softDepend, ", "))
+		}
+		if len(deps) > 0 {
+			fmt.Printf("  \033[90m%s\033[0m\n", strings.Join(deps, "  "))
+		}
+	}
+
+	if problems := pluginProblems(server, plugins); len(problems) > 0 {
+		fmt.Println("\n\033[33m问题:\033[0m")
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+	}
+}
+
+func describePluginSource(src *PluginSource) string {
+	if src.Index != "" {
+		return fmt.Sprintf("%s:%s", src.Index, src.Project)
+	}
+	return src.URL
+}
+
+func pluginIndexes() []*PluginIndex {
+	if len(config.PluginIndexes) == 0 {
+		return defaultPluginIndexes
+	}
+	return config.PluginIndexes
+}
+
+func findPluginIndex(name string) *PluginIndex {
+	for _, index := range pluginIndexes() {
+		if index.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// pluginRelease 是索引中一个可下载的版本
+type pluginRelease struct {
+	version  string
+	url      string
+	filename string
+	hashes   map[string]string
+}
+
+type modrinthVersion struct {
+	ID            string `json:"id"`
+	VersionNumber string `json:"version_number"`
+	DatePublished string `json:"date_published"`
+	Files         []struct {
+		URL      string            `json:"url"`
+		Filename string            `json:"filename"`
+		Primary  bool              `json:"primary"`
+		Hashes   map[string]string `json:"hashes"`
+	} `json:"files"`
+}
+
+// modrinthRelease 查询 Modrinth 兼容 API 中与加载器和 MC 版本匹配的最新版本，version 不为空时查找该版本
+func modrinthRelease(base, project string, loaders []string, mcVersion, version string) (*pluginRelease, error) {
+	query := url.Values{}
+	loaderJSON, _ := json.Marshal(loaders)
+	query.Set("loaders", string(loaderJSON))
+	if _, ok := parseMCVersion(mcVersion); ok {
+		versionJSON, _ := json.Marshal([]string{mcVersion})
+		query.Set("game_versions", string(versionJSON))
+	}
+	var versions []modrinthVersion
+	err := httpGetJSON(fmt.Sprintf("%s/project/%s/version?%s", strings.TrimRight(base, "/"), url.PathEscape(project), query.Encode()), &versions)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("找不到项目 %s", project)
+		}
+		return nil, err
+	}
+	// RFC 3339 时间可以直接按字符串比较
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].DatePublished > versions[j].DatePublished })
+	for _, v := range versions {
+		if version != "" && v.VersionNumber != version && v.ID != version {
+			continue
+		}
+		if len(v.Files) == 0 {
+			continue
+		}
+		file := v.Files[0]
+		for _, f := range v.Files {
+			if f.Primary {
+				file = f
+				break
+			}
+		}
+		return &pluginRelease{v.VersionNumber, file.URL, file.Filename, file.Hashes}, nil
+	}
+	if version != "" {
+		return nil, fmt.Errorf("%s 没有与 %s %s 兼容的版本 %s", project, strings.Join(loaders, "/"), mcVersion, version)
+	}
+	return nil, fmt.Errorf("%s 没有与 %s %s 兼容的版本", project, strings.Join(loaders, "/"), mcVersion)
+}
+
+type hangarDownload struct {
+	FileInfo *struct {
+		Name       string `json:"name"`
+		SHA256Hash string `json:"sha256Hash"`
+	} `json:"fileInfo"`
+	ExternalURL string `json:"externalUrl"`
+	DownloadURL string `json:"downloadUrl"`
+}
+
+type hangarVersion struct {
+	Name    string `json:"name"`
+	Channel struct {
+		Name string `json:"name"`
+	} `json:"channel"`
+	Downloads map[string]hangarDownload `json:"downloads"`
+}
+
+// hangarRelease 查询 Hangar 兼容 API，没有指定版本时优先选择 Release 频道的最新版本
+func hangarRelease(base, project, mcVersion, version string) (*pluginRelease, error) {
+	base = strings.TrimRight(base, "/")
+	var candidates []hangarVersion
+	if version != "" {
+		var v hangarVersion
+		if err := httpGetJSON(fmt.Sprintf("%s/projects/%s/versions/%s", base, url.PathEscape(project), url.PathEscape(version)), &v); err != nil {
+			if isNotFound(err) {
+				return nil, fmt.Errorf("找不到 %s 的版本 %s", project, version)
+			}
+			return nil, err
+		}
+		candidates = append(candidates, v)
+	} else {
+		query := url.Values{"platform": {"PAPER"}, "limit": {"25"}}
+		if _, ok := parseMCVersion(mcVersion); ok {
+			query.Set("platformVersion", mcVersion)
+		}
+		var page struct {
+			Result []hangarVersion `json:"result"`
+		}
+		if err := httpGetJSON(fmt.Sprintf("%s/projects/%s/versions?%s", base, url.PathEscape(project), query.Encode()), &page); err != nil {
+			if isNotFound(err) {
+				return nil, fmt.Errorf("找不到项目 %s", project)
+			}
+			return nil, err
+		}
+		sort.SliceStable(page.Result, func(i, j int) bool {
+			return page.Result[i].Channel.Name == "Release" && page.Result[j].Channel.Name != "Release"
+		})
+		candidates = page.Result
+	}
+
+	for _, v := range candidates {
+		d, ok := v.Downloads["PAPER"]
+		if !ok {
+			continue
+		}
+		release := &pluginRelease{version: v.Name, url: d.DownloadURL, hashes: map[string]string{}}
+		if release.url == "" {
+			release.url = d.ExternalURL
+		}
+		if d.FileInfo != nil {
+			release.filename = d.FileInfo.Name
+			release.hashes["sha256"] = d.FileInfo.SHA256Hash
+		}
+		if release.url == "" {
+			continue
+		}
+		if release.filename == "" {
+			release.filename = urlFilename(release.url)
+		}
+		return release, nil
+	}
+	return nil, fmt.Errorf("%s 没有与 Paper %s 兼容的版本", project, mcVersion)
+}
+
+func (index *PluginIndex) release(server *ServerInstance, project, version string) (*pluginRelease, error) {
+	switch index.Type {
+	case INDEX_MODRINTH:
+		return modrinthRelease(index.URL, project, pluginLoaders(server), server.MCVersion, version)
+	case INDEX_HANGAR:
+		return hangarRelease(index.URL, project, server.MCVersion, version)
+	}
+	return nil, fmt.Errorf("不支持的索引类型: %s", index.Type)
+}
+
+func urlFilename(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name, _ := url.PathUnescape(path.Base(u.Path))
+	return name
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// resolvePlugin 在索引中查找项目，spec 可以是 项目 或 索引:项目，未指定索引时依次查找
+func resolvePlugin(server *ServerInstance, spec, version string) (*pluginRelease, *PluginSource, error) {
+	indexes := pluginIndexes()
+	project := spec
+	if name, rest, ok := strings.Cut(spec, ":"); ok {
+		index := findPluginIndex(name)
+		if index == nil {
+			return nil, nil, fmt.Errorf("找不到插件索引: %s", name)
+		}
+		indexes = []*PluginIndex{index}
+		project = rest
+	}
+	var errs []string
+	for _, index := range indexes {
+		release, err := index.release(server, project, version)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", index.Name, err))
+			continue
+		}
+		return release, &PluginSource{Index: index.Name, Project: project, Version: release.version}, nil
+	}
+	return nil, nil, errors.New(strings.Join(errs, "\n"))
+}
+
+// stageFile 把本地文件、URL 或 resolve 在索引中找到的版本复制或下载到 dir 中的临时文件
+// (不以 .jar 结尾，不会被服务端加载)，返回临时文件、最终文件名和来源，本地文件没有来源
+func stageFile(dir, spec string, resolve func(string) (*pluginRelease, *PluginSource, error)) (string, string, *PluginSource, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", nil, err
+	}
+
+	if info, err := os.Stat(spec); err == nil && !info.IsDir() {
+		filename := filepath.Base(spec)
+		stage := filepath.Join(dir, filename+".download")
+		if err := copyFile(spec, stage); err != nil {
+			os.Remove(stage)
+			return "", "", nil, err
+		}
+		return stage, filename, nil, nil
+	}
+
+	var release *pluginRelease
+	var source *PluginSource
+	if isURL(spec) {
+		release = &pluginRelease{url: spec, filename: urlFilename(spec)}
+		source = &PluginSource{URL: spec}
+	} else {
+		var err error
+		if release, source, err = resolve(spec); err != nil {
+			return "", "", nil, err
+		}
+		fmt.Printf("从 %s 下载 %s %s\n", source.Index, source.Project, release.version)
+	}
+	stage, filename, err := stageRelease(dir, release)
+	return stage, filename, source, err
+}
+
+func stageRelease(dir string, release *pluginRelease) (string, string, error) {
+	filename := filepath.Base(release.filename)
+	if !strings.HasSuffix(strings.ToLower(filename), ".jar") {
+		return "", "", fmt.Errorf("无法确定文件名: %s", release.url)
+	}
+	stage := filepath.Join(dir, filename+".download")
+	if err := downloadVerified(release.url, stage, release.hashes); err != nil {
+		return "", "", err
+	}
+	return stage, filename, nil
+}
+
+func stagePlugin(server *ServerInstance, spec, version string) (string, string, *PluginSource, error) {
+	return stageFile(pluginsDir(server), spec, func(project string) (*pluginRelease, *PluginSource, error) {
+		return resolvePlugin(server, project, version)
+	})
+}
+
+// installStaged 校验临时文件后替换同名插件的旧文件，并记录来源
+func installStaged(server *ServerInstance, stage, filename string, source *PluginSource) (*pluginInfo, error) {
+	defer os.Remove(stage)
+	info := readPluginJar(stage, isPaperFamily(server))
+	if info.err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, info.err)
+	}
+	info.file = filename
+
+	target := filepath.Join(pluginsDir(server), filename)
+	var replaced []string
+	for _, p := range installedPlugins(server) {
+		switch {
+		case p.err == nil && p.name == info.name:
+			if p.file != filename {
+				replaced = append(replaced, p.file)
+			}
+		case p.file == filename:
+			return nil, fmt.Errorf("%s 已被其他插件 %s 使用", filename, p.name)
+		}
+	}
+	if err := os.Rename(stage, target); err != nil {
+		return nil, err
+	}
+	for _, file := range replaced {
+		if err := os.Remove(filepath.Join(pluginsDir(server), file)); err != nil {
+			fmt.Printf("\033[33m删除旧版本 %s 失败: %v\033[0m\n", file, err)
+		} else {
+			fmt.Printf("已删除旧版本 %s\n", file)
+		}
+	}
+
+	if source != nil {
+		if server.Plugins == nil {
+			server.Plugins = make(map[string]*PluginSource)
+		}
+		source.File = filename
+		source.InstalledAt = time.Now().Format(time.RFC3339)
+		server.Plugins[info.name] = source
+	} else {
+		delete(server.Plugins, info.name)
+	}
+	saveConfig()
+	return &info, nil
+}
+
+// reportPlugin 安装后报告该插件缺少的前置插件和兼容性问题
+func reportPlugin(server *ServerInstance, info *pluginInfo) {
+	prefix := info.name + " "
+	for _, problem := range pluginProblems(server, installedPlugins(server)) {
+		if strings.HasPrefix(problem, prefix) {
+			fmt.Printf("\033[33m警告: %s\033[0m\n", problem)
+		}
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("服务器正在运行，重启后生效")
+	}
+}
+
+func addPlugin(server *ServerInstance, spec, version string) error {
+	stage, filename, source, err := stagePlugin(server, spec, version)
+	if err != nil {
+		return err
+	}
+	info, err := installStaged(server, stage, filename, source)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已安装 %s %s (%s)\n", info.name, info.version, info.file)
+	reportPlugin(server, info)
+	return nil
+}
+
+// removePlugin 按插件名或文件名删除，有其他插件依赖它时需要 force
+func removePlugin(server *ServerInstance, target string, force bool) error {
+	plugins := installedPlugins(server)
+	var matched []pluginInfo
+	for _, p := range plugins {
+		if p.file == target || (p.err == nil && strings.EqualFold(p.name, target)) {
+			matched = append(matched, p)
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("没有找到插件: %s", target)
+	}
+
+	if !force {
+		var dependents []string
+		for _, p := range plugins {
+			for _, m := range matched {
+				if m.err == nil && p.name != m.name && containsString(p.depend, m.name) && !containsString(dependents, p.name) {
+					dependents = append(dependents, p.name)
+				}
+			}
+		}
+		if len(dependents) > 0 {
+			return fmt.Errorf("%s 依赖 %s，使用 --force 仍然删除", strings.Join(dependents, ", "), target)
+		}
+	}
+
+	for _, m := range matched {
+		if err := os.Remove(filepath.Join(pluginsDir(server), m.file)); err != nil {
+			return err
+		}
+		fmt.Printf("已删除 %s\n", m.file)
+		if m.err == nil {
+			delete(server.Plugins, m.name)
+			if info, err := os.Stat(filepath.Join(pluginsDir(server), m.name)); err == nil && info.IsDir() {
+				fmt.Printf("配置目录 %s 已保留\n", filepath.Join(pluginsDir(server), m.name))
+			}
+		}
+	}
+	saveConfig()
+	if isServerRunning(server.ID) {
+		fmt.Println("服务器正在运行，重启后生效")
+	}
+	return nil
+}
+
+// updatePlugins 更新从索引或 URL 安装的插件，names 为空时更新全部
+func updatePlugins(server *ServerInstance, names []string) {
+	installed := make(map[string]string)
+	for _, p := range installedPlugins(server) {
+		if p.err == nil {
+			installed[p.name] = p.file
+		}
+	}
+	if len(names) == 0 {
+		for name := range server.Plugins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			fmt.Println("没有从索引或 URL 安装的插件")
+			return
+		}
+	}
+
+	for _, name := range names {
+		src := server.Plugins[name]
+		if src == nil {
+			if _, ok := installed[name]; ok {
+				fmt.Printf("%s: 从本地文件安装，无法自动更新\n", name)
+			} else {
+				fmt.Printf("%s: 没有安装\n", name)
+			}
+			continue
+		}
+		if installed[name] != src.File {
+			fmt.Printf("%s: %s 已不存在，跳过\n", name, src.File)
+			continue
+		}
+
+		release := &pluginRelease{url: src.URL, filename: urlFilename(src.URL)}
+		source := &PluginSource{URL: src.URL}
+		if src.Index != "" {
+			index := findPluginIndex(src.Index)
+			if index == nil {
+				fmt.Printf("%s: 找不到插件索引 %s\n", name, src.Index)
+				continue
+			}
+			var err error
+			if release, err = index.release(server, src.Project, ""); err != nil {
+				fmt.Printf("%s: %v\n", name, err)
+				continue
+			}
+			if release.version == src.Version {
+				fmt.Printf("%s: 已是最新 (%s)\n", name, src.Version)
+				continue
+			}
+			source = &PluginSource{Index: src.Index, Project: src.Project, Version: release.version}
+		}
+		stage, filename, err := stageRelease(pluginsDir(server), release)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			continue
+		}
+		if src.URL != "" && sameFileContent(stage, filepath.Join(pluginsDir(server), src.File)) {
+			os.Remove(stage)
+			fmt.Printf("%s: 已是最新\n", name)
+			continue
+		}
+		info, err := installStaged(server, stage, filename, source)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("%s: 已更新到 %s (%s)\n", name, info.version, info.file)
+		reportPlugin(server, info)
+	}
+}
+
+func sameFileContent(a, b string) bool {
+	da, errA := os.ReadFile(a)
+	db, errB := os.ReadFile(b)
+	return errA == nil && errB == nil && string(da) == string(db)
+}
+
+func handlePluginIndexCLI(args []string) {
+	if len(args) == 0 || args[0] == "ls" {
+		for _, index := range pluginIndexes() {
+			fmt.Printf("%s%s%s\n", padRight(index.Name, 16), padRight(index.Type, 12), index.URL)
+		}
+		return
+	}
+	switch args[0] {
+	case "add":
+		if len(args) < 4 || (args[2] != INDEX_MODRINTH && args[2] != INDEX_HANGAR) {
+			fmt.Println("用法: emcm plugin index add <名称> <modrinth|hangar> <API 地址>")
+			return
+		}
+		if strings.Contains(args[1], ":") || findPluginIndex(args[1]) != nil {
+			fmt.Printf("索引名称无效或已存在: %s\n", args[1])
+			return
+		}
+		if len(config.PluginIndexes) == 0 {
+			config.PluginIndexes = append(config.PluginIndexes, defaultPluginIndexes...)
+		}
+		config.PluginIndexes = append(config.PluginIndexes, &PluginIndex{args[1], args[2], args[3]})
+		saveConfig()
+		fmt.Printf("已添加插件索引 %s\n", args[1])
+	case "rm":
+		if len(args) < 2 {
+			fmt.Println("用法: emcm plugin index rm <名称>")
+			return
+		}
+		var kept []*PluginIndex
+		for _, index := range pluginIndexes() {
+			if index.Name != args[1] {
+				kept = append(kept, index)
+			}
+		}
+		if len(kept) == len(pluginIndexes()) {
+			fmt.Printf("找不到插件索引: %s\n", args[1])
+			return
+		}
+		config.PluginIndexes = kept
+		saveConfig()
+		fmt.Printf("已删除插件索引 %s\n", args[1])
+	default:
+		printPluginUsage()
+	}
+}
+
+func printPluginUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm plugin <服务器ID> ls                               列出插件并检查依赖和版本")
+	fmt.Println("  emcm plugin <服务器ID> add <文件|URL|[索引:]项目> [--version 版本]  安装插件")
+	fmt.Println("  emcm plugin <服务器ID> rm <插件名|文件名> [--force]      删除插件")
+	fmt.Println("  emcm plugin <服务器ID> update [插件名...]               更新从索引或 URL 安装的插件")
+	fmt.Println("  emcm plugin index [add <名称> <modrinth|hangar> <地址> | rm <名称>]  管理插件索引")
+}
+
+func handlePluginCLI(args []string) {
+	if len(args) > 0 && args[0] == "index" {
+		handlePluginIndexCLI(args[1:])
+		return
+	}
+	if len(args) < 1 {
+		printPluginUsage()
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	if !supportsPlugins(server) {
+		fmt.Printf("实例类型 %s 不支持 Bukkit 插件\n", server.ServerType)
+		return
+	}
+	action := "ls"
+	if len(args) > 1 {
+		action = args[1]
+	}
+
+	switch action {
+	case "ls":
+		printPlugins(server)
+	case "add":
+		var version string
+		var specs []string
+		for i := 2; i < len(args); i++ {
+			if args[i] == "--version" && i+1 < len(args) {
+				version = args[i+1]
+				i++
+			} else {
+				specs = append(specs, args[i])
+			}
+		}
+		if len(specs) == 0 {
+			printPluginUsage()
+			return
+		}
+		for _, spec := range specs {
+			if err := addPlugin(server, spec, version); err != nil {
+				fmt.Println("安装插件失败:", err)
+			}
+		}
+	case "rm":
+		force := false
+		var targets []string
+		for _, arg := range args[2:] {
+			if arg == "--force" {
+				force = true
+			} else {
+				targets = append(targets, arg)
+			}
+		}
+		if len(targets) == 0 {
+			printPluginUsage()
+			return
+		}
+		for _, target := range targets {
+			if err := removePlugin(server, target, force); err != nil {
+				fmt.Println("删除插件失败:", err)
+			}
+		}
+	case "update":
+		updatePlugins(server, args[2:])
+	default:
+		printPluginUsage()
+	}
+}
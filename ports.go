@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	PORT_SERVER = "server-port"
+	PORT_QUERY  = "query.port"
+	PORT_RCON   = "rcon.port"
+
+	DEFAULT_SERVER_PORT = 25565
+	DEFAULT_RCON_PORT   = 25575
+	// PORT_SEARCH_LIMIT 是自动分配时最多尝试的端口数
+	PORT_SEARCH_LIMIT = 1000
+)
+
+var portKeys = []string{PORT_SERVER, PORT_QUERY, PORT_RCON}
+
+// portUsage 是实例使用的一个端口，query 使用 UDP，其余使用 TCP
+type portUsage struct {
+	key     string
+	port    int
+	proto   string
+	enabled bool
+}
+
+// instancePorts 返回实例的端口: 优先读取 server.properties，文件中没有时使用记录的分配，再没有时使用默认值
+func instancePorts(server *ServerInstance) []portUsage {
+	props, _ := readServerProperties(server)
+	lookup := func(key string, fallback int) int {
+		if n, err := strconv.Atoi(strings.TrimSpace(props[key])); err == nil && n > 0 && n <= 65535 {
+			return n
+		}
+		if n, ok := server.Ports[key]; ok {
+			return n
+		}
+		return fallback
+	}
+	serverPort := lookup(PORT_SERVER, DEFAULT_SERVER_PORT)
+	return []portUsage{
+		{PORT_SERVER, serverPort, "tcp", true},
+		// query.port 默认与 server-port 相同 (一个 TCP 一个 UDP，互不冲突)
+		{PORT_QUERY, lookup(PORT_QUERY, serverPort), "udp", props["enable-query"] == "true"},
+		{PORT_RCON, lookup(PORT_RCON, DEFAULT_RCON_PORT), "tcp", props["enable-rcon"] == "true"},
+	}
+}
+
+// recordPorts 把 server.properties 中的端口同步到实例记录，返回是否有变化
+func recordPorts(server *ServerInstance) bool {
+	changed := false
+	for _, u := range instancePorts(server) {
+		if server.Ports[u.key] != u.port {
+			if server.Ports == nil {
+				server.Ports = make(map[string]int)
+			}
+			server.Ports[u.key] = u.port
+			changed = true
+		}
+	}
+	return changed
+}
+
+// hostPortBusy 尝试监听端口，失败说明已被本机其他程序占用
+func hostPortBusy(proto string, port int) bool {
+	addr := net.JoinHostPort("", strconv.Itoa(port))
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return true
+	}
+	ln.Close()
+	return false
+}
+
+func portID(proto string, port int) string {
+	return fmt.Sprintf("%s/%d", proto, port)
+}
+
+// reservedPorts 返回其他实例占用的端口，未启用的 query 和 RCON 端口也会保留，以便以后启用
+func reservedPorts(except string) map[string]string {
+	reserved := make(map[string]string)
+	for _, id := range sortedServerIDs() {
+		if id == except {
+			continue
+		}
+		for _, u := range instancePorts(config.ServerInstalls[id]) {
+			reserved[portID(u.proto, u.port)] = id + " " + u.key
+		}
+	}
+	return reserved
+}
+
+// assignPorts 为实例分配不与其他实例和本机程序冲突的端口并写入 server.properties；
+// only 不为空时只重新分配这些键，返回分配结果
+func assignPorts(server *ServerInstance, only ...string) (map[string]int, error) {
+	reserved := reservedPorts(server.ID)
+	current := make(map[string]portUsage)
+	for _, u := range instancePorts(server) {
+		current[u.key] = u
+	}
+
+	free := func(proto string, port int) bool {
+		_, taken := reserved[portID(proto, port)]
+		return !taken && !hostPortBusy(proto, port)
+	}
+	pick := func(proto string, start int) (int, error) {
+		for port := start; port < start+PORT_SEARCH_LIMIT && port <= 65535; port++ {
+			if free(proto, port) {
+				reserved[portID(proto, port)] = server.ID
+				return port, nil
+			}
+		}
+		return 0, fmt.Errorf("从 %d 开始找不到可用的 %s 端口", start, proto)
+	}
+
+	// 不重新分配的端口先保留，避免被其它键选中
+	assigned := make(map[string]int)
+	for _, key := range portKeys {
+		if u := current[key]; len(only) > 0 && !containsString(only, key) {
+			reserved[portID(u.proto, u.port)] = server.ID
+			assigned[key] = u.port
+		}
+	}
+	for _, key := range portKeys {
+		u := current[key]
+		if _, kept := assigned[key]; kept {
+			continue
+		}
+		start := u.port
+		switch key {
+		case PORT_SERVER:
+			start = DEFAULT_SERVER_PORT
+		case PORT_QUERY:
+			start = assigned[PORT_SERVER]
+		case PORT_RCON:
+			start = DEFAULT_RCON_PORT
+		}
+		// 当前端口可用时保持不变
+		if free(u.proto, u.port) {
+			start = u.port
+		}
+		port, err := pick(u.proto, start)
+		if err != nil {
+			return nil, err
+		}
+		assigned[key] = port
+	}
+
+	values := make(map[string]string)
+	for key, port := range assigned {
+		values[key] = strconv.Itoa(port)
+	}
+	if err := setServerProperties(server, values); err != nil {
+		return nil, err
+	}
+	server.Ports = assigned
+	saveConfig()
+	return assigned, nil
+}
+
+// portConflict 是一个端口冲突，fatal 表示启动一定会失败
+type portConflict struct {
+	usage   portUsage
+	message string
+	fatal   bool
+}
+
+// portConflicts 检查实例已启用的端口是否与其他实例的已启用端口或本机程序冲突
+func portConflicts(server *ServerInstance) []portConflict {
+	var conflicts []portConflict
+	running := isServerRunning(server.ID)
+	for _, u := range instancePorts(server) {
+		if !u.enabled {
+			continue
+		}
+		withRunning := false
+		for _, id := range sortedServerIDs() {
+			if id == server.ID {
+				continue
+			}
+			other := config.ServerInstalls[id]
+			for _, o := range instancePorts(other) {
+				if !o.enabled || o.proto != u.proto || o.port != u.port {
+					continue
+				}
+				otherRunning := isServerRunning(id)
+				state := "未运行"
+				if otherRunning {
+					state = "运行中"
+					withRunning = true
+				}
+				conflicts = append(conflicts, portConflict{u, fmt.Sprintf("%s %d 与 %s 的 %s 相同 (%s)", u.key, u.port, id, o.key, state), otherRunning})
+			}
+		}
+		// 自己运行时端口当然被占用；与运行中的实例冲突时已经报告过
+		if !running && !withRunning && hostPortBusy(u.proto, u.port) {
+			conflicts = append(conflicts, portConflict{u, fmt.Sprintf("%s %d (%s) 已被本机其他程序占用", u.key, u.port, strings.ToUpper(u.proto)), true})
+		}
+	}
+	return conflicts
+}
+
+func printPortsTable() {
+	if len(config.ServerInstalls) == 0 {
+		fmt.Println("没有服务器实例")
+		return
+	}
+	changed := false
+	fmt.Printf("%s%s%s%s%s\n", padRight("ID", 12), padRight("名称", 20), padRight("server-port", 14), padRight("query.port", 14), padRight("rcon.port", 14)+"状态")
+	for _, id := range sortedServerIDs() {
+		server := config.ServerInstalls[id]
+		if recordPorts(server) {
+			changed = true
+		}
+		conflicted := make(map[string]bool)
+		for _, c := range portConflicts(server) {
+			conflicted[c.usage.key] = true
+		}
+		var cells []string
+		for _, u := range instancePorts(server) {
+			text := strconv.Itoa(u.port)
+			if !u.enabled {
+				text += " (关)"
+			}
+			cell := padRight(text, 14)
+			switch {
+			case conflicted[u.key]:
+				cell = "\033[31m" + cell + "\033[0m"
+			case !u.enabled:
+				cell = "\033[90m" + cell + "\033[0m"
+			}
+			cells = append(cells, cell)
+		}
+		state := "已停止"
+		if isServerRunning(id) {
+			state = "\033[32m运行中\033[0m"
+		}
+		fmt.Printf("%s%s%s%s\n", padRight(id, 12), padRight(server.Name, 20), strings.Join(cells, ""), state)
+	}
+	if changed {
+		saveConfig()
+	}
+
+	var problems []string
+	for _, id := range sortedServerIDs() {
+		for _, c := range portConflicts(config.ServerInstalls[id]) {
+			problems = append(problems, fmt.Sprintf("%s: %s", id, c.message))
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Println("\n\033[33m冲突:\033[0m")
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+		fmt.Println("使用 emcm ports assign <服务器ID> 重新分配端口")
+	}
+}
+
+func handlePortsCLI(args []string) {
+	if len(args) == 0 || args[0] == "ls" {
+		printPortsTable()
+		return
+	}
+	if args[0] != "assign" || len(args) < 2 {
+		fmt.Println("用法:")
+		fmt.Println("  emcm ports                           显示所有实例的端口分配和冲突")
+		fmt.Println("  emcm ports assign <服务器ID> [--all]   重新分配冲突的端口，--all 重新分配全部端口")
+		return
+	}
+	server, ok := requireServer(args[1])
+	if !ok {
+		return
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("服务器正在运行，请先停止")
+		return
+	}
+
+	var only []string
+	if len(args) < 3 || args[2] != "--all" {
+		for _, c := range portConflicts(server) {
+			only = append(only, c.usage.key)
+		}
+		if len(only) == 0 {
+			fmt.Println("没有端口冲突")
+			return
+		}
+	}
+	before := instancePorts(server)
+	assigned, err := assignPorts(server, only...)
+	if err != nil {
+		fmt.Println("分配端口失败:", err)
+		return
+	}
+	for _, u := range before {
+		if assigned[u.key] != u.port {
+			fmt.Printf("%s: %d -> %d\n", u.key, u.port, assigned[u.key])
+		} else {
+			fmt.Printf("%s: %d\n", u.key, u.port)
+		}
+	}
+}
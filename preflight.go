@@ -0,0 +1,473 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 检查结果
+const (
+	CHECK_PASS = "pass"
+	CHECK_WARN = "warn"
+	CHECK_FAIL = "fail"
+)
+
+const (
+	JAVA_VERSION_TIMEOUT = 10 * time.Second
+	DISK_WARN_BYTES      = 2 << 30
+	DISK_FAIL_BYTES      = 256 << 20
+)
+
+// checkResult 是一项检查的结果，hint 是修复建议
+type checkResult struct {
+	name    string
+	status  string
+	message string
+	hint    string
+}
+
+var javaVersionRe = regexp.MustCompile(`version "(\d+)(?:\.(\d+))?`)
+
+// javaMajorVersion 运行 java -version 获取主版本号，1.8 返回 8
+func javaMajorVersion(javaPath string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), JAVA_VERSION_TIMEOUT)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, javaPath, "-version").CombinedOutput()
+	if err != nil {
+		return 0, err
+	}
+	m := javaVersionRe.FindStringSubmatch(string(out))
+	if m == nil {
+		return 0, fmt.Errorf("无法识别的输出: %s", strings.TrimSpace(firstLine(string(out))))
+	}
+	major, _ := strconv.Atoi(m[1])
+	if major == 1 && m[2] != "" {
+		major, _ = strconv.Atoi(m[2])
+	}
+	return major, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// requiredJava 返回 MC 版本需要的最低 Java 版本，版本未知时返回 0
+func requiredJava(mcVersion string) int {
+	if _, ok := parseMCVersion(mcVersion); !ok {
+		return 0
+	}
+	switch {
+	case compareMCVersion(mcVersion, "1.20.5") >= 0:
+		return 21
+	case compareMCVersion(mcVersion, "1.18") >= 0:
+		return 17
+	case compareMCVersion(mcVersion, "1.17") >= 0:
+		return 16
+	}
+	return 8
+}
+
+func serverJavaPath(server *ServerInstance) string {
+	if server.JavaPath != "" {
+		return server.JavaPath
+	}
+	return config.JavaPath
+}
+
+func checkJava(server *ServerInstance) []checkResult {
+	javaPath := serverJavaPath(server)
+	if javaPath == "" {
+		return []checkResult{{"Java", CHECK_FAIL, "没有配置 Java 路径", "运行 emcm java detect 或 emcm java set <路径>"}}
+	}
+	resolved, err := exec.LookPath(javaPath)
+	if err != nil {
+		hint := "在实例管理菜单中为该实例配置 Java，或运行 emcm java add <版本> <路径>"
+		if strings.HasPrefix(javaPath, "java") && len(javaPath) > 4 {
+			// recommendJavaVersion 在没有配置对应版本时返回 java17 这样的占位名称
+			hint = fmt.Sprintf("没有配置 Java %s，运行 emcm java add %s <路径>", javaPath[4:], javaPath[4:])
+		}
+		return []checkResult{{"Java", CHECK_FAIL, "找不到 Java: " + javaPath, hint}}
+	}
+	results := []checkResult{{"Java", CHECK_PASS, resolved, ""}}
+
+	major, err := javaMajorVersion(resolved)
+	if err != nil {
+		return append(results, checkResult{"Java 版本", CHECK_WARN, fmt.Sprintf("无法获取 Java 版本: %v", err), ""})
+	}
+	need := requiredJava(server.MCVersion)
+	switch {
+	case need == 0:
+		results = append(results, checkResult{"Java 版本", CHECK_PASS, fmt.Sprintf("Java %d (MC 版本未知，不检查)", major), ""})
+	case major < need:
+		results = append(results, checkResult{"Java 版本", CHECK_FAIL,
+			fmt.Sprintf("MC %s 需要 Java %d 或更高，当前为 Java %d", server.MCVersion, need, major),
+			fmt.Sprintf("安装 Java %d 后运行 emcm java add %d <路径>，并在实例管理菜单中切换", need, need)})
+	case need == 8 && major > 16:
+		results = append(results, checkResult{"Java 版本", CHECK_WARN,
+			fmt.Sprintf("MC %s 使用 Java %d，旧版本 (尤其是 Forge) 可能不兼容", server.MCVersion, major),
+			"启动失败时改用 Java 8 或 11"})
+	default:
+		results = append(results, checkResult{"Java 版本", CHECK_PASS, fmt.Sprintf("Java %d (需要 %d+)", major, need), ""})
+	}
+	return results
+}
+
+// checkJarFile 检查服务端核心存在且是有效的 jar
+func checkJarFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s 是目录", path)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("不是有效的 jar 文件 (可能下载不完整): %v", err)
+	}
+	zr.Close()
+	return nil
+}
+
+func checkServerJar(server *ServerInstance) checkResult {
+	if err := checkJarFile(server.Path); err != nil {
+		return checkResult{"服务端核心", CHECK_FAIL, err.Error(), "重新下载服务端，或修改实例的服务端路径"}
+	}
+	return checkResult{"服务端核心", CHECK_PASS, server.Path, ""}
+}
+
+func checkEULA(server *ServerInstance) checkResult {
+	switch {
+	case eulaAccepted(server):
+		return checkResult{"EULA", CHECK_PASS, "已同意", ""}
+	case server.EULAAcceptedAt != "":
+		return checkResult{"EULA", CHECK_PASS, "已同意 (启动时重新写入 eula.txt)", ""}
+	}
+	return checkResult{"EULA", CHECK_FAIL, "尚未同意 Minecraft EULA", fmt.Sprintf("阅读 %s 后运行 emcm eula %s accept", EULA_URL, server.ID)}
+}
+
+func checkPorts(server *ServerInstance) []checkResult {
+	if recordPorts(server) {
+		saveConfig()
+	}
+	var results []checkResult
+	for _, c := range portConflicts(server) {
+		status := CHECK_WARN
+		if c.fatal {
+			status = CHECK_FAIL
+		}
+		results = append(results, checkResult{"端口", status, c.message, fmt.Sprintf("运行 emcm ports assign %s 重新分配端口", server.ID)})
+	}
+	if len(results) == 0 {
+		var ports []string
+		for _, u := range instancePorts(server) {
+			if u.enabled {
+				ports = append(ports, fmt.Sprintf("%s %d", u.key, u.port))
+			}
+		}
+		results = append(results, checkResult{"端口", CHECK_PASS, strings.Join(ports, ", "), ""})
+	}
+	return results
+}
+
+func checkDisk(server *ServerInstance) checkResult {
+	free, ok := diskFree(serverDir(server))
+	switch {
+	case !ok:
+		return checkResult{"磁盘空间", CHECK_WARN, "无法检测", ""}
+	case free < DISK_FAIL_BYTES:
+		return checkResult{"磁盘空间", CHECK_FAIL, "剩余 " + formatBytes(int64(free)), fmt.Sprintf("清理磁盘，或运行 emcm backup prune %s 删除旧备份", server.ID)}
+	case free < DISK_WARN_BYTES:
+		return checkResult{"磁盘空间", CHECK_WARN, "剩余 " + formatBytes(int64(free)), "世界和日志增长后可能写满磁盘"}
+	}
+	return checkResult{"磁盘空间", CHECK_PASS, "剩余 " + formatBytes(int64(free)), ""}
+}
+
+// checkMemory 比较可用内存和实例的堆大小，不足一半时 JVM 很可能无法启动或被系统终止
+func checkMemory(server *ServerInstance) checkResult {
+	if server.Memory <= 0 {
+		return checkResult{"内存", CHECK_FAIL, "实例没有设置内存", "在实例管理菜单中设置内存"}
+	}
+	need := uint64(server.Memory) << 20
+	available, ok := availableMemory()
+	msg := fmt.Sprintf("可用 %s，实例需要 %dMB", formatBytes(int64(available)), server.Memory)
+	switch {
+	case !ok:
+		return checkResult{"内存", CHECK_PASS, fmt.Sprintf("实例需要 %dMB (无法检测可用内存)", server.Memory), ""}
+	case available < need/2:
+		return checkResult{"内存", CHECK_FAIL, msg, "关闭其它程序，或在实例管理菜单中调低内存"}
+	case available < need:
+		return checkResult{"内存", CHECK_WARN, msg, "内存紧张时服务器可能被系统终止"}
+	}
+	return checkResult{"内存", CHECK_PASS, msg, ""}
+}
+
+// preflightChecks 是启动前的检查
+func preflightChecks(server *ServerInstance) []checkResult {
+	var results []checkResult
+	results = append(results, checkJava(server)...)
+	results = append(results, checkServerJar(server), checkEULA(server))
+	results = append(results, checkPorts(server)...)
+	results = append(results, checkDisk(server), checkMemory(server))
+	results = append(results, checkMods(server)...)
+	results = append(results, checkResourcePack(server)...)
+	return results
+}
+
+// printChecks 打印检查结果，onlyProblems 时只打印警告和失败，返回失败数和警告数
+func printChecks(results []checkResult, onlyProblems bool) (int, int) {
+	fails, warns := 0, 0
+	for _, r := range results {
+		var mark string
+		switch r.status {
+		case CHECK_FAIL:
+			fails++
+			mark = "\033[31m✘\033[0m"
+		case CHECK_WARN:
+			warns++
+			mark = "\033[33m⚠\033[0m"
+		default:
+			if onlyProblems {
+				continue
+			}
+			mark = "\033[32m✔\033[0m"
+		}
+		fmt.Printf("%s %s%s\n", mark, padRight(r.name, 12), r.message)
+		if r.hint != "" && r.status != CHECK_PASS {
+			fmt.Printf("  %s \033[90m%s\033[0m\n", padRight("", 12), r.hint)
+		}
+	}
+	return fails, warns
+}
+
+// runPreflight 在启动前执行检查，有失败项时返回 false
+func runPreflight(server *ServerInstance) bool {
+	fails, _ := printChecks(preflightChecks(server), true)
+	if fails > 0 {
+		fmt.Printf("\033[31m启动前检查失败，服务器 [%s] 未启动\033[0m\n", server.Name)
+		return false
+	}
+	return true
+}
+
+// checkConfig 检查配置文件的一致性
+func checkConfig() []checkResult {
+	var results []checkResult
+	add := func(status, message, hint string) {
+		results = append(results, checkResult{"配置", status, message, hint})
+	}
+
+	configPath := filepath.Join(CACHE_DIR, CONFIG_FILE)
+	if info, err := os.Stat(configPath); err == nil && info.Mode().Perm()&0077 != 0 {
+		add(CHECK_WARN, fmt.Sprintf("%s 的权限为 %o，其他用户可以读取 (可能包含访问密钥)", configPath, info.Mode().Perm()), "chmod 600 "+configPath)
+	}
+
+	dirs := make(map[string]string)
+	for _, id := range sortedServerIDs() {
+		server := config.ServerInstalls[id]
+		switch {
+		case server == nil:
+			add(CHECK_FAIL, fmt.Sprintf("实例 %s 的配置为空", id), "删除该实例后重新创建")
+			continue
+		case server.ID != id:
+			add(CHECK_FAIL, fmt.Sprintf("实例 %s 的 id 字段为 %q", id, server.ID), "修改配置文件使两者一致")
+		case server.Path == "":
+			add(CHECK_FAIL, fmt.Sprintf("实例 %s 没有服务端路径", id), "")
+		}
+		if other, ok := dirs[serverDir(server)]; ok {
+			add(CHECK_WARN, fmt.Sprintf("实例 %s 与 %s 使用同一个目录 %s，世界和配置文件会互相覆盖", id, other, serverDir(server)), "用 emcm create --dir 为实例创建独立目录")
+		} else {
+			dirs[serverDir(server)] = id
+		}
+		for _, t := range getBackupConfig(server).Targets {
+			if _, ok := config.BackupTargets[t]; !ok {
+				add(CHECK_WARN, fmt.Sprintf("实例 %s 启用的备份目标 %s 不存在", id, t), fmt.Sprintf("emcm backup target disable %s %s", id, t))
+			}
+		}
+	}
+	for version, path := range config.JavaVersions {
+		if _, err := exec.LookPath(path); err != nil {
+			add(CHECK_WARN, fmt.Sprintf("Java %s 的路径不存在: %s", version, path), "emcm java add "+version+" <路径>")
+		}
+	}
+	for _, name := range sortedGroupNames() {
+		for _, id := range config.PlayerGroups[name].Members {
+			if _, ok := config.ServerInstalls[id]; !ok {
+				add(CHECK_WARN, fmt.Sprintf("名单组 %s 的成员 %s 不存在", name, id), fmt.Sprintf("emcm group leave %s %s", name, id))
+			}
+		}
+	}
+	if len(results) == 0 {
+		add(CHECK_PASS, fmt.Sprintf("%d 个实例", len(config.ServerInstalls)), "")
+	}
+	return results
+}
+
+// checkCache 检查下载缓存、临时文件和已删除实例留下的数据
+func checkCache() []checkResult {
+	var results []checkResult
+	add := func(status, message, hint string) {
+		results = append(results, checkResult{"缓存", status, message, hint})
+	}
+
+	cachePath := filepath.Join(CACHE_DIR, "cache", "servers.json")
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var list []ServerInfo
+		if err := json.Unmarshal(data, &list); err != nil {
+			add(CHECK_WARN, "服务端列表缓存损坏: "+err.Error(), "删除 "+cachePath+"，下次会重新获取")
+		}
+	}
+
+	cores, _ := filepath.Glob(filepath.Join(CACHE_DIR, "servers", "*", "*.jar"))
+	for _, core := range cores {
+		if err := checkJarFile(core); err != nil {
+			add(CHECK_FAIL, fmt.Sprintf("下载的服务端 %s 已损坏", core), "删除该文件后重新下载")
+		}
+	}
+
+	var leftovers []string
+	filepath.WalkDir(CACHE_DIR, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), ".tmp") {
+			leftovers = append(leftovers, path)
+		}
+		return nil
+	})
+	if len(leftovers) > 0 {
+		add(CHECK_WARN, fmt.Sprintf("%d 个未完成写入的临时文件 (例如 %s)", len(leftovers), leftovers[0]), "确认没有 emcm 在运行后可以删除")
+	}
+
+	// 按实例 ID 存放的数据目录
+	for _, dir := range []string{BACKUPS_DIR, LOGS_DIR, MAPS_DIR} {
+		entries, _ := os.ReadDir(filepath.Join(CACHE_DIR, dir))
+		for _, entry := range entries {
+			if _, ok := config.ServerInstalls[entry.Name()]; ok || !entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(CACHE_DIR, dir, entry.Name())
+			add(CHECK_WARN, fmt.Sprintf("已删除的实例 %s 留下了 %s (%s)", entry.Name(), path, formatBytes(dirSize(path))), "不再需要时可以删除")
+		}
+	}
+	if len(results) == 0 {
+		add(CHECK_PASS, fmt.Sprintf("%d 个已下载的服务端", len(cores)), "")
+	}
+	return results
+}
+
+func checkDicts() []checkResult {
+	var results []checkResult
+	rules := 0
+	for _, layer := range allDictLayers() {
+		rules += len(layer.Rules)
+		if problems := dictLayerProblems(layer); len(problems) > 0 {
+			results = append(results, checkResult{"字典", CHECK_WARN, fmt.Sprintf("%s: %s", layer.Name, problems[0]), "运行 emcm dict check 查看全部问题"})
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, checkResult{"字典", CHECK_PASS, fmt.Sprintf("%d 条规则", rules), ""})
+	}
+	return results
+}
+
+// checkRuntime 检查运行记录: 对应的实例是否存在、服务端进程和控制端口是否还在，fix 为 true 时删除失效的记录
+func checkRuntime(fix bool) []checkResult {
+	var results []checkResult
+	files, _ := filepath.Glob(filepath.Join(CACHE_DIR, RUN_DIR, "*.json"))
+	running := 0
+	// stale 报告一条失效的记录，fix 时删除
+	stale := func(file, detail string) {
+		if !fix {
+			results = append(results, checkResult{"运行记录", CHECK_WARN, detail, "运行 emcm doctor --fix 删除该记录"})
+			return
+		}
+		if err := os.Remove(file); err != nil {
+			results = append(results, checkResult{"运行记录", CHECK_FAIL, fmt.Sprintf("%s，删除失败: %v", detail, err), ""})
+			return
+		}
+		results = append(results, checkResult{"运行记录", CHECK_WARN, detail + "，已删除", ""})
+	}
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		info, err := readRunInfo(id)
+		switch {
+		case err != nil:
+			stale(file, fmt.Sprintf("%s 损坏", file))
+		case config.ServerInstalls[id] == nil:
+			results = append(results, checkResult{"运行记录", CHECK_WARN, fmt.Sprintf("实例 %s 已不存在，但记录显示它由 emcm 进程 %d 运行", id, info.EMCMPID), "停止该进程或删除 " + file})
+		case localConsole(id) == nil && !runInfoAlive(info):
+			stale(file, fmt.Sprintf("%s 的服务端进程已退出或控制端口不可达 (emcm 进程可能已异常退出)", id))
+		default:
+			running++
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, checkResult{"运行记录", CHECK_PASS, fmt.Sprintf("%d 个运行中的实例", running), ""})
+	}
+	return results
+}
+
+func handleDoctorCLI(args []string) {
+	fix := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "--fix" {
+			fix = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	keepStaleRunInfo = !fix
+
+	if len(rest) > 0 {
+		server, ok := requireServer(rest[0])
+		if !ok {
+			return
+		}
+		// 运行中的实例占用着端口和内存，启动前检查会把它自己报告为问题
+		if isServerRunning(server.ID) {
+			fmt.Println("\033[32m✔\033[0m 运行中，跳过启动前检查")
+			printDoctorSummary(0, 0)
+			return
+		}
+		fails, warns := printChecks(preflightChecks(server), false)
+		printDoctorSummary(fails, warns)
+		return
+	}
+
+	fmt.Println("\033[1mEMCM\033[0m")
+	fails, warns := printChecks(append(append(append(checkConfig(), checkCache()...), checkDicts()...), checkRuntime(fix)...), false)
+	for _, id := range sortedServerIDs() {
+		server := config.ServerInstalls[id]
+		fmt.Printf("\n\033[1m%s (%s)\033[0m\n", id, server.Name)
+		if isServerRunning(id) {
+			fmt.Println("\033[32m✔\033[0m 运行中，跳过启动前检查")
+			continue
+		}
+		f, w := printChecks(preflightChecks(server), false)
+		fails += f
+		warns += w
+	}
+	printDoctorSummary(fails, warns)
+}
+
+func printDoctorSummary(fails, warns int) {
+	fmt.Println()
+	switch {
+	case fails > 0:
+		fmt.Printf("\033[31m%d 项失败\033[0m，%d 项警告\n", fails, warns)
+		os.Exit(1)
+	case warns > 0:
+		fmt.Printf("\033[33m%d 项警告\033[0m\n", warns)
+	default:
+		fmt.Println("\033[32m所有检查通过\033[0m")
+	}
+}
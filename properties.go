@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const SERVER_PROPERTIES = "server.properties"
+
+func serverPropertiesPath(server *ServerInstance) string {
+	return filepath.Join(serverDir(server), SERVER_PROPERTIES)
+}
+
+// propertyLine 是一个逻辑行，raw 保留原始内容 (可能跨越多个物理行)，注释和空行的 key 为空
+type propertyLine struct {
+	raw   string
+	key   string
+	value string
+}
+
+// propertiesFile 按 java.util.Properties 的规则解析，未修改的行原样写回
+type propertiesFile struct {
+	lines []propertyLine
+}
+
+func parseProperties(data string) *propertiesFile {
+	p := &propertiesFile{}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	physical := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	if data == "" {
+		physical = nil
+	}
+	for i := 0; i < len(physical); i++ {
+		raw := physical[i]
+		trimmed := strings.TrimLeft(raw, " \t\f")
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			p.lines = append(p.lines, propertyLine{raw: raw})
+			continue
+		}
+		// 以奇数个反斜杠结尾的行与下一行相连，下一行的前导空白被忽略
+		logical := trimmed
+		for continued(logical) && i+1 < len(physical) {
+			i++
+			raw += "\n" + physical[i]
+			logical = logical[:len(logical)-1] + strings.TrimLeft(physical[i], " \t\f")
+		}
+		if continued(logical) {
+			logical = logical[:len(logical)-1]
+		}
+		key, value := splitProperty(logical)
+		p.lines = append(p.lines, propertyLine{raw: raw, key: key, value: value})
+	}
+	return p
+}
+
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty 在第一个未转义的 =、: 或空白处分开键和值
+func splitProperty(line string) (string, string) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+	key, rest := line[:end], line[end:]
+	rest = strings.TrimLeft(rest, " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return unescapeProperty(key), unescapeProperty(rest)
+}
+
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var units []uint16
+	var b strings.Builder
+	flush := func() {
+		if len(units) > 0 {
+			b.WriteString(string(utf16.Decode(units)))
+			units = nil
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			flush()
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			flush()
+			b.WriteByte('\t')
+		case 'n':
+			flush()
+			b.WriteByte('\n')
+		case 'r':
+			flush()
+			b.WriteByte('\r')
+		case 'f':
+			flush()
+			b.WriteByte('\f')
+		case 'u':
+			// \uXXXX 是 UTF-16 代码单元，代理对需要合并解码
+			if i+5 <= len(s) {
+				if n, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					units = append(units, uint16(n))
+					i += 4
+					continue
+				}
+			}
+			flush()
+			b.WriteByte('u')
+		default:
+			flush()
+			b.WriteByte(s[i])
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// escapeProperty 按 Properties.store 的规则转义，非 ASCII 字符写为 \uXXXX，兼容所有版本的服务端
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == ' ' && (isKey || i == 0):
+			b.WriteString(`\ `)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (p *propertiesFile) get(key string) (string, bool) {
+	for i := len(p.lines) - 1; i >= 0; i-- {
+		if p.lines[i].key == key {
+			return p.lines[i].value, true
+		}
+	}
+	return "", false
+}
+
+// set 修改已有的项 (重复的键只保留最后一个生效的位置)，不存在时追加到末尾
+func (p *propertiesFile) set(key, value string) {
+	line := propertyLine{raw: escapeProperty(key, true) + "=" + escapeProperty(value, false), key: key, value: value}
+	for i := len(p.lines) - 1; i >= 0; i-- {
+		if p.lines[i].key == key {
+			if p.lines[i].value != value {
+				p.lines[i] = line
+			}
+			return
+		}
+	}
+	p.lines = append(p.lines, line)
+}
+
+func (p *propertiesFile) values() map[string]string {
+	values := make(map[string]string)
+	for _, line := range p.lines {
+		if line.key != "" {
+			values[line.key] = line.value
+		}
+	}
+	return values
+}
+
+// keys 按文件中的顺序返回键
+func (p *propertiesFile) keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, line := range p.lines {
+		if line.key != "" && !seen[line.key] {
+			seen[line.key] = true
+			keys = append(keys, line.key)
+		}
+	}
+	return keys
+}
+
+func (p *propertiesFile) String() string {
+	var b strings.Builder
+	for _, line := range p.lines {
+		b.WriteString(line.raw)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// loadProperties 读取实例的 server.properties，文件不存在时返回空文件
+func loadProperties(server *ServerInstance) (*propertiesFile, error) {
+	data, err := os.ReadFile(serverPropertiesPath(server))
+	if os.IsNotExist(err) {
+		return &propertiesFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseProperties(string(data)), nil
+}
+
+func saveProperties(server *ServerInstance, p *propertiesFile) error {
+	path := serverPropertiesPath(server)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(p.String()), 0644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", SERVER_PROPERTIES, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// readServerProperties 读取 server.properties 为键值表
+func readServerProperties(server *ServerInstance) (map[string]string, error) {
+	data, err := os.ReadFile(serverPropertiesPath(server))
+	if err != nil {
+		return nil, err
+	}
+	return parseProperties(string(data)).values(), nil
+}
+
+// setServerProperties 修改 server.properties 中的若干项，保留注释和其它行的顺序，不存在的项追加到末尾
+func setServerProperties(server *ServerInstance, values map[string]string) error {
+	p, err := loadProperties(server)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p.set(key, values[key])
+	}
+	return saveProperties(server, p)
+}
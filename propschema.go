@@ -0,0 +1,648 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 属性值类型
+const (
+	PROP_BOOL   = "bool"
+	PROP_INT    = "int"
+	PROP_STRING = "string"
+	PROP_ENUM   = "enum"
+)
+
+// propertySpec 描述 server.properties 中一个已知的键
+type propertySpec struct {
+	Key     string
+	Type    string
+	Default string
+	Min     int
+	Max     int
+	Values  []string
+	Since   string // 引入该键的版本，空表示一直存在
+	Removed string // 移除该键的版本
+	// NumericBefore 之前的版本中枚举值使用序号 (例如 1.14 之前 gamemode=0)
+	NumericBefore string
+	Pattern       *regexp.Regexp
+	Desc          string
+}
+
+const MAX_INT = 2147483647
+
+var gameModeValues = []string{"survival", "creative", "adventure", "spectator"}
+
+var difficultyValues = []string{"peaceful", "easy", "normal", "hard"}
+
+var propertySchema = []propertySpec{
+	{Key: "server-port", Type: PROP_INT, Default: "25565", Min: 1, Max: 65535, Desc: "服务器端口"},
+	{Key: "server-ip", Type: PROP_STRING, Desc: "绑定的地址，留空表示所有地址"},
+	{Key: "motd", Type: PROP_STRING, Default: "A Minecraft Server", Desc: "服务器列表中显示的描述"},
+	{Key: "online-mode", Type: PROP_BOOL, Default: "true", Desc: "正版验证"},
+	{Key: "max-players", Type: PROP_INT, Default: "20", Min: 0, Max: MAX_INT, Desc: "最大玩家数"},
+	{Key: "gamemode", Type: PROP_ENUM, Default: "survival", Values: gameModeValues, NumericBefore: "1.14", Desc: "默认游戏模式"},
+	{Key: "force-gamemode", Type: PROP_BOOL, Default: "false", Desc: "玩家加入时强制切换到默认游戏模式"},
+	{Key: "difficulty", Type: PROP_ENUM, Default: "easy", Values: difficultyValues, NumericBefore: "1.14", Desc: "难度"},
+	{Key: "hardcore", Type: PROP_BOOL, Default: "false", Desc: "极限模式"},
+	{Key: "pvp", Type: PROP_BOOL, Default: "true", Desc: "允许玩家互相攻击"},
+	{Key: "level-name", Type: PROP_STRING, Default: "world", Desc: "世界目录名"},
+	{Key: "level-seed", Type: PROP_STRING, Desc: "世界种子"},
+	{Key: "level-type", Type: PROP_STRING, Default: "minecraft:normal", Desc: "世界类型"},
+	{Key: "generator-settings", Type: PROP_STRING, Default: "{}", Desc: "超平坦等世界类型的生成设置"},
+	{Key: "generate-structures", Type: PROP_BOOL, Default: "true", Desc: "生成结构"},
+	{Key: "max-world-size", Type: PROP_INT, Default: "29999984", Min: 1, Max: 29999984, Desc: "世界边界半径"},
+	{Key: "max-build-height", Type: PROP_INT, Default: "256", Min: 0, Max: 256, Removed: "1.17", Desc: "最大建筑高度"},
+	{Key: "view-distance", Type: PROP_INT, Default: "10", Min: 3, Max: 32, Desc: "视距 (区块)"},
+	{Key: "simulation-distance", Type: PROP_INT, Default: "10", Min: 3, Max: 32, Since: "1.18", Desc: "模拟距离 (区块)"},
+	{Key: "entity-broadcast-range-percentage", Type: PROP_INT, Default: "100", Min: 10, Max: 1000, Since: "1.16", Desc: "实体可见距离百分比"},
+	{Key: "spawn-protection", Type: PROP_INT, Default: "16", Min: 0, Max: MAX_INT, Desc: "出生点保护半径"},
+	{Key: "spawn-monsters", Type: PROP_BOOL, Default: "true", Desc: "生成怪物"},
+	{Key: "spawn-animals", Type: PROP_BOOL, Default: "true", Desc: "生成动物"},
+	{Key: "spawn-npcs", Type: PROP_BOOL, Default: "true", Desc: "生成村民"},
+	{Key: "allow-nether", Type: PROP_BOOL, Default: "true", Desc: "允许进入下界"},
+	{Key: "allow-flight", Type: PROP_BOOL, Default: "false", Desc: "允许飞行 (关闭时飞行会被踢出)"},
+	{Key: "enable-command-block", Type: PROP_BOOL, Default: "false", Desc: "启用命令方块"},
+	{Key: "white-list", Type: PROP_BOOL, Default: "false", Desc: "启用白名单"},
+	{Key: "enforce-whitelist", Type: PROP_BOOL, Default: "false", Since: "1.13", Desc: "重新加载白名单时踢出不在名单中的玩家"},
+	{Key: "op-permission-level", Type: PROP_INT, Default: "4", Min: 1, Max: 4, Desc: "op 命令授予的权限等级"},
+	{Key: "function-permission-level", Type: PROP_INT, Default: "2", Min: 1, Max: 4, Since: "1.14.4", Desc: "函数的权限等级"},
+	{Key: "player-idle-timeout", Type: PROP_INT, Default: "0", Min: 0, Max: MAX_INT, Desc: "挂机踢出时间 (分钟)，0 表示不踢出"},
+	{Key: "pause-when-empty-seconds", Type: PROP_INT, Default: "60", Min: 0, Max: MAX_INT, Since: "1.21.2", Desc: "没有玩家时暂停前等待的秒数"},
+	{Key: "max-tick-time", Type: PROP_INT, Default: "60000", Min: -1, Max: MAX_INT, Desc: "单刻超时 (毫秒)，-1 表示关闭看门狗"},
+	{Key: "max-chained-neighbor-updates", Type: PROP_INT, Default: "1000000", Min: -1, Max: MAX_INT, Since: "1.19", Desc: "连锁方块更新上限"},
+	{Key: "network-compression-threshold", Type: PROP_INT, Default: "256", Min: -1, Max: MAX_INT, Desc: "数据包压缩阈值 (字节)"},
+	{Key: "rate-limit", Type: PROP_INT, Default: "0", Min: 0, Max: MAX_INT, Since: "1.16.2", Desc: "每秒数据包上限，0 表示不限制"},
+	{Key: "prevent-proxy-connections", Type: PROP_BOOL, Default: "false", Since: "1.11", Desc: "拒绝通过代理连接的玩家"},
+	{Key: "use-native-transport", Type: PROP_BOOL, Default: "true", Desc: "Linux 上使用 epoll"},
+	{Key: "sync-chunk-writes", Type: PROP_BOOL, Default: "true", Since: "1.16", Desc: "同步写入区块"},
+	{Key: "region-file-compression", Type: PROP_ENUM, Default: "deflate", Values: []string{"deflate", "lz4", "none"}, Since: "1.20.5", Desc: "区域文件压缩算法"},
+	{Key: "enable-status", Type: PROP_BOOL, Default: "true", Since: "1.16", Desc: "在服务器列表中显示在线状态"},
+	{Key: "hide-online-players", Type: PROP_BOOL, Default: "false", Since: "1.18", Desc: "在服务器列表中隐藏在线玩家"},
+	{Key: "enforce-secure-profile", Type: PROP_BOOL, Default: "true", Since: "1.19", Desc: "要求玩家拥有 Mojang 签名的公钥"},
+	{Key: "previews-chat", Type: PROP_BOOL, Default: "false", Since: "1.19", Removed: "1.19.3", Desc: "聊天预览"},
+	{Key: "accepts-transfers", Type: PROP_BOOL, Default: "false", Since: "1.20.5", Desc: "接受其它服务器转移过来的玩家"},
+	{Key: "log-ips", Type: PROP_BOOL, Default: "true", Since: "1.20.2", Desc: "在日志中记录玩家 IP"},
+	{Key: "broadcast-console-to-ops", Type: PROP_BOOL, Default: "true", Desc: "向管理员广播控制台命令的输出"},
+	{Key: "broadcast-rcon-to-ops", Type: PROP_BOOL, Default: "true", Desc: "向管理员广播 RCON 命令的输出"},
+	{Key: "enable-jmx-monitoring", Type: PROP_BOOL, Default: "false", Since: "1.16", Desc: "启用 JMX 监控"},
+	{Key: "snooper-enabled", Type: PROP_BOOL, Default: "true", Removed: "1.18", Desc: "发送使用统计"},
+	{Key: "enable-rcon", Type: PROP_BOOL, Default: "false", Desc: "启用 RCON"},
+	{Key: "rcon.port", Type: PROP_INT, Default: "25575", Min: 1, Max: 65535, Desc: "RCON 端口"},
+	{Key: "rcon.password", Type: PROP_STRING, Desc: "RCON 密码"},
+	{Key: "enable-query", Type: PROP_BOOL, Default: "false", Desc: "启用 GameSpy4 查询"},
+	{Key: "query.port", Type: PROP_INT, Default: "25565", Min: 1, Max: 65535, Desc: "查询端口"},
+	{Key: "resource-pack", Type: PROP_STRING, Desc: "资源包下载地址"},
+	{Key: "resource-pack-sha1", Type: PROP_STRING, Pattern: regexp.MustCompile(`^([0-9a-fA-F]{40})?$`), Desc: "资源包的 SHA-1 (40 位十六进制)"},
+	{Key: "resource-pack-id", Type: PROP_STRING, Since: "1.20.3", Pattern: regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})?$`), Desc: "资源包的 UUID"},
+	{Key: "require-resource-pack", Type: PROP_BOOL, Default: "false", Since: "1.17", Desc: "拒绝资源包的玩家会被断开"},
+	{Key: "resource-pack-prompt", Type: PROP_STRING, Since: "1.17", Desc: "资源包提示文本 (JSON 文本组件)"},
+	{Key: "initial-enabled-packs", Type: PROP_STRING, Default: "vanilla", Since: "1.19.3", Desc: "创建世界时启用的数据包"},
+	{Key: "initial-disabled-packs", Type: PROP_STRING, Since: "1.19.3", Desc: "创建世界时禁用的数据包"},
+	{Key: "text-filtering-config", Type: PROP_STRING, Since: "1.17", Desc: "文本过滤配置"},
+	{Key: "bug-report-link", Type: PROP_STRING, Since: "1.21", Desc: "暂停菜单中的问题反馈链接"},
+}
+
+func findPropertySpec(key string) *propertySpec {
+	for i := range propertySchema {
+		if propertySchema[i].Key == key {
+			return &propertySchema[i]
+		}
+	}
+	return nil
+}
+
+// compareMCVersion 比较 1.20.4 这样的版本号，无法解析的版本 (快照、Unknown) 视为最新版本
+func compareMCVersion(a, b string) int {
+	pa, okA := parseMCVersion(a)
+	pb, okB := parseMCVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+	for i := 0; i < 3; i++ {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseMCVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	fields := strings.Split(v, ".")
+	if len(fields) < 2 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// availableIn 判断键在该版本中是否存在
+func (s *propertySpec) availableIn(version string) bool {
+	if s.Since != "" && compareMCVersion(version, s.Since) < 0 {
+		return false
+	}
+	return s.Removed == "" || compareMCVersion(version, s.Removed) < 0
+}
+
+func (s *propertySpec) numeric(version string) bool {
+	return s.NumericBefore != "" && compareMCVersion(version, s.NumericBefore) < 0
+}
+
+// defaultFor 返回该版本的默认值
+func (s *propertySpec) defaultFor(version string) string {
+	if s.Type == PROP_ENUM && s.numeric(version) {
+		for i, v := range s.Values {
+			if v == s.Default {
+				return strconv.Itoa(i)
+			}
+		}
+	}
+	if s.Key == "level-type" && compareMCVersion(version, "1.19") < 0 {
+		return "default"
+	}
+	return s.Default
+}
+
+// normalize 检查值并转换为该版本使用的写法，枚举值可以写名称或序号
+func (s *propertySpec) normalize(value, version string) (string, error) {
+	switch s.Type {
+	case PROP_BOOL:
+		switch strings.ToLower(value) {
+		case "true", "on", "yes":
+			return "true", nil
+		case "false", "off", "no":
+			return "false", nil
+		}
+		return "", fmt.Errorf("%s 必须是 true 或 false", s.Key)
+
+	case PROP_INT:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%s 必须是整数", s.Key)
+		}
+		if n < s.Min || n > s.Max {
+			return "", fmt.Errorf("%s 的范围是 %d-%d", s.Key, s.Min, s.Max)
+		}
+		return strconv.Itoa(n), nil
+
+	case PROP_ENUM:
+		index := -1
+		for i, v := range s.Values {
+			if strings.EqualFold(v, value) || value == strconv.Itoa(i) && s.NumericBefore != "" {
+				index = i
+			}
+		}
+		if index < 0 {
+			return "", fmt.Errorf("%s 的可选值: %s", s.Key, strings.Join(s.Values, ", "))
+		}
+		if s.numeric(version) {
+			return strconv.Itoa(index), nil
+		}
+		return s.Values[index], nil
+	}
+
+	if s.Pattern != nil && !s.Pattern.MatchString(value) {
+		return "", fmt.Errorf("%s 格式错误: %s", s.Key, s.Desc)
+	}
+	return value, nil
+}
+
+// describeType 返回类型说明，例如 int 3-32
+func (s *propertySpec) describeType() string {
+	switch s.Type {
+	case PROP_INT:
+		if s.Max == MAX_INT {
+			return fmt.Sprintf("int >= %d", s.Min)
+		}
+		return fmt.Sprintf("int %d-%d", s.Min, s.Max)
+	case PROP_ENUM:
+		return strings.Join(s.Values, "|")
+	}
+	return s.Type
+}
+
+// checkProperty 检查键和值，返回规范化后的值；force 时未知的键和版本不符只给出警告
+func checkProperty(server *ServerInstance, key, value string, force bool) (string, error) {
+	spec := findPropertySpec(key)
+	if spec == nil {
+		if !force {
+			return "", fmt.Errorf("未知的键: %s (确认无误可以加 --force)", key)
+		}
+		return value, nil
+	}
+	if !spec.availableIn(server.MCVersion) {
+		msg := fmt.Sprintf("%s 在 %s 中不可用 (%s)", key, server.MCVersion, spec.versionRange())
+		if !force {
+			return "", errors.New(msg + "，确认无误可以加 --force")
+		}
+		fmt.Printf("\033[33m警告: %s\033[0m\n", msg)
+	}
+	return spec.normalize(value, server.MCVersion)
+}
+
+func (s *propertySpec) versionRange() string {
+	switch {
+	case s.Since != "" && s.Removed != "":
+		return fmt.Sprintf("%s 引入，%s 移除", s.Since, s.Removed)
+	case s.Since != "":
+		return s.Since + " 引入"
+	case s.Removed != "":
+		return s.Removed + " 移除"
+	}
+	return "所有版本"
+}
+
+// propertyFlag 返回列表中键的标记: 未知的键、当前版本不可用的键
+func propertyFlag(server *ServerInstance, key, value string) string {
+	spec := findPropertySpec(key)
+	if spec == nil {
+		return " \033[90m(未知)\033[0m"
+	}
+	if !spec.availableIn(server.MCVersion) {
+		return fmt.Sprintf(" \033[33m(%s 不可用: %s)\033[0m", server.MCVersion, spec.versionRange())
+	}
+	if _, err := spec.normalize(value, server.MCVersion); err != nil {
+		return fmt.Sprintf(" \033[31m(%v)\033[0m", err)
+	}
+	return ""
+}
+
+func printPropertiesList(server *ServerInstance, p *propertiesFile, all bool) {
+	values := p.values()
+	keys := p.keys()
+	width := 20
+	for _, key := range keys {
+		width = max(width, len(key)+2)
+	}
+	for _, key := range keys {
+		fmt.Printf("%s%s%s\n", padRight(key, width), values[key], propertyFlag(server, key, values[key]))
+	}
+	if !all {
+		return
+	}
+	var missing []*propertySpec
+	for i := range propertySchema {
+		spec := &propertySchema[i]
+		if _, ok := values[spec.Key]; !ok && spec.availableIn(server.MCVersion) {
+			missing = append(missing, spec)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	fmt.Println("\n未设置 (使用默认值):")
+	for _, spec := range missing {
+		fmt.Printf("%s\033[90m%s  %s\033[0m\n", padRight(spec.Key, width), spec.defaultFor(server.MCVersion), spec.Desc)
+	}
+}
+
+// diffProperties 比较两组属性，other 为 nil 时与该版本的默认值比较
+func diffProperties(server *ServerInstance, p *propertiesFile, other *ServerInstance) error {
+	values := p.values()
+	var theirs map[string]string
+	title := "默认值"
+	if other != nil {
+		op, err := loadProperties(other)
+		if err != nil {
+			return err
+		}
+		theirs = op.values()
+		title = other.ID
+	} else {
+		theirs = make(map[string]string)
+		for _, spec := range propertySchema {
+			if spec.availableIn(server.MCVersion) {
+				theirs[spec.Key] = spec.defaultFor(server.MCVersion)
+			}
+		}
+	}
+
+	keys := make(map[string]bool)
+	for key := range values {
+		keys[key] = true
+	}
+	for key := range theirs {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	// 未设置的项以灰色显示，先对齐再着色
+	cell := func(v string, ok bool, width int) string {
+		pad := func(s string) string {
+			if width == 0 {
+				return s
+			}
+			return padRight(s, width)
+		}
+		switch {
+		case !ok:
+			return "\033[90m" + pad("(未设置)") + "\033[0m"
+		case v == "":
+			return pad(`""`)
+		}
+		return pad(v)
+	}
+	var rows []string
+	width := 20
+	for _, key := range sorted {
+		mine, okMine := values[key]
+		their, okTheir := theirs[key]
+		// 与默认值比较时，未写入文件的项就是默认值
+		if okMine == okTheir && mine == their || other == nil && !okMine {
+			continue
+		}
+		rows = append(rows, key)
+		width = max(width, len(key)+2)
+	}
+	fmt.Printf("%s%s%s\n", padRight("键", width), padRight(server.ID, 28), title)
+	for _, key := range rows {
+		mine, okMine := values[key]
+		their, okTheir := theirs[key]
+		fmt.Printf("%s%s%s\n", padRight(key, width), cell(mine, okMine, 28), cell(their, okTheir, 0))
+	}
+	diffs := len(rows)
+	if diffs == 0 {
+		fmt.Println("没有差异")
+	}
+	return nil
+}
+
+// parseAssignments 解析 set 的参数，支持 key=value 和 key value 两种写法
+func parseAssignments(args []string) ([][2]string, error) {
+	var pairs [][2]string
+	for i := 0; i < len(args); i++ {
+		if key, value, ok := strings.Cut(args[i], "="); ok {
+			pairs = append(pairs, [2]string{key, value})
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("缺少 %s 的值", args[i])
+		}
+		pairs = append(pairs, [2]string{args[i], args[i+1]})
+		i++
+	}
+	return pairs, nil
+}
+
+// setProperties 校验并写入若干项
+func setProperties(server *ServerInstance, pairs [][2]string, force bool) error {
+	p, err := loadProperties(server)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		value, err := checkProperty(server, pair[0], pair[1], force)
+		if err != nil {
+			return err
+		}
+		old, ok := p.get(pair[0])
+		p.set(pair[0], value)
+		if !ok {
+			fmt.Printf("%s = %s (新增)\n", pair[0], value)
+		} else if old != value {
+			fmt.Printf("%s: %s -> %s\n", pair[0], old, value)
+		} else {
+			fmt.Printf("%s 未改变\n", pair[0])
+		}
+	}
+	if err := saveProperties(server, p); err != nil {
+		return err
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("\033[33m服务器正在运行，重启后生效\033[0m")
+	}
+	return nil
+}
+
+func printPropsUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm props <服务器ID> ls [--all]             列出所有项，--all 同时列出未设置的已知项")
+	fmt.Println("  emcm props <服务器ID> get <键>...")
+	fmt.Println("  emcm props <服务器ID> set <键>=<值>... [--force]")
+	fmt.Println("  emcm props <服务器ID> diff [服务器ID]         与默认值或另一个实例比较")
+	fmt.Println("  emcm props <服务器ID> info <键>              查看键的类型、范围和引入版本")
+	fmt.Println("枚举值可以写名称或序号，1.14 之前的版本会自动写为序号")
+}
+
+func handlePropsCLI(args []string) {
+	if len(args) < 2 {
+		printPropsUsage()
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	p, err := loadProperties(server)
+	if err != nil {
+		fmt.Println("读取 server.properties 失败:", err)
+		return
+	}
+
+	switch args[1] {
+	case "ls":
+		if len(p.keys()) == 0 {
+			fmt.Println("server.properties 不存在或为空 (首次启动服务器时生成)")
+		}
+		printPropertiesList(server, p, len(args) > 2 && args[2] == "--all")
+
+	case "get":
+		if len(args) < 3 {
+			printPropsUsage()
+			return
+		}
+		for _, key := range args[2:] {
+			value, ok := p.get(key)
+			if !ok {
+				if spec := findPropertySpec(key); spec != nil && !spec.availableIn(server.MCVersion) {
+					fmt.Printf("%s 在 %s 中不可用 (%s)\n", key, server.MCVersion, spec.versionRange())
+				} else if spec != nil {
+					fmt.Printf("%s 未设置 (默认: %s)\n", key, spec.defaultFor(server.MCVersion))
+				} else {
+					fmt.Printf("%s 未设置\n", key)
+				}
+				continue
+			}
+			if len(args) == 3 {
+				fmt.Println(value)
+			} else {
+				fmt.Printf("%s=%s\n", key, value)
+			}
+		}
+
+	case "set":
+		force := false
+		var rest []string
+		for _, arg := range args[2:] {
+			if arg == "--force" {
+				force = true
+			} else {
+				rest = append(rest, arg)
+			}
+		}
+		pairs, err := parseAssignments(rest)
+		if err != nil || len(pairs) == 0 {
+			printPropsUsage()
+			return
+		}
+		if err := setProperties(server, pairs, force); err != nil {
+			fmt.Println("修改失败:", err)
+		}
+
+	case "diff":
+		var other *ServerInstance
+		if len(args) > 2 {
+			if other, ok = requireServer(args[2]); !ok {
+				return
+			}
+		}
+		if err := diffProperties(server, p, other); err != nil {
+			fmt.Println("比较失败:", err)
+		}
+
+	case "info":
+		if len(args) < 3 {
+			printPropsUsage()
+			return
+		}
+		spec := findPropertySpec(args[2])
+		if spec == nil {
+			fmt.Println("未知的键:", args[2])
+			return
+		}
+		fmt.Printf("%s: %s\n", spec.Key, spec.Desc)
+		fmt.Printf("类型: %s\n", spec.describeType())
+		fmt.Printf("默认值: %s\n", spec.defaultFor(server.MCVersion))
+		fmt.Printf("版本: %s", spec.versionRange())
+		if !spec.availableIn(server.MCVersion) {
+			fmt.Printf(" \033[33m(%s 不可用)\033[0m", server.MCVersion)
+		}
+		fmt.Println()
+
+	default:
+		printPropsUsage()
+	}
+}
+
+// promptProperty 在向导中询问一项设置，回车使用当前值，输入无效时重新询问
+func promptProperty(scanner *bufio.Scanner, server *ServerInstance, key, label, current string) string {
+	spec := findPropertySpec(key)
+	for {
+		fmt.Printf("%s [%s]: ", label, current)
+		if !scanner.Scan() {
+			return current
+		}
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			return current
+		}
+		value, err := spec.normalize(input, server.MCVersion)
+		if err == nil {
+			return value
+		}
+		fmt.Println(err)
+	}
+}
+
+// wizardProperties 是创建向导和菜单中询问的常用设置
+var wizardProperties = []struct{ key, label string }{
+	{"server-port", "端口"},
+	{"motd", "MOTD"},
+	{"gamemode", "游戏模式 (survival/creative/adventure/spectator)"},
+	{"difficulty", "难度 (peaceful/easy/normal/hard)"},
+	{"level-seed", "世界种子 (留空随机)"},
+	{"max-players", "最大玩家数"},
+	{"online-mode", "正版验证 (true/false)"},
+	{"view-distance", "视距"},
+}
+
+// propertiesWizard 依次询问常用设置并写入 server.properties，keys 为空时询问全部
+func propertiesWizard(scanner *bufio.Scanner, server *ServerInstance, keys ...string) error {
+	if _, err := os.Stat(serverDir(server)); err != nil {
+		return err
+	}
+	p, err := loadProperties(server)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string)
+	for _, item := range wizardProperties {
+		if len(keys) > 0 && !containsString(keys, item.key) {
+			continue
+		}
+		spec := findPropertySpec(item.key)
+		current, ok := p.get(item.key)
+		if !ok {
+			current = spec.defaultFor(server.MCVersion)
+		}
+		if value := promptProperty(scanner, server, item.key, item.label, current); value != current || !ok {
+			values[item.key] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return setServerProperties(server, values)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// editPropertiesMenu 是实例管理菜单中的 server.properties 编辑器
+func editPropertiesMenu(server *ServerInstance) {
+	scanner := bufio.NewScanner(os.Stdin)
+	if err := propertiesWizard(scanner, server); err != nil {
+		fmt.Println("修改失败:", err)
+		return
+	}
+	for {
+		fmt.Print("修改其它项 (键=值，回车结束): ")
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			fmt.Println("格式应为 键=值")
+			continue
+		}
+		if err := setProperties(server, [][2]string{{strings.TrimSpace(key), strings.TrimSpace(value)}}, false); err != nil {
+			fmt.Println("修改失败:", err)
+		}
+	}
+	fmt.Println("server.properties 已更新")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	RCON_TYPE_RESPONSE = 0
+	RCON_TYPE_COMMAND  = 2
+	RCON_TYPE_LOGIN    = 3
+	RCON_TIMEOUT       = 10 * time.Second
+	RCON_MAX_PACKET    = 4096 + 14
+)
+
+var errRCONDisabled = errors.New("服务器未启用 RCON")
+
+type rconClient struct {
+	conn   net.Conn
+	nextID int32
+}
+
+func dialRCON(addr, password string) (*rconClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, RCON_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	client := &rconClient{conn: conn}
+
+	id, err := client.write(RCON_TYPE_LOGIN, password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	respID, _, err := client.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if respID == -1 || respID != id {
+		conn.Close()
+		return nil, errors.New("RCON 认证失败，请检查 rcon.password")
+	}
+	return client, nil
+}
+
+// dialServerRCON 根据实例的 server.properties 连接 RCON
+func dialServerRCON(server *ServerInstance) (*rconClient, error) {
+	props, err := readServerProperties(server)
+	if err != nil || props["enable-rcon"] != "true" {
+		return nil, errRCONDisabled
+	}
+	port := props["rcon.port"]
+	if port == "" {
+		port = "25575"
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return nil, fmt.Errorf("rcon.port 无效: %s", port)
+	}
+	return dialRCON(net.JoinHostPort("127.0.0.1", port), props["rcon.password"])
+}
+
+func (c *rconClient) write(packetType int32, body string) (int32, error) {
+	c.nextID++
+	id := c.nextID
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(len(body)+10))
+	binary.Write(&buf, binary.LittleEndian, id)
+	binary.Write(&buf, binary.LittleEndian, packetType)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+
+	c.conn.SetWriteDeadline(time.Now().Add(RCON_TIMEOUT))
+	_, err := c.conn.Write(buf.Bytes())
+	return id, err
+}
+
+func (c *rconClient) read() (int32, string, error) {
+	c.conn.SetReadDeadline(time.Now().Add(RCON_TIMEOUT))
+
+	var length int32
+	if err := binary.Read(c.conn, binary.LittleEndian, &length); err != nil {
+		return 0, "", err
+	}
+	if length < 10 || length > RCON_MAX_PACKET {
+		return 0, "", fmt.Errorf("RCON 数据包长度无效: %d", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return 0, "", err
+	}
+	id := int32(binary.LittleEndian.Uint32(payload[0:4]))
+	body := payload[8 : len(payload)-2]
+	return id, string(body), nil
+}
+
+func (c *rconClient) Command(command string) (string, error) {
+	id, err := c.write(RCON_TYPE_COMMAND, command)
+	if err != nil {
+		return "", err
+	}
+	for {
+		respID, body, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		if respID == id {
+			return body, nil
+		}
+	}
+}
+
+func (c *rconClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	REGION_SECTOR_SIZE = 4096
+	REGION_CHUNKS      = 1024
+	REGION_HEADER_SIZE = 2 * REGION_SECTOR_SIZE
+	TICKS_PER_SECOND   = 20
+
+	CHUNK_COMPRESSION_GZIP     = 1
+	CHUNK_COMPRESSION_ZLIB     = 2
+	CHUNK_COMPRESSION_NONE     = 3
+	CHUNK_COMPRESSION_LZ4      = 4
+	CHUNK_COMPRESSION_EXTERNAL = 0x80
+)
+
+var regionNameRe = regexp.MustCompile(`^r\.(-?\d+)\.(-?\d+)\.mca$`)
+
+// regionFile 是读入内存的 Anvil 区域文件: 前 4KB 为区块位置表，后 4KB 为时间戳表，之后按 4KB 扇区存放区块
+type regionFile struct {
+	path string
+	x, z int
+	data []byte
+}
+
+func openRegion(path string) (*regionFile, error) {
+	m := regionNameRe.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return nil, fmt.Errorf("不是区域文件: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// 服务端有时会留下空的区域文件，视为没有区块
+	if len(data) > 0 && len(data) < REGION_HEADER_SIZE {
+		return nil, fmt.Errorf("%s: 文件头不完整", filepath.Base(path))
+	}
+	x, _ := strconv.Atoi(m[1])
+	z, _ := strconv.Atoi(m[2])
+	return &regionFile{path: path, x: x, z: z, data: data}, nil
+}
+
+// location 返回区块所在的扇区位置和扇区数，不存在的区块返回 0, 0
+func (r *regionFile) location(i int) (int, int) {
+	if len(r.data) < REGION_HEADER_SIZE {
+		return 0, 0
+	}
+	entry := binary.BigEndian.Uint32(r.data[i*4:])
+	return int(entry >> 8), int(entry & 0xff)
+}
+
+// chunkPos 返回第 i 个区块的区块坐标
+func (r *regionFile) chunkPos(i int) (int, int) {
+	return r.x*32 + i%32, r.z*32 + i/32
+}
+
+// externalPath 是超过 1MB 的区块单独存放的 c.x.z.mcc 文件
+func (r *regionFile) externalPath(i int) string {
+	x, z := r.chunkPos(i)
+	return filepath.Join(filepath.Dir(r.path), fmt.Sprintf("c.%d.%d.mcc", x, z))
+}
+
+// compression 返回区块的压缩方式字节，包含外部文件标志位
+func (r *regionFile) compression(i int) (byte, []byte, error) {
+	offset, _ := r.location(i)
+	start := offset * REGION_SECTOR_SIZE
+	if offset < 2 || start+5 > len(r.data) {
+		return 0, nil, errors.New("区块位置超出文件范围")
+	}
+	length := int(binary.BigEndian.Uint32(r.data[start:]))
+	if length < 1 || start+4+length > len(r.data) {
+		return 0, nil, errors.New("区块长度无效")
+	}
+	return r.data[start+4], r.data[start+5 : start+4+length], nil
+}
+
+// chunkNBT 解压并解析第 i 个区块
+func (r *regionFile) chunkNBT(i int) (*nbtCompound, error) {
+	compression, payload, err := r.compression(i)
+	if err != nil {
+		return nil, err
+	}
+	if compression&CHUNK_COMPRESSION_EXTERNAL != 0 {
+		if payload, err = os.ReadFile(r.externalPath(i)); err != nil {
+			return nil, err
+		}
+		compression &^= CHUNK_COMPRESSION_EXTERNAL
+	}
+
+	var reader io.Reader
+	switch compression {
+	case CHUNK_COMPRESSION_GZIP:
+		gz, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case CHUNK_COMPRESSION_ZLIB:
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = zr
+	case CHUNK_COMPRESSION_NONE:
+		reader = bytes.NewReader(payload)
+	case CHUNK_COMPRESSION_LZ4:
+		decoded, err := decodeLZ4Stream(payload)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(decoded)
+	default:
+		return nil, fmt.Errorf("不支持的区块压缩方式: %d", compression)
+	}
+	_, root, err := readNBT(reader)
+	return root, err
+}
+
+// chunkInhabitedTime 读取区块的 InhabitedTime，1.18 之前的区块数据位于 Level 标签下
+func chunkInhabitedTime(root *nbtCompound) int64 {
+	data := root
+	if level := root.compound("Level"); level != nil {
+		data = level
+	}
+	ticks, _ := levelInt(data, "InhabitedTime")
+	return ticks
+}
+
+type chunkInfo struct {
+	index     int
+	x, z      int
+	sectors   int
+	inhabited int64
+	err       error
+}
+
+type regionScan struct {
+	path   string
+	size   int64
+	chunks []chunkInfo
+	err    error
+}
+
+func scanRegionFile(path string) *regionScan {
+	scan := &regionScan{path: path}
+	region, err := openRegion(path)
+	if err != nil {
+		scan.err = err
+		return scan
+	}
+	scan.size = int64(len(region.data))
+	for i := 0; i < REGION_CHUNKS; i++ {
+		offset, sectors := region.location(i)
+		if offset == 0 && sectors == 0 {
+			continue
+		}
+		x, z := region.chunkPos(i)
+		info := chunkInfo{index: i, x: x, z: z, sectors: sectors}
+		if root, err := region.chunkNBT(i); err != nil {
+			info.err = err
+		} else {
+			info.inhabited = chunkInhabitedTime(root)
+		}
+		scan.chunks = append(scan.chunks, info)
+	}
+	return scan
+}
+
+// worldDimension 是一个维度的存档目录，其中包含 region、entities 和 poi
+type worldDimension struct {
+	name string
+	dir  string
+}
+
+// worldDimensions 列出世界的所有维度，兼容原版和 Bukkit 系 (world_nether、world_the_end) 的目录布局
+func worldDimensions(server *ServerInstance, world string) []worldDimension {
+	base := worldDir(server, world)
+	candidates := []worldDimension{
+		{"overworld", base},
+		{"nether", filepath.Join(base, "DIM-1")},
+		{"nether", filepath.Join(base+"_nether", "DIM-1")},
+		{"end", filepath.Join(base, "DIM1")},
+		{"end", filepath.Join(base+"_the_end", "DIM1")},
+	}
+	custom, _ := filepath.Glob(filepath.Join(base, "dimensions", "*", "*"))
+	sort.Strings(custom)
+	for _, dir := range custom {
+		candidates = append(candidates, worldDimension{filepath.Base(filepath.Dir(dir)) + ":" + filepath.Base(dir), dir})
+	}
+
+	var dims []worldDimension
+	for _, dim := range candidates {
+		if info, err := os.Stat(filepath.Join(dim.dir, "region")); err == nil && info.IsDir() {
+			dims = append(dims, dim)
+		}
+	}
+	return dims
+}
+
+// scanDimension 并发解析维度下的所有区域文件
+func scanDimension(dim worldDimension) ([]*regionScan, error) {
+	paths, err := filepath.Glob(filepath.Join(dim.dir, "region", "r.*.mca"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	scans := make([]*regionScan, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				scans[i] = scanRegionFile(paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return scans, nil
+}
+
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+var inhabitedBuckets = []struct {
+	label string
+	below int64
+}{
+	{"0", 1},
+	{"< 10s", 10 * TICKS_PER_SECOND},
+	{"< 1m", 60 * TICKS_PER_SECOND},
+	{"< 5m", 5 * 60 * TICKS_PER_SECOND},
+	{"< 30m", 30 * 60 * TICKS_PER_SECOND},
+	{"< 2h", 2 * 3600 * TICKS_PER_SECOND},
+	{">= 2h", math.MaxInt64},
+}
+
+func analyzeWorld(server *ServerInstance, world string) error {
+	dims := worldDimensions(server, world)
+	if len(dims) == 0 {
+		return fmt.Errorf("没有找到世界 %s 的区域文件", worldDir(server, world))
+	}
+
+	var totalSize int64
+	totalChunks := 0
+	for _, dim := range dims {
+		scans, err := scanDimension(dim)
+		if err != nil {
+			return err
+		}
+		regionSize := dirSize(filepath.Join(dim.dir, "region"))
+		entitiesSize := dirSize(filepath.Join(dim.dir, "entities"))
+		poiSize := dirSize(filepath.Join(dim.dir, "poi"))
+
+		buckets := make([]int, len(inhabitedBuckets))
+		chunks, corrupt := 0, 0
+		var badRegions []string
+		for _, scan := range scans {
+			if scan.err != nil {
+				badRegions = append(badRegions, scan.err.Error())
+				continue
+			}
+			for _, c := range scan.chunks {
+				chunks++
+				if c.err != nil {
+					corrupt++
+					continue
+				}
+				for b, bucket := range inhabitedBuckets {
+					if c.inhabited < bucket.below {
+						buckets[b]++
+						break
+					}
+				}
+			}
+		}
+		size := regionSize + entitiesSize + poiSize
+		totalSize += size
+		totalChunks += chunks
+
+		fmt.Printf("\n\033[1;36m%s\033[0m (%s)\n", dim.name, dim.dir)
+		fmt.Printf("  大小:     %s (region %s, entities %s, poi %s)\n",
+			formatBytes(size), formatBytes(regionSize), formatBytes(entitiesSize), formatBytes(poiSize))
+		fmt.Printf("  区域文件: %d 个\n", len(scans))
+		fmt.Printf("  区块:     %d 个", chunks)
+		if corrupt > 0 {
+			fmt.Printf(", \033[31m%d 个无法读取\033[0m", corrupt)
+		}
+		fmt.Println()
+		for _, msg := range badRegions {
+			fmt.Printf("  \033[31m%s\033[0m\n", msg)
+		}
+		if chunks-corrupt == 0 {
+			continue
+		}
+		fmt.Println("  InhabitedTime 分布:")
+		for b, bucket := range inhabitedBuckets {
+			percent := float64(buckets[b]) * 100 / float64(chunks-corrupt)
+			bar := strings.Repeat("█", int(percent/4+0.5))
+			fmt.Printf("    %-10s %8d %5.1f%% %s\n", bucket.label, buckets[b], percent, bar)
+		}
+	}
+	fmt.Printf("\n合计: %s, %d 个区块\n", formatBytes(totalSize), totalChunks)
+	return nil
+}
+
+// parseInhabitedTime 解析 5m、2h 这样的时长或纯数字的 tick 数
+func parseInhabitedTime(value string) (int64, error) {
+	if ticks, err := strconv.ParseInt(value, 10, 64); err == nil && ticks >= 0 {
+		return ticks, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的时长: %s (示例: 30s、5m、1h 或 tick 数)", value)
+	}
+	return int64(d.Seconds() * TICKS_PER_SECOND), nil
+}
+
+type pruneOptions struct {
+	world      string
+	below      int64
+	radius     int
+	dimension  string
+	dryRun     bool
+	yes        bool
+	skipBackup bool
+}
+
+// pruneCenter 返回保护半径的中心方块坐标: 主世界以出生点为中心，下界按 1:8 换算，其它维度以原点为中心
+func pruneCenter(spawnX, spawnZ int64, dimension string) (int64, int64) {
+	switch dimension {
+	case "overworld":
+		return spawnX, spawnZ
+	case "nether":
+		return spawnX / 8, spawnZ / 8
+	}
+	return 0, 0
+}
+
+// pruneRegion 记录一个区域文件中要删除的区块
+type pruneRegion struct {
+	path    string
+	remove  map[int]bool
+	sectors int
+	kept    int
+}
+
+type prunePlan struct {
+	dim     worldDimension
+	chunks  int
+	regions []*pruneRegion
+	removed int
+	freed   int64
+}
+
+func planPrune(server *ServerInstance, opts pruneOptions) ([]*prunePlan, error) {
+	dims := worldDimensions(server, opts.world)
+	if len(dims) == 0 {
+		return nil, fmt.Errorf("没有找到世界 %s 的区域文件", worldDir(server, opts.world))
+	}
+	var spawnX, spawnZ int64
+	if level, err := readNBTFile(levelDatPath(server, opts.world)); err == nil {
+		if data := level.Root.compound("Data"); data != nil {
+			spawnX, _ = levelInt(data, "SpawnX")
+			spawnZ, _ = levelInt(data, "SpawnZ")
+		}
+	} else if opts.radius > 0 {
+		return nil, fmt.Errorf("读取出生点失败: %v", err)
+	}
+
+	var plans []*prunePlan
+	for _, dim := range dims {
+		if opts.dimension != "" && dim.name != opts.dimension {
+			continue
+		}
+		scans, err := scanDimension(dim)
+		if err != nil {
+			return nil, err
+		}
+		centerX, centerZ := pruneCenter(spawnX, spawnZ, dim.name)
+		radius := int64(opts.radius)
+
+		plan := &prunePlan{dim: dim}
+		for _, scan := range scans {
+			if scan.err != nil {
+				fmt.Printf("\033[33m跳过 %s\033[0m\n", scan.err)
+				continue
+			}
+			region := &pruneRegion{path: scan.path, remove: make(map[int]bool)}
+			for _, c := range scan.chunks {
+				plan.chunks++
+				// 无法读取的区块不删除
+				if c.err != nil || c.inhabited >= opts.below {
+					region.kept++
+					continue
+				}
+				if radius > 0 {
+					dx := int64(c.x)*16 + 8 - centerX
+					dz := int64(c.z)*16 + 8 - centerZ
+					if dx*dx+dz*dz <= radius*radius {
+						region.kept++
+						continue
+					}
+				}
+				region.remove[c.index] = true
+				region.sectors += c.sectors
+			}
+			if len(region.remove) > 0 {
+				plan.regions = append(plan.regions, region)
+				plan.removed += len(region.remove)
+				plan.freed += int64(region.sectors) * REGION_SECTOR_SIZE
+			}
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("世界中没有维度 %s", opts.dimension)
+	}
+	return plans, nil
+}
+
+// rewriteRegion 重写区域文件，去掉指定的区块并压缩空洞，所有区块都被删除时删除文件
+func rewriteRegion(path string, remove map[int]bool) error {
+	region, err := openRegion(path)
+	if err != nil {
+		return err
+	}
+	if len(region.data) == 0 {
+		return nil
+	}
+
+	out := make([]byte, REGION_HEADER_SIZE, len(region.data))
+	kept := 0
+	for i := 0; i < REGION_CHUNKS; i++ {
+		offset, sectors := region.location(i)
+		if offset == 0 && sectors == 0 {
+			continue
+		}
+		if remove[i] {
+			if compression, _, err := region.compression(i); err == nil && compression&CHUNK_COMPRESSION_EXTERNAL != 0 {
+				os.Remove(region.externalPath(i))
+			}
+			continue
+		}
+		start := offset * REGION_SECTOR_SIZE
+		end := min(start+sectors*REGION_SECTOR_SIZE, len(region.data))
+		if start >= end {
+			continue
+		}
+		newOffset := len(out) / REGION_SECTOR_SIZE
+		out = append(out, region.data[start:end]...)
+		if pad := len(out) % REGION_SECTOR_SIZE; pad != 0 {
+			out = append(out, make([]byte, REGION_SECTOR_SIZE-pad)...)
+		}
+		binary.BigEndian.PutUint32(out[i*4:], uint32(newOffset)<<8|uint32(sectors))
+		copy(out[REGION_SECTOR_SIZE+i*4:], region.data[REGION_SECTOR_SIZE+i*4:REGION_SECTOR_SIZE+i*4+4])
+		kept++
+	}
+
+	if kept == 0 {
+		return os.Remove(path)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// applyPrune 删除区块，同时删除 entities 和 poi 中对应的数据 (1.17 起实体和兴趣点单独存放)
+func applyPrune(plans []*prunePlan) (int64, error) {
+	var freed int64
+	for _, plan := range plans {
+		for _, region := range plan.regions {
+			name := filepath.Base(region.path)
+			for _, sub := range []string{"region", "entities", "poi"} {
+				path := filepath.Join(plan.dim.dir, sub, name)
+				info, err := os.Stat(path)
+				if err != nil {
+					continue
+				}
+				if err := rewriteRegion(path, region.remove); err != nil {
+					return freed, fmt.Errorf("%s: %v", path, err)
+				}
+				if after, err := os.Stat(path); err == nil {
+					freed += info.Size() - after.Size()
+				} else {
+					freed += info.Size()
+				}
+			}
+		}
+	}
+	return freed, nil
+}
+
+func pruneWorld(server *ServerInstance, opts pruneOptions) error {
+	if !opts.dryRun && isServerRunning(server.ID) {
+		return errors.New("服务器正在运行，请先停止服务器 (可以先用 --dry-run 查看报告)")
+	}
+	fmt.Println("正在分析区域文件...")
+	plans, err := planPrune(server, opts)
+	if err != nil {
+		return err
+	}
+
+	total, removed := 0, 0
+	var freed int64
+	fmt.Printf("\n删除条件: InhabitedTime < %s", formatTicks(opts.below))
+	if opts.radius > 0 {
+		fmt.Printf("，且距出生点超过 %d 格", opts.radius)
+	}
+	fmt.Println()
+	for _, plan := range plans {
+		emptied := 0
+		for _, region := range plan.regions {
+			if region.kept == 0 {
+				emptied++
+			}
+		}
+		fmt.Printf("  %-20s %8d / %-8d 个区块, %d 个区域文件将被清空, 约释放 %s\n",
+			plan.dim.name, plan.removed, plan.chunks, emptied, formatBytes(plan.freed))
+		total += plan.chunks
+		removed += plan.removed
+		freed += plan.freed
+	}
+	fmt.Printf("合计删除 %d / %d 个区块，约释放 %s (不含 entities 和 poi)\n", removed, total, formatBytes(freed))
+
+	if opts.dryRun || removed == 0 {
+		if removed == 0 {
+			fmt.Println("没有需要删除的区块")
+		}
+		return nil
+	}
+	if !opts.yes {
+		fmt.Print("被删除的区块会在玩家下次到达时重新生成，确定继续吗? (y/n): ")
+		var confirm string
+		fmt.Scanln(&confirm)
+		if strings.ToLower(confirm) != "y" {
+			fmt.Println("已取消")
+			return nil
+		}
+	}
+
+	if !opts.skipBackup {
+		fmt.Println("删除前先备份实例...")
+		if _, err := createBackup(server, "", false); err != nil {
+			return fmt.Errorf("备份失败，已取消删除: %v", err)
+		}
+	}
+	actual, err := applyPrune(plans)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\033[32m已删除 %d 个区块，释放 %s\033[0m\n", removed, formatBytes(actual))
+	return nil
+}
+
+// formatTicks 将 tick 数显示为时长
+func formatTicks(ticks int64) string {
+	return (time.Duration(ticks) * time.Second / TICKS_PER_SECOND).String()
+}
+
+func handleWorldPruneCLI(server *ServerInstance, world string, args []string) {
+	opts := pruneOptions{world: world, below: -1}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--inhabited-below":
+			if i+1 < len(args) {
+				i++
+				ticks, err := parseInhabitedTime(args[i])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				opts.below = ticks
+			}
+		case "--keep-radius":
+			if i+1 < len(args) {
+				i++
+				radius, err := strconv.Atoi(args[i])
+				if err != nil || radius < 0 {
+					fmt.Println("无效的半径:", args[i])
+					return
+				}
+				opts.radius = radius
+			}
+		case "--dimension":
+			if i+1 < len(args) {
+				i++
+				opts.dimension = args[i]
+			}
+		case "--dry-run":
+			opts.dryRun = true
+		case "--yes":
+			opts.yes = true
+		case "--no-backup":
+			opts.skipBackup = true
+		default:
+			fmt.Println("未知参数:", args[i])
+			printWorldUsage()
+			return
+		}
+	}
+	if opts.below < 0 {
+		fmt.Println("请使用 --inhabited-below 指定删除条件，例如 --inhabited-below 5m")
+		return
+	}
+	if err := pruneWorld(server, opts); err != nil {
+		fmt.Println("清理失败:", err)
+	}
+}
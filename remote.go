@@ -0,0 +1,878 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TARGET_TYPE_LOCAL = "local"
+	TARGET_TYPE_S3    = "s3"
+	TARGET_TYPE_SFTP  = "sftp"
+	UPLOAD_LOCK_FILE  = "upload.lock"
+	UPLOAD_LOG_NAME   = "upload.log"
+	PUSH_MAX_PASSES   = 3
+)
+
+// BackupTarget 是异地备份目标，实例的备份上传到 <目标>/<实例ID>/ 下，目录结构与本地 .emcm/backups/<实例ID>/ 相同
+type BackupTarget struct {
+	Type string `json:"type"`
+	// Path 对本地目标是目录，对 SFTP 是远程目录，对 S3 是对象键前缀
+	Path          string `json:"path,omitempty"`
+	Endpoint      string `json:"endpoint,omitempty"`
+	Bucket        string `json:"bucket,omitempty"`
+	Region        string `json:"region,omitempty"`
+	AccessKey     string `json:"access_key,omitempty"`
+	SecretKey     string `json:"secret_key,omitempty"`
+	VirtualHost   bool   `json:"virtual_host,omitempty"`
+	Host          string `json:"host,omitempty"`
+	Port          int    `json:"port,omitempty"`
+	IdentityFile  string `json:"identity_file,omitempty"`
+	BandwidthKBps int    `json:"bandwidth_kbps,omitempty"`
+	// 远程保留策略，为 0 时使用实例的保留策略
+	KeepLast   int `json:"keep_last,omitempty"`
+	KeepDaily  int `json:"keep_daily,omitempty"`
+	KeepWeekly int `json:"keep_weekly,omitempty"`
+}
+
+// remoteFile 是一次上传或下载中的文件，Name 为相对目标根目录的路径
+type remoteFile struct {
+	Name  string
+	Local string
+}
+
+// remoteStore 是备份目标的存储接口，list 递归列出前缀下的文件及大小
+type remoteStore interface {
+	list(prefix string) (map[string]int64, error)
+	put(files []remoteFile) error
+	get(files []remoteFile) error
+	remove(names []string) error
+}
+
+// bandwidthLimiter 限制一次上传会话的总速率，为 nil 时不限速
+type bandwidthLimiter struct {
+	mu    sync.Mutex
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+func newBandwidthLimiter(kbps int) *bandwidthLimiter {
+	if kbps <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{rate: int64(kbps) * 1024, start: time.Now()}
+}
+
+func (l *bandwidthLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.sent += int64(n)
+	expected := time.Duration(float64(l.sent) / float64(l.rate) * float64(time.Second))
+	delay := expected - time.Since(l.start)
+	l.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > 32<<10 {
+		p = p[:32<<10]
+	}
+	n, err := t.r.Read(p)
+	t.limiter.wait(n)
+	return n, err
+}
+
+func throttle(r io.Reader, limiter *bandwidthLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: limiter}
+}
+
+// localStore 把备份复制到本地或挂载的目录 (NAS、外接硬盘等)
+type localStore struct {
+	root    string
+	limiter *bandwidthLimiter
+}
+
+func (s *localStore) list(prefix string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	base := filepath.Join(s.root, filepath.FromSlash(prefix))
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".partial") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.root, p)
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	return files, err
+}
+
+func (s *localStore) put(files []remoteFile) error {
+	for _, f := range files {
+		dst := filepath.Join(s.root, filepath.FromSlash(f.Name))
+		if err := copyFileThrottled(f.Local, dst, s.limiter); err != nil {
+			return fmt.Errorf("上传 %s 失败: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *localStore) get(files []remoteFile) error {
+	for _, f := range files {
+		if err := copyFileThrottled(filepath.Join(s.root, filepath.FromSlash(f.Name)), f.Local, nil); err != nil {
+			return fmt.Errorf("下载 %s 失败: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *localStore) remove(names []string) error {
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(s.root, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFileThrottled 先写入 .partial 再重命名，中断的复制不会被当作完整文件
+func copyFileThrottled(src, dst string, limiter *bandwidthLimiter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	partial := dst + ".partial"
+	out, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, throttle(in, limiter)); err != nil {
+		out.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, dst)
+}
+
+func openRemoteStore(target *BackupTarget) (remoteStore, error) {
+	limiter := newBandwidthLimiter(target.BandwidthKBps)
+	switch target.Type {
+	case TARGET_TYPE_LOCAL:
+		if target.Path == "" {
+			return nil, errors.New("本地目标未设置目录")
+		}
+		return &localStore{root: target.Path, limiter: limiter}, nil
+	case TARGET_TYPE_S3:
+		return newS3Store(target, limiter)
+	case TARGET_TYPE_SFTP:
+		return newSFTPStore(target)
+	}
+	return nil, fmt.Errorf("未知的目标类型: %s", target.Type)
+}
+
+// remoteBackupName 返回备份在目标中的路径
+func remoteBackupName(serverID string, s backupSnapshot) string {
+	dir := BACKUP_ARCHIVES_DIR
+	if s.Format == BACKUP_FORMAT_DEDUP {
+		dir = DEDUP_SNAPSHOTS_DIR
+	}
+	return path.Join(serverID, dir, s.Name)
+}
+
+func remoteChunkName(serverID, id string) string {
+	return path.Join(serverID, DEDUP_CHUNKS_DIR, id[:2], id)
+}
+
+// remoteBackups 从目标的文件列表中找出备份
+func remoteBackups(serverID string, files map[string]int64) []backupSnapshot {
+	var snapshots []backupSnapshot
+	for name, size := range files {
+		dir, file := path.Split(name)
+		if dir != serverID+"/"+BACKUP_ARCHIVES_DIR+"/" && dir != serverID+"/"+DEDUP_SNAPSHOTS_DIR+"/" {
+			continue
+		}
+		m := backupNameRe.FindStringSubmatch(file)
+		if m == nil {
+			continue
+		}
+		t, err := time.ParseInLocation(BACKUP_STAMP, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, backupSnapshot{Name: file, Path: name, Time: t, Size: size, Format: m[2]})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	return snapshots
+}
+
+func getBackupTarget(name string) (*BackupTarget, error) {
+	target, ok := config.BackupTargets[name]
+	if !ok {
+		return nil, fmt.Errorf("找不到备份目标: %s (可用 emcm backup target ls 查看)", name)
+	}
+	return target, nil
+}
+
+// pushBackups 把实例尚未上传的备份上传到所有 (或指定的) 目标并执行远程保留策略
+// 上传期间产生的新备份会在下一轮一并上传
+func pushBackups(server *ServerInstance, only string) error {
+	cfg := getBackupConfig(server)
+	if len(cfg.Targets) == 0 {
+		return errors.New("该实例没有启用任何备份目标 (emcm backup target enable <服务器ID> <目标>)")
+	}
+
+	unlock, err := acquireLock(filepath.Join(backupDir(server.ID), UPLOAD_LOCK_FILE))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var failed []string
+	for _, name := range cfg.Targets {
+		if only != "" && name != only {
+			continue
+		}
+		target, err := getBackupTarget(name)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		for pass := 0; pass < PUSH_MAX_PASSES; pass++ {
+			uploaded, err := pushToTarget(server, name, target)
+			if err != nil {
+				fmt.Printf("\033[31m[%s] 上传失败: %v\033[0m\n", name, err)
+				failed = append(failed, name)
+				break
+			}
+			if uploaded == 0 {
+				break
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("部分目标上传失败: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func pushToTarget(server *ServerInstance, name string, target *BackupTarget) (int, error) {
+	store, err := openRemoteStore(target)
+	if err != nil {
+		return 0, err
+	}
+	remote, err := store.list(server.ID + "/")
+	if err != nil {
+		return 0, fmt.Errorf("列出远程文件失败: %v", err)
+	}
+
+	// 先按目标的保留策略从本地和远程的全部备份中选出要保留的，只上传其中的备份，
+	// 否则策略比本地严格时每次上传都会重新上传上次刚删除的备份
+	local := listBackups(server.ID)
+	keep := targetRetainedBackups(server, target, local, remoteBackups(server.ID, remote))
+
+	uploaded := 0
+	pushed := make(map[string]bool)
+	for _, s := range local {
+		if !keep[s.Name] {
+			continue
+		}
+		key := remoteBackupName(server.ID, s)
+		if s.Format != BACKUP_FORMAT_DEDUP {
+			info, err := os.Stat(s.Path)
+			if err != nil {
+				continue
+			}
+			if size, ok := remote[key]; ok && size == info.Size() {
+				continue
+			}
+			fmt.Printf("[%s] 上传 %s (%s)\n", name, s.Name, formatBytes(info.Size()))
+			if err := store.put([]remoteFile{{Name: key, Local: s.Path}}); err != nil {
+				return uploaded, err
+			}
+			remote[key] = info.Size()
+			pushed[s.Name] = true
+			uploaded++
+			continue
+		}
+
+		if _, ok := remote[key]; ok {
+			continue
+		}
+		snapshot, err := readDedupSnapshot(s.Path)
+		if err != nil {
+			fmt.Printf("\033[33m[%s] 跳过 %s: %v\033[0m\n", name, s.Name, err)
+			continue
+		}
+		// 先上传缺少的数据块，最后上传快照文件，远程出现的快照总是完整的
+		var files []remoteFile
+		var bytes int64
+		seen := make(map[string]bool)
+		for _, f := range snapshot.Files {
+			for _, id := range f.Chunks {
+				chunkKey := remoteChunkName(server.ID, id)
+				if _, ok := remote[chunkKey]; ok || seen[id] {
+					continue
+				}
+				seen[id] = true
+				info, err := os.Stat(chunkPath(server.ID, id))
+				if err != nil {
+					return uploaded, fmt.Errorf("%s 缺少本地数据块 %s，请先执行 emcm backup check", s.Name, id[:12])
+				}
+				files = append(files, remoteFile{Name: chunkKey, Local: chunkPath(server.ID, id)})
+				bytes += info.Size()
+			}
+		}
+		fmt.Printf("[%s] 上传 %s (%d 个新数据块, %s)\n", name, s.Name, len(files), formatBytes(bytes))
+		if len(files) > 0 {
+			if err := store.put(files); err != nil {
+				return uploaded, err
+			}
+			for _, f := range files {
+				remote[f.Name] = 0
+			}
+		}
+		if err := store.put([]remoteFile{{Name: key, Local: s.Path}}); err != nil {
+			return uploaded, err
+		}
+		remote[key] = 0
+		pushed[s.Name] = true
+		uploaded++
+	}
+
+	if err := applyRemoteRetention(server, name, store, remote, keep, pushed); err != nil {
+		return uploaded, fmt.Errorf("远程清理失败: %v", err)
+	}
+	if uploaded > 0 {
+		fmt.Printf("\033[32m[%s] 已上传 %d 个备份\033[0m\n", name, uploaded)
+	}
+	return uploaded, nil
+}
+
+// targetRetainedBackups 对本地和远程备份的并集执行目标的保留策略 (未设置的项沿用实例设置)
+func targetRetainedBackups(server *ServerInstance, target *BackupTarget, local, remote []backupSnapshot) map[string]bool {
+	cfg := getBackupConfig(server)
+	keepLast, keepDaily, keepWeekly := cfg.KeepLast, cfg.KeepDaily, cfg.KeepWeekly
+	if target.KeepLast > 0 {
+		keepLast = target.KeepLast
+	}
+	if target.KeepDaily > 0 {
+		keepDaily = target.KeepDaily
+	}
+	if target.KeepWeekly > 0 {
+		keepWeekly = target.KeepWeekly
+	}
+
+	all := append([]backupSnapshot{}, remote...)
+	seen := make(map[string]bool)
+	for _, s := range remote {
+		seen[s.Name] = true
+	}
+	for _, s := range local {
+		if !seen[s.Name] {
+			all = append(all, s)
+		}
+	}
+	return retainedBackups(all, keepLast, keepDaily, keepWeekly)
+}
+
+// applyRemoteRetention 删除目标中 keep 以外的备份，并回收远程不再被引用的数据块。
+// pushed 是本次刚上传的备份，它们不应被删除，否则下次上传还会重复上传
+func applyRemoteRetention(server *ServerInstance, name string, store remoteStore, remote map[string]int64, keep, pushed map[string]bool) error {
+	snapshots := remoteBackups(server.ID, remote)
+	var stale []string
+	droppedDedup := false
+	for _, s := range snapshots {
+		if keep[s.Name] {
+			continue
+		}
+		if pushed[s.Name] {
+			return fmt.Errorf("保留策略会删除刚上传的备份 %s", s.Name)
+		}
+		stale = append(stale, s.Path)
+		if s.Format == BACKUP_FORMAT_DEDUP {
+			droppedDedup = true
+		}
+	}
+	if len(stale) > 0 {
+		if err := store.remove(stale); err != nil {
+			return err
+		}
+		for _, key := range stale {
+			delete(remote, key)
+			fmt.Printf("[%s] 删除远程备份 %s\n", name, path.Base(key))
+		}
+	}
+	if !droppedDedup {
+		return nil
+	}
+
+	// 快照只在本地已被清理时才需要下载，用来确定仍被引用的数据块
+	refs := make(map[string]bool)
+	tmpDir, err := os.MkdirTemp("", "emcm-snapshots-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, s := range snapshots {
+		if !keep[s.Name] || s.Format != BACKUP_FORMAT_DEDUP {
+			continue
+		}
+		local := filepath.Join(dedupSnapshotsDir(server.ID), s.Name)
+		if _, err := os.Stat(local); err != nil {
+			local = filepath.Join(tmpDir, s.Name)
+			if err := store.get([]remoteFile{{Name: s.Path, Local: local}}); err != nil {
+				return err
+			}
+		}
+		snapshot, err := readDedupSnapshot(local)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.Name, err)
+		}
+		for _, f := range snapshot.Files {
+			for _, id := range f.Chunks {
+				refs[id] = true
+			}
+		}
+	}
+
+	var unused []string
+	chunkPrefix := server.ID + "/" + DEDUP_CHUNKS_DIR + "/"
+	for key := range remote {
+		if strings.HasPrefix(key, chunkPrefix) && !refs[path.Base(key)] {
+			unused = append(unused, key)
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	if err := store.remove(unused); err != nil {
+		return err
+	}
+	for _, key := range unused {
+		delete(remote, key)
+	}
+	fmt.Printf("[%s] 回收了 %d 个远程数据块\n", name, len(unused))
+	return nil
+}
+
+// pullBackup 把目标中的备份下载到本地，之后可以用 emcm restore 恢复
+func pullBackup(server *ServerInstance, name, ref string) error {
+	target, err := getBackupTarget(name)
+	if err != nil {
+		return err
+	}
+	store, err := openRemoteStore(target)
+	if err != nil {
+		return err
+	}
+	remote, err := store.list(server.ID + "/")
+	if err != nil {
+		return err
+	}
+	snapshots := remoteBackups(server.ID, remote)
+	if len(snapshots) == 0 {
+		return fmt.Errorf("目标 %s 中没有实例 %s 的备份", name, server.ID)
+	}
+
+	var snapshot *backupSnapshot
+	if ref == "latest" {
+		snapshot = &snapshots[len(snapshots)-1]
+	}
+	for i, s := range snapshots {
+		if s.Name == ref || strings.HasPrefix(s.Name, ref+".") {
+			snapshot = &snapshots[i]
+		}
+	}
+	if snapshot == nil {
+		return fmt.Errorf("目标 %s 中没有备份 %s", name, ref)
+	}
+
+	local := filepath.Join(backupTargetDir(server.ID, snapshot.Format), snapshot.Name)
+	if _, err := os.Stat(local); err == nil {
+		return fmt.Errorf("本地已存在备份 %s", snapshot.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return err
+	}
+
+	if snapshot.Format != BACKUP_FORMAT_DEDUP {
+		fmt.Printf("正在下载 %s (%s)...\n", snapshot.Name, formatBytes(snapshot.Size))
+		return store.get([]remoteFile{{Name: snapshot.Path, Local: local}})
+	}
+
+	partial := local + ".partial"
+	if err := store.get([]remoteFile{{Name: snapshot.Path, Local: partial}}); err != nil {
+		return err
+	}
+	defer os.Remove(partial)
+	dedup, err := readDedupSnapshot(partial)
+	if err != nil {
+		return err
+	}
+	var files []remoteFile
+	seen := make(map[string]bool)
+	for _, f := range dedup.Files {
+		for _, id := range f.Chunks {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if _, err := os.Stat(chunkPath(server.ID, id)); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(chunkPath(server.ID, id)), 0755); err != nil {
+				return err
+			}
+			files = append(files, remoteFile{Name: remoteChunkName(server.ID, id), Local: chunkPath(server.ID, id)})
+		}
+	}
+	fmt.Printf("正在下载 %s (%d 个数据块)...\n", snapshot.Name, len(files))
+	if err := store.get(files); err != nil {
+		return err
+	}
+	return os.Rename(partial, local)
+}
+
+// spawnBackgroundPush 启动后台 emcm 进程上传备份，输出写入 .emcm/logs/<ID>/upload.log
+func spawnBackgroundPush(server *ServerInstance) {
+	if len(getBackupConfig(server).Targets) == 0 {
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Println("启动后台上传失败:", err)
+		return
+	}
+	logDir := filepath.Join(CACHE_DIR, LOGS_DIR, server.ID)
+	os.MkdirAll(logDir, 0755)
+	logPath := filepath.Join(logDir, UPLOAD_LOG_NAME)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("启动后台上传失败:", err)
+		return
+	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "\n[%s] 开始上传\n", time.Now().Format(LOG_TIME_LAYOUT))
+
+	cmd := exec.Command(exe, "backup", "push", server.ID)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		fmt.Println("启动后台上传失败:", err)
+		return
+	}
+	go cmd.Wait()
+	fmt.Printf("正在后台上传到 %s，日志: %s\n", strings.Join(getBackupConfig(server).Targets, ", "), logPath)
+}
+
+func printTargetUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm backup target ls")
+	fmt.Println("  emcm backup target add <名称> local <目录> [--bwlimit KB/s]")
+	fmt.Println("  emcm backup target add <名称> s3 <endpoint> <bucket> [--prefix 前缀] [--region 区域] [--access-key KEY] [--secret-key SECRET] [--virtual-host] [--bwlimit KB/s]")
+	fmt.Println("  emcm backup target add <名称> sftp <用户@主机:目录> [--port 端口] [--identity 私钥] [--bwlimit KB/s]")
+	fmt.Println("  emcm backup target rm <名称>")
+	fmt.Println("  emcm backup target retention <名称> [--last N] [--daily N] [--weekly N]   远程保留策略 (0 表示与实例相同)")
+	fmt.Println("  emcm backup target enable|disable <服务器ID> <名称>")
+	fmt.Println("S3 密钥未设置时读取环境变量 AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY")
+}
+
+func describeTarget(target *BackupTarget) string {
+	var desc string
+	switch target.Type {
+	case TARGET_TYPE_S3:
+		desc = fmt.Sprintf("s3 %s/%s/%s", strings.TrimSuffix(target.Endpoint, "/"), target.Bucket, target.Path)
+	case TARGET_TYPE_SFTP:
+		desc = fmt.Sprintf("sftp %s:%s", target.Host, target.Path)
+		if target.Port != 0 {
+			desc += fmt.Sprintf(" (端口 %d)", target.Port)
+		}
+	default:
+		desc = fmt.Sprintf("%s %s", target.Type, target.Path)
+	}
+	if target.BandwidthKBps > 0 {
+		desc += fmt.Sprintf(", 限速 %d KB/s", target.BandwidthKBps)
+	}
+	return strings.TrimSuffix(desc, "/")
+}
+
+func handleTargetCLI(args []string) {
+	if len(args) < 1 {
+		printTargetUsage()
+		return
+	}
+
+	switch args[0] {
+	case "ls":
+		if len(config.BackupTargets) == 0 {
+			fmt.Println("还没有配置备份目标")
+			return
+		}
+		names := make([]string, 0, len(config.BackupTargets))
+		for name := range config.BackupTargets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var users []string
+			for _, id := range sortedServerIDs() {
+				for _, t := range getBackupConfig(config.ServerInstalls[id]).Targets {
+					if t == name {
+						users = append(users, id)
+					}
+				}
+			}
+			fmt.Printf("%-12s %s\n", name, describeTarget(config.BackupTargets[name]))
+			if len(users) > 0 {
+				fmt.Printf("%-12s 使用的实例: %s\n", "", strings.Join(users, ", "))
+			}
+		}
+
+	case "add":
+		if len(args) < 4 {
+			printTargetUsage()
+			return
+		}
+		name, kind := args[1], args[2]
+		target := &BackupTarget{Type: kind}
+		var rest []string
+		switch kind {
+		case TARGET_TYPE_LOCAL:
+			abs, err := filepath.Abs(args[3])
+			if err != nil {
+				fmt.Println("无效的目录:", err)
+				return
+			}
+			target.Path = abs
+			rest = args[4:]
+		case TARGET_TYPE_S3:
+			if len(args) < 5 {
+				printTargetUsage()
+				return
+			}
+			target.Endpoint, target.Bucket = args[3], args[4]
+			rest = args[5:]
+		case TARGET_TYPE_SFTP:
+			host, dir, ok := strings.Cut(args[3], ":")
+			if !ok || host == "" {
+				fmt.Println("SFTP 目标格式应为 用户@主机:目录")
+				return
+			}
+			target.Host, target.Path = host, dir
+			rest = args[4:]
+		default:
+			fmt.Println("未知的目标类型:", kind)
+			return
+		}
+
+		for i := 0; i < len(rest); i++ {
+			value := ""
+			if i+1 < len(rest) {
+				value = rest[i+1]
+			}
+			switch rest[i] {
+			case "--virtual-host":
+				target.VirtualHost = true
+				continue
+			case "--prefix":
+				target.Path = strings.Trim(value, "/")
+			case "--region":
+				target.Region = value
+			case "--access-key":
+				target.AccessKey = value
+			case "--secret-key":
+				target.SecretKey = value
+			case "--identity":
+				target.IdentityFile = value
+			case "--port", "--bwlimit":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					fmt.Printf("无效的数值: %s\n", value)
+					return
+				}
+				if rest[i] == "--port" {
+					target.Port = n
+				} else {
+					target.BandwidthKBps = n
+				}
+			default:
+				fmt.Println("未知参数:", rest[i])
+				return
+			}
+			i++
+		}
+
+		if _, err := openRemoteStore(target); err != nil {
+			fmt.Println("目标配置无效:", err)
+			return
+		}
+		if config.BackupTargets == nil {
+			config.BackupTargets = make(map[string]*BackupTarget)
+		}
+		config.BackupTargets[name] = target
+		saveConfig()
+		fmt.Printf("已添加备份目标 %s: %s\n", name, describeTarget(target))
+
+	case "rm":
+		if len(args) < 2 {
+			printTargetUsage()
+			return
+		}
+		if _, err := getBackupTarget(args[1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+		delete(config.BackupTargets, args[1])
+		for _, server := range config.ServerInstalls {
+			cfg := getBackupConfig(server)
+			var kept []string
+			for _, t := range cfg.Targets {
+				if t != args[1] {
+					kept = append(kept, t)
+				}
+			}
+			cfg.Targets = kept
+		}
+		saveConfig()
+		fmt.Println("已删除备份目标 (远程文件不会被删除):", args[1])
+
+	case "retention":
+		if len(args) < 2 {
+			printTargetUsage()
+			return
+		}
+		target, err := getBackupTarget(args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 {
+				fmt.Printf("无效的数量: %s\n", args[i+1])
+				return
+			}
+			switch args[i] {
+			case "--last":
+				target.KeepLast = n
+			case "--daily":
+				target.KeepDaily = n
+			case "--weekly":
+				target.KeepWeekly = n
+			default:
+				fmt.Println("未知参数:", args[i])
+				return
+			}
+		}
+		saveConfig()
+		fmt.Printf("远程保留策略: 最近 %d 个, 每天一个保留 %d 天, 每周一个保留 %d 周 (0 表示与实例相同)\n", target.KeepLast, target.KeepDaily, target.KeepWeekly)
+
+	case "enable", "disable":
+		if len(args) < 3 {
+			printTargetUsage()
+			return
+		}
+		server, ok := requireServer(args[1])
+		if !ok {
+			return
+		}
+		if _, err := getBackupTarget(args[2]); err != nil {
+			fmt.Println(err)
+			return
+		}
+		cfg := getBackupConfig(server)
+		if args[0] == "enable" {
+			cfg.Targets = appendUnique(cfg.Targets, args[2])
+		} else {
+			var kept []string
+			for _, t := range cfg.Targets {
+				if t != args[2] {
+					kept = append(kept, t)
+				}
+			}
+			cfg.Targets = kept
+		}
+		saveConfig()
+		if len(cfg.Targets) == 0 {
+			fmt.Printf("%s 没有启用备份目标\n", server.ID)
+		} else {
+			fmt.Printf("%s 的备份目标: %s\n", server.ID, strings.Join(cfg.Targets, ", "))
+		}
+
+	default:
+		printTargetUsage()
+	}
+}
+
+func printRemoteBackupList(server *ServerInstance, name string) error {
+	target, err := getBackupTarget(name)
+	if err != nil {
+		return err
+	}
+	store, err := openRemoteStore(target)
+	if err != nil {
+		return err
+	}
+	remote, err := store.list(server.ID + "/")
+	if err != nil {
+		return err
+	}
+	snapshots := remoteBackups(server.ID, remote)
+	if len(snapshots) == 0 {
+		fmt.Printf("目标 %s 中没有实例 %s 的备份\n", name, server.ID)
+		return nil
+	}
+
+	var total int64
+	for _, size := range remote {
+		total += size
+	}
+	fmt.Printf("\n%s 在 %s 的备份:\n", server.Name, name)
+	fmt.Printf("%-4s %-22s %-20s %12s\n", "#", "名称", "时间", "大小")
+	for i, s := range snapshots {
+		fmt.Printf("%-4d %-22s %-20s %12s\n", i+1, s.Name, s.Time.Format("2006-01-02 15:04:05"), formatBytes(s.Size))
+	}
+	fmt.Printf("共 %d 个备份，占用 %s\n", len(snapshots), formatBytes(total))
+	return nil
+}
@@ -0,0 +1,791 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MAPS_DIR         = "maps"
+	MAP_TILES_DIR    = "tiles"
+	MAP_STATE_FILE   = "render.json"
+	MAP_TILES_FILE   = "tiles.json"
+	MAP_TILE_SIZE    = 512
+	MAP_MAX_LEVELS   = 8
+	MAP_MAX_IMAGE    = 16384
+	RENDERER_VERSION = 1
+
+	// DATA_VERSION_NON_SPANNING 起 (20w17a / 1.16) 压缩数组中的条目不再跨越两个 long
+	DATA_VERSION_NON_SPANNING = 2529
+	// 下界没有可用的高度图 (基岩顶层)，从这个高度向下寻找地面
+	NETHER_SCAN_TOP = 120
+)
+
+// blockSection 是 16x16x16 的方块数据: 调色板加上按位压缩的索引
+type blockSection struct {
+	palette  []string
+	data     []int64
+	bits     int
+	spanning bool
+}
+
+// packedValue 读取按位压缩数组的第 idx 项，spanning 表示 1.16 之前条目可以跨越两个 long
+func packedValue(data []int64, bitsPer, idx int, spanning bool) int {
+	mask := uint64(1)<<bitsPer - 1
+	if spanning {
+		bit := idx * bitsPer
+		word, offset := bit/64, bit%64
+		if word >= len(data) {
+			return 0
+		}
+		v := uint64(data[word]) >> offset
+		if offset+bitsPer > 64 && word+1 < len(data) {
+			v |= uint64(data[word+1]) << (64 - offset)
+		}
+		return int(v & mask)
+	}
+	perLong := 64 / bitsPer
+	word := idx / perLong
+	if word >= len(data) {
+		return 0
+	}
+	return int(uint64(data[word]) >> ((idx % perLong) * bitsPer) & mask)
+}
+
+func (s *blockSection) block(x, y, z int) string {
+	if len(s.palette) == 1 || len(s.data) == 0 {
+		return s.palette[0]
+	}
+	i := packedValue(s.data, s.bits, y*256+z*16+x, s.spanning)
+	if i >= len(s.palette) {
+		return ""
+	}
+	return s.palette[i]
+}
+
+// chunkBlocks 统一 1.13~1.17 (Level.Sections) 和 1.18+ (sections/block_states) 两种区块格式
+type chunkBlocks struct {
+	minY     int
+	sections map[int]*blockSection
+	surface  []int
+	floor    []int
+}
+
+func (c *chunkBlocks) block(x, y, z int) string {
+	s := c.sections[floorDiv(y, 16)]
+	if s == nil {
+		return ""
+	}
+	return s.block(x, y-floorDiv(y, 16)*16, z)
+}
+
+func (c *chunkBlocks) maxY() int {
+	top := c.minY
+	for y := range c.sections {
+		top = max(top, y*16+15)
+	}
+	return top
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+var renderedStatuses = map[string]bool{
+	"full": true, "minecraft:full": true, "postprocessed": true, "fullchunk": true, "mobs_spawned": true,
+}
+
+var errLegacyChunk = errors.New("1.13 之前的区块格式不支持渲染")
+
+func paletteNames(v interface{}) []string {
+	list, ok := v.(*nbtList)
+	if !ok {
+		return nil
+	}
+	names := make([]string, len(list.items))
+	for i, item := range list.items {
+		if entry, ok := item.(*nbtCompound); ok {
+			names[i] = levelString(entry, "Name")
+		}
+	}
+	return names
+}
+
+// decodeHeightmap 解码 256 个高度值，每项位数由数组长度推算
+func decodeHeightmap(v interface{}, spanning bool) []int {
+	data, ok := v.([]int64)
+	if !ok || len(data) == 0 {
+		return nil
+	}
+	bitsPer := len(data) * 64 / 256
+	if !spanning {
+		perLong := (256 + len(data) - 1) / len(data)
+		bitsPer = 64 / perLong
+	}
+	heights := make([]int, 256)
+	for i := range heights {
+		heights[i] = packedValue(data, bitsPer, i, spanning)
+	}
+	return heights
+}
+
+// parseChunkBlocks 解析区块，返回 nil 表示区块尚未生成完成
+func parseChunkBlocks(root *nbtCompound) (*chunkBlocks, error) {
+	dataVersion, _ := levelInt(root, "DataVersion")
+	spanning := dataVersion < DATA_VERSION_NON_SPANNING
+
+	data := root
+	sectionsKey, paletteKey, statesKey := "sections", "palette", "data"
+	if level := root.compound("Level"); level != nil {
+		data = level
+		sectionsKey, paletteKey, statesKey = "Sections", "Palette", "BlockStates"
+	}
+	if status := levelString(data, "Status"); status != "" && !renderedStatuses[status] {
+		return nil, nil
+	}
+
+	chunk := &chunkBlocks{sections: make(map[int]*blockSection)}
+	if yPos, ok := levelInt(data, "yPos"); ok {
+		chunk.minY = int(yPos) * 16
+	}
+	sections, _ := data.get(sectionsKey)
+	if list, ok := sections.(*nbtList); ok {
+		for _, item := range list.items {
+			section, ok := item.(*nbtCompound)
+			if !ok {
+				continue
+			}
+			if _, legacy := section.get("Blocks"); legacy {
+				return nil, errLegacyChunk
+			}
+			holder := section
+			if states := section.compound("block_states"); states != nil {
+				holder = states
+			}
+			palette := paletteNames(holderValue(holder, paletteKey))
+			if len(palette) == 0 {
+				continue
+			}
+			states, _ := holderValue(holder, statesKey).([]int64)
+			y, _ := levelInt(section, "Y")
+			chunk.sections[int(y)] = &blockSection{
+				palette:  palette,
+				data:     states,
+				bits:     max(4, bits.Len(uint(len(palette)-1))),
+				spanning: spanning,
+			}
+		}
+	}
+
+	if heightmaps := data.compound("Heightmaps"); heightmaps != nil {
+		surface, _ := heightmaps.get("WORLD_SURFACE")
+		floor, _ := heightmaps.get("OCEAN_FLOOR")
+		chunk.surface = decodeHeightmap(surface, spanning)
+		chunk.floor = decodeHeightmap(floor, spanning)
+	}
+	return chunk, nil
+}
+
+func holderValue(c *nbtCompound, key string) interface{} {
+	v, _ := c.get(key)
+	return v
+}
+
+// column 是地图上的一个像素: 顶部方块及其高度，水下时记录水深
+type column struct {
+	block string
+	y     int
+	depth int
+}
+
+// topColumn 找到 (x, z) 处从上方可见的方块
+func (c *chunkBlocks) topColumn(x, z int, nether bool) (column, bool) {
+	i := z*16 + x
+	if !nether && c.surface != nil && c.surface[i] > 0 {
+		y := c.minY + c.surface[i] - 1
+		col := column{block: c.block(x, y, z), y: y}
+		if !isAirBlock(col.block) {
+			if isWaterBlock(col.block) {
+				if c.floor != nil && c.floor[i] > 0 {
+					col.depth = y - (c.minY + c.floor[i] - 1)
+				} else {
+					col.depth = c.waterDepth(x, y, z)
+				}
+			}
+			return col, true
+		}
+	}
+
+	top := c.maxY()
+	if nether {
+		// 跳过顶层基岩和下方的实心方块，找到第一个空腔后的地面
+		top = min(top, NETHER_SCAN_TOP)
+		for top > c.minY && !isAirBlock(c.block(x, top, z)) {
+			top--
+		}
+	}
+	for y := top; y >= c.minY; y-- {
+		name := c.block(x, y, z)
+		if isAirBlock(name) {
+			continue
+		}
+		col := column{block: name, y: y}
+		if isWaterBlock(name) {
+			col.depth = c.waterDepth(x, y, z)
+		}
+		return col, true
+	}
+	return column{}, false
+}
+
+func (c *chunkBlocks) waterDepth(x, y, z int) int {
+	depth := 0
+	for y--; y >= c.minY && isWaterBlock(c.block(x, y, z)); y-- {
+		depth++
+	}
+	return depth
+}
+
+// shade 按与北侧方块的高度差调整亮度，效果类似原版地图
+func shade(c color.NRGBA, factor float64) color.NRGBA {
+	scale := func(v uint8) uint8 {
+		return uint8(min(255, float64(v)*factor))
+	}
+	return color.NRGBA{scale(c.R), scale(c.G), scale(c.B), c.A}
+}
+
+func columnColor(col column, northY int, hasNorth bool) color.NRGBA {
+	if col.depth > 0 || isWaterBlock(col.block) {
+		// 水越深颜色越暗
+		return shade(waterColor, 1.1-min(float64(col.depth), 20)/40)
+	}
+	c := blockColor(col.block)
+	switch {
+	case !hasNorth || col.y == northY:
+		return c
+	case col.y > northY:
+		return shade(c, 1.12)
+	default:
+		return shade(c, 0.82)
+	}
+}
+
+type regionRender struct {
+	image   *image.NRGBA
+	chunks  int
+	skipped int
+	failed  int
+}
+
+// renderRegion 把区域文件渲染成 512x512 的图片，每个像素对应一个方块，未生成的区块透明
+func renderRegion(path string, nether bool) (*regionRender, error) {
+	region, err := openRegion(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &regionRender{image: image.NewNRGBA(image.Rect(0, 0, MAP_TILE_SIZE, MAP_TILE_SIZE))}
+	heights := make([]int, MAP_TILE_SIZE*MAP_TILE_SIZE)
+	columns := make([]column, MAP_TILE_SIZE*MAP_TILE_SIZE)
+	present := make([]bool, MAP_TILE_SIZE*MAP_TILE_SIZE)
+
+	for i := 0; i < REGION_CHUNKS; i++ {
+		if offset, sectors := region.location(i); offset == 0 && sectors == 0 {
+			continue
+		}
+		root, err := region.chunkNBT(i)
+		if err != nil {
+			result.failed++
+			continue
+		}
+		chunk, err := parseChunkBlocks(root)
+		if err != nil {
+			result.failed++
+			continue
+		}
+		if chunk == nil {
+			result.skipped++
+			continue
+		}
+		result.chunks++
+		baseX, baseZ := i%32*16, i/32*16
+		for z := 0; z < 16; z++ {
+			for x := 0; x < 16; x++ {
+				col, ok := chunk.topColumn(x, z, nether)
+				if !ok {
+					continue
+				}
+				p := (baseZ+z)*MAP_TILE_SIZE + baseX + x
+				columns[p], heights[p], present[p] = col, col.y, true
+			}
+		}
+	}
+
+	for p, col := range columns {
+		if !present[p] {
+			continue
+		}
+		north := p - MAP_TILE_SIZE
+		hasNorth := north >= 0 && present[north]
+		northY := 0
+		if hasNorth {
+			northY = heights[north]
+		}
+		result.image.SetNRGBA(p%MAP_TILE_SIZE, p/MAP_TILE_SIZE, columnColor(col, northY, hasNorth))
+	}
+	return result, nil
+}
+
+// mapState 记录上次渲染时每个区域文件的大小和修改时间，用于增量渲染
+type mapState struct {
+	Renderer int                       `json:"renderer"`
+	Regions  map[string]mapRegionState `json:"regions"`
+}
+
+type mapRegionState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Chunks  int       `json:"chunks"`
+}
+
+// mapTilesInfo 写入 tiles.json，供网页端按层级加载瓦片
+type mapTilesInfo struct {
+	Dimension string    `json:"dimension"`
+	TileSize  int       `json:"tile_size"`
+	Levels    int       `json:"levels"`
+	MinX      int       `json:"min_x"`
+	MinZ      int       `json:"min_z"`
+	MaxX      int       `json:"max_x"`
+	MaxZ      int       `json:"max_z"`
+	Layout    string    `json:"layout"`
+	Updated   time.Time `json:"updated"`
+}
+
+func mapDir(serverID, dimension string) string {
+	return filepath.Join(CACHE_DIR, MAPS_DIR, serverID, strings.ReplaceAll(dimension, ":", "_"))
+}
+
+func tilePath(dir string, level, x, z int) string {
+	return filepath.Join(dir, MAP_TILES_DIR, strconv.Itoa(level), fmt.Sprintf("%d_%d.png", x, z))
+}
+
+type tileKey struct{ x, z int }
+
+// regionKey 从 r.x.z.mca 文件名解析区域坐标
+func regionKey(name string) (tileKey, bool) {
+	m := regionNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return tileKey{}, false
+	}
+	x, _ := strconv.Atoi(m[1])
+	z, _ := strconv.Atoi(m[2])
+	return tileKey{x, z}, true
+}
+
+func loadMapState(dir string) *mapState {
+	state := &mapState{Regions: make(map[string]mapRegionState)}
+	data, err := os.ReadFile(filepath.Join(dir, MAP_STATE_FILE))
+	if err == nil {
+		json.Unmarshal(data, state)
+	}
+	if state.Renderer != RENDERER_VERSION || state.Regions == nil {
+		state = &mapState{Renderer: RENDERER_VERSION, Regions: make(map[string]mapRegionState)}
+	}
+	return state
+}
+
+// saveJSON 以缩进格式写入 JSON，先写临时文件再重命名
+func saveJSON(path string, v interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+// downscaleTile 把 2x2 个下层瓦片合并缩小为一个瓦片，透明像素不参与颜色平均
+func downscaleTile(dir string, level, x, z int) (*image.NRGBA, bool) {
+	out := image.NewNRGBA(image.Rect(0, 0, MAP_TILE_SIZE, MAP_TILE_SIZE))
+	found := false
+	half := MAP_TILE_SIZE / 2
+	for dz := 0; dz < 2; dz++ {
+		for dx := 0; dx < 2; dx++ {
+			child, err := readPNG(tilePath(dir, level-1, 2*x+dx, 2*z+dz))
+			if err != nil {
+				continue
+			}
+			found = true
+			for py := 0; py < half; py++ {
+				for px := 0; px < half; px++ {
+					var r, g, b, a, n uint32
+					for _, off := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+						c := color.NRGBAModel.Convert(child.At(2*px+off[0], 2*py+off[1])).(color.NRGBA)
+						a += uint32(c.A)
+						if c.A > 0 {
+							r, g, b = r+uint32(c.R), g+uint32(c.G), b+uint32(c.B)
+							n++
+						}
+					}
+					if n == 0 {
+						continue
+					}
+					out.SetNRGBA(dx*half+px, dz*half+py, color.NRGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / 4)})
+				}
+			}
+		}
+	}
+	return out, found
+}
+
+func listTiles(dir string, level int) map[tileKey]bool {
+	tiles := make(map[tileKey]bool)
+	entries, _ := os.ReadDir(filepath.Join(dir, MAP_TILES_DIR, strconv.Itoa(level)))
+	for _, entry := range entries {
+		var x, z int
+		if _, err := fmt.Sscanf(entry.Name(), "%d_%d.png", &x, &z); err == nil {
+			tiles[tileKey{x, z}] = true
+		}
+	}
+	return tiles
+}
+
+// updatePyramid 从第 0 层开始逐层合并，只重新生成包含变化区域的瓦片；瓦片数不超过 4 个时停止
+func updatePyramid(dir string, dirty map[tileKey]bool) (int, error) {
+	levels := 1
+	tiles := listTiles(dir, 0)
+	for level := 1; level < MAP_MAX_LEVELS && len(tiles) > 4; level++ {
+		parents := make(map[tileKey]bool)
+		for t := range tiles {
+			parents[tileKey{floorDiv(t.x, 2), floorDiv(t.z, 2)}] = true
+		}
+		parentDirty := make(map[tileKey]bool)
+		for t := range dirty {
+			parentDirty[tileKey{floorDiv(t.x, 2), floorDiv(t.z, 2)}] = true
+		}
+		existing := listTiles(dir, level)
+		for t := range existing {
+			if !parents[t] {
+				os.Remove(tilePath(dir, level, t.x, t.z))
+			}
+		}
+		for t := range parents {
+			if !parentDirty[t] && existing[t] {
+				continue
+			}
+			parentDirty[t] = true
+			img, ok := downscaleTile(dir, level, t.x, t.z)
+			if !ok {
+				continue
+			}
+			if err := writePNG(tilePath(dir, level, t.x, t.z), img); err != nil {
+				return levels, err
+			}
+		}
+		tiles, dirty = parents, parentDirty
+		levels++
+	}
+	// 世界缩小后多余的层级
+	for level := levels; level < MAP_MAX_LEVELS; level++ {
+		os.RemoveAll(filepath.Join(dir, MAP_TILES_DIR, strconv.Itoa(level)))
+	}
+	return levels, nil
+}
+
+// composeMap 把某一层的瓦片拼成一张图片
+func composeMap(dir string, level int) (*image.NRGBA, error) {
+	tiles := listTiles(dir, level)
+	if len(tiles) == 0 {
+		return nil, errors.New("没有可用的瓦片")
+	}
+	first := true
+	var minX, minZ, maxX, maxZ int
+	for t := range tiles {
+		if first {
+			minX, minZ, maxX, maxZ = t.x, t.z, t.x, t.z
+			first = false
+		}
+		minX, minZ, maxX, maxZ = min(minX, t.x), min(minZ, t.z), max(maxX, t.x), max(maxZ, t.z)
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, (maxX-minX+1)*MAP_TILE_SIZE, (maxZ-minZ+1)*MAP_TILE_SIZE))
+	for t := range tiles {
+		img, err := readPNG(tilePath(dir, level, t.x, t.z))
+		if err != nil {
+			return nil, err
+		}
+		offset := image.Pt((t.x-minX)*MAP_TILE_SIZE, (t.z-minZ)*MAP_TILE_SIZE)
+		draw.Draw(out, img.Bounds().Add(offset), img, image.Point{}, draw.Src)
+	}
+	return out, nil
+}
+
+type renderOptions struct {
+	world     string
+	dimension string
+	out       string
+	full      bool
+}
+
+func renderWorld(server *ServerInstance, opts renderOptions) error {
+	var dim *worldDimension
+	for _, d := range worldDimensions(server, opts.world) {
+		if d.name == opts.dimension {
+			dim = &d
+			break
+		}
+	}
+	if dim == nil {
+		return fmt.Errorf("没有找到维度 %s 的区域文件", opts.dimension)
+	}
+	dir := mapDir(server.ID, opts.dimension)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	state := loadMapState(dir)
+	if opts.full {
+		state.Regions = make(map[string]mapRegionState)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dim.dir, "region", "r.*.mca"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	// 找出新增或修改过的区域文件，已删除的区域对应的瓦片一并删除
+	type renderJob struct {
+		path string
+		key  tileKey
+		info os.FileInfo
+	}
+	dirty := make(map[tileKey]bool)
+	var changed []renderJob
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		name := filepath.Base(path)
+		key, ok := regionKey(name)
+		info, err := os.Stat(path)
+		if !ok || err != nil {
+			continue
+		}
+		seen[name] = true
+		prev, ok := state.Regions[name]
+		_, tileErr := os.Stat(tilePath(dir, 0, key.x, key.z))
+		if ok && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) && (tileErr == nil || prev.Chunks == 0) {
+			continue
+		}
+		changed = append(changed, renderJob{path, key, info})
+		dirty[key] = true
+	}
+	for name := range state.Regions {
+		if seen[name] {
+			continue
+		}
+		delete(state.Regions, name)
+		if key, ok := regionKey(name); ok {
+			os.Remove(tilePath(dir, 0, key.x, key.z))
+			dirty[key] = true
+		}
+	}
+
+	fmt.Printf("维度 %s: %d 个区域文件，%d 个需要渲染\n", opts.dimension, len(paths), len(changed))
+	var (
+		mu                      sync.Mutex
+		wg                      sync.WaitGroup
+		chunks, skipped, failed int
+		done                    int
+		firstErr                error
+	)
+	jobs := make(chan renderJob)
+	nether := opts.dimension == "nether"
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result, err := renderRegion(job.path, nether)
+				if err == nil {
+					if result.chunks > 0 {
+						err = writePNG(tilePath(dir, 0, job.key.x, job.key.z), result.image)
+					} else {
+						os.Remove(tilePath(dir, 0, job.key.x, job.key.z))
+					}
+				}
+
+				mu.Lock()
+				done++
+				if err != nil {
+					fmt.Printf("\n\033[31m%s: %v\033[0m\n", filepath.Base(job.path), err)
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					state.Regions[filepath.Base(job.path)] = mapRegionState{Size: job.info.Size(), ModTime: job.info.ModTime(), Chunks: result.chunks}
+					chunks += result.chunks
+					skipped += result.skipped
+					failed += result.failed
+				}
+				fmt.Printf("\r渲染进度: %d/%d", done, len(changed))
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range changed {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+	if len(changed) > 0 {
+		fmt.Println()
+	}
+	if err := saveJSON(filepath.Join(dir, MAP_STATE_FILE), state); err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return fmt.Errorf("部分区域渲染失败，下次运行时会重试")
+	}
+	if len(changed) > 0 {
+		fmt.Printf("已渲染 %d 个区块", chunks)
+		if skipped > 0 {
+			fmt.Printf("，跳过 %d 个未生成完成的区块", skipped)
+		}
+		if failed > 0 {
+			fmt.Printf("，\033[33m%d 个区块无法读取或格式不支持\033[0m", failed)
+		}
+		fmt.Println()
+	}
+
+	levels, err := updatePyramid(dir, dirty)
+	if err != nil {
+		return fmt.Errorf("生成瓦片失败: %v", err)
+	}
+	base := listTiles(dir, 0)
+	if len(base) == 0 {
+		return errors.New("没有可渲染的区块")
+	}
+	info := mapTilesInfo{
+		Dimension: opts.dimension,
+		TileSize:  MAP_TILE_SIZE,
+		Levels:    levels,
+		Layout:    "tiles/<层级>/<x>_<z>.png，第 0 层每个瓦片对应一个区域 (1 像素 = 1 方块)，每升一层缩小一半",
+		Updated:   time.Now(),
+	}
+	first := true
+	for t := range base {
+		x0, z0 := t.x*MAP_TILE_SIZE, t.z*MAP_TILE_SIZE
+		if first {
+			info.MinX, info.MinZ, info.MaxX, info.MaxZ = x0, z0, x0+MAP_TILE_SIZE-1, z0+MAP_TILE_SIZE-1
+			first = false
+		}
+		info.MinX, info.MinZ = min(info.MinX, x0), min(info.MinZ, z0)
+		info.MaxX, info.MaxZ = max(info.MaxX, x0+MAP_TILE_SIZE-1), max(info.MaxZ, z0+MAP_TILE_SIZE-1)
+	}
+	if err := saveJSON(filepath.Join(dir, MAP_TILES_DIR, MAP_TILES_FILE), info); err != nil {
+		return err
+	}
+	fmt.Printf("瓦片: %s (%d 层)\n", filepath.Join(dir, MAP_TILES_DIR), levels)
+
+	if opts.out == "" {
+		return nil
+	}
+	// 整张图过大时使用缩小后的层级
+	level := 0
+	width, height := info.MaxX-info.MinX+1, info.MaxZ-info.MinZ+1
+	for level < levels-1 && (width>>level > MAP_MAX_IMAGE || height>>level > MAP_MAX_IMAGE) {
+		level++
+	}
+	img, err := composeMap(dir, level)
+	if err != nil {
+		return err
+	}
+	if err := writePNG(opts.out, img); err != nil {
+		return err
+	}
+	scale := ""
+	if level > 0 {
+		scale = fmt.Sprintf("，缩小为 1/%d", 1<<level)
+	}
+	fmt.Printf("\033[32m已生成 %s (%dx%d%s)\033[0m\n", opts.out, img.Bounds().Dx(), img.Bounds().Dy(), scale)
+	return nil
+}
+
+func handleWorldRenderCLI(server *ServerInstance, world string, args []string) {
+	opts := renderOptions{world: world, dimension: "overworld"}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dimension":
+			if i+1 < len(args) {
+				i++
+				opts.dimension = args[i]
+			}
+		case "--out":
+			if i+1 < len(args) {
+				i++
+				opts.out = args[i]
+			}
+		case "--full":
+			opts.full = true
+		default:
+			fmt.Println("未知参数:", args[i])
+			printWorldUsage()
+			return
+		}
+	}
+	if err := renderWorld(server, opts); err != nil {
+		fmt.Println("渲染失败:", err)
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_RESOURCE_PACK_PORT = 8100
+	// RESOURCE_PACK_DIR 存放托管的资源包副本，位于 CACHE_DIR，按 SHA-1 命名
+	RESOURCE_PACK_DIR = "resourcepacks"
+	// RESOURCE_PACK_CHECK_INTERVAL 是托管时检查资源包是否变化的间隔
+	RESOURCE_PACK_CHECK_INTERVAL = 5 * time.Second
+)
+
+// ResourcePackConfig 是由 EMCM 托管的服务器资源包
+type ResourcePackConfig struct {
+	File string `json:"file"`
+	Port int    `json:"port"`
+	// Host 是玩家访问的地址，为空时使用 server-ip 或本机局域网地址
+	Host    string `json:"host,omitempty"`
+	Require bool   `json:"require"`
+	Prompt  string `json:"prompt,omitempty"`
+	// PromptRestart 表示资源包变化后在控制台提示重启
+	PromptRestart bool   `json:"prompt_restart,omitempty"`
+	SHA1          string `json:"sha1,omitempty"`
+}
+
+// localIP 返回访问外网时使用的本机地址，UDP 连接不会实际发送数据
+func localIP() string {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+func resourcePackHost(server *ServerInstance) string {
+	if host := server.ResourcePack.Host; host != "" {
+		return host
+	}
+	if props, err := readServerProperties(server); err == nil && props["server-ip"] != "" {
+		return props["server-ip"]
+	}
+	return localIP()
+}
+
+func resourcePackURL(server *ServerInstance) string {
+	cfg := server.ResourcePack
+	host := net.JoinHostPort(resourcePackHost(server), strconv.Itoa(cfg.Port))
+	return fmt.Sprintf("http://%s/%s", host, url.PathEscape(filepath.Base(cfg.File)))
+}
+
+// pickResourcePackPort 选择不与其他实例的端口和资源包端口冲突、且本机未占用的端口
+func pickResourcePackPort(server *ServerInstance, start int) (int, error) {
+	reserved := reservedPorts(server.ID)
+	for _, id := range sortedServerIDs() {
+		if other := config.ServerInstalls[id]; id != server.ID && other.ResourcePack != nil {
+			reserved[portID("tcp", other.ResourcePack.Port)] = id + " resource-pack"
+		}
+	}
+	for port := start; port < start+PORT_SEARCH_LIMIT && port <= 65535; port++ {
+		if _, taken := reserved[portID("tcp", port)]; !taken && !hostPortBusy("tcp", port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("从 %d 开始找不到可用的端口", start)
+}
+
+func resourcePackSnapshotDir(server *ServerInstance) string {
+	return filepath.Join(CACHE_DIR, RESOURCE_PACK_DIR, server.ID)
+}
+
+func resourcePackSnapshot(server *ServerInstance, sha1 string) string {
+	return filepath.Join(resourcePackSnapshotDir(server), sha1+".zip")
+}
+
+// snapshotResourcePack 复制资源包并按副本的 SHA-1 命名。托管时提供的是副本，
+// 运行中的服务器公布的 SHA-1 在重启前不会变，资源包文件之后的修改不能影响正在提供的内容
+func snapshotResourcePack(server *ServerInstance) (string, error) {
+	dir := resourcePackSnapshotDir(server)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	partial := filepath.Join(dir, "pack.zip.partial")
+	if err := copyFile(server.ResourcePack.File, partial); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	hashes, _, err := hashFile(partial)
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	if err := os.Rename(partial, resourcePackSnapshot(server, hashes["sha1"])); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	// 服务器运行时旧副本可能仍在被提供
+	if !isServerRunning(server.ID) {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.zip"))
+		for _, file := range files {
+			if filepath.Base(file) != hashes["sha1"]+".zip" {
+				os.Remove(file)
+			}
+		}
+	}
+	return hashes["sha1"], nil
+}
+
+// syncResourcePack 更新资源包副本并把 SHA-1 写入 server.properties，返回摘要是否变化
+func syncResourcePack(server *ServerInstance) (bool, error) {
+	cfg := server.ResourcePack
+	sha1, err := snapshotResourcePack(server)
+	if err != nil {
+		return false, err
+	}
+	values := map[string]string{
+		"resource-pack":         resourcePackURL(server),
+		"resource-pack-sha1":    sha1,
+		"require-resource-pack": strconv.FormatBool(cfg.Require),
+	}
+	if cfg.Prompt != "" {
+		// 1.17 起提示文本是 JSON 文本组件
+		prompt, _ := json.Marshal(cfg.Prompt)
+		values["resource-pack-prompt"] = string(prompt)
+	}
+	if err := setServerProperties(server, values); err != nil {
+		return false, err
+	}
+	changed := cfg.SHA1 != sha1
+	if changed {
+		updateConfig(func() {
+			cfg.SHA1 = sha1
+			server.UpdatedAt = time.Now().Format(time.RFC3339)
+		})
+	}
+	return changed, nil
+}
+
+// prepareResourcePack 在启动前同步资源包的地址和摘要
+func prepareResourcePack(server *ServerInstance) {
+	if server.ResourcePack == nil {
+		return
+	}
+	if _, err := syncResourcePack(server); err != nil {
+		fmt.Println("更新资源包失败:", err)
+	}
+}
+
+// runResourcePackHost 在服务器运行期间托管资源包副本，stop 为 nil 时一直运行。
+// 提供的始终是与服务器公布的 SHA-1 一致的副本，资源包变化后要重启服务器才会切换
+func runResourcePackHost(server *ServerInstance, stop <-chan struct{}) {
+	cfg := server.ResourcePack
+	if cfg == nil {
+		return
+	}
+	name := filepath.Base(cfg.File)
+	served := cfg.SHA1
+	var servedMu sync.Mutex
+	if _, err := os.Stat(resourcePackSnapshot(server, served)); err != nil {
+		fmt.Printf("\033[33m托管资源包失败: %v\033[0m\n", err)
+		return
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+name {
+			http.NotFound(w, r)
+			return
+		}
+		servedMu.Lock()
+		sha1 := served
+		servedMu.Unlock()
+		f, err := os.Open(resourcePackSnapshot(server, sha1))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(cfg.Port)))
+	if err != nil {
+		fmt.Printf("\033[33m托管资源包失败: %v\033[0m\n", err)
+		return
+	}
+	httpServer := &http.Server{Handler: handler}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+	fmt.Printf("资源包地址: %s\n", resourcePackURL(server))
+
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(cfg.File); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+	warned := ""
+	ticker := time.NewTicker(RESOURCE_PACK_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(cfg.File)
+		if err != nil || (info.ModTime().Equal(lastMod) && info.Size() == lastSize) {
+			continue
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+
+		// 只托管资源包而服务器未运行时，可以直接切换到新的资源包
+		if stop == nil && !isServerRunning(server.ID) {
+			changed, err := syncResourcePack(server)
+			switch {
+			case err != nil:
+				fmt.Printf("\033[33m更新资源包失败: %v\033[0m\n", err)
+			case changed:
+				servedMu.Lock()
+				served = cfg.SHA1
+				servedMu.Unlock()
+				fmt.Printf("资源包已更新 (SHA-1 %s)\n", cfg.SHA1)
+			}
+			continue
+		}
+
+		hashes, _, err := hashFile(cfg.File)
+		if err != nil || hashes["sha1"] == served || hashes["sha1"] == warned {
+			continue
+		}
+		warned = hashes["sha1"]
+		if cfg.PromptRestart {
+			fmt.Printf("\033[33m资源包已变化 (SHA-1 %s)，重启后玩家才会下载新的资源包，请输入 stop 后重新启动服务器\033[0m\n", warned)
+		} else {
+			fmt.Printf("\033[33m资源包已变化 (SHA-1 %s)，在重启服务器前仍提供原来的资源包\033[0m\n", warned)
+		}
+	}
+}
+
+// setResourcePack 配置资源包，file 为空时只修改选项
+func setResourcePack(server *ServerInstance, file string, port int, host string, require, optional, promptRestart bool, prompt *string) error {
+	cfg := server.ResourcePack
+	if cfg == nil {
+		if file == "" {
+			return errors.New("需要指定资源包文件")
+		}
+		cfg = &ResourcePackConfig{Require: true}
+	}
+	if file != "" {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if _, err := readPackMeta(abs); err != nil {
+			return fmt.Errorf("%s 不是有效的资源包: %v", file, err)
+		}
+		cfg.File = abs
+	}
+	switch {
+	case port > 0:
+		cfg.Port = port
+	case cfg.Port == 0:
+		picked, err := pickResourcePackPort(server, DEFAULT_RESOURCE_PACK_PORT)
+		if err != nil {
+			return err
+		}
+		cfg.Port = picked
+	}
+	if host != "" {
+		cfg.Host = host
+	}
+	if require {
+		cfg.Require = true
+	}
+	if optional {
+		cfg.Require = false
+	}
+	if promptRestart {
+		cfg.PromptRestart = true
+	}
+	if prompt != nil {
+		cfg.Prompt = *prompt
+	}
+	server.ResourcePack = cfg
+	if _, err := syncResourcePack(server); err != nil {
+		return err
+	}
+	saveConfig()
+
+	fmt.Printf("资源包: %s\n", cfg.File)
+	fmt.Printf("地址: %s\n", resourcePackURL(server))
+	fmt.Printf("SHA-1: %s\n", cfg.SHA1)
+	if cfg.Host == "" {
+		fmt.Printf("\033[90m玩家不在同一局域网时，使用 --host 指定公网地址并开放 TCP 端口 %d\033[0m\n", cfg.Port)
+	}
+	if isServerRunning(server.ID) {
+		fmt.Println("服务器正在运行，重启后生效")
+	}
+	return nil
+}
+
+func removeResourcePack(server *ServerInstance) error {
+	if server.ResourcePack == nil {
+		return errors.New("没有配置资源包")
+	}
+	values := map[string]string{"resource-pack": "", "resource-pack-sha1": "", "require-resource-pack": "false", "resource-pack-prompt": ""}
+	if err := setServerProperties(server, values); err != nil {
+		return err
+	}
+	server.ResourcePack = nil
+	server.UpdatedAt = time.Now().Format(time.RFC3339)
+	saveConfig()
+	if !isServerRunning(server.ID) {
+		os.RemoveAll(resourcePackSnapshotDir(server))
+	}
+	fmt.Println("已取消托管资源包")
+	return nil
+}
+
+func printResourcePack(server *ServerInstance) {
+	cfg := server.ResourcePack
+	if cfg == nil {
+		fmt.Printf("没有配置资源包，运行 emcm resourcepack %s set <资源包.zip> 开始托管\n", server.ID)
+		return
+	}
+	fmt.Printf("资源包: %s\n", cfg.File)
+	fmt.Printf("地址: %s\n", resourcePackURL(server))
+	fmt.Printf("强制使用: %s\n", map[bool]string{true: "是", false: "否"}[cfg.Require])
+	if cfg.Prompt != "" {
+		fmt.Printf("提示: %s\n", cfg.Prompt)
+	}
+	hashes, size, err := hashFile(cfg.File)
+	switch {
+	case err != nil:
+		fmt.Printf("\033[31m读取资源包失败: %v\033[0m\n", err)
+	case hashes["sha1"] != cfg.SHA1:
+		fmt.Printf("SHA-1: %s \033[33m(文件已变化，当前为 %s，启动时更新)\033[0m\n", cfg.SHA1, hashes["sha1"])
+	default:
+		fmt.Printf("SHA-1: %s (%s)\n", cfg.SHA1, formatBytes(size))
+	}
+}
+
+// checkResourcePack 是启动前的资源包检查
+func checkResourcePack(server *ServerInstance) []checkResult {
+	cfg := server.ResourcePack
+	if cfg == nil {
+		return nil
+	}
+	if _, err := os.Stat(cfg.File); err != nil {
+		return []checkResult{{"资源包", CHECK_WARN, err.Error(), fmt.Sprintf("运行 emcm resourcepack %s set <资源包.zip> 重新指定", server.ID)}}
+	}
+	if !isServerRunning(server.ID) && hostPortBusy("tcp", cfg.Port) {
+		return []checkResult{{"资源包", CHECK_WARN, fmt.Sprintf("端口 %d 已被占用，玩家无法下载资源包", cfg.Port), fmt.Sprintf("运行 emcm resourcepack %s set --port <端口> 更换端口", server.ID)}}
+	}
+	return []checkResult{{"资源包", CHECK_PASS, fmt.Sprintf("托管于端口 %d", cfg.Port), ""}}
+}
+
+func printResourcePackUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm resourcepack <服务器ID>                                   查看资源包配置")
+	fmt.Println("  emcm resourcepack <服务器ID> set [资源包.zip] [--port 端口] [--host 地址] [--require|--optional] [--prompt 文本] [--prompt-restart]")
+	fmt.Println("                                                                 托管资源包并写入 server.properties")
+	fmt.Println("  emcm resourcepack <服务器ID> rm                                取消托管")
+	fmt.Println("  emcm resourcepack <服务器ID> serve                             只托管资源包 (服务器不由 EMCM 启动时使用)")
+	fmt.Println("通过 EMCM 启动服务器时自动托管，资源包变化后在下次启动时更新 SHA-1")
+}
+
+func handleResourcePackCLI(args []string) {
+	if len(args) < 1 {
+		printResourcePackUsage()
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	action := "show"
+	if len(args) > 1 {
+		action = args[1]
+	}
+
+	switch action {
+	case "show":
+		printResourcePack(server)
+	case "set":
+		var file, host string
+		var prompt *string
+		port := 0
+		require, optional, promptRestart := false, false, false
+		for i := 2; i < len(args); i++ {
+			switch {
+			case args[i] == "--port" && i+1 < len(args):
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n <= 0 || n > 65535 {
+					fmt.Println("无效的端口:", args[i+1])
+					return
+				}
+				port = n
+				i++
+			case args[i] == "--host" && i+1 < len(args):
+				host = args[i+1]
+				i++
+			case args[i] == "--prompt" && i+1 < len(args):
+				prompt = &args[i+1]
+				i++
+			case args[i] == "--require":
+				require = true
+			case args[i] == "--optional":
+				optional = true
+			case args[i] == "--prompt-restart":
+				promptRestart = true
+			case file == "":
+				file = args[i]
+			default:
+				printResourcePackUsage()
+				return
+			}
+		}
+		if err := setResourcePack(server, file, port, host, require, optional, promptRestart, prompt); err != nil {
+			fmt.Println("设置资源包失败:", err)
+		}
+	case "rm":
+		if err := removeResourcePack(server); err != nil {
+			fmt.Println("取消托管失败:", err)
+		}
+	case "serve":
+		if server.ResourcePack == nil {
+			printResourcePack(server)
+			return
+		}
+		prepareResourcePack(server)
+		fmt.Println("按 Ctrl+C 停止")
+		runResourcePackHost(server, nil)
+	default:
+		printResourcePackUsage()
+	}
+}
@@ -0,0 +1,588 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RESTORE_ASIDE_PREFIX = ".emcm-restore-"
+	STOP_WAIT_TIMEOUT    = 90 * time.Second
+)
+
+type archiveEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
+	IsDir   bool
+}
+
+// walkArchive 依次遍历 tar.gz、zip 备份或去重快照中的条目
+func walkArchive(archivePath string, fn func(entry archiveEntry, r io.Reader) error) error {
+	if strings.HasSuffix(archivePath, "."+BACKUP_FORMAT_DEDUP) {
+		return walkDedupSnapshot(archivePath, fn)
+	}
+	if strings.HasSuffix(archivePath, ".zip") {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		for _, f := range zr.File {
+			entry := archiveEntry{
+				Name:    strings.TrimSuffix(f.Name, "/"),
+				Size:    int64(f.UncompressedSize64),
+				ModTime: f.Modified,
+				Mode:    f.Mode(),
+				IsDir:   strings.HasSuffix(f.Name, "/"),
+			}
+			if entry.IsDir {
+				if err := fn(entry, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(entry, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := archiveEntry{
+			Name:    strings.TrimSuffix(header.Name, "/"),
+			Size:    header.Size,
+			ModTime: header.ModTime,
+			Mode:    header.FileInfo().Mode(),
+			IsDir:   header.Typeflag == tar.TypeDir,
+		}
+		if header.Typeflag != tar.TypeDir && header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(entry, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// findBackup 按文件名、时间戳、序号或 latest 查找备份
+func findBackup(serverID, ref string) (*backupSnapshot, error) {
+	snapshots := listBackups(serverID)
+	if len(snapshots) == 0 {
+		return nil, errors.New("该实例还没有任何备份")
+	}
+	if ref == "latest" {
+		return &snapshots[len(snapshots)-1], nil
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(snapshots) {
+		return &snapshots[n-1], nil
+	}
+	for i, s := range snapshots {
+		if s.Name == ref || strings.HasPrefix(s.Name, ref+".") {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("未找到备份: %s (可用 emcm backup ls %s 查看)", ref, serverID)
+}
+
+// archiveHashes 计算备份中匹配文件的 SHA-1
+func archiveHashes(archivePath string, match func(name string) bool) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := walkArchive(archivePath, func(entry archiveEntry, r io.Reader) error {
+		if entry.IsDir || !match(entry.Name) {
+			return nil
+		}
+		h := sha1.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		hashes[entry.Name] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	return hashes, err
+}
+
+func isRegionFile(name string) bool {
+	return strings.HasSuffix(name, ".mca") || strings.HasSuffix(name, ".mcr")
+}
+
+// dimensionOf 根据路径推断区域文件所属维度
+func dimensionOf(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		switch part {
+		case "DIM-1":
+			return "nether"
+		case "DIM1":
+			return "end"
+		case "dimensions":
+			if i+2 < len(parts) {
+				return parts[i+1] + ":" + parts[i+2]
+			}
+		}
+	}
+	return "overworld"
+}
+
+func printBackupList(server *ServerInstance) {
+	snapshots := listBackups(server.ID)
+	if len(snapshots) == 0 {
+		fmt.Println("该实例还没有任何备份")
+		return
+	}
+
+	var total int64
+	fmt.Printf("\n%s 的备份:\n", server.Name)
+	fmt.Printf("%-4s %-22s %-20s %12s\n", "#", "名称", "时间", "大小")
+	for i, s := range snapshots {
+		size := formatBytes(s.Size)
+		if s.Format == BACKUP_FORMAT_DEDUP {
+			// 去重快照的数据块由多个快照共享，这里显示该快照新增的数据量
+			size = "+" + size
+		} else {
+			total += s.Size
+		}
+		fmt.Printf("%-4d %-22s %-20s %12s\n", i+1, s.Name, s.Time.Format("2006-01-02 15:04:05"), size)
+	}
+	if chunks, err := listChunks(server.ID); err == nil {
+		for _, size := range chunks {
+			total += size
+		}
+	}
+	fmt.Printf("共 %d 个备份，占用 %s\n", len(snapshots), formatBytes(total))
+}
+
+func diffBackups(server *ServerInstance, refA, refB string, all bool) error {
+	a, err := findBackup(server.ID, refA)
+	if err != nil {
+		return err
+	}
+	b, err := findBackup(server.ID, refB)
+	if err != nil {
+		return err
+	}
+
+	match := isRegionFile
+	if all {
+		match = func(string) bool { return true }
+	}
+
+	fmt.Printf("正在比较 %s 和 %s ...\n", a.Name, b.Name)
+	hashesA, err := archiveHashes(a.Path, match)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %v", a.Name, err)
+	}
+	hashesB, err := archiveHashes(b.Path, match)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %v", b.Name, err)
+	}
+
+	type change struct {
+		kind string
+		name string
+	}
+	byDim := make(map[string][]change)
+	for name, hash := range hashesB {
+		old, ok := hashesA[name]
+		if !ok {
+			byDim[dimensionOf(name)] = append(byDim[dimensionOf(name)], change{"+", name})
+		} else if old != hash {
+			byDim[dimensionOf(name)] = append(byDim[dimensionOf(name)], change{"~", name})
+		}
+	}
+	for name := range hashesA {
+		if _, ok := hashesB[name]; !ok {
+			byDim[dimensionOf(name)] = append(byDim[dimensionOf(name)], change{"-", name})
+		}
+	}
+
+	if len(byDim) == 0 {
+		fmt.Println("两个备份之间没有变化")
+		return nil
+	}
+
+	dims := make([]string, 0, len(byDim))
+	for dim := range byDim {
+		dims = append(dims, dim)
+	}
+	sort.Strings(dims)
+
+	colors := map[string]string{"+": "\033[32m", "-": "\033[31m", "~": "\033[33m"}
+	for _, dim := range dims {
+		changes := byDim[dim]
+		sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+		counts := map[string]int{}
+		for _, c := range changes {
+			counts[c.kind]++
+		}
+		fmt.Printf("\n[%s] 新增 %d, 修改 %d, 删除 %d\n", dim, counts["+"], counts["~"], counts["-"])
+		for _, c := range changes {
+			fmt.Printf("  %s%s %s\033[0m\n", colors[c.kind], c.kind, c.name)
+		}
+	}
+	return nil
+}
+
+// stopServerAndWait 停止运行中的服务器并等待服务端进程退出
+func stopServerAndWait(serverID string, timeout time.Duration) error {
+	if !isServerRunning(serverID) {
+		return nil
+	}
+	// 由其他 emcm 进程运行时按服务端 PID 判断，该进程清理控制端口可能晚于服务端退出
+	pid := 0
+	if info := remoteRunInfo(serverID); info != nil {
+		pid = info.PID
+	}
+	fmt.Println("正在停止服务器...")
+	if _, err := consoleCommand(serverID, "stop", nil, timeout); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		if pid > 0 && !processAlive(pid) || pid == 0 && !isServerRunning(serverID) {
+			fmt.Println("服务器已停止")
+			return nil
+		}
+	}
+	return fmt.Errorf("等待服务器停止超时 (%s)", timeout)
+}
+
+// archiveWorlds 找出备份中包含 level.dat 的顶层世界目录
+func archiveWorlds(archivePath string) ([]string, error) {
+	var worlds []string
+	err := walkArchive(archivePath, func(entry archiveEntry, r io.Reader) error {
+		dir, file := path.Split(entry.Name)
+		if file == "level.dat" && strings.Count(dir, "/") == 1 {
+			worlds = appendUnique(worlds, strings.TrimSuffix(dir, "/"))
+		}
+		return nil
+	})
+	sort.Strings(worlds)
+	return worlds, err
+}
+
+// dimensionPrefixes 返回某个维度在备份中的目录前缀，兼容原版和 Bukkit 系的目录布局
+func dimensionPrefixes(worlds []string, level, dimension string) ([]string, error) {
+	has := func(name string) bool {
+		for _, w := range worlds {
+			if w == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch dimension {
+	case "overworld":
+		return []string{level + "/region/", level + "/entities/", level + "/poi/"}, nil
+	case "nether":
+		if has(level + "_nether") {
+			return []string{level + "_nether/DIM-1/"}, nil
+		}
+		return []string{level + "/DIM-1/"}, nil
+	case "end":
+		if has(level + "_the_end") {
+			return []string{level + "_the_end/DIM1/"}, nil
+		}
+		return []string{level + "/DIM1/"}, nil
+	}
+
+	ns, name, ok := strings.Cut(dimension, ":")
+	if !ok {
+		return nil, fmt.Errorf("未知维度: %s (可用 overworld、nether、end 或 命名空间:名称)", dimension)
+	}
+	return []string{fmt.Sprintf("%s/dimensions/%s/%s/", level, ns, name)}, nil
+}
+
+// resolvePlayerUUID 把玩家名通过 usercache.json 转换为 UUID
+func resolvePlayerUUID(server *ServerInstance, player string) (string, error) {
+	if len(player) == 36 && strings.Count(player, "-") == 4 {
+		return strings.ToLower(player), nil
+	}
+
+	cache, err := readUserCache(server)
+	if err != nil {
+		return "", fmt.Errorf("无法读取 usercache.json，请直接使用 UUID: %v", err)
+	}
+	for _, entry := range cache {
+		if strings.EqualFold(entry.Name, player) {
+			return entry.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("usercache.json 中没有玩家 %s", player)
+}
+
+func worldLevelName(server *ServerInstance) string {
+	if props, err := readServerProperties(server); err == nil && props["level-name"] != "" {
+		return props["level-name"]
+	}
+	return "world"
+}
+
+// safeJoin 防止备份或整合包中的条目通过 .. 写到实例目录之外
+func safeJoin(root, name string) (string, error) {
+	target := filepath.Join(root, filepath.FromSlash(name))
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("路径不安全: %s", name)
+	}
+	return target, nil
+}
+
+func extractArchive(archivePath, root string, include func(name string) bool) (int, error) {
+	count := 0
+	err := walkArchive(archivePath, func(entry archiveEntry, r io.Reader) error {
+		if !include(entry.Name) {
+			return nil
+		}
+		target, err := safeJoin(root, entry.Name)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir {
+			return os.MkdirAll(target, 0755)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		mode := entry.Mode.Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		os.Chtimes(target, entry.ModTime, entry.ModTime)
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// moveAside 把即将被覆盖的路径移动到 .emcm-restore-<时间>/ 下保留
+func moveAside(root, asideDir string, rels []string) error {
+	for _, rel := range rels {
+		src := filepath.Join(root, filepath.FromSlash(rel))
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		dst := filepath.Join(asideDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("移动 %s 失败: %v", rel, err)
+		}
+	}
+	return nil
+}
+
+func handleRestoreCLI(args []string) {
+	if len(args) < 2 {
+		fmt.Println("用法: emcm restore <服务器ID> <备份> [--dimension overworld|nether|end|命名空间:名称] [--player 玩家名|UUID] [--yes]")
+		fmt.Println("备份可以是 emcm backup ls 中的序号、名称、时间戳或 latest")
+		return
+	}
+	server, ok := requireServer(args[0])
+	if !ok {
+		return
+	}
+	snapshot, err := findBackup(server.ID, args[1])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	dimension, player := "", ""
+	yes := false
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "--dimension":
+			if i+1 < len(args) {
+				i++
+				dimension = args[i]
+			}
+		case "--player":
+			if i+1 < len(args) {
+				i++
+				player = args[i]
+			}
+		case "--yes", "-y":
+			yes = true
+		default:
+			fmt.Println("未知参数:", args[i])
+			return
+		}
+	}
+
+	if err := restoreBackup(server, snapshot, dimension, player, yes); err != nil {
+		fmt.Println("恢复失败:", err)
+	}
+}
+
+func restoreBackup(server *ServerInstance, snapshot *backupSnapshot, dimension, player string, yes bool) error {
+	root := serverDir(server)
+	worlds, err := archiveWorlds(snapshot.Path)
+	if err != nil {
+		return fmt.Errorf("读取备份失败: %v", err)
+	}
+	level := worldLevelName(server)
+
+	var include func(name string) bool
+	var aside []string
+	var scope string
+	full := false
+
+	switch {
+	case player != "":
+		uuid, err := resolvePlayerUUID(server, player)
+		if err != nil {
+			return err
+		}
+		target := level + "/playerdata/" + uuid + ".dat"
+		include = func(name string) bool { return name == target }
+		aside = []string{target}
+		scope = fmt.Sprintf("玩家 %s 的数据 (%s)", player, target)
+
+	case dimension != "":
+		prefixes, err := dimensionPrefixes(worlds, level, dimension)
+		if err != nil {
+			return err
+		}
+		include = func(name string) bool {
+			for _, p := range prefixes {
+				if strings.HasPrefix(name+"/", p) {
+					return true
+				}
+			}
+			return false
+		}
+		for _, p := range prefixes {
+			aside = append(aside, strings.TrimSuffix(p, "/"))
+		}
+		scope = fmt.Sprintf("维度 %s (%s)", dimension, strings.Join(prefixes, ", "))
+
+	default:
+		if len(worlds) == 0 {
+			return errors.New("备份中没有找到世界存档")
+		}
+		// 备份中的每个顶层文件和目录都会被覆盖，全部先移到一边
+		include = func(string) bool { return true }
+		full = true
+		scope = fmt.Sprintf("整个实例 (世界: %s)", strings.Join(worlds, ", "))
+	}
+
+	matched := 0
+	err = walkArchive(snapshot.Path, func(entry archiveEntry, r io.Reader) error {
+		if !entry.IsDir && include(entry.Name) {
+			matched++
+		}
+		if full {
+			if top := strings.SplitN(entry.Name, "/", 2)[0]; top != "" && top != "." {
+				aside = appendUnique(aside, top)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("读取备份失败: %v", err)
+	}
+	sort.Strings(aside)
+	if matched == 0 {
+		return fmt.Errorf("备份 %s 中没有%s的文件", snapshot.Name, scope)
+	}
+
+	fmt.Printf("将从备份 %s (%s) 恢复%s 到 %s，共 %d 个文件\n", snapshot.Name, snapshot.Time.Format("2006-01-02 15:04:05"), scope, root, matched)
+	if full {
+		fmt.Printf("会被覆盖的内容: %s\n", strings.Join(aside, ", "))
+	}
+	if !yes {
+		fmt.Print("当前数据会被移动到 " + RESTORE_ASIDE_PREFIX + "<时间>/ 目录保留，确定继续吗? (y/n): ")
+		var confirm string
+		fmt.Scanln(&confirm)
+		if strings.ToLower(confirm) != "y" {
+			fmt.Println("已取消")
+			return nil
+		}
+	}
+
+	if err := stopServerAndWait(server.ID, STOP_WAIT_TIMEOUT); err != nil {
+		return fmt.Errorf("无法停止服务器: %v", err)
+	}
+
+	asideDir := filepath.Join(root, RESTORE_ASIDE_PREFIX+time.Now().Format(BACKUP_STAMP))
+	for i := 2; ; i++ {
+		if _, err := os.Stat(asideDir); os.IsNotExist(err) {
+			break
+		}
+		asideDir = filepath.Join(root, fmt.Sprintf("%s%s-%d", RESTORE_ASIDE_PREFIX, time.Now().Format(BACKUP_STAMP), i))
+	}
+	if err := moveAside(root, asideDir, aside); err != nil {
+		return err
+	}
+
+	count, err := extractArchive(snapshot.Path, root, include)
+	if err != nil {
+		return fmt.Errorf("解压失败: %v (原数据保留在 %s)", err, asideDir)
+	}
+
+	fmt.Printf("\033[32m恢复完成，共恢复 %d 个文件\033[0m\n", count)
+	if _, err := os.Stat(asideDir); err == nil {
+		fmt.Printf("原数据已移动到: %s\n", asideDir)
+	}
+	fmt.Printf("可使用 emcm start %s 启动服务器\n", server.ID)
+	return nil
+}
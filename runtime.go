@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RUN_DIR              = "run"
+	CONTROL_DIAL_TIMEOUT = 2 * time.Second
+	CONTROL_MAX_SESSION  = 10 * time.Minute
+)
+
+var (
+	serverConsoles = make(map[string]*serverConsole)
+	consoleMutex   sync.Mutex
+)
+
+// RunInfo 记录由 EMCM 启动的服务器，供其他 emcm 进程通过本地控制端口发送命令
+type RunInfo struct {
+	ServerID    string    `json:"server_id"`
+	PID         int       `json:"pid"`
+	EMCMPID     int       `json:"emcm_pid"`
+	ControlAddr string    `json:"control_addr"`
+	Token       string    `json:"token"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// serverConsole 是当前进程中运行的服务器的控制台，负责串行写入命令和分发输出
+type serverConsole struct {
+	serverID string
+	mu       sync.Mutex
+	stdin    io.Writer
+	watchMu  sync.Mutex
+	watchers map[int]chan string
+	nextID   int
+	listener net.Listener
+	token    string
+}
+
+func runInfoPath(serverID string) string {
+	return filepath.Join(CACHE_DIR, RUN_DIR, serverID+".json")
+}
+
+func newServerConsole(serverID string, stdin io.Writer) *serverConsole {
+	return &serverConsole{
+		serverID: serverID,
+		stdin:    stdin,
+		watchers: make(map[int]chan string),
+	}
+}
+
+func (c *serverConsole) send(command string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := fmt.Fprintln(c.stdin, command)
+	return err
+}
+
+func (c *serverConsole) watch() (int, <-chan string) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	c.nextID++
+	ch := make(chan string, 256)
+	c.watchers[c.nextID] = ch
+	return c.nextID, ch
+}
+
+func (c *serverConsole) unwatch(id int) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	if ch, ok := c.watchers[id]; ok {
+		close(ch)
+		delete(c.watchers, id)
+	}
+}
+
+// publish 把一行输出分发给所有观察者，观察者来不及处理时丢弃
+func (c *serverConsole) publish(line string) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	for _, ch := range c.watchers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// registerConsole 登记运行中的控制台并开启本地控制端口
+func registerConsole(console *serverConsole, pid int) {
+	consoleMutex.Lock()
+	serverConsoles[console.serverID] = console
+	consoleMutex.Unlock()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Printf("开启控制端口失败: %v\n", err)
+		return
+	}
+	token := make([]byte, 16)
+	rand.Read(token)
+	console.listener = listener
+	console.token = hex.EncodeToString(token)
+
+	info := RunInfo{
+		ServerID:    console.serverID,
+		PID:         pid,
+		EMCMPID:     os.Getpid(),
+		ControlAddr: listener.Addr().String(),
+		Token:       console.token,
+		StartedAt:   time.Now(),
+	}
+	os.MkdirAll(filepath.Join(CACHE_DIR, RUN_DIR), 0755)
+	data, _ := json.MarshalIndent(info, "", "  ")
+	if err := os.WriteFile(runInfoPath(console.serverID), data, 0600); err != nil {
+		fmt.Printf("写入运行信息失败: %v\n", err)
+	}
+
+	go console.serveControl()
+}
+
+func unregisterConsole(serverID string) {
+	consoleMutex.Lock()
+	console, ok := serverConsoles[serverID]
+	delete(serverConsoles, serverID)
+	consoleMutex.Unlock()
+
+	if ok && console.listener != nil {
+		console.listener.Close()
+	}
+	os.Remove(runInfoPath(serverID))
+}
+
+func localConsole(serverID string) *serverConsole {
+	consoleMutex.Lock()
+	defer consoleMutex.Unlock()
+	return serverConsoles[serverID]
+}
+
+// serveControl 处理控制连接: 第一行为令牌，第二行为命令，之后把控制台输出回传直到连接关闭
+func (c *serverConsole) serveControl() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.handleControlConn(conn)
+	}
+}
+
+func (c *serverConsole) handleControlConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(CONTROL_MAX_SESSION))
+
+	reader := bufio.NewReader(conn)
+	token, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(token) != c.token {
+		return
+	}
+	command, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	command = strings.TrimSpace(command)
+
+	id, lines := c.watch()
+	defer c.unwatch(id)
+
+	if command != "" {
+		if err := c.send(command); err != nil {
+			fmt.Fprintf(conn, "ERR %v\n", err)
+			return
+		}
+	}
+	fmt.Fprintln(conn, "OK")
+
+	// 客户端关闭连接时结束
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, reader)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintln(conn, line); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func readRunInfo(serverID string) (*RunInfo, error) {
+	data, err := os.ReadFile(runInfoPath(serverID))
+	if err != nil {
+		return nil, err
+	}
+	var info RunInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// keepStaleRunInfo 为 true 时不清理失效的运行记录，emcm doctor 未指定 --fix 时只报告不修改
+var keepStaleRunInfo bool
+
+// remoteRunInfo 返回由其他 emcm 进程运行的服务器信息，服务端进程已退出或控制端口不可达时视为已停止并清理记录
+func remoteRunInfo(serverID string) *RunInfo {
+	info, err := readRunInfo(serverID)
+	if err != nil {
+		return nil
+	}
+	if !runInfoAlive(info) {
+		if !keepStaleRunInfo {
+			os.Remove(runInfoPath(serverID))
+		}
+		return nil
+	}
+	return info
+}
+
+// runInfoAlive 判断运行记录对应的服务端进程是否仍在运行、控制端口是否可达
+func runInfoAlive(info *RunInfo) bool {
+	if info.PID > 0 && !processAlive(info.PID) {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", info.ControlAddr, CONTROL_DIAL_TIMEOUT)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// isServerRunning 判断服务器是否在运行: 由任一 emcm 进程启动，或在 EMCM 之外启动但 RCON 端口可连接
+func isServerRunning(serverID string) bool {
+	if localConsole(serverID) != nil {
+		return true
+	}
+	if remoteRunInfo(serverID) != nil {
+		return true
+	}
+	if server, ok := config.ServerInstalls[serverID]; ok {
+		if props, err := readServerProperties(server); err == nil && props["enable-rcon"] == "true" {
+			port := props["rcon.port"]
+			if port == "" {
+				port = "25575"
+			}
+			if conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), CONTROL_DIAL_TIMEOUT); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// consoleCommand 向服务器发送控制台命令，waitFor 不为空时等待匹配的输出行并返回
+// 依次尝试: 本进程的标准输入 -> 其他 emcm 进程的控制端口 -> RCON
+func consoleCommand(serverID, command string, waitFor *regexp.Regexp, timeout time.Duration) (string, error) {
+	if console := localConsole(serverID); console != nil {
+		if waitFor == nil {
+			return "", console.send(command)
+		}
+		id, lines := console.watch()
+		defer console.unwatch(id)
+		if err := console.send(command); err != nil {
+			return "", err
+		}
+		return waitForLine(lines, waitFor, timeout)
+	}
+
+	if info := remoteRunInfo(serverID); info != nil {
+		return remoteConsoleCommand(info, command, waitFor, timeout)
+	}
+
+	if server, ok := config.ServerInstalls[serverID]; ok {
+		if client, err := dialServerRCON(server); err == nil {
+			defer client.Close()
+			return client.Command(command)
+		} else if !errors.Is(err, errRCONDisabled) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("服务器 %s 未运行", serverID)
+}
+
+func waitForLine(lines <-chan string, waitFor *regexp.Regexp, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return "", errors.New("服务器已停止")
+			}
+			if waitFor.MatchString(line) {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", fmt.Errorf("等待服务器响应超时 (%s)", timeout)
+		}
+	}
+}
+
+func remoteConsoleCommand(info *RunInfo, command string, waitFor *regexp.Regexp, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("tcp", info.ControlAddr, CONTROL_DIAL_TIMEOUT)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintf(conn, "%s\n%s\n", info.Token, command); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(CONTROL_DIAL_TIMEOUT))
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("控制端口无响应: %v", err)
+	}
+	if status = strings.TrimSpace(status); status != "OK" {
+		return "", errors.New(strings.TrimPrefix(status, "ERR "))
+	}
+	if waitFor == nil {
+		return "", nil
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return "", fmt.Errorf("等待服务器响应超时 (%s)", timeout)
+			}
+			return "", errors.New("服务器已停止")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if waitFor.MatchString(line) {
+			return line, nil
+		}
+	}
+}
+
+func handleCmdCLI(args []string) {
+	if len(args) < 2 {
+		fmt.Println("用法: emcm cmd <服务器ID> <控制台命令...>")
+		return
+	}
+	if _, ok := config.ServerInstalls[args[0]]; !ok {
+		fmt.Printf("找不到服务器实例: %s\n", args[0])
+		return
+	}
+
+	command := strings.Join(args[1:], " ")
+	// 等待一小段时间收集命令输出
+	output, err := consoleCommand(args[0], command, regexp.MustCompile(`.`), 3*time.Second)
+	if err != nil && output == "" && !strings.Contains(err.Error(), "超时") {
+		fmt.Println("发送命令失败:", err)
+		return
+	}
+	fmt.Println("命令已发送:", command)
+	if output != "" {
+		fmt.Println(output)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	S3_DEFAULT_REGION       = "us-east-1"
+	S3_MULTIPART_THRESHOLD  = 64 << 20
+	S3_MIN_PART_SIZE        = 16 << 20
+	S3_MAX_PARTS            = 10000
+	S3_REQUEST_TIMEOUT      = 30 * time.Minute
+	S3_EMPTY_PAYLOAD_SHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// s3Store 通过 S3 兼容接口 (AWS S3、MinIO、各家对象存储) 保存备份，使用 SigV4 签名
+type s3Store struct {
+	endpoint    *url.URL
+	bucket      string
+	prefix      string
+	region      string
+	accessKey   string
+	secretKey   string
+	virtualHost bool
+	client      *http.Client
+	limiter     *bandwidthLimiter
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteUpload struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+func newS3Store(target *BackupTarget, limiter *bandwidthLimiter) (*s3Store, error) {
+	if target.Endpoint == "" || target.Bucket == "" {
+		return nil, errors.New("S3 目标需要 endpoint 和 bucket")
+	}
+	endpoint := target.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的 endpoint: %s", target.Endpoint)
+	}
+
+	store := &s3Store{
+		endpoint:    u,
+		bucket:      target.Bucket,
+		prefix:      strings.Trim(target.Path, "/"),
+		region:      target.Region,
+		accessKey:   target.AccessKey,
+		secretKey:   target.SecretKey,
+		virtualHost: target.VirtualHost,
+		client:      &http.Client{Timeout: S3_REQUEST_TIMEOUT},
+		limiter:     limiter,
+	}
+	if store.region == "" {
+		store.region = S3_DEFAULT_REGION
+	}
+	if store.accessKey == "" {
+		store.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if store.secretKey == "" {
+		store.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if store.accessKey == "" || store.secretKey == "" {
+		return nil, errors.New("S3 目标缺少访问密钥 (--access-key/--secret-key 或环境变量 AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)")
+	}
+	return store, nil
+}
+
+func (s *s3Store) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+// awsEscape 按 SigV4 的规则编码: 只保留非保留字符，路径中的 / 可选择保留
+func awsEscape(value string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k, false)+"="+awsEscape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sign 为请求添加 SigV4 签名所需的头部
+func (s *s3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" || lower == "range" {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// request 发送签名后的请求，key 为空时访问存储桶本身，非 2xx 响应转换为错误
+func (s *s3Store) request(method, key string, query url.Values, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	host := s.endpoint.Host
+	objectPath := strings.TrimSuffix(s.endpoint.Path, "/")
+	if s.virtualHost {
+		host = s.bucket + "." + host
+	} else {
+		objectPath += "/" + s.bucket
+	}
+	objectPath += "/" + key
+
+	rawURL := s.endpoint.Scheme + "://" + host + awsEscape(objectPath, true)
+	if q := canonicalQuery(query); q != "" {
+		rawURL += "?" + q
+	}
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if payloadHash == "" {
+		payloadHash = S3_EMPTY_PAYLOAD_SHA256
+	}
+	s.sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var e s3Error
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("S3 %s %s: %s (%s)", method, key, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("S3 %s %s: HTTP %d", method, key, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (s *s3Store) list(prefix string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	fullPrefix := s.key(prefix)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {fullPrefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.request(http.MethodGet, "", query, nil, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析对象列表失败: %v", err)
+		}
+		for _, obj := range result.Contents {
+			name := obj.Key
+			if s.prefix != "" {
+				name = strings.TrimPrefix(name, s.prefix+"/")
+			}
+			files[name] = obj.Size
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *s3Store) put(files []remoteFile) error {
+	for _, f := range files {
+		if err := s.putFile(f.Name, f.Local); err != nil {
+			return fmt.Errorf("上传 %s 失败: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func hashSection(r io.ReaderAt, offset, size int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, offset, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *s3Store) putFile(name, local string) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > S3_MULTIPART_THRESHOLD {
+		return s.putMultipart(name, file, info.Size())
+	}
+
+	hash, err := hashSection(file, 0, info.Size())
+	if err != nil {
+		return err
+	}
+	body := throttle(io.NewSectionReader(file, 0, info.Size()), s.limiter)
+	resp, err := s.request(http.MethodPut, s.key(name), nil, body, info.Size(), hash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putMultipart 分片上传大文件，失败时中止上传以免残留的分片继续占用空间
+func (s *s3Store) putMultipart(name string, file *os.File, size int64) error {
+	key := s.key(name)
+	partSize := int64(S3_MIN_PART_SIZE)
+	if size/partSize >= S3_MAX_PARTS {
+		partSize = size/(S3_MAX_PARTS-1) + 1
+	}
+
+	resp, err := s.request(http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	var initiated s3InitiateResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("创建分片上传失败: %v", err)
+	}
+	uploadID := initiated.UploadID
+
+	abort := func() {
+		if resp, err := s.request(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0, ""); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	var parts []s3CompletePart
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		hash, err := hashSection(file, offset, length)
+		if err != nil {
+			abort()
+			return err
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		body := throttle(io.NewSectionReader(file, offset, length), s.limiter)
+		resp, err := s.request(http.MethodPut, key, query, body, length, hash)
+		if err != nil {
+			abort()
+			return fmt.Errorf("上传分片 %d 失败: %v", number, err)
+		}
+		resp.Body.Close()
+		parts = append(parts, s3CompletePart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		fmt.Printf("  分片 %d/%d\n", number, (size+partSize-1)/partSize)
+	}
+
+	payload, _ := xml.Marshal(s3CompleteUpload{Parts: parts})
+	sum := sha256.Sum256(payload)
+	resp, err = s.request(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(payload), int64(len(payload)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		abort()
+		return err
+	}
+	defer resp.Body.Close()
+	// 完成分片上传时，服务端可能返回 200 但在响应体中给出错误
+	data, _ := io.ReadAll(resp.Body)
+	var e s3Error
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		abort()
+		return fmt.Errorf("完成分片上传失败: %s (%s)", e.Code, e.Message)
+	}
+	return nil
+}
+
+func (s *s3Store) get(files []remoteFile) error {
+	for _, f := range files {
+		if err := s.getFile(f.Name, f.Local); err != nil {
+			return fmt.Errorf("下载 %s 失败: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *s3Store) getFile(name, local string) error {
+	resp, err := s.request(http.MethodGet, s.key(name), nil, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return err
+	}
+	partial := local + ".download"
+	out, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, local)
+}
+
+func (s *s3Store) remove(names []string) error {
+	for _, name := range names {
+		resp, err := s.request(http.MethodDelete, s.key(name), nil, nil, 0, "")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SFTP_BATCH_SIZE 限制单次 sftp 会话中的命令数，避免命令过多时一次失败需要全部重来
+const SFTP_BATCH_SIZE = 500
+
+// sftpStore 调用系统的 sftp 客户端以批处理模式传输，认证使用 ssh 密钥 (不支持交互式输入密码)
+type sftpStore struct {
+	host     string
+	port     int
+	identity string
+	root     string
+	limitKB  int
+}
+
+func newSFTPStore(target *BackupTarget) (*sftpStore, error) {
+	if _, err := exec.LookPath("sftp"); err != nil {
+		return nil, errors.New("未找到 sftp 命令，请先安装 OpenSSH 客户端")
+	}
+	if target.Host == "" {
+		return nil, errors.New("SFTP 目标未设置主机")
+	}
+	root := strings.TrimSuffix(target.Path, "/")
+	if root == "" {
+		root = "."
+	}
+	return &sftpStore{
+		host:     target.Host,
+		port:     target.Port,
+		identity: target.IdentityFile,
+		root:     root,
+		limitKB:  target.BandwidthKBps,
+	}, nil
+}
+
+// sftpQuote 为批处理命令中的路径加引号
+func sftpQuote(p string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p) + `"`
+}
+
+func (s *sftpStore) remotePath(name string) string {
+	return path.Join(s.root, name)
+}
+
+// run 在一次 sftp 会话中执行批处理命令，以 - 开头的命令失败时不会中止会话
+func (s *sftpStore) run(commands []string) (string, error) {
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if s.port != 0 {
+		args = append(args, "-P", strconv.Itoa(s.port))
+	}
+	if s.identity != "" {
+		args = append(args, "-i", s.identity)
+	}
+	if s.limitKB > 0 {
+		// sftp -l 的单位是 Kbit/s
+		args = append(args, "-l", strconv.Itoa(s.limitKB*8))
+	}
+	args = append(args, s.host)
+
+	cmd := exec.Command("sftp", args...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), fmt.Errorf("sftp: %s", msg)
+	}
+	return stdout.String(), nil
+}
+
+func (s *sftpStore) runBatches(commands []string) error {
+	for start := 0; start < len(commands); start += SFTP_BATCH_SIZE {
+		end := min(start+SFTP_BATCH_SIZE, len(commands))
+		if _, err := s.run(commands[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list 逐层列出目录: 每一层的所有目录在同一个会话中列出，备份目录最多三层
+func (s *sftpStore) list(prefix string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	dirs := []string{strings.TrimSuffix(prefix, "/")}
+
+	for len(dirs) > 0 {
+		commands := make([]string, len(dirs))
+		for i, dir := range dirs {
+			commands[i] = "-ls -la " + sftpQuote(s.remotePath(dir))
+		}
+		output, err := s.run(commands)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []string
+		current := -1
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasPrefix(line, "sftp> ") {
+				current++
+				continue
+			}
+			fields := strings.Fields(line)
+			if current < 0 || current >= len(dirs) || len(fields) < 9 {
+				continue
+			}
+			name := path.Base(fields[len(fields)-1])
+			if name == "." || name == ".." || strings.HasSuffix(name, ".partial") {
+				continue
+			}
+			rel := path.Join(dirs[current], name)
+			if strings.HasPrefix(fields[0], "d") {
+				next = append(next, rel)
+				continue
+			}
+			if strings.HasPrefix(fields[0], "-") {
+				size, _ := strconv.ParseInt(fields[4], 10, 64)
+				files[rel] = size
+			}
+		}
+		dirs = next
+	}
+	return files, nil
+}
+
+// put 先创建所需的目录，再上传为 .partial 后重命名，中断的上传不会被当作完整文件
+func (s *sftpStore) put(files []remoteFile) error {
+	dirSet := make(map[string]bool)
+	for _, f := range files {
+		for dir := path.Dir(f.Name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			dirSet[dir] = true
+		}
+	}
+	dirs := make([]string, 0, len(dirSet))
+	for dir := range dirSet {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	commands := []string{"-mkdir " + sftpQuote(s.root)}
+	for _, dir := range dirs {
+		commands = append(commands, "-mkdir "+sftpQuote(s.remotePath(dir)))
+	}
+	if _, err := s.run(commands); err != nil {
+		return err
+	}
+
+	commands = commands[:0]
+	for _, f := range files {
+		target := s.remotePath(f.Name)
+		commands = append(commands,
+			"put "+sftpQuote(f.Local)+" "+sftpQuote(target+".partial"),
+			"-rm "+sftpQuote(target),
+			"rename "+sftpQuote(target+".partial")+" "+sftpQuote(target))
+	}
+	return s.runBatches(commands)
+}
+
+func (s *sftpStore) get(files []remoteFile) error {
+	var commands []string
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.Local), 0755); err != nil {
+			return err
+		}
+		commands = append(commands, "get "+sftpQuote(s.remotePath(f.Name))+" "+sftpQuote(f.Local))
+	}
+	return s.runBatches(commands)
+}
+
+func (s *sftpStore) remove(names []string) error {
+	var commands []string
+	for _, name := range names {
+		commands = append(commands, "-rm "+sftpQuote(s.remotePath(name)))
+	}
+	return s.runBatches(commands)
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 只实现读取模组描述文件 (mods.toml、neoforge.mods.toml) 需要的 TOML:
+// 表、表数组、点分键、字符串 (含多行和字面量)、数组和内联表。
+// 布尔值解析为 bool，数字和日期保留为原始字符串
+
+type tomlParser struct {
+	s    string
+	i    int
+	line int
+}
+
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{s: strings.ReplaceAll(string(data), "\r\n", "\n"), line: 1}
+	root := make(map[string]interface{})
+	current := root
+	for {
+		p.skipSpaceAndNewlines()
+		if p.i >= len(p.s) {
+			return root, nil
+		}
+		var err error
+		if p.s[p.i] == '[' {
+			current, err = p.parseHeader(root)
+		} else {
+			err = p.parseKeyValue(current)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %v", p.line, err)
+		}
+		if err := p.expectLineEnd(); err != nil {
+			return nil, fmt.Errorf("第 %d 行: %v", p.line, err)
+		}
+	}
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	if p.i < len(p.s) && p.s[p.i] == '#' {
+		for p.i < len(p.s) && p.s[p.i] != '\n' {
+			p.i++
+		}
+	}
+}
+
+// skipSpaceAndNewlines 跳过空白、换行和注释，用于顶层和数组内部
+func (p *tomlParser) skipSpaceAndNewlines() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t':
+			p.i++
+		case '\n':
+			p.i++
+			p.line++
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) expectLineEnd() error {
+	p.skipSpace()
+	p.skipComment()
+	if p.i < len(p.s) && p.s[p.i] != '\n' {
+		return fmt.Errorf("多余的内容: %q", firstLine(p.s[p.i:]))
+	}
+	return nil
+}
+
+func (p *tomlParser) parseHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	array := strings.HasPrefix(p.s[p.i:], "[[")
+	if array {
+		p.i += 2
+	} else {
+		p.i++
+	}
+	p.skipSpace()
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.s[p.i:], closing) {
+		return nil, fmt.Errorf("表头缺少 %s", closing)
+	}
+	p.i += len(closing)
+
+	parent, err := tomlDescend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	if array {
+		list, _ := parent[last].([]interface{})
+		if _, exists := parent[last]; exists && list == nil {
+			return nil, fmt.Errorf("%s 已定义为其他类型", strings.Join(keys, "."))
+		}
+		table := make(map[string]interface{})
+		parent[last] = append(list, table)
+		return table, nil
+	}
+	return tomlDescend(parent, []string{last})
+}
+
+// tomlDescend 沿着键进入 (必要时创建) 子表，键对应表数组时进入最后一个元素
+func tomlDescend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch v := table[key].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = v
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%s 不是表", key)
+			}
+			last, ok := v[len(v)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s 不是表", key)
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("%s 不是表", key)
+		}
+	}
+	return table, nil
+}
+
+// parseKey 解析点分键，例如 a."b.c".d
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) {
+			return nil, fmt.Errorf("缺少键")
+		}
+		var key string
+		switch p.s[p.i] {
+		case '"', '\'':
+			v, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = v
+		default:
+			start := p.i
+			for p.i < len(p.s) && isBareKeyChar(p.s[p.i]) {
+				p.i++
+			}
+			if start == p.i {
+				return nil, fmt.Errorf("无效的键: %q", firstLine(p.s[start:]))
+			}
+			key = p.s[start:p.i]
+		}
+		keys = append(keys, key)
+		p.skipSpace()
+		if p.i < len(p.s) && p.s[p.i] == '.' {
+			p.i++
+			continue
+		}
+		return keys, nil
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.i >= len(p.s) || p.s[p.i] != '=' {
+		return fmt.Errorf("%s 后应为 =", strings.Join(keys, "."))
+	}
+	p.i++
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	parent, err := tomlDescend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	parent[keys[len(keys)-1]] = value
+	return nil
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.i >= len(p.s) {
+		return nil, fmt.Errorf("缺少值")
+	}
+	switch p.s[p.i] {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+	start := p.i
+	for p.i < len(p.s) && !strings.ContainsRune(",]}\n#", rune(p.s[p.i])) {
+		p.i++
+	}
+	token := strings.TrimSpace(p.s[start:p.i])
+	switch token {
+	case "":
+		return nil, fmt.Errorf("缺少值")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return token, nil
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	p.i++
+	list := []interface{}{}
+	for {
+		p.skipSpaceAndNewlines()
+		if p.i >= len(p.s) {
+			return nil, fmt.Errorf("数组缺少 ]")
+		}
+		if p.s[p.i] == ']' {
+			p.i++
+			return list, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.skipSpaceAndNewlines()
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			p.i++
+		} else if p.i < len(p.s) && p.s[p.i] != ']' {
+			return nil, fmt.Errorf("数组元素之间应为 ,")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	p.i++
+	table := make(map[string]interface{})
+	for {
+		p.skipSpace()
+		if p.i < len(p.s) && p.s[p.i] == '}' {
+			p.i++
+			return table, nil
+		}
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			p.i++
+		} else if p.i >= len(p.s) || p.s[p.i] != '}' {
+			return nil, fmt.Errorf("内联表缺少 }")
+		}
+	}
+}
+
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.s[p.i]
+	multi := strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3))
+	if multi {
+		p.i += 3
+		// 紧跟开始引号的换行不属于内容
+		if p.i < len(p.s) && p.s[p.i] == '\n' {
+			p.i++
+			p.line++
+		}
+	} else {
+		p.i++
+	}
+
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case multi && strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3)):
+			p.i += 3
+			// 结束引号前最多还可以有两个引号属于内容
+			for n := 0; n < 2 && p.i < len(p.s) && p.s[p.i] == quote; n++ {
+				b.WriteByte(quote)
+				p.i++
+			}
+			return b.String(), nil
+		case !multi && c == quote:
+			p.i++
+			return b.String(), nil
+		case c == '\n':
+			if !multi {
+				return "", fmt.Errorf("字符串没有结束")
+			}
+			p.line++
+			b.WriteByte(c)
+			p.i++
+		case c == '\\' && quote == '"':
+			if err := p.parseEscape(&b, multi); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return "", fmt.Errorf("字符串没有结束")
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder, multi bool) error {
+	p.i++
+	if p.i >= len(p.s) {
+		return fmt.Errorf("字符串没有结束")
+	}
+	c := p.s[p.i]
+	p.i++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.i+n > len(p.s) {
+			return fmt.Errorf("无效的转义")
+		}
+		code, err := strconv.ParseUint(p.s[p.i:p.i+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("无效的转义 \\%c%s", c, p.s[p.i:p.i+n])
+		}
+		b.WriteRune(rune(code))
+		p.i += n
+	default:
+		// 多行字符串中行尾的 \ 去掉换行和下一行开头的空白
+		if multi && (c == ' ' || c == '\t' || c == '\n') {
+			p.i--
+			for p.i < len(p.s) && strings.ContainsRune(" \t\n", rune(p.s[p.i])) {
+				if p.s[p.i] == '\n' {
+					p.line++
+				}
+				p.i++
+			}
+			return nil
+		}
+		return fmt.Errorf("无效的转义 \\%c", c)
+	}
+	return nil
+}
+
+func tomlString(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// tomlTables 返回表数组，单个表视为只有一项
+func tomlTables(v interface{}) []map[string]interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{t}
+	case []interface{}:
+		var result []map[string]interface{}
+		for _, item := range t {
+			if m, ok := item.(map[string]interface{}); ok {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 模组版本号的比较和版本范围匹配。
+// Fabric/Quilt 使用 >=1.0 <2.0、~1.2、^1.2、1.20.x 这样的谓词，Forge/NeoForge 使用 [1.0,2.0) 这样的 Maven 范围
+
+// versionQualifiers 是预发布标记的顺序，正式版排在它们之后
+var versionQualifiers = []string{"alpha", "a", "beta", "b", "milestone", "m", "pre", "rc", "cr", "snapshot"}
+
+func splitVersion(v string) []string {
+	// 构建元数据不参与比较
+	v, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(v)), "+")
+	var tokens []string
+	start := 0
+	for i := 0; i <= len(v); i++ {
+		boundary := i == len(v) || v[i] == '.' || v[i] == '-' || v[i] == '_'
+		// 数字和字母之间也是分隔，例如 1.0beta2
+		if !boundary && i > start && isDigit(v[i]) != isDigit(v[i-1]) {
+			tokens = append(tokens, v[start:i])
+			start = i
+		}
+		if boundary {
+			if i > start {
+				tokens = append(tokens, v[start:i])
+			}
+			start = i + 1
+		}
+	}
+	return tokens
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func qualifierRank(token string) int {
+	for i, q := range versionQualifiers {
+		if token == q {
+			return i
+		}
+	}
+	return len(versionQualifiers)
+}
+
+// compareToken 比较两个片段: 数字大于字母 (1.0.1 > 1.0-beta)，字母按预发布顺序比较
+func compareToken(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInt(na, nb)
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	}
+	if ra, rb := qualifierRank(a), qualifierRank(b); ra != rb {
+		return compareInt(ra, rb)
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareVersions 比较两个版本号，缺少的数字片段视为 0，缺少的一方比预发布版本新
+func compareVersions(a, b string) int {
+	ta, tb := splitVersion(a), splitVersion(b)
+	for i := 0; i < len(ta) || i < len(tb); i++ {
+		switch {
+		case i >= len(ta):
+			return -missingToken(tb[i])
+		case i >= len(tb):
+			return missingToken(ta[i])
+		}
+		if c := compareToken(ta[i], tb[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// missingToken 返回一方多出 token 时的比较结果
+func missingToken(token string) int {
+	if n, err := strconv.Atoi(token); err == nil {
+		return compareInt(n, 0)
+	}
+	return -1
+}
+
+// comparableVersion 判断版本号能否比较，未替换的 ${version} 之类的占位符不能比较
+func comparableVersion(v string) bool {
+	tokens := splitVersion(v)
+	if len(tokens) == 0 || strings.ContainsAny(v, "${}") {
+		return false
+	}
+	_, err := strconv.Atoi(tokens[0])
+	return err == nil
+}
+
+// matchFabricPredicate 匹配 Fabric 的版本谓词，空格分隔的多个谓词都要满足
+func matchFabricPredicate(version, predicate string) bool {
+	for _, p := range strings.Fields(predicate) {
+		if !matchFabricTerm(version, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchFabricTerm(version, term string) bool {
+	if term == "*" || term == "" {
+		return true
+	}
+	for _, op := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+		if !strings.HasPrefix(term, op) {
+			continue
+		}
+		target := term[len(op):]
+		c := compareVersions(version, target)
+		switch op {
+		case ">=":
+			return c >= 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case "<":
+			return c < 0
+		case "=":
+			return matchWildcard(version, target)
+		case "~":
+			// ~1.2.3 表示 >=1.2.3 且 <1.3
+			return c >= 0 && sameVersionPrefix(version, target, 2)
+		case "^":
+			// ^1.2.3 表示 >=1.2.3 且 <2
+			return c >= 0 && sameVersionPrefix(version, target, 1)
+		}
+	}
+	return matchWildcard(version, term)
+}
+
+// matchWildcard 匹配 1.20.x 或 1.20.* 形式的版本，没有通配符时要求相等
+func matchWildcard(version, pattern string) bool {
+	if !strings.HasSuffix(pattern, ".x") && !strings.HasSuffix(pattern, ".X") && !strings.HasSuffix(pattern, ".*") {
+		return compareVersions(version, pattern) == 0
+	}
+	prefix := splitVersion(pattern[:len(pattern)-2])
+	return sameVersionPrefix(version, pattern[:len(pattern)-2], len(prefix))
+}
+
+func sameVersionPrefix(a, b string, n int) bool {
+	ta, tb := splitVersion(a), splitVersion(b)
+	for i := 0; i < n; i++ {
+		x, y := "0", "0"
+		if i < len(ta) {
+			x = ta[i]
+		}
+		if i < len(tb) {
+			y = tb[i]
+		}
+		if compareToken(x, y) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// matchMavenRange 匹配 Maven 版本范围，例如 [1.0,2.0)、[47,)、(,1.0]、[1.0]，逗号连接的多个范围满足其一即可。
+// 不带括号的版本号 (例如 1.0) 在 Forge 中只是推荐版本，任何版本都满足
+func matchMavenRange(version, spec string) bool {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "*" {
+		return true
+	}
+	if spec[0] != '[' && spec[0] != '(' {
+		return true
+	}
+	for _, r := range splitMavenRanges(spec) {
+		if matchOneMavenRange(version, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitMavenRanges(spec string) []string {
+	var ranges []string
+	start := -1
+	for i := 0; i < len(spec); i++ {
+		switch spec[i] {
+		case '[', '(':
+			start = i
+		case ']', ')':
+			if start >= 0 {
+				ranges = append(ranges, spec[start:i+1])
+				start = -1
+			}
+		}
+	}
+	return ranges
+}
+
+func matchOneMavenRange(version, r string) bool {
+	inclusiveLow, inclusiveHigh := r[0] == '[', r[len(r)-1] == ']'
+	inner := r[1 : len(r)-1]
+	low, high, isRange := strings.Cut(inner, ",")
+	if !isRange {
+		return compareVersions(version, strings.TrimSpace(inner)) == 0
+	}
+	low, high = strings.TrimSpace(low), strings.TrimSpace(high)
+	if low != "" {
+		c := compareVersions(version, low)
+		if c < 0 || (c == 0 && !inclusiveLow) {
+			return false
+		}
+	}
+	if high != "" {
+		c := compareVersions(version, high)
+		if c > 0 || (c == 0 && !inclusiveHigh) {
+			return false
+		}
+	}
+	return true
+}
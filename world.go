@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	LEVEL_DAT     = "level.dat"
+	LEVEL_DAT_OLD = "level.dat_old"
+	TICKS_PER_DAY = 24000
+)
+
+var (
+	difficultyNames = []string{"和平", "简单", "普通", "困难"}
+	gameModeNames   = []string{"生存", "创造", "冒险", "旁观"}
+)
+
+// worldDir 返回实例的世界目录，world 为空时使用 server.properties 中的 level-name
+func worldDir(server *ServerInstance, world string) string {
+	if world == "" {
+		world = worldLevelName(server)
+	}
+	return filepath.Join(serverDir(server), world)
+}
+
+func levelDatPath(server *ServerInstance, world string) string {
+	return filepath.Join(worldDir(server, world), LEVEL_DAT)
+}
+
+// resolveLevelPath 允许省略开头的 Data，例如 GameRules.keepInventory 等同于 Data.GameRules.keepInventory
+func resolveLevelPath(root *nbtCompound, path string) ([]string, error) {
+	segments, err := nbtPathSegments(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := root.get(segments[0]); !ok && root.compound("Data") != nil {
+		segments = append([]string{"Data"}, segments...)
+	}
+	return segments, nil
+}
+
+func levelString(data *nbtCompound, name string) string {
+	v, _ := data.get(name)
+	s, _ := v.(string)
+	return s
+}
+
+func levelInt(data *nbtCompound, name string) (int64, bool) {
+	v, ok := data.get(name)
+	if !ok {
+		return 0, false
+	}
+	return nbtInt(v)
+}
+
+func namedValue(names []string, data *nbtCompound, key string) string {
+	n, ok := levelInt(data, key)
+	if !ok {
+		return "-"
+	}
+	if n >= 0 && int(n) < len(names) {
+		return names[n]
+	}
+	return fmt.Sprint(n)
+}
+
+func yesNo(data *nbtCompound, key string) string {
+	if n, ok := levelInt(data, key); ok && n != 0 {
+		return "是"
+	}
+	return "否"
+}
+
+// levelSeed 读取世界种子，1.16 起位于 WorldGenSettings.seed，之前为 RandomSeed
+func levelSeed(data *nbtCompound) (int64, bool) {
+	if gen := data.compound("WorldGenSettings"); gen != nil {
+		if seed, ok := levelInt(gen, "seed"); ok {
+			return seed, true
+		}
+	}
+	return levelInt(data, "RandomSeed")
+}
+
+func printLevelSummary(server *ServerInstance, path string, level *nbtFile) {
+	data := level.Root.compound("Data")
+	if data == nil {
+		fmt.Println("level.dat 中没有 Data 字段，显示原始内容:")
+		printNBTTree("", level.Root, 0, 3)
+		return
+	}
+
+	fmt.Printf("\n\033[1;36m%s\033[0m (%s, %s 压缩)\n", levelString(data, "LevelName"), path, level.Compression)
+	if version := data.compound("Version"); version != nil {
+		dataVersion, _ := levelInt(data, "DataVersion")
+		fmt.Printf("版本:       %s (DataVersion %d)\n", levelString(version, "Name"), dataVersion)
+	}
+	if seed, ok := levelSeed(data); ok {
+		fmt.Printf("种子:       %d\n", seed)
+	}
+	x, _ := levelInt(data, "SpawnX")
+	y, _ := levelInt(data, "SpawnY")
+	z, _ := levelInt(data, "SpawnZ")
+	fmt.Printf("出生点:     %d, %d, %d\n", x, y, z)
+	locked := ""
+	if yesNo(data, "DifficultyLocked") == "是" {
+		locked = " (已锁定)"
+	}
+	fmt.Printf("难度:       %s%s\n", namedValue(difficultyNames, data, "Difficulty"), locked)
+	fmt.Printf("游戏模式:   %s, 极限模式: %s, 允许作弊: %s\n",
+		namedValue(gameModeNames, data, "GameType"), yesNo(data, "hardcore"), yesNo(data, "allowCommands"))
+	if dayTime, ok := levelInt(data, "DayTime"); ok {
+		fmt.Printf("游戏时间:   第 %d 天 (%d ticks)\n", dayTime/TICKS_PER_DAY+1, dayTime)
+	}
+	weather := "晴"
+	if yesNo(data, "thundering") == "是" {
+		weather = "雷雨"
+	} else if yesNo(data, "raining") == "是" {
+		weather = "雨"
+	}
+	fmt.Printf("天气:       %s\n", weather)
+	if last, ok := levelInt(data, "LastPlayed"); ok && last > 0 {
+		fmt.Printf("最后保存:   %s\n", time.UnixMilli(last).Format("2006-01-02 15:04:05"))
+	}
+	if packs := data.compound("DataPacks"); packs != nil {
+		if enabled, ok := packs.get("Enabled"); ok {
+			if list, ok := enabled.(*nbtList); ok && len(list.items) > 0 {
+				var names []string
+				for _, item := range list.items {
+					names = append(names, fmt.Sprint(item))
+				}
+				fmt.Printf("数据包:     %s\n", strings.Join(names, ", "))
+			}
+		}
+	}
+
+	if rules := data.compound("GameRules"); rules != nil && len(rules.keys()) > 0 {
+		keys := append([]string{}, rules.keys()...)
+		sort.Strings(keys)
+		fmt.Println("\n游戏规则:")
+		for _, key := range keys {
+			value, _ := rules.get(key)
+			text := fmt.Sprint(value)
+			if _, ok := value.(string); !ok {
+				text = formatNBTValue(value)
+			}
+			fmt.Printf("  %-32s %s\n", key, text)
+		}
+	}
+	fmt.Printf("\n查看完整内容: emcm world info %s --raw\n", server.ID)
+}
+
+// levelEdit 是一次字段修改，typeName 不为空时允许创建新字段
+type levelEdit struct {
+	path     string
+	typeName string
+	value    string
+}
+
+func parseLevelEdit(arg string) (levelEdit, error) {
+	lhs, value, ok := strings.Cut(arg, "=")
+	if !ok || lhs == "" {
+		return levelEdit{}, fmt.Errorf("无效的修改: %s (格式: 路径=值)", arg)
+	}
+	edit := levelEdit{path: lhs, value: value}
+	if path, typeName, ok := strings.Cut(lhs, ":"); ok {
+		edit.path, edit.typeName = path, typeName
+	}
+	return edit, nil
+}
+
+// applyLevelEdit 修改字段并返回原值，字段类型保持不变
+func applyLevelEdit(root *nbtCompound, edit levelEdit) (string, string, error) {
+	segments, err := resolveLevelPath(root, edit.path)
+	if err != nil {
+		return "", "", err
+	}
+	parent, key, current, err := lookupNBT(root, segments)
+	if err != nil {
+		return "", "", err
+	}
+
+	var tagType byte
+	old := "(新建)"
+	if current == nil {
+		if edit.typeName == "" {
+			return "", "", fmt.Errorf("字段不存在: %s (使用 %s:类型=值 创建，类型: %s)",
+				strings.Join(segments, "."), edit.path, strings.Join(sortedNBTTypeNames(), " "))
+		}
+		t, ok := nbtTypeByName(edit.typeName)
+		if !ok {
+			return "", "", fmt.Errorf("未知类型: %s", edit.typeName)
+		}
+		tagType = t
+	} else {
+		tagType = nbtTagType(current)
+		if edit.typeName != "" && nbtTypeNames[tagType] != edit.typeName {
+			return "", "", fmt.Errorf("%s 的类型是 %s，不能改为 %s", strings.Join(segments, "."), nbtTypeNames[tagType], edit.typeName)
+		}
+		old = formatNBTValue(current)
+	}
+
+	value, err := parseNBTValue(tagType, edit.value)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: 无效的 %s 值 %q", strings.Join(segments, "."), nbtTypeNames[tagType], edit.value)
+	}
+
+	switch p := parent.(type) {
+	case *nbtCompound:
+		p.set(key, value)
+	case *nbtList:
+		var idx int
+		fmt.Sscanf(key, "[%d]", &idx)
+		p.items[idx] = value
+	}
+	return old, formatNBTValue(value), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// setLevelFields 修改 level.dat: 全部修改成功后才写入，原文件保存为 level.dat_old
+func setLevelFields(server *ServerInstance, world string, args []string) error {
+	if isServerRunning(server.ID) {
+		return errors.New("服务器正在运行，修改会在服务器保存时被覆盖，请先停止服务器")
+	}
+	path := levelDatPath(server, world)
+	level, err := readNBTFile(path)
+	if err != nil {
+		return err
+	}
+
+	type change struct{ path, old, new string }
+	var changes []change
+	for _, arg := range args {
+		edit, err := parseLevelEdit(arg)
+		if err != nil {
+			return err
+		}
+		old, updated, err := applyLevelEdit(level.Root, edit)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change{edit.path, old, updated})
+	}
+
+	if err := copyFile(path, filepath.Join(filepath.Dir(path), LEVEL_DAT_OLD)); err != nil {
+		return fmt.Errorf("备份 level.dat 失败: %v", err)
+	}
+	if err := writeNBTFile(path, level); err != nil {
+		return fmt.Errorf("写入 level.dat 失败: %v", err)
+	}
+	for _, c := range changes {
+		fmt.Printf("%s: %s -> \033[32m%s\033[0m\n", c.path, c.old, c.new)
+	}
+	fmt.Printf("已保存 %s (原文件已备份为 %s)\n", path, LEVEL_DAT_OLD)
+	return nil
+}
+
+func printWorldUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  emcm world info <服务器ID> [路径] [--raw] [--world 世界目录]   查看 level.dat")
+	fmt.Println("  emcm world set <服务器ID> <路径>=<值>... [--world 世界目录]    修改 level.dat (服务器需已停止)")
+	fmt.Println("  emcm world analyze <服务器ID> [--world 世界目录]            统计各维度大小、区块数和 InhabitedTime 分布")
+	fmt.Println("  emcm world prune <服务器ID> --inhabited-below <时长> [--keep-radius 格数] [--dimension 维度] [--dry-run] [--yes] [--no-backup]")
+	fmt.Println("                                                              删除很少有玩家停留的区块，删除前自动备份")
+	fmt.Println("  emcm world render <服务器ID> [--dimension 维度] [--out map.png] [--full]  渲染俯视地图，只重新渲染变化的区域")
+	fmt.Println("路径以 . 分隔，列表用 [下标]，可省略开头的 Data，例如:")
+	fmt.Println("  emcm world set server-1 GameRules.keepInventory=true SpawnX=0 SpawnZ=0 DifficultyLocked=1")
+	fmt.Println("  emcm world set server-1 GameRules.newRule:string=true     创建新字段")
+}
+
+// takeWorldFlag 从参数中取出 --world 选项
+func takeWorldFlag(args []string) ([]string, string) {
+	var rest []string
+	world := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--world" && i+1 < len(args) {
+			world = args[i+1]
+			i++
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	return rest, world
+}
+
+func handleWorldCLI(args []string) {
+	if len(args) < 2 {
+		printWorldUsage()
+		return
+	}
+	server, ok := requireServer(args[1])
+	if !ok {
+		return
+	}
+	rest, world := takeWorldFlag(args[2:])
+
+	switch args[0] {
+	case "info":
+		path := levelDatPath(server, world)
+		level, err := readNBTFile(path)
+		if err != nil {
+			fmt.Println("读取 level.dat 失败:", err)
+			return
+		}
+		raw := false
+		field := ""
+		for _, arg := range rest {
+			if arg == "--raw" {
+				raw = true
+			} else {
+				field = arg
+			}
+		}
+		switch {
+		case field != "":
+			segments, err := resolveLevelPath(level.Root, field)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			_, _, value, err := lookupNBT(level.Root, segments)
+			if err != nil || value == nil {
+				fmt.Println("字段不存在:", field)
+				return
+			}
+			printNBTTree(strings.Join(segments, "."), value, 0, 0)
+		case raw:
+			printNBTTree("", level.Root, 0, 0)
+		default:
+			printLevelSummary(server, path, level)
+		}
+
+	case "set":
+		if len(rest) == 0 {
+			printWorldUsage()
+			return
+		}
+		if err := setLevelFields(server, world, rest); err != nil {
+			fmt.Println("修改失败:", err)
+		}
+
+	case "analyze":
+		if err := analyzeWorld(server, world); err != nil {
+			fmt.Println("分析失败:", err)
+		}
+
+	case "prune":
+		handleWorldPruneCLI(server, world, rest)
+
+	case "render":
+		handleWorldRenderCLI(server, world, rest)
+
+	default:
+		printWorldUsage()
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 只实现插件描述文件 (plugin.yml、paper-plugin.yml) 用到的 YAML 子集:
+// 块映射、块序列、流式 [a, b] 和 {k: v}、引号字符串、| 和 > 块文本。
+// 所有标量都保留为字符串，避免 api-version: 1.20 被当成数字 1.2
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML 解析 YAML 文档，返回 map[string]interface{}、[]interface{} 或 string
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	raw := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(raw); i++ {
+		line := strings.TrimRight(raw[i], " \t")
+		text := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("第 %d 行: 不能用 Tab 缩进", i+1)
+		}
+		indent := len(line) - len(text)
+		text = stripYAMLComment(text)
+		if text == "" && line != "" {
+			// 注释行
+			continue
+		}
+		if text == "" || text == "---" || text == "..." || strings.HasPrefix(text, "%") {
+			// 空行和文档标记，indent 为 -1
+			p.lines = append(p.lines, yamlLine{i + 1, -1, text})
+			continue
+		}
+		// 跨行的流式集合合并为一行
+		num := i + 1
+		for flowDepth(text) > 0 && i+1 < len(raw) {
+			i++
+			text += " " + stripYAMLComment(strings.TrimSpace(raw[i]))
+		}
+		p.lines = append(p.lines, yamlLine{num, indent, text})
+	}
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return map[string]interface{}{}, nil
+	}
+	value, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("第 %d 行: 缩进错误", p.lines[p.pos].num)
+	}
+	return value, nil
+}
+
+// stripYAMLComment 去掉引号之外的 # 注释
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t:[{,-", rune(text[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimRight(text[:i], " \t")
+		}
+	}
+	return text
+}
+
+func flowDepth(text string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// skipBlank 跳过空行和注释行 (indent 为 -1)
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].indent < 0 {
+		p.pos++
+	}
+}
+
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	p.skipBlank()
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	result := make(map[string]interface{})
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && isSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("第 %d 行: 缩进错误", line.num)
+		}
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("第 %d 行: 应为 键: 值", line.num)
+		}
+		p.pos++
+		parsed, err := p.parseValue(indent, value, line.num)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = parsed
+	}
+	return result, nil
+}
+
+// parseValue 解析键或序列项之后的值，值为空时读取下面缩进更深的块
+func (p *yamlParser) parseValue(indent int, value string, num int) (interface{}, error) {
+	if value == "" {
+		p.skipBlank()
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			// 序列可以与父键同一缩进
+			if next.indent > indent || (next.indent == indent && isSequenceItem(next.text)) {
+				return p.parseBlock(next.indent)
+			}
+		}
+		return "", nil
+	}
+	if value[0] == '|' || value[0] == '>' {
+		return p.parseBlockScalar(indent, value[0] == '|'), nil
+	}
+	v, err := parseYAMLFlow(value)
+	if err != nil {
+		return nil, fmt.Errorf("第 %d 行: %v", num, err)
+	}
+	return v, nil
+}
+
+func (p *yamlParser) parseBlockScalar(indent int, literal bool) string {
+	var parts []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if line.indent < 0 {
+			if line.text != "" {
+				break
+			}
+			parts = append(parts, "")
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		parts = append(parts, strings.Repeat(" ", max(line.indent-blockIndent, 0))+line.text)
+	}
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	if literal {
+		return strings.Join(parts, "\n")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	var result []interface{}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSequenceItem(line.text) {
+			if line.indent > indent {
+				return nil, fmt.Errorf("第 %d 行: 缩进错误", line.num)
+			}
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if _, _, isMap := splitYAMLKey(rest); isMap && rest[0] != '[' && rest[0] != '{' && rest[0] != '"' && rest[0] != '\'' {
+			// "- key: value" 开始一个映射，后续键与 key 对齐
+			offset := len(line.text) - len(rest)
+			p.lines[p.pos] = yamlLine{line.num, indent + offset, rest}
+			item, err := p.parseMapping(indent + offset)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, item)
+			continue
+		}
+		p.pos++
+		item, err := p.parseValue(indent, rest, line.num)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// splitYAMLKey 在引号之外的第一个 ": " 或行尾的 ":" 处分开键和值
+func splitYAMLKey(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if unquoted, err := parseYAMLScalar(key); err == nil {
+				key = unquoted
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseYAMLFlow 解析标量或流式集合
+func parseYAMLFlow(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", nil
+	}
+	if text[0] != '[' && text[0] != '{' {
+		return parseYAMLScalar(text)
+	}
+	closing := byte(']')
+	if text[0] == '{' {
+		closing = '}'
+	}
+	if text[len(text)-1] != closing {
+		return nil, fmt.Errorf("未闭合的 %c", text[0])
+	}
+	items := splitFlowItems(text[1 : len(text)-1])
+	if text[0] == '[' {
+		list := []interface{}{}
+		for _, item := range items {
+			v, err := parseYAMLFlow(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	result := make(map[string]interface{})
+	for _, item := range items {
+		key, value, ok := splitYAMLKey(item)
+		if !ok {
+			return nil, fmt.Errorf("应为 键: 值: %s", item)
+		}
+		v, err := parseYAMLFlow(value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = v
+	}
+	return result, nil
+}
+
+func splitFlowItems(text string) []string {
+	var items []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, text[start:i])
+			start = i + 1
+		}
+	}
+	items = append(items, text[start:])
+	var result []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func parseYAMLScalar(text string) (string, error) {
+	if len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return "", fmt.Errorf("无效的字符串: %s", text)
+		}
+		return s, nil
+	}
+	if text == "~" || text == "null" {
+		return "", nil
+	}
+	return text, nil
+}
+
+// yamlString 返回映射中的字符串值
+func yamlString(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// yamlStrings 返回字符串列表，单个字符串视为只有一项的列表
+func yamlStrings(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}